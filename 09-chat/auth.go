@@ -0,0 +1,134 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Name of the session cookie holding the token.
+const sessionCookie = "chat_session"
+
+// validNickname matches allowed nicknames, they can not contain dots used as
+// token separators.
+var validNickname = regexp.MustCompile(`^[A-Za-z0-9_-]{1,32}$`)
+
+var (
+	errNoToken      = errors.New("missing token")
+	errInvalidToken = errors.New("invalid token")
+	errExpiredToken = errors.New("token is expired")
+)
+
+// Authenticator issues and verifies tokens identifying chat users by
+// nickname. Token is "<nickname>.<expiry Unix time>.<signature>", where the
+// signature is HMAC-SHA256 of the first two parts. Other services sharing the
+// key can issue tokens for their users.
+type Authenticator struct {
+	key []byte
+	ttl time.Duration
+}
+
+// NewAuthenticator returns authenticator signing tokens with the key, which
+// are valid for ttl.
+func NewAuthenticator(key []byte, ttl time.Duration) *Authenticator {
+	return &Authenticator{key: key, ttl: ttl}
+}
+
+func (a *Authenticator) sign(payload string) string {
+	mac := hmac.New(sha256.New, a.key)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Token returns token of the user with the nickname.
+func (a *Authenticator) Token(nickname string) string {
+	return a.token(nickname, time.Now().Add(a.ttl))
+}
+
+func (a *Authenticator) token(nickname string, expires time.Time) string {
+	payload := nickname + "." + strconv.FormatInt(expires.Unix(), 10)
+	return payload + "." + a.sign(payload)
+}
+
+// Verify returns nickname of the user if the token is valid.
+func (a *Authenticator) Verify(token string) (string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || !validNickname.MatchString(parts[0]) {
+		return "", errInvalidToken
+	}
+	expected := a.sign(parts[0] + "." + parts[1])
+	if !hmac.Equal([]byte(parts[2]), []byte(expected)) {
+		return "", errInvalidToken
+	}
+	expires, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return "", errInvalidToken
+	}
+	if time.Now().Unix() >= expires {
+		return "", errExpiredToken
+	}
+	return parts[0], nil
+}
+
+// authenticate returns nickname of the user sending the request with token
+// in "Authorization: Bearer" header, token query parameter (browsers can not
+// set headers of websocket requests) or session cookie.
+func (a *Authenticator) authenticate(r *http.Request) (string, error) {
+	token := ""
+	if header := r.Header.Get("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		token = strings.TrimPrefix(header, "Bearer ")
+	} else if value := r.URL.Query().Get("token"); value != "" {
+		token = value
+	} else if cookie, err := r.Cookie(sessionCookie); err == nil {
+		token = cookie.Value
+	}
+	if token == "" {
+		return "", errNoToken
+	}
+	return a.Verify(token)
+}
+
+// authenticated wraps the handler to respond with 401 Unauthorized to requests
+// without valid token.
+func authenticated(auth *Authenticator, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, err := auth.authenticate(r); err != nil {
+			http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// serveLogin starts session of the user with nickname form parameter, setting
+// the session cookie and responding with the token. Anybody can use any
+// nickname, so it is meant for development only.
+func serveLogin(auth *Authenticator, w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	nickname := r.FormValue("nickname")
+	if !validNickname.MatchString(nickname) {
+		http.Error(w, "Nickname must have 1 to 32 letters, digits, '_' or '-'", http.StatusBadRequest)
+		return
+	}
+	token := auth.Token(nickname)
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    token,
+		Path:     "/",
+		MaxAge:   int(auth.ttl.Seconds()),
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"nickname": nickname, "token": token})
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAuthenticator(t *testing.T) {
+	auth := NewAuthenticator([]byte("s3cret"), time.Hour)
+	token := auth.Token("alice")
+	if nick, err := auth.Verify(token); err != nil || nick != "alice" {
+		t.Errorf("Verify(%q) = %q, %v, want alice", token, nick, err)
+	}
+
+	other := NewAuthenticator([]byte("other"), time.Hour)
+	tests := []struct {
+		name  string
+		token string
+		want  error
+	}{
+		{"other key", other.Token("alice"), errInvalidToken},
+		{"changed nickname", "bob" + strings.TrimPrefix(token, "alice"), errInvalidToken},
+		{"expired", auth.token("alice", time.Now().Add(-time.Second)), errExpiredToken},
+		{"malformed", "alice", errInvalidToken},
+		{"invalid nickname", auth.token("al.ice", time.Now().Add(time.Hour)), errInvalidToken},
+	}
+	for _, tt := range tests {
+		if _, err := auth.Verify(tt.token); err != tt.want {
+			t.Errorf("%s: Verify(%q) error = %v, want %v", tt.name, tt.token, err, tt.want)
+		}
+	}
+}
+
+func TestServeUnauthorized(t *testing.T) {
+	_, server := newTestServer(t, NewMemoryStore(10))
+	expired := url.QueryEscape(testAuth.token("alice", time.Now().Add(-time.Second)))
+	for _, path := range []string{"/ws", "/ws?token=" + expired, "/history?room=go", "/history?room=go&token=" + expired, "/presence", "/metrics", "/rooms"} {
+		resp, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("GET %s = %d, want %d", path, resp.StatusCode, http.StatusUnauthorized)
+		}
+	}
+}
+
+func TestServeLogin(t *testing.T) {
+	auth := NewAuthenticator([]byte("s3cret"), time.Hour)
+	rr := httptest.NewRecorder()
+	serveLogin(auth, rr, httptest.NewRequest("POST", "/login?nickname=alice", nil))
+	cookies := rr.Result().Cookies()
+	if rr.Code != http.StatusOK || len(cookies) != 1 || cookies[0].Name != sessionCookie {
+		t.Fatalf("login = %d with cookies %v, want session cookie", rr.Code, cookies)
+	}
+
+	r := httptest.NewRequest("GET", "/ws", nil)
+	r.AddCookie(cookies[0])
+	if nick, err := auth.authenticate(r); err != nil || nick != "alice" {
+		t.Errorf("authenticate with session cookie = %q, %v, want alice", nick, err)
+	}
+
+	rr = httptest.NewRecorder()
+	serveLogin(auth, rr, httptest.NewRequest("POST", "/login?nickname=a+b", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("login with invalid nickname = %d, want %d", rr.Code, http.StatusBadRequest)
+	}
+}
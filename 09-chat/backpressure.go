@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// SlowConsumerAction is what the hub does with a message for a client whose
+// send buffer is full.
+type SlowConsumerAction int
+
+const (
+	// Disconnect the client.
+	Disconnect SlowConsumerAction = iota
+	// DropOldest drops the oldest queued message to make room for the message.
+	DropOldest
+	// DropNewest drops the message.
+	DropNewest
+	// Block waits until there is room for the message, disconnecting the
+	// client after timeout. All clients wait while the hub is blocked.
+	Block
+)
+
+var actionNames = map[SlowConsumerAction]string{
+	Disconnect: "disconnect",
+	DropOldest: "drop-oldest",
+	DropNewest: "drop-newest",
+	Block:      "block",
+}
+
+func (a SlowConsumerAction) String() string {
+	return actionNames[a]
+}
+
+// ParseSlowConsumerAction returns action of the name, e.g. "drop-oldest".
+func ParseSlowConsumerAction(name string) (SlowConsumerAction, error) {
+	for action, actionName := range actionNames {
+		if name == actionName {
+			return action, nil
+		}
+	}
+	return Disconnect, fmt.Errorf("unknown slow consumer action: %q", name)
+}
+
+// SlowConsumerPolicy decides how the hub handles clients which do not read
+// messages as fast as they are sent to them.
+type SlowConsumerPolicy struct {
+	Action SlowConsumerAction
+	// Time the Block action waits for room in the send buffer.
+	Timeout time.Duration
+}
+
+// ClientMetrics are backpressure metrics of a connected client.
+type ClientMetrics struct {
+	ID            int64  `json:"id"`
+	Nick          string `json:"nick"`
+	QueueDepth    int    `json:"queueDepth"`
+	QueueCapacity int    `json:"queueCapacity"`
+	Queued        uint64 `json:"queued"`
+	Dropped       uint64 `json:"dropped"`
+}
+
+// Metrics are backpressure metrics of the hub.
+type Metrics struct {
+	Policy  string          `json:"policy"`
+	Clients []ClientMetrics `json:"clients"`
+	// Messages dropped by all clients, including disconnected ones.
+	Dropped uint64 `json:"dropped"`
+	// Clients disconnected as slow consumers.
+	SlowDisconnects uint64 `json:"slowDisconnects"`
+	// Messages waiting to be published to the broker.
+	Pending int `json:"pending"`
+}
+
+// sendData queues the encoded message to the client. If the client's send
+// buffer is full, the client is handled by the slow consumer policy.
+func (h *Hub) sendData(client *Client, data []byte) {
+	if _, ok := h.clients[client]; !ok {
+		return
+	}
+	select {
+	case client.send <- data:
+		client.queued++
+		return
+	default:
+	}
+
+	switch h.policy.Action {
+	case DropNewest:
+		h.drop(client)
+	case DropOldest:
+		// writePump may have taken the oldest message meanwhile
+		select {
+		case <-client.send:
+			h.drop(client)
+		default:
+		}
+		// the hub is the only sender, so there is room now
+		client.send <- data
+		client.queued++
+	case Block:
+		timer := time.NewTimer(h.policy.Timeout)
+		defer timer.Stop()
+		select {
+		case client.send <- data:
+			client.queued++
+		case <-timer.C:
+			h.disconnect(client)
+		}
+	default:
+		h.disconnect(client)
+	}
+}
+
+// drop counts message dropped by the client.
+func (h *Hub) drop(client *Client) {
+	client.dropped++
+	h.dropped++
+}
+
+// disconnect removes slow client, which closes its websocket.
+func (h *Hub) disconnect(client *Client) {
+	h.slowDisconnects++
+	h.remove(client)
+}
+
+// metrics returns backpressure metrics of the hub and its clients ordered by ID.
+func (h *Hub) metrics() Metrics {
+	m := Metrics{
+		Policy:          h.policy.Action.String(),
+		Clients:         make([]ClientMetrics, 0, len(h.clients)),
+		Dropped:         h.dropped,
+		SlowDisconnects: h.slowDisconnects,
+		Pending:         len(h.pending),
+	}
+	for client := range h.clients {
+		m.Clients = append(m.Clients, ClientMetrics{
+			ID:            client.id,
+			Nick:          client.nick,
+			QueueDepth:    len(client.send),
+			QueueCapacity: cap(client.send),
+			Queued:        client.queued,
+			Dropped:       client.dropped,
+		})
+	}
+	sort.Slice(m.Clients, func(i, j int) bool { return m.Clients[i].ID < m.Clients[j].ID })
+	return m
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newStalledClient adds client with send buffer of the size to the hub which is not running,
+// no writePump reads its messages
+func newStalledClient(h *Hub, nick string, size int) *Client {
+	client := &Client{hub: h, send: make(chan []byte, size), rooms: make(map[string]bool), nick: nick}
+	h.add(client)
+	// discard presence messages
+	for len(client.send) > 0 {
+		<-client.send
+	}
+	client.queued = 0
+	return client
+}
+
+// queued returns texts of messages queued for the client, or nil if its send channel is closed
+func queued(client *Client) []string {
+	texts := []string{}
+	for len(client.send) > 0 {
+		data, ok := <-client.send
+		if !ok {
+			return nil
+		}
+		texts = append(texts, string(data))
+	}
+	select {
+	case _, ok := <-client.send:
+		if !ok {
+			return nil
+		}
+	default:
+	}
+	return texts
+}
+
+func TestSlowConsumerPolicies(t *testing.T) {
+	tests := []struct {
+		action          SlowConsumerAction
+		queued          string
+		dropped         uint64
+		slowDisconnects uint64
+	}{
+		{Disconnect, "", 0, 1},
+		{DropOldest, "2 3", 1, 0},
+		{DropNewest, "1 2", 1, 0},
+		{Block, "", 0, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.action.String(), func(t *testing.T) {
+			h := newHub(NewMemoryStore(10), SlowConsumerPolicy{Action: tt.action, Timeout: 10 * time.Millisecond}, NewLocalBroker().Connect())
+			slow := newStalledClient(h, "slow", 2)
+			for _, text := range []string{"1", "2", "3"} {
+				h.sendData(slow, []byte(text))
+			}
+
+			texts := queued(slow)
+			disconnected := texts == nil
+			if disconnected != (tt.slowDisconnects > 0) || strings.Join(texts, " ") != tt.queued {
+				t.Errorf("queued messages = %q, want %q", texts, tt.queued)
+			}
+			m := h.metrics()
+			if m.Dropped != tt.dropped || m.SlowDisconnects != tt.slowDisconnects || m.Policy != tt.action.String() {
+				t.Errorf("metrics = %+v, want %d dropped and %d disconnects", m, tt.dropped, tt.slowDisconnects)
+			}
+			if !disconnected && (len(m.Clients) != 1 || m.Clients[0].Dropped != tt.dropped || m.Clients[0].QueueCapacity != 2) {
+				t.Errorf("client metrics = %+v, want %d dropped", m.Clients, tt.dropped)
+			}
+		})
+	}
+}
+
+func TestSlowConsumerBlock(t *testing.T) {
+	h := newHub(NewMemoryStore(10), SlowConsumerPolicy{Action: Block, Timeout: time.Second}, NewLocalBroker().Connect())
+	slow := newStalledClient(h, "slow", 1)
+	h.sendData(slow, []byte("1"))
+
+	// reader catching up within the timeout gets all messages
+	received := make(chan []byte)
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		received <- <-slow.send
+		received <- <-slow.send
+	}()
+	h.sendData(slow, []byte("2"))
+	if got := string(<-received) + string(<-received); got != "12" {
+		t.Errorf("received %q, want 12", got)
+	}
+	if m := h.metrics(); m.SlowDisconnects != 0 || m.Clients[0].Queued != 2 {
+		t.Errorf("metrics = %+v, want 2 queued messages and no disconnects", m)
+	}
+}
+
+// TestSlowConsumerDisconnect checks stalled websocket reader is disconnected and others receive all messages
+func TestSlowConsumerDisconnect(t *testing.T) {
+	hub, server := newTestServer(t, NewMemoryStore(10))
+	alice := dial(t, server, "alice")
+	alice.join("go")
+	// the buffer is filled by online messages of slow and alice, and joined message
+	slow := &Client{hub: hub, send: make(chan []byte, 3), rooms: make(map[string]bool), nick: "slow"}
+	hub.register <- slow
+	hub.broadcast <- &Message{Type: typeJoin, Room: "go", client: slow}
+
+	alice.send(Message{Type: typeMessage, Room: "go", Text: "Hello"})
+	alice.expect(Message{Type: typeMessage, Room: "go", From: "alice", Text: "Hello"})
+	closed := make(chan bool)
+	go func() {
+		for range slow.send {
+		}
+		closed <- true
+	}()
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("send channel of slow client is not closed")
+	}
+
+	resp := get(t, server, "/metrics")
+	defer resp.Body.Close()
+	var m Metrics
+	if err := json.NewDecoder(resp.Body).Decode(&m); err != nil {
+		t.Fatal(err)
+	}
+	if m.Policy != "disconnect" || m.SlowDisconnects != 1 || len(m.Clients) != 1 || m.Clients[0].Nick != "alice" {
+		t.Errorf("metrics = %+v, want alice connected and 1 slow disconnect", m)
+	}
+}
+
+func TestParseSlowConsumerAction(t *testing.T) {
+	for _, action := range []SlowConsumerAction{Disconnect, DropOldest, DropNewest, Block} {
+		if got, err := ParseSlowConsumerAction(action.String()); err != nil || got != action {
+			t.Errorf("ParseSlowConsumerAction(%q) = %v, %v", action, got, err)
+		}
+	}
+	if _, err := ParseSlowConsumerAction("ignore"); err == nil {
+		t.Errorf("ParseSlowConsumerAction(ignore) succeeded")
+	}
+}
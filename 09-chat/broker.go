@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"sync"
+)
+
+var errBrokerClosed = errors.New("broker is closed")
+
+// Broker fans out messages published by the hubs of chat server nodes, so
+// that users connected to different nodes share rooms. Every hub receives all
+// published messages, including its own, in the same order on all nodes.
+//
+// Messages published by a hub have Node field set to the ID of the hub. When
+// a node disconnects, the broker sends node-down message with the ID of the
+// node to the other nodes.
+type Broker interface {
+	// Publish sends the message to all nodes.
+	Publish(m *Message) error
+	// Messages returns channel of the published messages, it is closed when
+	// the node is disconnected from the broker.
+	Messages() <-chan *Message
+	// Close disconnects the node from the broker.
+	Close() error
+}
+
+// LocalBroker fans out messages between hubs in the same process.
+type LocalBroker struct {
+	mu    sync.Mutex
+	nodes map[*localNode]bool
+}
+
+// localNode is connection of a hub to LocalBroker.
+type localNode struct {
+	broker   *LocalBroker
+	messages chan *Message
+	// ID of the hub, taken from the first published message.
+	id     string
+	closed bool
+}
+
+func NewLocalBroker() *LocalBroker {
+	return &LocalBroker{nodes: make(map[*localNode]bool)}
+}
+
+// Connect returns new node of the broker.
+func (b *LocalBroker) Connect() Broker {
+	node := &localNode{broker: b, messages: make(chan *Message, sendBufferSize)}
+	b.mu.Lock()
+	b.nodes[node] = true
+	b.mu.Unlock()
+	return node
+}
+
+// relay sends a copy of the message to every node, the caller holds the lock.
+// Sending waits for slow hubs, which never wait for the broker.
+func (b *LocalBroker) relay(m *Message) {
+	for node := range b.nodes {
+		message := *m
+		node.messages <- &message
+	}
+}
+
+func (n *localNode) Publish(m *Message) error {
+	n.broker.mu.Lock()
+	defer n.broker.mu.Unlock()
+	if n.closed {
+		return errBrokerClosed
+	}
+	if n.id == "" {
+		n.id = m.Node
+	}
+	n.broker.relay(m)
+	return nil
+}
+
+func (n *localNode) Messages() <-chan *Message {
+	return n.messages
+}
+
+func (n *localNode) Close() error {
+	n.broker.mu.Lock()
+	defer n.broker.mu.Unlock()
+	if n.closed {
+		return errBrokerClosed
+	}
+	n.closed = true
+	delete(n.broker.nodes, n)
+	close(n.messages)
+	if n.id != "" {
+		n.broker.relay(&Message{Type: typeNodeDown, Node: n.id})
+	}
+	return nil
+}
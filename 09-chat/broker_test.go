@@ -0,0 +1,151 @@
+package main
+
+import (
+	"io"
+	"net"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// testNodes checks users connected to the nodes, one for each broker, share rooms and presence.
+func testNodes(t *testing.T, brokers []Broker) {
+	servers := make([]*httptest.Server, len(brokers))
+	for i, broker := range brokers {
+		_, servers[i] = newTestNode(t, NewMemoryStore(10), broker)
+	}
+	alice := dial(t, servers[0], "alice")
+	alice.presence = true
+	alice.expect(Message{Type: typeOnline, From: "alice"})
+	bob := dial(t, servers[1], "bob")
+	alice.expect(Message{Type: typeOnline, From: "bob"})
+	carol := dial(t, servers[2], "carol")
+	alice.expect(Message{Type: typeOnline, From: "carol"})
+	alice.presence = false
+	for _, server := range servers {
+		waitPresence(t, server, []string{"alice", "bob", "carol"})
+	}
+
+	alice.join("go")
+	bob.join("go")
+	alice.send(Message{Type: typeMessage, Room: "go", Text: "Hello"})
+	want := Message{Type: typeMessage, Room: "go", From: "alice", Text: "Hello"}
+	alice.expect(want)
+	bob.expect(want)
+	// every node keeps history of the rooms
+	if history := getHistory(t, servers[2], "room=go"); len(history) != 1 || history[0].Text != "Hello" || history[0].Node != "" {
+		t.Errorf("history on third node = %+v, want Hello", history)
+	}
+
+	carol.send(Message{Type: typeDirect, To: "bob", Text: "Hi Bob"})
+	want = Message{Type: typeDirect, From: "carol", To: "bob", Text: "Hi Bob"}
+	bob.expect(want)
+	carol.expect(want)
+
+	// users of disconnected node are offline on the other nodes
+	brokers[2].Close()
+	alice.presence = true
+	alice.expect(Message{Type: typeOffline, From: "carol"})
+	waitPresence(t, servers[1], []string{"alice", "bob"})
+}
+
+func TestLocalBroker(t *testing.T) {
+	broker := NewLocalBroker()
+	testNodes(t, []Broker{broker.Connect(), broker.Connect(), broker.Connect()})
+}
+
+func TestTCPBroker(t *testing.T) {
+	server, err := ListenBroker("127.0.0.1:0", testAuth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve()
+	t.Cleanup(func() { server.Close() })
+	brokers := make([]Broker, 3)
+	for i := range brokers {
+		broker, err := DialBroker(server.Addr().String(), testAuth)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { broker.Close() })
+		brokers[i] = broker
+	}
+	testNodes(t, brokers)
+}
+
+// TestBrokerDisconnected checks hub disconnected from the broker keeps serving its clients
+func TestBrokerDisconnected(t *testing.T) {
+	broker := NewLocalBroker()
+	node := broker.Connect()
+	_, server := newTestNode(t, NewMemoryStore(10), node)
+	_, other := newTestNode(t, NewMemoryStore(10), broker.Connect())
+	alice := dial(t, server, "alice")
+	alice.join("go")
+	dial(t, other, "bob")
+	waitPresence(t, server, []string{"alice", "bob"})
+
+	node.Close()
+	// skip online messages of alice and bob
+	alice.presence = true
+	for m := alice.read(); m.Type != typeOffline || m.From != "bob"; m = alice.read() {
+		if m.Type != typeOnline {
+			t.Fatalf("message = %+v, want offline message of bob", m)
+		}
+	}
+	alice.presence = false
+	alice.send(Message{Type: typeMessage, Room: "go", Text: "Hello"})
+	alice.expect(Message{Type: typeMessage, Room: "go", From: "alice", Text: "Hello"})
+
+	alice2 := dial(t, server, "alice")
+	alice2.presence = true
+	alice2.expect(Message{Type: typeOnline, From: "alice"})
+	alice2.send(Message{Type: typeDirect, To: "bob", Text: "Hi Bob"})
+	alice2.expect(Message{Type: typeError, To: "bob", Text: "user is not online"})
+	alice2.send(Message{Type: typeDirect, To: "alice", Text: "Note"})
+	alice2.expect(Message{Type: typeDirect, From: "alice", To: "alice", Text: "Note"})
+	waitPresence(t, server, []string{"alice"})
+}
+
+// TestTCPBroker_Authentication checks the server relays messages only of the
+// nodes sharing its key.
+func TestTCPBroker_Authentication(t *testing.T) {
+	server, err := ListenBroker("127.0.0.1:0", testAuth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve()
+	t.Cleanup(func() { server.Close() })
+	addr := server.Addr().String()
+
+	if _, err := DialBroker(addr, NewAuthenticator([]byte("other"), time.Hour)); err != errBrokerRejected {
+		t.Errorf("DialBroker with other key error = %v, want %v", err, errBrokerRejected)
+	}
+	node, err := DialBroker(addr, testAuth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { node.Close() })
+
+	// messages sent without answering the challenge are not relayed
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Write(append((&Message{Type: typeDirect, Node: "forged", From: "alice", To: "bob", Text: "forged"}).encode(), '\n'))
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := io.Copy(io.Discard, conn); err != nil {
+		t.Fatalf("unauthenticated connection is not closed: %v", err)
+	}
+	// nodes can not report other nodes disconnected
+	node.Publish(&Message{Type: typeNodeDown, Node: "other"})
+	node.Publish(&Message{Type: typeMessage, Node: "node", Room: "go", From: "bob", Text: "Hello"})
+	select {
+	case m := <-node.Messages():
+		if m.Type != typeMessage || m.Text != "Hello" {
+			t.Errorf("message = %+v, want Hello of the authenticated node", m)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for message")
+	}
+}
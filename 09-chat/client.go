@@ -5,9 +5,9 @@
 package main
 
 import (
-	"bytes"
 	"log"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -25,13 +25,13 @@ const (
 
 	// Maximum message size allowed from peer.
 	maxMessageSize = 512
-)
 
-var (
-	newline = []byte{'\n'}
-	space   = []byte{' '}
+	// Number of outbound messages queued for the peer.
+	sendBufferSize = 256
 )
 
+var newline = []byte{'\n'}
+
 var upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
@@ -46,6 +46,18 @@ type Client struct {
 
 	// Buffered channel of outbound messages.
 	send chan []byte
+
+	// Rooms the client joined, accessed only by the hub.
+	rooms map[string]bool
+
+	// Nickname of the authenticated user.
+	nick string
+
+	// ID of the client and counters of queued and dropped outbound messages,
+	// accessed only by the hub.
+	id      int64
+	queued  uint64
+	dropped uint64
 }
 
 // readPump pumps messages from the websocket connection to the hub.
@@ -69,8 +81,12 @@ func (c *Client) readPump() {
 			}
 			break
 		}
-		message = bytes.TrimSpace(bytes.Replace(message, newline, space, -1))
-		c.hub.broadcast <- message
+		m, err := parseMessage(message)
+		if err != nil {
+			m = &Message{Type: typeError, Text: err.Error()}
+		}
+		m.client = c
+		c.hub.broadcast <- m
 	}
 }
 
@@ -101,11 +117,20 @@ func (c *Client) writePump() {
 			}
 			w.Write(message)
 
-			// Add queued chat messages to the current websocket message.
-			n := len(c.send)
-			for i := 0; i < n; i++ {
-				w.Write(newline)
-				w.Write(<-c.send)
+			// Add queued chat messages to the current websocket message. The
+			// hub may drop queued messages meanwhile, so do not wait for them.
+		coalesce:
+			for n := len(c.send); n > 0; n-- {
+				select {
+				case message, ok := <-c.send:
+					if !ok {
+						break coalesce
+					}
+					w.Write(newline)
+					w.Write(message)
+				default:
+					break coalesce
+				}
 			}
 
 			if err := w.Close(); err != nil {
@@ -120,16 +145,39 @@ func (c *Client) writePump() {
 	}
 }
 
-// serveWs handles websocket requests from the peer.
-func serveWs(hub *Hub, w http.ResponseWriter, r *http.Request) {
+// joinMessage returns join command of the websocket request parameters, e.g.
+// /ws?room=go&last_id=42, or nil if there is no valid room parameter.
+func joinMessage(r *http.Request) *Message {
+	room := r.FormValue("room")
+	if room == "" || len(room) > maxRoomName {
+		return nil
+	}
+	lastID, _ := strconv.ParseInt(r.FormValue("last_id"), 10, 64)
+	return &Message{Type: typeJoin, Room: room, ID: lastID}
+}
+
+// serveWs handles websocket requests from the peer, which must be
+// authenticated by token.
+func serveWs(hub *Hub, auth *Authenticator, w http.ResponseWriter, r *http.Request) {
+	nick, err := auth.authenticate(r)
+	if err != nil {
+		http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+		return
+	}
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Println(err)
 		return
 	}
-	client := &Client{hub: hub, conn: conn, send: make(chan []byte, 256)}
+	client := &Client{hub: hub, conn: conn, send: make(chan []byte, sendBufferSize), rooms: make(map[string]bool), nick: nick}
 	client.hub.register <- client
 
+	// Join the room of the request, replaying messages after last_id.
+	if join := joinMessage(r); join != nil {
+		join.client = client
+		client.hub.broadcast <- join
+	}
+
 	// Allow collection of memory referenced by the caller by doing all work in
 	// new goroutines.
 	go client.writePump()
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+)
+
+// FileStore keeps all messages in append-only file, one JSON message per
+// line. Only positions of the messages are kept in memory.
+type FileStore struct {
+	mu     sync.Mutex
+	file   *os.File
+	size   int64
+	rooms  map[string][]record
+	lastID int64
+}
+
+// record is position of a message in the file.
+type record struct {
+	id     int64
+	offset int64
+	length int
+}
+
+// OpenFileStore opens (and creates if needed) the history file and indexes
+// its messages. Incomplete last line left by a crash is discarded.
+func OpenFileStore(path string) (*FileStore, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	s := &FileStore{file: file, rooms: make(map[string][]record)}
+	if err := s.index(); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to read history file %s: %v", path, err)
+	}
+	return s, nil
+}
+
+// index reads positions of all messages and truncates the file after the
+// last complete line.
+func (s *FileStore) index() error {
+	reader := bufio.NewReader(s.file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		var m Message
+		if err := json.Unmarshal(line, &m); err != nil {
+			return fmt.Errorf("invalid message at offset %d: %v", s.size, err)
+		}
+		s.rooms[m.Room] = append(s.rooms[m.Room], record{id: m.ID, offset: s.size, length: len(line)})
+		s.lastID = m.ID
+		s.size += int64(len(line))
+	}
+	if err := s.file.Truncate(s.size); err != nil {
+		return err
+	}
+	_, err := s.file.Seek(s.size, io.SeekStart)
+	return err
+}
+
+func (s *FileStore) Append(m *Message) error {
+	line := append(m.encode(), '\n')
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.file.Write(line); err != nil {
+		return err
+	}
+	s.rooms[m.Room] = append(s.rooms[m.Room], record{id: m.ID, offset: s.size, length: len(line)})
+	s.lastID = m.ID
+	s.size += int64(len(line))
+	return nil
+}
+
+// read returns messages at the positions.
+func (s *FileStore) read(records []record) ([]Message, error) {
+	messages := make([]Message, len(records))
+	for i, r := range records {
+		line := make([]byte, r.length)
+		if _, err := s.file.ReadAt(line, r.offset); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(bytes.TrimSpace(line), &messages[i]); err != nil {
+			return nil, err
+		}
+	}
+	return messages, nil
+}
+
+func (s *FileStore) Before(room string, id int64, n int) ([]Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	records := s.rooms[room]
+	end := len(records)
+	if id > 0 {
+		end = sort.Search(len(records), func(i int) bool { return records[i].id >= id })
+	}
+	start := end - n
+	if start < 0 {
+		start = 0
+	}
+	return s.read(records[start:end])
+}
+
+func (s *FileStore) After(room string, id int64, n int) ([]Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	records := s.rooms[room]
+	start := sort.Search(len(records), func(i int) bool { return records[i].id > id })
+	end := start + n
+	if end > len(records) {
+		end = len(records)
+	}
+	return s.read(records[start:end])
+}
+
+func (s *FileStore) LastID() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastID
+}
+
+func (s *FileStore) Close() error {
+	return s.file.Close()
+}
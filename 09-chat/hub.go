@@ -4,50 +4,437 @@
 
 package main
 
-// Hub maintains the set of active clients and broadcasts messages to the
-// clients.
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"sort"
+	"time"
+)
+
+// RoomInfo describes a chat room in the room list.
+type RoomInfo struct {
+	Name    string `json:"name"`
+	Members int    `json:"members"`
+}
+
+// Hub maintains the set of active clients and the rooms they joined, and
+// routes messages to the members of the rooms, and direct messages to the
+// clients of the users. Chat, direct and presence messages are published to
+// the broker, and routed when the broker delivers them, so that hubs of
+// several nodes share rooms and users.
 type Hub struct {
 	// Registered clients.
 	clients map[*Client]bool
 
+	// Clients of online users by nickname, users can connect several clients.
+	users map[string]map[*Client]bool
+
+	// Nodes where online users have clients by nickname, including this one.
+	nodes map[string]map[string]bool
+
+	// Members of the rooms by room name. Rooms are created on first join and
+	// removed when their last member leaves.
+	rooms map[string]map[*Client]bool
+
 	// Inbound messages from the clients.
-	broadcast chan []byte
+	broadcast chan *Message
 
 	// Register requests from the clients.
 	register chan *Client
 
 	// Unregister requests from clients.
 	unregister chan *Client
+
+	// Room list requests.
+	roomList chan chan []RoomInfo
+
+	// Online user list requests.
+	presence chan chan []string
+
+	// History of the rooms.
+	store Store
+
+	// ID of the last chat message.
+	lastID int64
+
+	// Handling of clients with full send buffer.
+	policy SlowConsumerPolicy
+
+	// Metrics requests.
+	metricsRequests chan chan Metrics
+
+	// ID of the last registered client.
+	lastClientID int64
+
+	// Backpressure counters, see Metrics.
+	dropped         uint64
+	slowDisconnects uint64
+
+	// Fan-out of messages between nodes.
+	broker Broker
+
+	// ID of the hub, set in Node field of published messages.
+	node string
+
+	// Messages waiting to be published, so that the hub does not wait for
+	// the broker.
+	pending []*Message
+
+	// Messages passed to the goroutine publishing them to the broker.
+	outbox chan *Message
+
+	// Set when the broker connection is lost, messages are then delivered
+	// only to the clients of this node.
+	alone bool
 }
 
-func newHub() *Hub {
-	return &Hub{
-		broadcast:  make(chan []byte),
-		register:   make(chan *Client),
-		unregister: make(chan *Client),
-		clients:    make(map[*Client]bool),
+func newHub(store Store, policy SlowConsumerPolicy, broker Broker) *Hub {
+	h := &Hub{
+		store:           store,
+		policy:          policy,
+		broker:          broker,
+		node:            newNodeID(),
+		outbox:          make(chan *Message),
+		metricsRequests: make(chan chan Metrics),
+		lastID:          store.LastID(),
+		broadcast:       make(chan *Message),
+		register:        make(chan *Client),
+		unregister:      make(chan *Client),
+		roomList:        make(chan chan []RoomInfo),
+		presence:        make(chan chan []string),
+		clients:         make(map[*Client]bool),
+		users:           make(map[string]map[*Client]bool),
+		nodes:           make(map[string]map[string]bool),
+		rooms:           make(map[string]map[*Client]bool),
 	}
+	h.publish(&Message{Type: typeSync})
+	return h
+}
+
+// newNodeID returns random ID of a hub.
+func newNodeID() string {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(id)
 }
 
 func (h *Hub) run() {
+	go h.forward()
+	inbox := h.broker.Messages()
 	for {
+		// sending to nil channel blocks, so the case is disabled when
+		// there is nothing to publish
+		var outbox chan *Message
+		var next *Message
+		if len(h.pending) > 0 {
+			outbox, next = h.outbox, h.pending[0]
+		}
 		select {
+		case outbox <- next:
+			h.pending[0] = nil
+			h.pending = h.pending[1:]
+		case message, ok := <-inbox:
+			if !ok {
+				inbox = nil
+				h.runAlone()
+				continue
+			}
+			h.deliver(message)
 		case client := <-h.register:
-			h.clients[client] = true
+			h.add(client)
 		case client := <-h.unregister:
 			if _, ok := h.clients[client]; ok {
-				delete(h.clients, client)
-				close(client.send)
+				h.remove(client)
 			}
 		case message := <-h.broadcast:
-			for client := range h.clients {
-				select {
-				case client.send <- message:
-				default:
-					close(client.send)
-					delete(h.clients, client)
+			if _, ok := h.clients[message.client]; ok {
+				h.handle(message)
+			}
+		case reply := <-h.roomList:
+			reply <- h.roomInfos()
+		case reply := <-h.presence:
+			reply <- h.online()
+		case reply := <-h.metricsRequests:
+			reply <- h.metrics()
+		}
+	}
+}
+
+// Rooms returns rooms sorted by name with their member counts on this node.
+func (h *Hub) Rooms() []RoomInfo {
+	reply := make(chan []RoomInfo)
+	h.roomList <- reply
+	return <-reply
+}
+
+// Online returns nicknames of users online on any node sorted.
+func (h *Hub) Online() []string {
+	reply := make(chan []string)
+	h.presence <- reply
+	return <-reply
+}
+
+// Metrics returns backpressure metrics of the hub and its clients.
+func (h *Hub) Metrics() Metrics {
+	reply := make(chan Metrics)
+	h.metricsRequests <- reply
+	return <-reply
+}
+
+// forward publishes messages from the outbox to the broker.
+func (h *Hub) forward() {
+	for m := range h.outbox {
+		if err := h.broker.Publish(m); err != nil {
+			log.Printf("error publishing %s message: %v", m.Type, err)
+		}
+	}
+}
+
+// publish queues the message to be published to the broker, or delivers it
+// if the hub runs alone.
+func (h *Hub) publish(m *Message) {
+	m.Node = h.node
+	if h.alone {
+		h.deliver(m)
+		return
+	}
+	h.pending = append(h.pending, m)
+}
+
+// runAlone switches the hub to deliver messages itself when the broker
+// connection is lost. Users of other nodes are offline, and messages waiting
+// to be published are delivered.
+func (h *Hub) runAlone() {
+	log.Println("disconnected from broker, the hub runs alone")
+	h.alone = true
+	for nick, nodes := range h.nodes {
+		for node := range nodes {
+			if node != h.node {
+				h.offline(nick, node)
+			}
+		}
+	}
+	pending := h.pending
+	h.pending = nil
+	for _, m := range pending {
+		h.deliver(m)
+	}
+}
+
+// handle executes command of the client.
+func (h *Hub) handle(m *Message) {
+	client := m.client
+	switch m.Type {
+	case typeJoin:
+		members, ok := h.rooms[m.Room]
+		if !ok {
+			members = make(map[*Client]bool)
+			h.rooms[m.Room] = members
+		}
+		members[client] = true
+		client.rooms[m.Room] = true
+		h.send(client, &Message{Type: typeJoined, Room: m.Room})
+		h.replay(client, m.Room, m.ID)
+	case typeLeave:
+		if !client.rooms[m.Room] {
+			h.send(client, &Message{Type: typeError, Room: m.Room, Text: "not a member of the room"})
+			return
+		}
+		h.leave(client, m.Room)
+		h.send(client, &Message{Type: typeLeft, Room: m.Room})
+	case typeMessage:
+		if !client.rooms[m.Room] {
+			h.send(client, &Message{Type: typeError, Room: m.Room, Text: "not a member of the room"})
+			return
+		}
+		h.publish(&Message{Type: typeMessage, Room: m.Room, From: client.nick, Text: m.Text, Time: time.Now().UnixMilli()})
+	case typeDirect:
+		h.publish(&Message{Type: typeDirect, From: client.nick, To: m.To, Text: m.Text, Time: time.Now().UnixMilli()})
+	case typeError:
+		h.send(client, m)
+	}
+}
+
+// deliver routes message published by a hub of any node, including this one,
+// to the clients of this node.
+func (h *Hub) deliver(m *Message) {
+	node := m.Node
+	m.Node = ""
+	switch m.Type {
+	case typeMessage:
+		h.stamp(m)
+		if err := h.store.Append(m); err != nil {
+			log.Printf("error storing message %d: %v", m.ID, err)
+		}
+		data := m.encode()
+		for member := range h.rooms[m.Room] {
+			h.sendData(member, data)
+		}
+	case typeDirect:
+		if _, ok := h.nodes[m.To]; !ok {
+			// only the hub of the sender reports the error
+			if node == h.node {
+				data := (&Message{Type: typeError, To: m.To, Text: "user is not online"}).encode()
+				for sender := range h.users[m.From] {
+					h.sendData(sender, data)
 				}
 			}
+			return
+		}
+		data := h.stamp(m).encode()
+		for recipient := range h.users[m.To] {
+			h.sendData(recipient, data)
+		}
+		// other clients of the sender see the message too
+		if m.To != m.From {
+			for sender := range h.users[m.From] {
+				h.sendData(sender, data)
+			}
+		}
+	case typeOnline:
+		nodes, ok := h.nodes[m.From]
+		if !ok {
+			nodes = make(map[string]bool)
+			h.nodes[m.From] = nodes
+			h.sendAll(m)
+		}
+		nodes[node] = true
+	case typeOffline:
+		h.offline(m.From, node)
+	case typeSync:
+		if node != h.node {
+			for nick := range h.users {
+				h.publish(&Message{Type: typeOnline, From: nick})
+			}
+		}
+	case typeNodeDown:
+		for nick := range h.nodes {
+			h.offline(nick, node)
 		}
 	}
 }
+
+// offline removes the node from nodes of the user. If it was the last node,
+// all clients are notified that the user is offline.
+func (h *Hub) offline(nick, node string) {
+	nodes, ok := h.nodes[nick]
+	if !ok || !nodes[node] {
+		return
+	}
+	delete(nodes, node)
+	if len(nodes) == 0 {
+		delete(h.nodes, nick)
+		h.sendAll(&Message{Type: typeOffline, From: nick})
+	}
+}
+
+// stamp sets next message ID of the message. IDs increase in the order the
+// messages are delivered to this node.
+func (h *Hub) stamp(m *Message) *Message {
+	h.lastID++
+	m.ID = h.lastID
+	return m
+}
+
+// add registers the client. If it is the first client of the user on this
+// node, the user is published to be online. The new client is notified of
+// all online users, and of the user when the message is delivered.
+func (h *Hub) add(client *Client) {
+	h.lastClientID++
+	client.id = h.lastClientID
+	h.clients[client] = true
+	connections, ok := h.users[client.nick]
+	if !ok {
+		connections = make(map[*Client]bool)
+		h.users[client.nick] = connections
+	}
+	connections[client] = true
+	for _, nick := range h.online() {
+		h.send(client, &Message{Type: typeOnline, From: nick})
+	}
+	if !ok {
+		h.publish(&Message{Type: typeOnline, From: client.nick})
+	}
+}
+
+// replay sends history of the room to the client, messages after lastID if
+// it is not 0, otherwise the last replaySize messages.
+func (h *Hub) replay(client *Client, room string, lastID int64) {
+	var messages []Message
+	var err error
+	if lastID > 0 {
+		messages, err = h.store.After(room, lastID, replaySize)
+	} else {
+		messages, err = h.store.Before(room, 0, replaySize)
+	}
+	if err != nil {
+		log.Printf("error reading history of room %s: %v", room, err)
+		return
+	}
+	for i := range messages {
+		h.send(client, &messages[i])
+	}
+}
+
+// leave removes the client from the room, removing the room if it is empty.
+func (h *Hub) leave(client *Client, room string) {
+	delete(client.rooms, room)
+	members := h.rooms[room]
+	delete(members, client)
+	if len(members) == 0 {
+		delete(h.rooms, room)
+	}
+}
+
+// remove removes the client from all its rooms and closes its send channel.
+// If it was the last client of the user on this node, the user is published to
+// be offline on this node.
+func (h *Hub) remove(client *Client) {
+	for room := range client.rooms {
+		h.leave(client, room)
+	}
+	delete(h.clients, client)
+	close(client.send)
+	connections := h.users[client.nick]
+	delete(connections, client)
+	if len(connections) == 0 {
+		delete(h.users, client.nick)
+		h.publish(&Message{Type: typeOffline, From: client.nick})
+	}
+}
+
+// sendAll sends the message to all clients.
+func (h *Hub) sendAll(m *Message) {
+	data := m.encode()
+	for client := range h.clients {
+		h.sendData(client, data)
+	}
+}
+
+// send sends the message to the client.
+func (h *Hub) send(client *Client, m *Message) {
+	h.sendData(client, m.encode())
+}
+
+// roomInfos returns rooms sorted by name with their member counts.
+func (h *Hub) roomInfos() []RoomInfo {
+	infos := make([]RoomInfo, 0, len(h.rooms))
+	for name, members := range h.rooms {
+		infos = append(infos, RoomInfo{Name: name, Members: len(members)})
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos
+}
+
+// online returns nicknames of users online on any node sorted.
+func (h *Hub) online() []string {
+	nicks := make([]string, 0, len(h.nodes))
+	for nick := range h.nodes {
+		nicks = append(nicks, nick)
+	}
+	sort.Strings(nicks)
+	return nicks
+}
@@ -0,0 +1,354 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// testAuth authenticates users of test servers.
+var testAuth = NewAuthenticator([]byte("s3cret"), time.Hour)
+
+// newTestServer starts hub with the store and server with chat endpoints.
+func newTestServer(t *testing.T, store Store) (*Hub, *httptest.Server) {
+	t.Helper()
+	return newTestNode(t, store, NewLocalBroker().Connect())
+}
+
+// newTestNode starts hub with the store connected to the broker and server with chat endpoints.
+func newTestNode(t *testing.T, store Store, broker Broker) (*Hub, *httptest.Server) {
+	t.Helper()
+	hub := newHub(store, SlowConsumerPolicy{}, broker)
+	go hub.run()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
+		serveWs(hub, testAuth, w, r)
+	})
+	mux.HandleFunc("/rooms", authenticated(testAuth, func(w http.ResponseWriter, r *http.Request) {
+		serveRooms(hub, w, r)
+	}))
+	mux.HandleFunc("/history", authenticated(testAuth, func(w http.ResponseWriter, r *http.Request) {
+		serveHistory(store, w, r)
+	}))
+	mux.HandleFunc("/presence", authenticated(testAuth, func(w http.ResponseWriter, r *http.Request) {
+		servePresence(hub, w, r)
+	}))
+	mux.HandleFunc("/metrics", authenticated(testAuth, func(w http.ResponseWriter, r *http.Request) {
+		serveMetrics(hub, w, r)
+	}))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return hub, server
+}
+
+// testClient is websocket client reading messages coalesced by writePump one by one.
+type testClient struct {
+	t       *testing.T
+	conn    *websocket.Conn
+	pending [][]byte
+	// Online and offline messages are skipped unless presence is set.
+	presence bool
+}
+
+// dial connects the user to websocket endpoint.
+func dial(t *testing.T, server *httptest.Server, nick string) *testClient {
+	t.Helper()
+	return dialPath(t, server, nick, "/ws")
+}
+
+// dialPath connects the user to websocket endpoint at the path, which may have query parameters.
+func dialPath(t *testing.T, server *httptest.Server, nick, path string) *testClient {
+	t.Helper()
+	header := http.Header{"Authorization": {"Bearer " + testAuth.Token(nick)}}
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+path, header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &testClient{t: t, conn: conn}
+}
+
+func (c *testClient) send(m Message) {
+	c.t.Helper()
+	if err := c.conn.WriteJSON(m); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// read returns next message, failing the test if there is none in a second.
+func (c *testClient) read() Message {
+	c.t.Helper()
+	for {
+		if len(c.pending) == 0 {
+			c.conn.SetReadDeadline(time.Now().Add(time.Second))
+			_, data, err := c.conn.ReadMessage()
+			if err != nil {
+				c.t.Fatalf("read: %v", err)
+			}
+			c.pending = bytes.Split(data, newline)
+		}
+		var m Message
+		if err := json.Unmarshal(c.pending[0], &m); err != nil {
+			c.t.Fatal(err)
+		}
+		c.pending = c.pending[1:]
+		if c.presence || (m.Type != typeOnline && m.Type != typeOffline) {
+			return m
+		}
+	}
+}
+
+// expect reads next message, comparing its ID and time only if the wanted message has ID.
+func (c *testClient) expect(want Message) {
+	c.t.Helper()
+	got := c.read()
+	if want.ID == 0 {
+		got.ID, got.Time = 0, 0
+	}
+	if got != want {
+		c.t.Errorf("message = %+v, want %+v", got, want)
+	}
+}
+
+func (c *testClient) join(room string) {
+	c.t.Helper()
+	c.send(Message{Type: typeJoin, Room: room})
+	c.expect(Message{Type: typeJoined, Room: room})
+}
+
+// get sends GET request of a user to the server.
+func get(t *testing.T, server *httptest.Server, path string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest("GET", server.URL+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+testAuth.Token("tester"))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func getRooms(t *testing.T, server *httptest.Server) []RoomInfo {
+	t.Helper()
+	resp := get(t, server, "/rooms")
+	defer resp.Body.Close()
+	rooms := []RoomInfo{}
+	if err := json.NewDecoder(resp.Body).Decode(&rooms); err != nil {
+		t.Fatal(err)
+	}
+	return rooms
+}
+
+// waitRooms waits until the room list is the wanted one, clients are unregistered asynchronously.
+func waitRooms(t *testing.T, server *httptest.Server, want []RoomInfo) {
+	t.Helper()
+	var rooms []RoomInfo
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if rooms = getRooms(t, server); reflect.DeepEqual(rooms, want) {
+			return
+		}
+	}
+	t.Errorf("rooms = %v, want %v", rooms, want)
+}
+
+func TestRooms(t *testing.T) {
+	_, server := newTestServer(t, NewMemoryStore(10))
+	alice, bob, carol := dial(t, server, "alice"), dial(t, server, "bob"), dial(t, server, "carol")
+	alice.join("go")
+	bob.join("go")
+	carol.join("rust")
+	alice.join("rust")
+
+	alice.send(Message{Type: typeMessage, Room: "go", Text: "Hello gophers"})
+	alice.expect(Message{Type: typeMessage, Room: "go", From: "alice", Text: "Hello gophers"})
+	bob.expect(Message{Type: typeMessage, Room: "go", From: "alice", Text: "Hello gophers"})
+	carol.send(Message{Type: typeMessage, Room: "rust", Text: "Hello crabs"})
+	carol.expect(Message{Type: typeMessage, Room: "rust", From: "carol", Text: "Hello crabs"})
+	alice.expect(Message{Type: typeMessage, Room: "rust", From: "carol", Text: "Hello crabs"})
+
+	// bob is not member of the room, and receives no messages of the room
+	bob.send(Message{Type: typeMessage, Room: "rust", Text: "Hi"})
+	bob.expect(Message{Type: typeError, Room: "rust", Text: "not a member of the room"})
+	waitRooms(t, server, []RoomInfo{{"go", 2}, {"rust", 2}})
+
+	// empty rooms are removed
+	carol.send(Message{Type: typeLeave, Room: "rust"})
+	carol.expect(Message{Type: typeLeft, Room: "rust"})
+	alice.conn.Close()
+	waitRooms(t, server, []RoomInfo{{"go", 1}})
+	bob.send(Message{Type: typeMessage, Room: "go", Text: "Anybody here?"})
+	bob.expect(Message{Type: typeMessage, Room: "go", From: "bob", Text: "Anybody here?"})
+}
+
+func TestInvalidCommands(t *testing.T) {
+	_, server := newTestServer(t, NewMemoryStore(10))
+	c := dial(t, server, "alice")
+	c.conn.WriteMessage(websocket.TextMessage, []byte("plain text"))
+	if m := c.read(); m.Type != typeError || !strings.HasPrefix(m.Text, "invalid message") {
+		t.Errorf("reply to plain text = %+v, want invalid message error", m)
+	}
+	c.send(Message{Type: "kick", Room: "go"})
+	if m := c.read(); m.Type != typeError || !strings.HasPrefix(m.Text, "unknown message type") {
+		t.Errorf("reply to unknown command = %+v, want unknown type error", m)
+	}
+	c.send(Message{Type: typeJoin})
+	if m := c.read(); m.Type != typeError {
+		t.Errorf("reply to join without room = %+v, want error", m)
+	}
+	c.send(Message{Type: typeLeave, Room: "go"})
+	c.expect(Message{Type: typeError, Room: "go", Text: "not a member of the room"})
+}
+
+func TestHistoryReplay(t *testing.T) {
+	_, server := newTestServer(t, NewMemoryStore(10))
+	alice := dial(t, server, "alice")
+	alice.join("go")
+	for _, text := range []string{"one", "two", "three"} {
+		alice.send(Message{Type: typeMessage, Room: "go", Text: text})
+		if m := alice.read(); m.ID == 0 || m.Time == 0 {
+			t.Errorf("message %+v has no ID or time", m)
+		}
+	}
+
+	bob := dial(t, server, "bob")
+	bob.join("go")
+	first := bob.read()
+	bob.expect(Message{Type: typeMessage, Room: "go", From: "alice", Text: "two"})
+	bob.expect(Message{Type: typeMessage, Room: "go", From: "alice", Text: "three"})
+	if first.Text != "one" {
+		t.Errorf("first replayed message = %+v, want one", first)
+	}
+
+	carol := dialPath(t, server, "carol", fmt.Sprintf("/ws?room=go&last_id=%d", first.ID))
+	carol.expect(Message{Type: typeJoined, Room: "go"})
+	carol.expect(Message{Type: typeMessage, Room: "go", From: "alice", Text: "two"})
+	carol.expect(Message{Type: typeMessage, Room: "go", From: "alice", Text: "three"})
+	carol.send(Message{Type: typeMessage, Room: "go", Text: "four"})
+	carol.expect(Message{Type: typeMessage, Room: "go", From: "carol", Text: "four"})
+}
+
+func getHistory(t *testing.T, server *httptest.Server, query string) []Message {
+	t.Helper()
+	resp := get(t, server, "/history?"+query)
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /history?%s = %d", query, resp.StatusCode)
+	}
+	var messages []Message
+	if err := json.NewDecoder(resp.Body).Decode(&messages); err != nil {
+		t.Fatal(err)
+	}
+	return messages
+}
+
+func TestHistoryEndpoint(t *testing.T) {
+	_, server := newTestServer(t, NewMemoryStore(10))
+	c := dial(t, server, "alice")
+	c.join("go")
+	for i := 1; i <= 5; i++ {
+		c.send(Message{Type: typeMessage, Room: "go", Text: strconv.Itoa(i)})
+		c.read()
+	}
+
+	texts := func(messages []Message) string {
+		var b strings.Builder
+		for _, m := range messages {
+			b.WriteString(m.Text)
+		}
+		return b.String()
+	}
+	page := getHistory(t, server, "room=go&limit=2")
+	if texts(page) != "45" {
+		t.Fatalf("last page = %v, want messages 4 and 5", page)
+	}
+	if page = getHistory(t, server, fmt.Sprintf("room=go&limit=2&before=%d", page[0].ID)); texts(page) != "23" {
+		t.Errorf("previous page = %v, want messages 2 and 3", page)
+	}
+	if page = getHistory(t, server, fmt.Sprintf("room=go&after=%d", page[0].ID)); texts(page) != "345" {
+		t.Errorf("page after message 2 = %v, want messages 3 to 5", page)
+	}
+	if page = getHistory(t, server, "room=rust"); len(page) != 0 {
+		t.Errorf("history of unknown room = %v, want none", page)
+	}
+	resp := get(t, server, "/history?room=go&limit=1000")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("history with too large limit = %d, want %d", resp.StatusCode, http.StatusBadRequest)
+	}
+}
+
+// waitPresence waits until the online users are the wanted ones, presence is published asynchronously.
+func waitPresence(t *testing.T, server *httptest.Server, want []string) {
+	t.Helper()
+	var online []string
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		resp := get(t, server, "/presence")
+		online = nil
+		json.NewDecoder(resp.Body).Decode(&online)
+		resp.Body.Close()
+		if reflect.DeepEqual(online, want) {
+			return
+		}
+	}
+	t.Errorf("presence = %v, want %v", online, want)
+}
+
+func TestPresence(t *testing.T) {
+	_, server := newTestServer(t, NewMemoryStore(10))
+	alice := dial(t, server, "alice")
+	alice.presence = true
+	alice.expect(Message{Type: typeOnline, From: "alice"})
+
+	bob := dial(t, server, "bob")
+	bob.presence = true
+	alice.expect(Message{Type: typeOnline, From: "bob"})
+	// bob is announced when the broker delivers his online message
+	bob.expect(Message{Type: typeOnline, From: "alice"})
+	bob.expect(Message{Type: typeOnline, From: "bob"})
+
+	// second client of the user is not announced
+	bob2 := dial(t, server, "bob")
+	bob2.presence = true
+	bob2.expect(Message{Type: typeOnline, From: "alice"})
+	bob2.expect(Message{Type: typeOnline, From: "bob"})
+	waitPresence(t, server, []string{"alice", "bob"})
+
+	bob.conn.Close()
+	bob2.send(Message{Type: typeDirect, To: "alice", Text: "still here"})
+	alice.expect(Message{Type: typeDirect, From: "bob", To: "alice", Text: "still here"})
+	bob2.conn.Close()
+	alice.expect(Message{Type: typeOffline, From: "bob"})
+}
+
+func TestDirectMessages(t *testing.T) {
+	_, server := newTestServer(t, NewMemoryStore(10))
+	alice, bob, bob2, carol := dial(t, server, "alice"), dial(t, server, "bob"), dial(t, server, "bob"), dial(t, server, "carol")
+	carol.join("go")
+	waitPresence(t, server, []string{"alice", "bob", "carol"})
+
+	// the sender can not be forged
+	alice.send(Message{Type: typeDirect, From: "carol", To: "bob", Text: "Hi Bob"})
+	want := Message{Type: typeDirect, From: "alice", To: "bob", Text: "Hi Bob"}
+	alice.expect(want)
+	bob.expect(want)
+	bob2.expect(want)
+
+	alice.send(Message{Type: typeDirect, To: "dave", Text: "Hi Dave"})
+	alice.expect(Message{Type: typeError, To: "dave", Text: "user is not online"})
+
+	// carol receives only her room messages
+	carol.send(Message{Type: typeMessage, Room: "go", Text: "Hello"})
+	carol.expect(Message{Type: typeMessage, Room: "go", From: "carol", Text: "Hello"})
+}
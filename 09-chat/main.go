@@ -5,12 +5,31 @@
 package main
 
 import (
+	"crypto/rand"
+	"encoding/json"
 	"flag"
 	"log"
 	"net/http"
+	"os"
+	"strconv"
+	"time"
 )
 
-var addr = flag.String("addr", ":8080", "http service address")
+var (
+	addr        = flag.String("addr", ":8080", "http service address")
+	historyFile = flag.String("history-file", "", "append-only chat history file, history is kept in memory if empty")
+	historySize = flag.Int("history-size", 1000, "number of messages of each room kept in memory")
+	secret      = flag.String("secret", os.Getenv("CHAT_SECRET"), "key signing user tokens and authenticating broker nodes, random if empty")
+	tokenTTL    = flag.Duration("token-ttl", 24*time.Hour, "validity of user tokens")
+	slowAction  = flag.String("slow-consumer", "disconnect", "handling of clients with full send buffer: disconnect, drop-oldest, drop-newest or block")
+	slowTimeout = flag.Duration("block-timeout", 100*time.Millisecond, "time to wait for a slow client with block policy before disconnecting it")
+	brokerAddr  = flag.String("broker", "", "address of TCP broker shared by chat server nodes, the hub runs alone if empty")
+	brokerServe = flag.String("broker-listen", "", "serve TCP broker for chat server nodes on the address, the node connects to it unless -broker is set")
+	devLogin    = flag.Bool("dev-login", false, "serve /login issuing tokens for any nickname, for development only")
+)
+
+// Maximum number of messages in history page.
+const maxHistoryPage = 100
 
 func serveHome(w http.ResponseWriter, r *http.Request) {
 	log.Println(r.URL)
@@ -25,15 +44,169 @@ func serveHome(w http.ResponseWriter, r *http.Request) {
 	http.ServeFile(w, r, "home.html")
 }
 
+// serveRooms responds with JSON list of rooms and their member counts.
+func serveRooms(hub *Hub, w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(hub.Rooms())
+}
+
+// serveHistory responds with JSON page of messages of the room ordered by ID:
+// /history?room=go returns the last messages, before=ID returns messages
+// preceding the message, and after=ID messages following the message.
+// The number of messages is set by limit parameter.
+func serveHistory(store Store, w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	room := r.FormValue("room")
+	if room == "" {
+		http.Error(w, "Missing room parameter", http.StatusBadRequest)
+		return
+	}
+	var before, after int64
+	limit := replaySize
+	var err error
+	if value := r.FormValue("before"); value != "" {
+		before, err = strconv.ParseInt(value, 10, 64)
+	}
+	if value := r.FormValue("after"); value != "" && err == nil {
+		after, err = strconv.ParseInt(value, 10, 64)
+	}
+	if value := r.FormValue("limit"); value != "" && err == nil {
+		limit, err = strconv.Atoi(value)
+	}
+	if err != nil || before < 0 || after < 0 || limit < 1 || limit > maxHistoryPage {
+		http.Error(w, "Invalid before, after or limit parameter", http.StatusBadRequest)
+		return
+	}
+
+	var messages []Message
+	if after > 0 {
+		messages, err = store.After(room, after, limit)
+	} else {
+		messages, err = store.Before(room, before, limit)
+	}
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Error reading history", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(messages)
+}
+
+// servePresence responds with JSON list of nicknames of online users.
+func servePresence(hub *Hub, w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(hub.Online())
+}
+
+// serveMetrics responds with JSON backpressure metrics of the hub.
+func serveMetrics(hub *Hub, w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(hub.Metrics())
+}
+
+// newAuthenticator returns authenticator with key configured by flags.
+func newAuthenticator() (*Authenticator, error) {
+	key := []byte(*secret)
+	if len(key) == 0 {
+		log.Println("No secret configured, tokens will be invalid after restart")
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+	}
+	return NewAuthenticator(key, *tokenTTL), nil
+}
+
+// openStore opens history store configured by flags.
+func openStore() (Store, error) {
+	if *historyFile != "" {
+		return OpenFileStore(*historyFile)
+	}
+	return NewMemoryStore(*historySize), nil
+}
+
+// openBroker starts and connects to broker configured by flags, nodes are
+// authenticated with the key of auth.
+func openBroker(auth *Authenticator) (Broker, error) {
+	addr := *brokerAddr
+	if *brokerServe != "" {
+		server, err := ListenBroker(*brokerServe, auth)
+		if err != nil {
+			return nil, err
+		}
+		go func() {
+			log.Fatal("broker: ", server.Serve())
+		}()
+		if addr == "" {
+			addr = server.Addr().String()
+		}
+	}
+	if addr != "" {
+		return DialBroker(addr, auth)
+	}
+	return NewLocalBroker().Connect(), nil
+}
+
 func main() {
 	flag.Parse()
-	hub := newHub()
+	store, err := openStore()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer store.Close()
+	auth, err := newAuthenticator()
+	if err != nil {
+		log.Fatal(err)
+	}
+	action, err := ParseSlowConsumerAction(*slowAction)
+	if err != nil {
+		log.Fatal(err)
+	}
+	broker, err := openBroker(auth)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer broker.Close()
+	hub := newHub(store, SlowConsumerPolicy{Action: action, Timeout: *slowTimeout}, broker)
 	go hub.run()
 	http.HandleFunc("/", serveHome)
+	http.HandleFunc("/rooms", authenticated(auth, func(w http.ResponseWriter, r *http.Request) {
+		serveRooms(hub, w, r)
+	}))
+	http.HandleFunc("/history", authenticated(auth, func(w http.ResponseWriter, r *http.Request) {
+		serveHistory(store, w, r)
+	}))
+	http.HandleFunc("/presence", authenticated(auth, func(w http.ResponseWriter, r *http.Request) {
+		servePresence(hub, w, r)
+	}))
+	http.HandleFunc("/metrics", authenticated(auth, func(w http.ResponseWriter, r *http.Request) {
+		serveMetrics(hub, w, r)
+	}))
+	if *devLogin {
+		http.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+			serveLogin(auth, w, r)
+		})
+	}
 	http.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
-		serveWs(hub, w, r)
+		serveWs(hub, auth, w, r)
 	})
-	err := http.ListenAndServe(*addr, nil)
+	err = http.ListenAndServe(*addr, nil)
 	if err != nil {
 		log.Fatal("ListenAndServe: ", err)
 	}
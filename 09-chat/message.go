@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Types of messages sent by clients.
+const (
+	// Join the room.
+	typeJoin = "join"
+	// Leave the room.
+	typeLeave = "leave"
+	// Send chat message to the room, the sender must be a member of the room.
+	typeMessage = "message"
+	// Send direct message to the user, which must be online.
+	typeDirect = "direct"
+)
+
+// Types of messages sent by the hub, besides chat messages of typeMessage.
+const (
+	// The client joined the room.
+	typeJoined = "joined"
+	// The client left the room.
+	typeLeft = "left"
+	// The client command failed.
+	typeError = "error"
+	// The user connected its first client.
+	typeOnline = "online"
+	// The user disconnected its last client.
+	typeOffline = "offline"
+)
+
+// Types of messages exchanged only between hubs through the broker, besides
+// chat, direct, online and offline messages.
+const (
+	// The hub started, other hubs announce their online users.
+	typeSync = "sync"
+	// The node of Node field disconnected from the broker, its users are
+	// offline.
+	typeNodeDown = "node-down"
+)
+
+// Maximum length of room names.
+const maxRoomName = 32
+
+// Number of messages of the room replayed on join.
+const replaySize = 50
+
+// Message is a message of the chat protocol. Clients send commands as JSON
+// messages, e.g. {"type": "join", "room": "go"} or
+// {"type": "message", "room": "go", "text": "Hello"}, and receive chat
+// messages, command acknowledgements and errors in the same format.
+//
+// Direct messages are sent to the nickname of the user, e.g.
+// {"type": "direct", "to": "bob", "text": "Hi"}. The hub sets nickname of the
+// sender in From field of chat and direct messages. It also sends online and
+// offline messages with the nickname of the user in From field when users
+// connect and disconnect, and online messages of all online users to new
+// clients.
+//
+// The hub stamps chat messages with increasing ID and time in Unix
+// milliseconds. Clients may send ID of the last message they have seen with
+// join command, e.g. {"type": "join", "room": "go", "id": 42}, to receive
+// messages of the room they missed, otherwise the last replaySize messages of
+// the room are replayed.
+//
+// Hubs of chat server nodes exchange messages through the broker with ID of
+// the publishing hub in Node field. Message IDs are assigned by each node in
+// the order it receives the messages, so they are valid only on that node.
+type Message struct {
+	Type string `json:"type"`
+	Room string `json:"room,omitempty"`
+	Text string `json:"text,omitempty"`
+	From string `json:"from,omitempty"`
+	To   string `json:"to,omitempty"`
+	ID   int64  `json:"id,omitempty"`
+	Time int64  `json:"time,omitempty"`
+	Node string `json:"node,omitempty"`
+
+	// The client that sent the command.
+	client *Client
+}
+
+// parseMessage decodes command sent by the client.
+func parseMessage(data []byte) (*Message, error) {
+	m := &Message{}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("invalid message: %v", err)
+	}
+	switch m.Type {
+	case typeJoin, typeLeave, typeMessage:
+		if m.Room == "" || len(m.Room) > maxRoomName {
+			return nil, fmt.Errorf("room name must have 1 to %d characters", maxRoomName)
+		}
+	case typeDirect:
+		if !validNickname.MatchString(m.To) {
+			return nil, fmt.Errorf("invalid recipient: %q", m.To)
+		}
+	default:
+		return nil, fmt.Errorf("unknown message type: %q", m.Type)
+	}
+	// the sender is set by the hub
+	m.From = ""
+	return m, nil
+}
+
+// encode returns JSON encoding of the message.
+func (m *Message) encode() []byte {
+	data, _ := json.Marshal(m)
+	return data
+}
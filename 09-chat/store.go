@@ -0,0 +1,105 @@
+package main
+
+import (
+	"sort"
+	"sync"
+)
+
+// Store keeps chat history of the rooms. Messages are appended by the hub
+// with increasing IDs. Stores are safe for concurrent use.
+type Store interface {
+	// Append stores the message.
+	Append(m *Message) error
+	// Before returns up to n latest messages of the room with IDs lower than
+	// id, or the latest messages if id is 0, ordered by ID.
+	Before(room string, id int64, n int) ([]Message, error)
+	// After returns up to n first messages of the room with IDs greater than
+	// id, ordered by ID.
+	After(room string, id int64, n int) ([]Message, error)
+	// LastID returns ID of the last stored message, or 0 if there is none.
+	LastID() int64
+	// Close releases resources of the store.
+	Close() error
+}
+
+// MemoryStore keeps last messages of each room in ring buffers.
+type MemoryStore struct {
+	mu     sync.Mutex
+	size   int
+	rooms  map[string]*ring
+	lastID int64
+}
+
+// ring is ring buffer of the last messages of a room.
+type ring struct {
+	messages []Message
+	// Index of the oldest message when the buffer is full.
+	start int
+}
+
+// NewMemoryStore returns store keeping up to size last messages of each room.
+func NewMemoryStore(size int) *MemoryStore {
+	return &MemoryStore{size: size, rooms: make(map[string]*ring)}
+}
+
+func (s *MemoryStore) Append(m *Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.rooms[m.Room]
+	if !ok {
+		r = &ring{}
+		s.rooms[m.Room] = r
+	}
+	if len(r.messages) < s.size {
+		r.messages = append(r.messages, *m)
+	} else {
+		r.messages[r.start] = *m
+		r.start = (r.start + 1) % s.size
+	}
+	s.lastID = m.ID
+	return nil
+}
+
+// ordered returns messages of the room ordered by ID.
+func (s *MemoryStore) ordered(room string) []Message {
+	r, ok := s.rooms[room]
+	if !ok {
+		return []Message{}
+	}
+	return append(append([]Message{}, r.messages[r.start:]...), r.messages[:r.start]...)
+}
+
+func (s *MemoryStore) Before(room string, id int64, n int) ([]Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	messages := s.ordered(room)
+	end := len(messages)
+	if id > 0 {
+		end = sort.Search(len(messages), func(i int) bool { return messages[i].ID >= id })
+	}
+	if start := end - n; start > 0 {
+		return messages[start:end], nil
+	}
+	return messages[:end], nil
+}
+
+func (s *MemoryStore) After(room string, id int64, n int) ([]Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	messages := s.ordered(room)
+	start := sort.Search(len(messages), func(i int) bool { return messages[i].ID > id })
+	if end := start + n; end < len(messages) {
+		return messages[start:end], nil
+	}
+	return messages[start:], nil
+}
+
+func (s *MemoryStore) LastID() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastID
+}
+
+func (s *MemoryStore) Close() error {
+	return nil
+}
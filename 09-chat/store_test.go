@@ -0,0 +1,102 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// ids returns IDs of the messages.
+func ids(messages []Message) []int64 {
+	ids := []int64{}
+	for _, m := range messages {
+		ids = append(ids, m.ID)
+	}
+	return ids
+}
+
+// testStore checks store with messages 1 to 6 of rooms go (odd IDs) and rust (even IDs).
+func testStore(t *testing.T, store Store) {
+	t.Helper()
+	tests := []struct {
+		name string
+		got  func() ([]Message, error)
+		want []int64
+	}{
+		{"last", func() ([]Message, error) { return store.Before("go", 0, 2) }, []int64{3, 5}},
+		{"all", func() ([]Message, error) { return store.Before("go", 0, 10) }, []int64{1, 3, 5}},
+		{"before", func() ([]Message, error) { return store.Before("rust", 6, 10) }, []int64{2, 4}},
+		{"before first", func() ([]Message, error) { return store.Before("rust", 2, 10) }, []int64{}},
+		{"after", func() ([]Message, error) { return store.After("go", 1, 1) }, []int64{3}},
+		{"after missing", func() ([]Message, error) { return store.After("go", 2, 10) }, []int64{3, 5}},
+		{"after last", func() ([]Message, error) { return store.After("go", 5, 10) }, []int64{}},
+		{"unknown room", func() ([]Message, error) { return store.Before("c", 0, 10) }, []int64{}},
+	}
+	for _, tt := range tests {
+		messages, err := tt.got()
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got := ids(messages); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+	if id := store.LastID(); id != 6 {
+		t.Errorf("LastID() = %d, want 6", id)
+	}
+}
+
+func appendMessages(t *testing.T, store Store) {
+	t.Helper()
+	for id := int64(1); id <= 6; id++ {
+		room := "go"
+		if id%2 == 0 {
+			room = "rust"
+		}
+		if err := store.Append(&Message{Type: typeMessage, Room: room, Text: "text", ID: id, Time: 1000 * id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	store := NewMemoryStore(3)
+	appendMessages(t, store)
+	testStore(t, store)
+
+	// ring buffer keeps the last messages
+	store.Append(&Message{Type: typeMessage, Room: "go", ID: 7})
+	messages, _ := store.Before("go", 0, 10)
+	if got := ids(messages); !reflect.DeepEqual(got, []int64{3, 5, 7}) {
+		t.Errorf("messages after overwrite = %v, want [3 5 7]", got)
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	store, err := OpenFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	appendMessages(t, store)
+	testStore(t, store)
+	store.Close()
+
+	// incomplete line is discarded on reopen
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"type":"message","room":"go","id":7`)
+	f.Close()
+	if store, err = OpenFileStore(path); err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	testStore(t, store)
+	messages, _ := store.After("rust", 2, 1)
+	if want := (Message{Type: typeMessage, Room: "rust", Text: "text", ID: 4, Time: 4000}); len(messages) != 1 || messages[0] != want {
+		t.Errorf("After = %+v, want %+v", messages, want)
+	}
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+// Time allowed to a node to answer the challenge.
+const handshakeTimeout = 10 * time.Second
+
+// Answer of the server to a node which passed the challenge.
+const handshakeAccepted = "ok"
+
+var errBrokerRejected = errors.New("broker rejected the node")
+
+// BrokerServer relays messages between chat server nodes connected over TCP,
+// each message is a JSON line. One of the nodes, or a separate process, runs
+// the server, and all nodes connect to it with DialBroker.
+//
+// Nodes must share the key of the server's authenticator. The server sends a
+// random challenge to each connecting node, and relays messages only of the
+// nodes which answer it with the challenge signed by the key.
+type BrokerServer struct {
+	listener net.Listener
+	auth     *Authenticator
+	mu       sync.Mutex
+	nodes    map[*brokerConn]bool
+}
+
+// brokerConn is connection of a node to BrokerServer.
+type brokerConn struct {
+	conn net.Conn
+	// Encoded messages to the node.
+	send chan []byte
+	// ID of the hub, taken from the first published message.
+	node string
+}
+
+// ListenBroker returns broker server listening on the TCP address, accepting
+// nodes sharing the key of auth.
+func ListenBroker(addr string, auth *Authenticator) (*BrokerServer, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &BrokerServer{listener: listener, auth: auth, nodes: make(map[*brokerConn]bool)}, nil
+}
+
+// challengeAnswer returns answer of a node to the challenge. Signed payload
+// contains no dot, so the answer is never a valid user token, and tokens do
+// not answer challenges.
+func challengeAnswer(auth *Authenticator, challenge string) string {
+	return auth.sign("broker " + challenge)
+}
+
+// Addr returns address the server listens on.
+func (s *BrokerServer) Addr() net.Addr {
+	return s.listener.Addr()
+}
+
+// Serve accepts connections of the nodes until the server is closed.
+func (s *BrokerServer) Serve() error {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return err
+		}
+		go s.serveNode(conn)
+	}
+}
+
+// authenticate checks the node answers the challenge.
+func (s *BrokerServer) authenticate(conn net.Conn, decoder *json.Decoder) error {
+	nonce := make([]byte, 32)
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	challenge := base64.RawURLEncoding.EncodeToString(nonce)
+	conn.SetDeadline(time.Now().Add(handshakeTimeout))
+	if err := json.NewEncoder(conn).Encode(challenge); err != nil {
+		return err
+	}
+	var answer string
+	if err := decoder.Decode(&answer); err != nil {
+		return err
+	}
+	if !hmac.Equal([]byte(answer), []byte(challengeAnswer(s.auth, challenge))) {
+		return errInvalidToken
+	}
+	if err := json.NewEncoder(conn).Encode(handshakeAccepted); err != nil {
+		return err
+	}
+	return conn.SetDeadline(time.Time{})
+}
+
+// Close stops the server and disconnects all nodes.
+func (s *BrokerServer) Close() error {
+	err := s.listener.Close()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for c := range s.nodes {
+		c.conn.Close()
+	}
+	return err
+}
+
+// serveNode authenticates the node and relays messages it publishes. When
+// the node disconnects, the other nodes are notified.
+func (s *BrokerServer) serveNode(conn net.Conn) {
+	decoder := json.NewDecoder(conn)
+	if err := s.authenticate(conn, decoder); err != nil {
+		log.Printf("rejecting broker node %s: %v", conn.RemoteAddr(), err)
+		conn.Close()
+		return
+	}
+	c := &brokerConn{conn: conn, send: make(chan []byte, sendBufferSize)}
+	s.mu.Lock()
+	s.nodes[c] = true
+	s.mu.Unlock()
+	go c.writeLoop()
+	for {
+		var m Message
+		if err := decoder.Decode(&m); err != nil {
+			break
+		}
+		// only the server reports disconnected nodes
+		if m.Type == typeNodeDown {
+			continue
+		}
+		if c.node == "" {
+			s.mu.Lock()
+			c.node = m.Node
+			s.mu.Unlock()
+		}
+		s.relay(&m)
+	}
+	c.conn.Close()
+	s.mu.Lock()
+	delete(s.nodes, c)
+	close(c.send)
+	s.mu.Unlock()
+	if c.node != "" {
+		s.relay(&Message{Type: typeNodeDown, Node: c.node})
+	}
+}
+
+// relay queues the message to all nodes. A node which does not read messages
+// as fast as they are published is disconnected, as it would miss messages.
+func (s *BrokerServer) relay(m *Message) {
+	data := append(m.encode(), '\n')
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for c := range s.nodes {
+		select {
+		case c.send <- data:
+		default:
+			log.Printf("disconnecting slow broker node %s", c.node)
+			c.conn.Close()
+		}
+	}
+}
+
+// writeLoop writes queued messages to the node until the send channel is
+// closed.
+func (c *brokerConn) writeLoop() {
+	for data := range c.send {
+		if _, err := c.conn.Write(data); err != nil {
+			c.conn.Close()
+		}
+	}
+}
+
+// TCPBroker is connection of a node to BrokerServer. The connection is not
+// restored when it fails, the hub then delivers messages only to its own
+// clients.
+type TCPBroker struct {
+	conn     net.Conn
+	mu       sync.Mutex
+	encoder  *json.Encoder
+	decoder  *json.Decoder
+	messages chan *Message
+}
+
+// DialBroker connects to broker server at the TCP address, answering its
+// challenge with the key of auth.
+func DialBroker(addr string, auth *Authenticator) (*TCPBroker, error) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	b := &TCPBroker{conn: conn, encoder: json.NewEncoder(conn), decoder: json.NewDecoder(conn),
+		messages: make(chan *Message, sendBufferSize)}
+	if err := b.handshake(auth); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	go b.readLoop()
+	return b, nil
+}
+
+// handshake answers the challenge of the server.
+func (b *TCPBroker) handshake(auth *Authenticator) error {
+	b.conn.SetDeadline(time.Now().Add(handshakeTimeout))
+	var challenge, result string
+	if err := b.decoder.Decode(&challenge); err != nil {
+		return err
+	}
+	if err := b.encoder.Encode(challengeAnswer(auth, challenge)); err != nil {
+		return err
+	}
+	if err := b.decoder.Decode(&result); err != nil || result != handshakeAccepted {
+		return errBrokerRejected
+	}
+	return b.conn.SetDeadline(time.Time{})
+}
+
+// readLoop passes messages relayed by the server to the hub until the
+// connection is closed.
+func (b *TCPBroker) readLoop() {
+	defer close(b.messages)
+	for {
+		m := &Message{}
+		if err := b.decoder.Decode(m); err != nil {
+			return
+		}
+		b.messages <- m
+	}
+}
+
+func (b *TCPBroker) Publish(m *Message) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.encoder.Encode(m)
+}
+
+func (b *TCPBroker) Messages() <-chan *Message {
+	return b.messages
+}
+
+func (b *TCPBroker) Close() error {
+	return b.conn.Close()
+}
@@ -0,0 +1,120 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/grpc-ecosystem/go-grpc-middleware/auth"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ownerKey is context key of the authenticated user ID
+type ownerKey struct{}
+
+// WithOwner returns context carrying ID of the authenticated user owning the requested ToDos
+func WithOwner(ctx context.Context, owner string) context.Context {
+	return context.WithValue(ctx, ownerKey{}, owner)
+}
+
+// Owner returns ID of the authenticated user stored in the context
+func Owner(ctx context.Context) (string, bool) {
+	owner, ok := ctx.Value(ownerKey{}).(string)
+	return owner, ok && owner != ""
+}
+
+// Verifier validates JWT bearer tokens signed with HMAC secret or RSA private key.
+// The token subject ("sub" claim) is the ID of the authenticated user.
+type Verifier struct {
+	// method is expected family of signing algorithms, tokens signed otherwise are rejected
+	method jwt.SigningMethod
+	key    interface{}
+}
+
+// NewHMACVerifier creates verifier of tokens signed by HS256, HS384 or HS512 with given secret
+func NewHMACVerifier(secret []byte) (*Verifier, error) {
+	if len(secret) == 0 {
+		return nil, errors.New("JWT HMAC secret is empty")
+	}
+	return &Verifier{method: jwt.SigningMethodHS256, key: secret}, nil
+}
+
+// NewRSAVerifier creates verifier of tokens signed by RS256, RS384 or RS512 with private key matching PEM encoded public key
+func NewRSAVerifier(publicKeyPEM []byte) (*Verifier, error) {
+	key, err := jwt.ParseRSAPublicKeyFromPEM(publicKeyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("invalid JWT RSA public key-> %w", err)
+	}
+	return &Verifier{method: jwt.SigningMethodRS256, key: key}, nil
+}
+
+// LoadVerifier creates verifier from RSA public key file if given, or from HMAC secret otherwise
+func LoadVerifier(secret, publicKeyFile string) (*Verifier, error) {
+	if publicKeyFile != "" {
+		pem, err := ioutil.ReadFile(publicKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read JWT RSA public key-> %w", err)
+		}
+		return NewRSAVerifier(pem)
+	}
+	if secret == "" {
+		return nil, errors.New("JWT verification key is not configured")
+	}
+	return NewHMACVerifier([]byte(secret))
+}
+
+// Verify checks token signature and validity, and returns its claims
+func (v *Verifier) Verify(token string) (*jwt.StandardClaims, error) {
+	claims := &jwt.StandardClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		// do not let the token choose verification algorithm, e.g. HMAC with RSA public key as secret
+		switch v.method.(type) {
+		case *jwt.SigningMethodHMAC:
+			if _, ok := t.Method.(*jwt.SigningMethodHMAC); ok {
+				return v.key, nil
+			}
+		case *jwt.SigningMethodRSA:
+			if _, ok := t.Method.(*jwt.SigningMethodRSA); ok {
+				return v.key, nil
+			}
+		}
+		return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+	})
+	if err != nil {
+		return nil, err
+	}
+	if claims.Subject == "" {
+		return nil, errors.New("token subject is missing")
+	}
+	return claims, nil
+}
+
+// AuthFunc authenticates gRPC call by bearer token in "authorization" metadata,
+// storing the token subject as owner in the returned context.
+// It is used by grpc_auth unary and stream server interceptors.
+func (v *Verifier) AuthFunc(ctx context.Context) (context.Context, error) {
+	token, err := grpc_auth.AuthFromMD(ctx, "bearer")
+	if err != nil {
+		return nil, err
+	}
+	claims, err := v.Verify(token)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "invalid auth token-> "+err.Error())
+	}
+	return WithOwner(ctx, claims.Subject), nil
+}
+
+// SignHMAC issues HS256 signed token for given user valid for ttl, e.g. for demo clients and tests
+func SignHMAC(secret []byte, subject string, ttl time.Duration) (string, error) {
+	now := time.Now()
+	claims := jwt.StandardClaims{
+		Subject:   subject,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(ttl).Unix(),
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(secret)
+}
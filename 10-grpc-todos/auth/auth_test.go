@@ -0,0 +1,120 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+var secret = []byte("test secret")
+
+func sign(t *testing.T, method jwt.SigningMethod, key interface{}, claims jwt.StandardClaims) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(method, claims).SignedString(key)
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+	return token
+}
+
+func TestVerifier_Verify(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate RSA key: %v", err)
+	}
+	der, _ := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	publicPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+
+	hmacVerifier, err := NewHMACVerifier(secret)
+	if err != nil {
+		t.Fatalf("NewHMACVerifier() error = %v", err)
+	}
+	rsaVerifier, err := NewRSAVerifier(publicPEM)
+	if err != nil {
+		t.Fatalf("NewRSAVerifier() error = %v", err)
+	}
+
+	valid := jwt.StandardClaims{Subject: "alice", ExpiresAt: time.Now().Add(time.Hour).Unix()}
+	issued, err := SignHMAC(secret, "alice", time.Hour)
+	if err != nil {
+		t.Fatalf("SignHMAC() error = %v", err)
+	}
+	tests := []struct {
+		name     string
+		verifier *Verifier
+		token    string
+		wantErr  bool
+	}{
+		{"HMAC", hmacVerifier, issued, false},
+		{"RSA", rsaVerifier, sign(t, jwt.SigningMethodRS256, rsaKey, valid), false},
+		{"wrong secret", hmacVerifier, sign(t, jwt.SigningMethodHS256, []byte("other"), valid), true},
+		{"expired", hmacVerifier, sign(t, jwt.SigningMethodHS256, secret,
+			jwt.StandardClaims{Subject: "alice", ExpiresAt: time.Now().Add(-time.Minute).Unix()}), true},
+		{"missing subject", hmacVerifier, sign(t, jwt.SigningMethodHS256, secret, jwt.StandardClaims{}), true},
+		{"HMAC signed with RSA public key", rsaVerifier, sign(t, jwt.SigningMethodHS256, publicPEM, valid), true},
+		{"RSA token for HMAC verifier", hmacVerifier, sign(t, jwt.SigningMethodRS256, rsaKey, valid), true},
+		{"malformed", hmacVerifier, "not a token", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := tt.verifier.Verify(tt.token)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Verify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && claims.Subject != "alice" {
+				t.Errorf("Verify() subject = %q, want %q", claims.Subject, "alice")
+			}
+		})
+	}
+}
+
+func TestVerifier_AuthFunc(t *testing.T) {
+	v, _ := NewHMACVerifier(secret)
+	token, _ := SignHMAC(secret, "alice", time.Hour)
+	tests := []struct {
+		name      string
+		md        metadata.MD
+		wantOwner string
+		wantCode  codes.Code
+	}{
+		{"bearer token", metadata.Pairs("authorization", "Bearer "+token), "alice", codes.OK},
+		{"missing header", metadata.MD{}, "", codes.Unauthenticated},
+		{"wrong scheme", metadata.Pairs("authorization", "Basic "+token), "", codes.Unauthenticated},
+		{"invalid token", metadata.Pairs("authorization", "Bearer invalid"), "", codes.Unauthenticated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, err := v.AuthFunc(metadata.NewIncomingContext(context.Background(), tt.md))
+			if status.Code(err) != tt.wantCode {
+				t.Fatalf("AuthFunc() error = %v, want code %v", err, tt.wantCode)
+			}
+			if err != nil {
+				return
+			}
+			if owner, ok := Owner(ctx); !ok || owner != tt.wantOwner {
+				t.Errorf("Owner() = %q, %v, want %q", owner, ok, tt.wantOwner)
+			}
+		})
+	}
+}
+
+func TestLoadVerifier(t *testing.T) {
+	if _, err := LoadVerifier("", ""); err == nil {
+		t.Error("LoadVerifier() without keys succeeded, want error")
+	}
+	if _, err := LoadVerifier("secret", "missing.pem"); err == nil {
+		t.Error("LoadVerifier() with missing key file succeeded, want error")
+	}
+	if _, err := LoadVerifier("secret", ""); err != nil {
+		t.Errorf("LoadVerifier() with secret error = %v", err)
+	}
+}
@@ -4,18 +4,43 @@ import (
 	"encoding/json"
 	"flag"
 	"fmt"
+	"github.com/iproduct/coursego/10-grpc-todos/auth"
 	"io/ioutil"
 	"log"
 	"net/http"
+	"os"
 	"strings"
 	"time"
 )
 
+// bearerTransport adds Authorization header with bearer token to all requests
+type bearerTransport struct {
+	token string
+}
+
+func (t bearerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+t.token)
+	return http.DefaultTransport.RoundTrip(req)
+}
+
 func main() {
 	// get configuration
 	address := flag.String("server", "http://localhost:8080", "HTTP gateway url, e.g. http://localhost:8080")
+	token := flag.String("token", "", "JWT bearer token (default is token issued for -user with -jwt-secret)")
+	secret := flag.String("jwt-secret", os.Getenv("JWT_SECRET"), "HMAC secret to issue token with (default $JWT_SECRET)")
+	user := flag.String("user", "demo", "ID of the user to issue token for")
 	flag.Parse()
 
+	if *token == "" {
+		var err error
+		if *token, err = auth.SignHMAC([]byte(*secret), *user, time.Hour); err != nil {
+			log.Fatalf("failed to issue token: %v", err)
+		}
+	}
+	// authenticate all calls made by http.Get, http.Post and http.DefaultClient
+	http.DefaultClient.Transport = bearerTransport{token: *token}
+
 	t := time.Now().In(time.UTC)
 	pfx := t.Format(time.RFC3339Nano)
 
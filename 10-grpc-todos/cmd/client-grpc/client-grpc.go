@@ -4,10 +4,14 @@ import (
 	"context"
 	"flag"
 	"github.com/golang/protobuf/ptypes"
+	"github.com/iproduct/coursego/10-grpc-todos/auth"
 	"github.com/iproduct/coursego/10-grpc-todos/generated/todo_service"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
 	"log"
+	"os"
 	"time"
 )
 
@@ -19,8 +23,18 @@ const (
 func main() {
 	// get configuration
 	address := flag.String("server", "localhost:9000", "gRPC server in format host:port")
+	token := flag.String("token", "", "JWT bearer token (default is token issued for -user with -jwt-secret)")
+	secret := flag.String("jwt-secret", os.Getenv("JWT_SECRET"), "HMAC secret to issue token with (default $JWT_SECRET)")
+	user := flag.String("user", "demo", "ID of the user to issue token for")
 	flag.Parse()
 
+	if *token == "" {
+		var err error
+		if *token, err = auth.SignHMAC([]byte(*secret), *user, time.Hour); err != nil {
+			log.Fatalf("failed to issue token: %v", err)
+		}
+	}
+
 	// Set up a connection to the server.
 	conn, err := grpc.Dial(*address, grpc.WithTransportCredentials(insecure.NewCredentials()))
 	if err != nil {
@@ -32,6 +46,7 @@ func main() {
 
 	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Second)
 	defer cancel()
+	ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+*token)
 
 	t := time.Now().In(time.UTC)
 	reminder, _ := ptypes.TimestampProto(t)
@@ -80,15 +95,15 @@ func main() {
 	}
 	log.Printf("Read result: <%+v>\n\n", res3)
 
-	// Update
+	// Update description of the version read, fails with Aborted if it was changed meanwhile
 	req4 := todo_service.UpdateRequest{
 		Api: apiVersion,
 		ToDo: &todo_service.ToDo{
 			Id:          res3.ToDo.Id,
-			Title:       res3.ToDo.Title,
 			Description: res3.ToDo.Description + " + updated",
-			Reminder:    res3.ToDo.Reminder,
+			Version:     res3.ToDo.Version,
 		},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"description"}},
 	}
 	res4, err := c.Update(ctx, &req4)
 	if err != nil {
@@ -2,16 +2,21 @@ package main
 
 import (
 	"context"
-	"database/sql"
 	"flag"
 	"fmt"
+	"github.com/iproduct/coursego/10-grpc-todos/auth"
+	"github.com/iproduct/coursego/10-grpc-todos/events"
+	"github.com/iproduct/coursego/10-grpc-todos/middleware"
 	logger_grpc "github.com/iproduct/coursego/10-grpc-todos/middleware/logger-grpc"
+	"github.com/iproduct/coursego/10-grpc-todos/reminder"
 	"github.com/iproduct/coursego/10-grpc-todos/server/grpc-server"
+	metrics_server "github.com/iproduct/coursego/10-grpc-todos/server/metrics-server"
 	"github.com/iproduct/coursego/10-grpc-todos/service"
+	"github.com/iproduct/coursego/10-grpc-todos/store"
+	"github.com/iproduct/coursego/10-grpc-todos/tracing"
+	"github.com/iproduct/coursego/10-grpc-todos/trash"
 	"os"
-
-	// mysql driver
-	_ "github.com/go-sql-driver/mysql"
+	"time"
 )
 
 // Config is configuration for Server
@@ -21,6 +26,10 @@ type Config struct {
 	GRPCPort string
 
 	// DB Datastore parameters section
+	// DatastoreType is storage backend: mysql, sqlite or memory
+	DatastoreType string
+	// DatastoreSQLitePath is SQLite database file path (":memory:" for in-memory database)
+	DatastoreSQLitePath string
 	// DatastoreDBHost is host of database
 	DatastoreDBHost string
 	// DatastoreDBUser is username to connect to database
@@ -30,6 +39,38 @@ type Config struct {
 	// DatastoreDBSchema is schema of database
 	DatastoreDBSchema string
 
+	// Reminders parameters section
+	// RemindersEnabled turns on firing of ToDo reminders
+	RemindersEnabled bool
+	// ReminderWebhookURL is URL fired reminders are posted to (empty to disable)
+	ReminderWebhookURL string
+
+	// Trash parameters section
+	// TrashRetention is time deleted ToDos are kept in trash before they are purged (0 to keep them forever)
+	TrashRetention time.Duration
+	// TrashPurgeInterval is time between purges of trash
+	TrashPurgeInterval time.Duration
+
+	// Authentication parameters section
+	// AuthJWTSecret is HMAC secret verifying JWT bearer tokens
+	AuthJWTSecret string
+	// AuthJWTPublicKeyFile is PEM file with RSA public key verifying JWT bearer tokens (overrides AuthJWTSecret)
+	AuthJWTPublicKeyFile string
+
+	// Middleware parameters section
+	// MetricsPort is TCP port to publish Prometheus metrics on /metrics (empty to disable metrics)
+	MetricsPort string
+	// Recovery turns on conversion of call handler panics to Internal errors
+	Recovery bool
+	// RateLimit is average number of calls per second allowed for each client (0 to disable rate limiting)
+	RateLimit float64
+	// RateLimitBurst is maximum number of calls allowed at once for each client
+	RateLimitBurst int
+	// RateLimitKey identifies clients for rate limiting: peer or user
+	RateLimitKey string
+	// TracingOutput is where trace spans are written: stdout, file path, or empty to disable tracing
+	TracingOutput string
+
 	// Log parameters section
 	// LogLevel is global log level: Debug(-1), Info(0), Warn(1), Error(2), DPanic(3), Panic(4), Fatal(5)
 	LogLevel int
@@ -44,10 +85,24 @@ func RunServer() error {
 	// get configuration
 	var cfg Config
 	flag.StringVar(&cfg.GRPCPort, "grpc-server-port", "9000", "gRPC port to bind")
+	flag.StringVar(&cfg.DatastoreType, "db-type", store.MySQL, "Storage backend: mysql, sqlite or memory")
+	flag.StringVar(&cfg.DatastoreSQLitePath, "sqlite-path", "todos.db", "SQLite database file path")
 	flag.StringVar(&cfg.DatastoreDBHost, "db-host", "localhost", "Database host")
 	flag.StringVar(&cfg.DatastoreDBUser, "db-user", "root", "Database user")
 	flag.StringVar(&cfg.DatastoreDBPassword, "db-password", "root", "Database password")
 	flag.StringVar(&cfg.DatastoreDBSchema, "db-schema", "grpc-demo", "Database schema")
+	flag.BoolVar(&cfg.RemindersEnabled, "reminders", true, "Fire ToDo reminders")
+	flag.StringVar(&cfg.ReminderWebhookURL, "reminder-webhook", "", "URL to post fired reminders to, e.g. http://localhost:8090/reminders")
+	flag.DurationVar(&cfg.TrashRetention, "trash-retention", trash.DefaultRetention, "Time deleted ToDos are kept in trash, 0 to keep them forever")
+	flag.DurationVar(&cfg.TrashPurgeInterval, "trash-purge-interval", trash.DefaultInterval, "Time between purges of trash")
+	flag.StringVar(&cfg.AuthJWTSecret, "jwt-secret", os.Getenv("JWT_SECRET"), "HMAC secret verifying JWT bearer tokens (default $JWT_SECRET)")
+	flag.StringVar(&cfg.AuthJWTPublicKeyFile, "jwt-public-key", "", "PEM file with RSA public key verifying JWT bearer tokens")
+	flag.StringVar(&cfg.MetricsPort, "metrics-port", "2112", "HTTP port to publish Prometheus metrics on /metrics, empty to disable")
+	flag.BoolVar(&cfg.Recovery, "recovery", true, "Recover from call handler panics with Internal error")
+	flag.Float64Var(&cfg.RateLimit, "rate-limit", 100, "Average calls per second allowed for each client, 0 to disable")
+	flag.IntVar(&cfg.RateLimitBurst, "rate-limit-burst", 200, "Maximum calls allowed at once for each client")
+	flag.StringVar(&cfg.RateLimitKey, "rate-limit-key", middleware.RateLimitByUser, "Rate limit clients by: peer or user")
+	flag.StringVar(&cfg.TracingOutput, "tracing", "", "Write trace spans to: stdout or file path, empty to disable tracing")
 	flag.IntVar(&cfg.LogLevel, "log-level", -1, "Global log level")
 	flag.StringVar(&cfg.LogTimeFormat, "log-time-format", "2006-01-02T15:04:05.999999999Z07:00",
 		"Print time format for logger-grpc e.g. 2006-01-02T15:04:05Z07:00")
@@ -60,24 +115,78 @@ func RunServer() error {
 		return fmt.Errorf("failed to initialize logger-grpc: %v", err)
 	}
 
-	// add MySQL driver specific parameter to parse date/time
-	// Drop it for another database
-	param := "parseTime=true"
-
-	dsn := fmt.Sprintf("%s:%s@tcp(%s)/%s?%s",
-		cfg.DatastoreDBUser,
-		cfg.DatastoreDBPassword,
-		cfg.DatastoreDBHost,
-		cfg.DatastoreDBSchema,
-		param)
-	db, err := sql.Open("mysql", dsn)
+	// configure authentication
+	verifier, err := auth.LoadVerifier(cfg.AuthJWTSecret, cfg.AuthJWTPublicKeyFile)
+	if err != nil {
+		return fmt.Errorf("failed to configure authentication (use -jwt-secret or -jwt-public-key): %v", err)
+	}
+
+	// start tracing
+	shutdownTracing, err := tracing.Start("todo-service", cfg.TracingOutput)
 	if err != nil {
-		return fmt.Errorf("failed to open database: %v", err)
+		return err
+	}
+	defer shutdownTracing(ctx)
+
+	// configure middleware
+	chain := middleware.Chain{
+		Tracing:  cfg.TracingOutput != "",
+		Logger:   logger_grpc.Log,
+		Metrics:  cfg.MetricsPort != "",
+		Recovery: cfg.Recovery,
+		AuthFunc: verifier.AuthFunc,
+	}
+	if cfg.RateLimit > 0 {
+		if chain.RateLimiter, err = middleware.NewRateLimiterKeyedBy(cfg.RateLimitKey, cfg.RateLimit, cfg.RateLimitBurst); err != nil {
+			return err
+		}
+	}
+
+	// open storage backend
+	dsn := cfg.DatastoreSQLitePath
+	if cfg.DatastoreType == store.MySQL {
+		// add MySQL driver specific parameter to parse date/time
+		param := "parseTime=true"
+
+		dsn = fmt.Sprintf("%s:%s@tcp(%s)/%s?%s",
+			cfg.DatastoreDBUser,
+			cfg.DatastoreDBPassword,
+			cfg.DatastoreDBHost,
+			cfg.DatastoreDBSchema,
+			param)
+	}
+	st, err := store.Open(cfg.DatastoreType, dsn)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+
+	broker := events.NewBroker(events.DefaultHistorySize)
+
+	// start reminder scheduler
+	var reminders *reminder.StreamNotifier
+	if cfg.RemindersEnabled {
+		if reminders, err = reminder.Start(ctx, st, broker, cfg.ReminderWebhookURL, logger_grpc.Log); err != nil {
+			return err
+		}
+	}
+
+	// start purging of trash
+	if cfg.TrashRetention > 0 {
+		if _, err := trash.Start(ctx, st, cfg.TrashRetention, cfg.TrashPurgeInterval, logger_grpc.Log); err != nil {
+			return err
+		}
+	}
+
+	API := service.NewToDoServiceServer(st, broker, reminders)
+	// run metrics server
+	if chain.Metrics {
+		go func() {
+			_ = metrics_server.RunServer(ctx, cfg.MetricsPort)
+		}()
 	}
-	defer db.Close()
 
-	API := service.NewToDoServiceServer(db)
-	return grpc_server.RunServer(ctx, API, cfg.GRPCPort)
+	return grpc_server.RunServer(ctx, API, cfg.GRPCPort, chain)
 }
 
 func main() {
@@ -0,0 +1,152 @@
+package events
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/iproduct/coursego/10-grpc-todos/generated/todo_service"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// DefaultHistorySize is number of recent events kept for resuming watchers
+	DefaultHistorySize = 1000
+	// subscriptionBuffer is number of new events queued for a watcher before it is dropped as too slow
+	subscriptionBuffer = 64
+)
+
+var (
+	// ErrCompacted is returned when requested revision is older than the retained history
+	ErrCompacted = errors.New("requested revision has been compacted")
+	// ErrFutureRevision is returned when requested revision has not been published yet
+	ErrFutureRevision = errors.New("requested revision is newer than the current revision")
+	// ErrSlowConsumer is reported by dropped subscription which did not keep up with events
+	ErrSlowConsumer = errors.New("subscriber is too slow")
+)
+
+// Broker assigns revisions to ToDo change events and fans them out to subscribers.
+// It keeps the most recent events, so reconnecting subscribers can resume without missing changes.
+type Broker struct {
+	mu          sync.Mutex
+	revision    int64
+	history     []*todo_service.ToDoEvent
+	historySize int
+	subs        map[*Subscription]struct{}
+	now         func() time.Time
+}
+
+// Subscription receives events published after it was created (and replayed ones if requested)
+type Subscription struct {
+	broker *Broker
+	events chan *todo_service.ToDoEvent
+	err    error
+}
+
+// NewBroker creates event broker keeping historySize most recent events
+func NewBroker(historySize int) *Broker {
+	if historySize <= 0 {
+		historySize = DefaultHistorySize
+	}
+	return &Broker{
+		historySize: historySize,
+		subs:        make(map[*Subscription]struct{}),
+		now:         time.Now,
+	}
+}
+
+// Revision returns revision of the last published event
+func (b *Broker) Revision() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.revision
+}
+
+// Publish records change of ToDo and sends it to all subscribers.
+// Subscribers which buffers are full are dropped with ErrSlowConsumer.
+func (b *Broker) Publish(typ todo_service.ToDoEvent_Type, td *todo_service.ToDo) *todo_service.ToDoEvent {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.revision++
+	ts, _ := ptypes.TimestampProto(b.now())
+	ev := &todo_service.ToDoEvent{
+		Revision: b.revision,
+		Type:     typ,
+		ToDo:     proto.Clone(td).(*todo_service.ToDo),
+		Time:     ts,
+	}
+
+	if len(b.history) == b.historySize {
+		copy(b.history, b.history[1:])
+		b.history = b.history[:len(b.history)-1]
+	}
+	b.history = append(b.history, ev)
+
+	for sub := range b.subs {
+		select {
+		case sub.events <- ev:
+		default:
+			sub.err = ErrSlowConsumer
+			b.remove(sub)
+		}
+	}
+	return ev
+}
+
+// Subscribe creates subscription to new events.
+// If fromRevision > 0, retained events with greater revision are replayed first.
+func (b *Broker) Subscribe(fromRevision int64) (*Subscription, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var replay []*todo_service.ToDoEvent
+	if fromRevision > 0 {
+		if fromRevision > b.revision {
+			return nil, ErrFutureRevision
+		}
+		oldest := b.revision - int64(len(b.history)) + 1
+		if fromRevision+1 < oldest {
+			return nil, ErrCompacted
+		}
+		replay = b.history[len(b.history)-int(b.revision-fromRevision):]
+	}
+
+	sub := &Subscription{
+		broker: b,
+		events: make(chan *todo_service.ToDoEvent, len(replay)+subscriptionBuffer),
+	}
+	for _, ev := range replay {
+		sub.events <- ev
+	}
+	b.subs[sub] = struct{}{}
+	return sub, nil
+}
+
+// remove unregisters subscription and closes its channel, must be called with lock held
+func (b *Broker) remove(sub *Subscription) {
+	if _, ok := b.subs[sub]; ok {
+		delete(b.subs, sub)
+		close(sub.events)
+	}
+}
+
+// Events returns channel of events, closed when the subscription ends
+func (s *Subscription) Events() <-chan *todo_service.ToDoEvent {
+	return s.events
+}
+
+// Err returns reason the events channel was closed by the broker, nil if closed by Close
+func (s *Subscription) Err() error {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+	return s.err
+}
+
+// Close ends the subscription
+func (s *Subscription) Close() {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+	s.broker.remove(s)
+}
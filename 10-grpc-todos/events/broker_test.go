@@ -0,0 +1,97 @@
+package events
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/iproduct/coursego/10-grpc-todos/generated/todo_service"
+)
+
+func publishN(b *Broker, n int) {
+	for i := 1; i <= n; i++ {
+		b.Publish(todo_service.ToDoEvent_CREATED, &todo_service.ToDo{Id: int64(i)})
+	}
+}
+
+func revisions(t *testing.T, sub *Subscription, n int) []int64 {
+	t.Helper()
+	var revs []int64
+	for i := 0; i < n; i++ {
+		select {
+		case ev := <-sub.Events():
+			revs = append(revs, ev.Revision)
+		default:
+			t.Fatalf("expected %d events, got %d", n, len(revs))
+		}
+	}
+	return revs
+}
+
+func TestBroker_PublishSubscribe(t *testing.T) {
+	b := NewBroker(10)
+	publishN(b, 2)
+	sub, err := b.Subscribe(0)
+	if err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+	defer sub.Close()
+
+	ev := b.Publish(todo_service.ToDoEvent_UPDATED, &todo_service.ToDo{Id: 1, Title: "updated"})
+	if ev.Revision != 3 || ev.Type != todo_service.ToDoEvent_UPDATED || ev.Time == nil {
+		t.Errorf("Publish() = %v, want UPDATED event with revision 3", ev)
+	}
+	got := <-sub.Events()
+	if got.Revision != 3 || got.ToDo.Title != "updated" {
+		t.Errorf("received %v, want UPDATED event with revision 3", got)
+	}
+	if len(sub.Events()) != 0 {
+		t.Errorf("received events published before Subscribe(0)")
+	}
+}
+
+func TestBroker_Resume(t *testing.T) {
+	b := NewBroker(5)
+	publishN(b, 8) // retained revisions 4..8
+
+	sub, err := b.Subscribe(5)
+	if err != nil {
+		t.Fatalf("Subscribe(5) error = %v", err)
+	}
+	defer sub.Close()
+	if revs := revisions(t, sub, 3); revs[0] != 6 || revs[2] != 8 {
+		t.Errorf("replayed revisions %v, want [6 7 8]", revs)
+	}
+
+	if sub, err := b.Subscribe(3); err != nil {
+		t.Errorf("Subscribe(3) error = %v, want replay of all retained events", err)
+	} else {
+		sub.Close()
+	}
+	if _, err := b.Subscribe(2); !errors.Is(err, ErrCompacted) {
+		t.Errorf("Subscribe(2) error = %v, want ErrCompacted", err)
+	}
+	if _, err := b.Subscribe(9); !errors.Is(err, ErrFutureRevision) {
+		t.Errorf("Subscribe(9) error = %v, want ErrFutureRevision", err)
+	}
+}
+
+func TestBroker_SlowConsumer(t *testing.T) {
+	b := NewBroker(10)
+	sub, err := b.Subscribe(0)
+	if err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+	publishN(b, subscriptionBuffer+1)
+
+	n := 0
+	for range sub.Events() {
+		n++
+	}
+	if n != subscriptionBuffer {
+		t.Errorf("received %d events before drop, want %d", n, subscriptionBuffer)
+	}
+	if !errors.Is(sub.Err(), ErrSlowConsumer) {
+		t.Errorf("Err() = %v, want ErrSlowConsumer", sub.Err())
+	}
+	sub.Close() // closing dropped subscription is safe
+}
@@ -20,8 +20,26 @@ const _ = grpc.SupportPackageIsVersion7
 type ToDoServiceClient interface {
 	// Read all todo tasks
 	ReadAll(ctx context.Context, in *ReadAllRequest, opts ...grpc.CallOption) (*ReadAllResponse, error)
+	// Watch todo task changes (declared before Read, so its path is not matched as todo task ID)
+	WatchToDos(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (ToDoService_WatchToDosClient, error)
+	// Watch fired todo task reminders (declared before Read, so its path is not matched as todo task ID)
+	WatchReminders(ctx context.Context, in *WatchRemindersRequest, opts ...grpc.CallOption) (ToDoService_WatchRemindersClient, error)
+	// List deleted todo tasks (declared before Read, so its path is not matched as todo task ID)
+	ListTrash(ctx context.Context, in *ListTrashRequest, opts ...grpc.CallOption) (*ListTrashResponse, error)
+	// Permanently delete todo tasks from trash (declared before Delete, so its path is not matched as todo task ID)
+	Purge(ctx context.Context, in *PurgeRequest, opts ...grpc.CallOption) (*PurgeResponse, error)
+	// Restore deleted todo task from trash
+	Restore(ctx context.Context, in *RestoreRequest, opts ...grpc.CallOption) (*RestoreResponse, error)
 	// Create new todo task
 	Create(ctx context.Context, in *CreateRequest, opts ...grpc.CallOption) (*CreateResponse, error)
+	// Create several todo tasks in single transaction
+	BatchCreate(ctx context.Context, in *BatchCreateRequest, opts ...grpc.CallOption) (*BatchCreateResponse, error)
+	// Update several todo tasks in single transaction
+	BatchUpdate(ctx context.Context, in *BatchUpdateRequest, opts ...grpc.CallOption) (*BatchUpdateResponse, error)
+	// Delete several todo tasks in single transaction
+	BatchDelete(ctx context.Context, in *BatchDeleteRequest, opts ...grpc.CallOption) (*BatchDeleteResponse, error)
+	// Import stream of todo tasks, committed in chunks
+	ImportToDos(ctx context.Context, opts ...grpc.CallOption) (ToDoService_ImportToDosClient, error)
 	// Read todo task
 	Read(ctx context.Context, in *ReadRequest, opts ...grpc.CallOption) (*ReadResponse, error)
 	// Update todo task
@@ -47,6 +65,97 @@ func (c *toDoServiceClient) ReadAll(ctx context.Context, in *ReadAllRequest, opt
 	return out, nil
 }
 
+func (c *toDoServiceClient) WatchToDos(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (ToDoService_WatchToDosClient, error) {
+	stream, err := c.cc.NewStream(ctx, &ToDoService_ServiceDesc.Streams[0], "/v1.ToDoService/WatchToDos", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &toDoServiceWatchToDosClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type ToDoService_WatchToDosClient interface {
+	Recv() (*WatchResponse, error)
+	grpc.ClientStream
+}
+
+type toDoServiceWatchToDosClient struct {
+	grpc.ClientStream
+}
+
+func (x *toDoServiceWatchToDosClient) Recv() (*WatchResponse, error) {
+	m := new(WatchResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *toDoServiceClient) WatchReminders(ctx context.Context, in *WatchRemindersRequest, opts ...grpc.CallOption) (ToDoService_WatchRemindersClient, error) {
+	stream, err := c.cc.NewStream(ctx, &ToDoService_ServiceDesc.Streams[1], "/v1.ToDoService/WatchReminders", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &toDoServiceWatchRemindersClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type ToDoService_WatchRemindersClient interface {
+	Recv() (*WatchRemindersResponse, error)
+	grpc.ClientStream
+}
+
+type toDoServiceWatchRemindersClient struct {
+	grpc.ClientStream
+}
+
+func (x *toDoServiceWatchRemindersClient) Recv() (*WatchRemindersResponse, error) {
+	m := new(WatchRemindersResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *toDoServiceClient) ListTrash(ctx context.Context, in *ListTrashRequest, opts ...grpc.CallOption) (*ListTrashResponse, error) {
+	out := new(ListTrashResponse)
+	err := c.cc.Invoke(ctx, "/v1.ToDoService/ListTrash", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *toDoServiceClient) Purge(ctx context.Context, in *PurgeRequest, opts ...grpc.CallOption) (*PurgeResponse, error) {
+	out := new(PurgeResponse)
+	err := c.cc.Invoke(ctx, "/v1.ToDoService/Purge", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *toDoServiceClient) Restore(ctx context.Context, in *RestoreRequest, opts ...grpc.CallOption) (*RestoreResponse, error) {
+	out := new(RestoreResponse)
+	err := c.cc.Invoke(ctx, "/v1.ToDoService/Restore", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *toDoServiceClient) Create(ctx context.Context, in *CreateRequest, opts ...grpc.CallOption) (*CreateResponse, error) {
 	out := new(CreateResponse)
 	err := c.cc.Invoke(ctx, "/v1.ToDoService/Create", in, out, opts...)
@@ -56,6 +165,67 @@ func (c *toDoServiceClient) Create(ctx context.Context, in *CreateRequest, opts
 	return out, nil
 }
 
+func (c *toDoServiceClient) BatchCreate(ctx context.Context, in *BatchCreateRequest, opts ...grpc.CallOption) (*BatchCreateResponse, error) {
+	out := new(BatchCreateResponse)
+	err := c.cc.Invoke(ctx, "/v1.ToDoService/BatchCreate", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *toDoServiceClient) BatchUpdate(ctx context.Context, in *BatchUpdateRequest, opts ...grpc.CallOption) (*BatchUpdateResponse, error) {
+	out := new(BatchUpdateResponse)
+	err := c.cc.Invoke(ctx, "/v1.ToDoService/BatchUpdate", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *toDoServiceClient) BatchDelete(ctx context.Context, in *BatchDeleteRequest, opts ...grpc.CallOption) (*BatchDeleteResponse, error) {
+	out := new(BatchDeleteResponse)
+	err := c.cc.Invoke(ctx, "/v1.ToDoService/BatchDelete", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *toDoServiceClient) ImportToDos(ctx context.Context, opts ...grpc.CallOption) (ToDoService_ImportToDosClient, error) {
+	stream, err := c.cc.NewStream(ctx, &ToDoService_ServiceDesc.Streams[2], "/v1.ToDoService/ImportToDos", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &toDoServiceImportToDosClient{stream}
+	return x, nil
+}
+
+type ToDoService_ImportToDosClient interface {
+	Send(*ImportToDosRequest) error
+	CloseAndRecv() (*ImportToDosResponse, error)
+	grpc.ClientStream
+}
+
+type toDoServiceImportToDosClient struct {
+	grpc.ClientStream
+}
+
+func (x *toDoServiceImportToDosClient) Send(m *ImportToDosRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *toDoServiceImportToDosClient) CloseAndRecv() (*ImportToDosResponse, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(ImportToDosResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 func (c *toDoServiceClient) Read(ctx context.Context, in *ReadRequest, opts ...grpc.CallOption) (*ReadResponse, error) {
 	out := new(ReadResponse)
 	err := c.cc.Invoke(ctx, "/v1.ToDoService/Read", in, out, opts...)
@@ -89,8 +259,26 @@ func (c *toDoServiceClient) Delete(ctx context.Context, in *DeleteRequest, opts
 type ToDoServiceServer interface {
 	// Read all todo tasks
 	ReadAll(context.Context, *ReadAllRequest) (*ReadAllResponse, error)
+	// Watch todo task changes (declared before Read, so its path is not matched as todo task ID)
+	WatchToDos(*WatchRequest, ToDoService_WatchToDosServer) error
+	// Watch fired todo task reminders (declared before Read, so its path is not matched as todo task ID)
+	WatchReminders(*WatchRemindersRequest, ToDoService_WatchRemindersServer) error
+	// List deleted todo tasks (declared before Read, so its path is not matched as todo task ID)
+	ListTrash(context.Context, *ListTrashRequest) (*ListTrashResponse, error)
+	// Permanently delete todo tasks from trash (declared before Delete, so its path is not matched as todo task ID)
+	Purge(context.Context, *PurgeRequest) (*PurgeResponse, error)
+	// Restore deleted todo task from trash
+	Restore(context.Context, *RestoreRequest) (*RestoreResponse, error)
 	// Create new todo task
 	Create(context.Context, *CreateRequest) (*CreateResponse, error)
+	// Create several todo tasks in single transaction
+	BatchCreate(context.Context, *BatchCreateRequest) (*BatchCreateResponse, error)
+	// Update several todo tasks in single transaction
+	BatchUpdate(context.Context, *BatchUpdateRequest) (*BatchUpdateResponse, error)
+	// Delete several todo tasks in single transaction
+	BatchDelete(context.Context, *BatchDeleteRequest) (*BatchDeleteResponse, error)
+	// Import stream of todo tasks, committed in chunks
+	ImportToDos(ToDoService_ImportToDosServer) error
 	// Read todo task
 	Read(context.Context, *ReadRequest) (*ReadResponse, error)
 	// Update todo task
@@ -107,9 +295,36 @@ type UnimplementedToDoServiceServer struct {
 func (UnimplementedToDoServiceServer) ReadAll(context.Context, *ReadAllRequest) (*ReadAllResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method ReadAll not implemented")
 }
+func (UnimplementedToDoServiceServer) WatchToDos(*WatchRequest, ToDoService_WatchToDosServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchToDos not implemented")
+}
+func (UnimplementedToDoServiceServer) WatchReminders(*WatchRemindersRequest, ToDoService_WatchRemindersServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchReminders not implemented")
+}
+func (UnimplementedToDoServiceServer) ListTrash(context.Context, *ListTrashRequest) (*ListTrashResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListTrash not implemented")
+}
+func (UnimplementedToDoServiceServer) Purge(context.Context, *PurgeRequest) (*PurgeResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Purge not implemented")
+}
+func (UnimplementedToDoServiceServer) Restore(context.Context, *RestoreRequest) (*RestoreResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Restore not implemented")
+}
 func (UnimplementedToDoServiceServer) Create(context.Context, *CreateRequest) (*CreateResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Create not implemented")
 }
+func (UnimplementedToDoServiceServer) BatchCreate(context.Context, *BatchCreateRequest) (*BatchCreateResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BatchCreate not implemented")
+}
+func (UnimplementedToDoServiceServer) BatchUpdate(context.Context, *BatchUpdateRequest) (*BatchUpdateResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BatchUpdate not implemented")
+}
+func (UnimplementedToDoServiceServer) BatchDelete(context.Context, *BatchDeleteRequest) (*BatchDeleteResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BatchDelete not implemented")
+}
+func (UnimplementedToDoServiceServer) ImportToDos(ToDoService_ImportToDosServer) error {
+	return status.Errorf(codes.Unimplemented, "method ImportToDos not implemented")
+}
 func (UnimplementedToDoServiceServer) Read(context.Context, *ReadRequest) (*ReadResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Read not implemented")
 }
@@ -150,6 +365,102 @@ func _ToDoService_ReadAll_Handler(srv interface{}, ctx context.Context, dec func
 	return interceptor(ctx, in, info, handler)
 }
 
+func _ToDoService_WatchToDos_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ToDoServiceServer).WatchToDos(m, &toDoServiceWatchToDosServer{stream})
+}
+
+type ToDoService_WatchToDosServer interface {
+	Send(*WatchResponse) error
+	grpc.ServerStream
+}
+
+type toDoServiceWatchToDosServer struct {
+	grpc.ServerStream
+}
+
+func (x *toDoServiceWatchToDosServer) Send(m *WatchResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _ToDoService_WatchReminders_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchRemindersRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ToDoServiceServer).WatchReminders(m, &toDoServiceWatchRemindersServer{stream})
+}
+
+type ToDoService_WatchRemindersServer interface {
+	Send(*WatchRemindersResponse) error
+	grpc.ServerStream
+}
+
+type toDoServiceWatchRemindersServer struct {
+	grpc.ServerStream
+}
+
+func (x *toDoServiceWatchRemindersServer) Send(m *WatchRemindersResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _ToDoService_ListTrash_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListTrashRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ToDoServiceServer).ListTrash(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/v1.ToDoService/ListTrash",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ToDoServiceServer).ListTrash(ctx, req.(*ListTrashRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ToDoService_Purge_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PurgeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ToDoServiceServer).Purge(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/v1.ToDoService/Purge",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ToDoServiceServer).Purge(ctx, req.(*PurgeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ToDoService_Restore_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RestoreRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ToDoServiceServer).Restore(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/v1.ToDoService/Restore",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ToDoServiceServer).Restore(ctx, req.(*RestoreRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _ToDoService_Create_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(CreateRequest)
 	if err := dec(in); err != nil {
@@ -168,6 +479,86 @@ func _ToDoService_Create_Handler(srv interface{}, ctx context.Context, dec func(
 	return interceptor(ctx, in, info, handler)
 }
 
+func _ToDoService_BatchCreate_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BatchCreateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ToDoServiceServer).BatchCreate(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/v1.ToDoService/BatchCreate",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ToDoServiceServer).BatchCreate(ctx, req.(*BatchCreateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ToDoService_BatchUpdate_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BatchUpdateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ToDoServiceServer).BatchUpdate(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/v1.ToDoService/BatchUpdate",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ToDoServiceServer).BatchUpdate(ctx, req.(*BatchUpdateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ToDoService_BatchDelete_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BatchDeleteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ToDoServiceServer).BatchDelete(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/v1.ToDoService/BatchDelete",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ToDoServiceServer).BatchDelete(ctx, req.(*BatchDeleteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ToDoService_ImportToDos_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(ToDoServiceServer).ImportToDos(&toDoServiceImportToDosServer{stream})
+}
+
+type ToDoService_ImportToDosServer interface {
+	SendAndClose(*ImportToDosResponse) error
+	Recv() (*ImportToDosRequest, error)
+	grpc.ServerStream
+}
+
+type toDoServiceImportToDosServer struct {
+	grpc.ServerStream
+}
+
+func (x *toDoServiceImportToDosServer) SendAndClose(m *ImportToDosResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *toDoServiceImportToDosServer) Recv() (*ImportToDosRequest, error) {
+	m := new(ImportToDosRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 func _ToDoService_Read_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(ReadRequest)
 	if err := dec(in); err != nil {
@@ -233,10 +624,34 @@ var ToDoService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "ReadAll",
 			Handler:    _ToDoService_ReadAll_Handler,
 		},
+		{
+			MethodName: "ListTrash",
+			Handler:    _ToDoService_ListTrash_Handler,
+		},
+		{
+			MethodName: "Purge",
+			Handler:    _ToDoService_Purge_Handler,
+		},
+		{
+			MethodName: "Restore",
+			Handler:    _ToDoService_Restore_Handler,
+		},
 		{
 			MethodName: "Create",
 			Handler:    _ToDoService_Create_Handler,
 		},
+		{
+			MethodName: "BatchCreate",
+			Handler:    _ToDoService_BatchCreate_Handler,
+		},
+		{
+			MethodName: "BatchUpdate",
+			Handler:    _ToDoService_BatchUpdate_Handler,
+		},
+		{
+			MethodName: "BatchDelete",
+			Handler:    _ToDoService_BatchDelete_Handler,
+		},
 		{
 			MethodName: "Read",
 			Handler:    _ToDoService_Read_Handler,
@@ -250,6 +665,22 @@ var ToDoService_ServiceDesc = grpc.ServiceDesc{
 			Handler:    _ToDoService_Delete_Handler,
 		},
 	},
-	Streams:  []grpc.StreamDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchToDos",
+			Handler:       _ToDoService_WatchToDos_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "WatchReminders",
+			Handler:       _ToDoService_WatchReminders_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "ImportToDos",
+			Handler:       _ToDoService_ImportToDos_Handler,
+			ClientStreams: true,
+		},
+	},
 	Metadata: "todo_service.proto",
 }
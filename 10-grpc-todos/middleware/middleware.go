@@ -1,15 +1,69 @@
 package middleware
 
 import (
-"github.com/grpc-ecosystem/go-grpc-middleware"
-"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap"
-"github.com/grpc-ecosystem/go-grpc-middleware/tags"
-"go.uber.org/zap"
-"go.uber.org/zap/zapcore"
-"google.golang.org/grpc"
-"google.golang.org/grpc/codes"
+	"context"
+	"runtime/debug"
+
+	"github.com/grpc-ecosystem/go-grpc-middleware/auth"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap"
+	"github.com/grpc-ecosystem/go-grpc-middleware/recovery"
+	"github.com/grpc-ecosystem/go-grpc-middleware/tags"
+	"github.com/grpc-ecosystem/go-grpc-prometheus"
+	"github.com/iproduct/coursego/10-grpc-todos/tracing"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
+// Chain configures interceptors of gRPC server.
+// Enabled interceptors run in order: tracing, metrics, logging, recovery, authentication, rate limiting.
+type Chain struct {
+	// Tracing turns on spans of calls continuing traces propagated in call metadata
+	Tracing bool
+	// Logger logs calls, recovered panics are logged by it too; nil disables call logging
+	Logger *zap.Logger
+	// Metrics turns on Prometheus request counters and latency histograms per method
+	Metrics bool
+	// Recovery converts panics of call handlers to codes.Internal errors
+	Recovery bool
+	// AuthFunc authenticates calls, nil disables authentication
+	AuthFunc grpc_auth.AuthFunc
+	// RateLimiter limits rate of calls, nil disables rate limiting
+	RateLimiter *RateLimiter
+}
+
+// ServerOptions returns grpc.Server config options installing the configured interceptors
+func (c Chain) ServerOptions() []grpc.ServerOption {
+	opts := []grpc.ServerOption{}
+	if c.Tracing {
+		opts = AddTracing(opts)
+	}
+	if c.Metrics {
+		opts = AddMetrics(opts)
+	}
+	if c.Logger != nil {
+		opts = AddLogging(c.Logger, opts)
+	}
+	if c.Recovery {
+		logger := c.Logger
+		if logger == nil {
+			logger = zap.NewNop()
+		}
+		opts = AddRecovery(logger, opts)
+	}
+	if c.AuthFunc != nil {
+		opts = AddAuth(c.AuthFunc, opts)
+	}
+	if c.RateLimiter != nil {
+		opts = AddRateLimit(c.RateLimiter, opts)
+	}
+	return opts
+}
+
 // codeToLevel redirects OK to DEBUG level logging instead of INFO
 // This is example how you can log several gRPC code results
 func codeToLevel(code codes.Code) zapcore.Level {
@@ -30,16 +84,85 @@ func AddLogging(logger *zap.Logger, opts []grpc.ServerOption) []grpc.ServerOptio
 	grpc_zap.ReplaceGrpcLoggerV2(logger)
 
 	// Add unary interceptor
-	opts = append(opts, grpc_middleware.WithUnaryServerChain(
+	opts = append(opts, grpc.ChainUnaryInterceptor(
 		grpc_ctxtags.UnaryServerInterceptor(grpc_ctxtags.WithFieldExtractor(grpc_ctxtags.CodeGenRequestFieldExtractor)),
 		grpc_zap.UnaryServerInterceptor(logger, o...),
 	))
 
 	// Add stream interceptor (added as an example here)
-	opts = append(opts, grpc_middleware.WithStreamServerChain(
+	opts = append(opts, grpc.ChainStreamInterceptor(
 		grpc_ctxtags.StreamServerInterceptor(grpc_ctxtags.WithFieldExtractor(grpc_ctxtags.CodeGenRequestFieldExtractor)),
 		grpc_zap.StreamServerInterceptor(logger, o...),
 	))
 
 	return opts
 }
+
+// AddTracing returns grpc.Server config options that run calls in spans continuing traces propagated in call metadata.
+// Request ID forwarded by the HTTP gateway is attached to the span.
+func AddTracing(opts []grpc.ServerOption) []grpc.ServerOption {
+	opts = append(opts, grpc.ChainUnaryInterceptor(
+		otelgrpc.UnaryServerInterceptor(),
+		func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			setRequestID(ctx)
+			return handler(ctx, req)
+		},
+	))
+	opts = append(opts, grpc.ChainStreamInterceptor(
+		otelgrpc.StreamServerInterceptor(),
+		func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			setRequestID(stream.Context())
+			return handler(srv, stream)
+		},
+	))
+	return opts
+}
+
+// setRequestID attaches request ID from incoming call metadata to the call span
+func setRequestID(ctx context.Context) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if ids := md.Get(tracing.RequestIDMetadata); len(ids) > 0 {
+		tracing.SetRequestID(ctx, ids[0])
+	}
+}
+
+// AddMetrics returns grpc.Server config options that count calls and measure their latency per method.
+// Metrics are registered in the default Prometheus registry, call grpc_prometheus.Register(server)
+// after registering services to initialize metrics of all methods.
+func AddMetrics(opts []grpc.ServerOption) []grpc.ServerOption {
+	grpc_prometheus.EnableHandlingTimeHistogram()
+	opts = append(opts, grpc.ChainUnaryInterceptor(grpc_prometheus.UnaryServerInterceptor))
+	opts = append(opts, grpc.ChainStreamInterceptor(grpc_prometheus.StreamServerInterceptor))
+	return opts
+}
+
+// AddRecovery returns grpc.Server config options that convert panics of call handlers to codes.Internal errors.
+// Panic value and stack are logged, but not sent to the client.
+func AddRecovery(logger *zap.Logger, opts []grpc.ServerOption) []grpc.ServerOption {
+	handler := grpc_recovery.WithRecoveryHandlerContext(func(ctx context.Context, p interface{}) error {
+		logger.Error("recovered from panic in gRPC call handler",
+			zap.Any("panic", p),
+			zap.ByteString("stack", debug.Stack()),
+		)
+		return status.Error(codes.Internal, "internal server error")
+	})
+	opts = append(opts, grpc.ChainUnaryInterceptor(grpc_recovery.UnaryServerInterceptor(handler)))
+	opts = append(opts, grpc.ChainStreamInterceptor(grpc_recovery.StreamServerInterceptor(handler)))
+	return opts
+}
+
+// AddAuth returns grpc.Server config options that reject calls not authenticated by authFunc.
+// Interceptors are chained after logging ones, so rejected calls are logged too.
+func AddAuth(authFunc grpc_auth.AuthFunc, opts []grpc.ServerOption) []grpc.ServerOption {
+	opts = append(opts, grpc.ChainUnaryInterceptor(grpc_auth.UnaryServerInterceptor(authFunc)))
+	opts = append(opts, grpc.ChainStreamInterceptor(grpc_auth.StreamServerInterceptor(authFunc)))
+	return opts
+}
+
+// AddRateLimit returns grpc.Server config options that reject calls exceeding the limiter rate
+// with codes.ResourceExhausted
+func AddRateLimit(limiter *RateLimiter, opts []grpc.ServerOption) []grpc.ServerOption {
+	opts = append(opts, grpc.ChainUnaryInterceptor(limiter.UnaryServerInterceptor()))
+	opts = append(opts, grpc.ChainStreamInterceptor(limiter.StreamServerInterceptor()))
+	return opts
+}
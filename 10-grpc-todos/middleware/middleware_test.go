@@ -0,0 +1,81 @@
+package middleware
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/iproduct/coursego/10-grpc-todos/auth"
+	"github.com/iproduct/coursego/10-grpc-todos/generated/todo_service"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// panickingServer panics reading ToDo with ID 13
+type panickingServer struct {
+	todo_service.UnimplementedToDoServiceServer
+}
+
+func (panickingServer) Read(ctx context.Context, req *todo_service.ReadRequest) (*todo_service.ReadResponse, error) {
+	if req.Id == 13 {
+		panic("unlucky ToDo")
+	}
+	return &todo_service.ReadResponse{Api: req.Api, ToDo: &todo_service.ToDo{Id: req.Id}}, nil
+}
+
+// dialChain starts server with interceptors of the chain and returns client connected to it
+func dialChain(t *testing.T, chain Chain) todo_service.ToDoServiceClient {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	server := grpc.NewServer(chain.ServerOptions()...)
+	todo_service.RegisterToDoServiceServer(server, panickingServer{})
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithInsecure())
+	if err != nil {
+		t.Fatalf("failed to dial server: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return todo_service.NewToDoServiceClient(conn)
+}
+
+func TestChain_ServerOptions(t *testing.T) {
+	secret := []byte("secret")
+	verifier, err := auth.NewHMACVerifier(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := dialChain(t, Chain{
+		Recovery:    true,
+		AuthFunc:    verifier.AuthFunc,
+		RateLimiter: NewRateLimiter(0.001, 3, KeyByUser),
+	})
+	token, _ := auth.SignHMAC(secret, "alice", time.Minute)
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token)
+
+	if _, err := client.Read(context.Background(), &todo_service.ReadRequest{Api: "v1", Id: 1}); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Read() without token error = %v, want Unauthenticated", err)
+	}
+	if _, err := client.Read(ctx, &todo_service.ReadRequest{Api: "v1", Id: 1}); err != nil {
+		t.Errorf("Read() error = %v", err)
+	}
+	// panic is converted to Internal error, and server keeps running
+	_, err = client.Read(ctx, &todo_service.ReadRequest{Api: "v1", Id: 13})
+	if st := status.Convert(err); st.Code() != codes.Internal || st.Message() != "internal server error" {
+		t.Errorf("Read() panicking error = %v, want Internal", err)
+	}
+	if _, err := client.Read(ctx, &todo_service.ReadRequest{Api: "v1", Id: 2}); err != nil {
+		t.Errorf("Read() after panic error = %v", err)
+	}
+	// burst of 3 calls is used up, and the bucket refills slowly
+	if _, err := client.Read(ctx, &todo_service.ReadRequest{Api: "v1", Id: 3}); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("Read() over rate limit error = %v, want ResourceExhausted", err)
+	}
+}
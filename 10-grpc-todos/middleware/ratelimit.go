@@ -0,0 +1,156 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/iproduct/coursego/10-grpc-todos/auth"
+	"golang.org/x/time/rate"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// RateLimitByPeer limits calls per client network address
+	RateLimitByPeer = "peer"
+	// RateLimitByUser limits calls per authenticated user (per peer for unauthenticated calls)
+	RateLimitByUser = "user"
+)
+
+// KeyFunc returns key of the call's token bucket
+type KeyFunc func(ctx context.Context) string
+
+// KeyByPeer returns client host of the call.
+// Calls from grpc-gateway all come from the gateway host, so limit them by user instead.
+func KeyByPeer(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	addr := p.Addr.String()
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+// KeyByUser returns authenticated user of the call, or client host if it is not authenticated
+func KeyByUser(ctx context.Context) string {
+	if owner, ok := auth.Owner(ctx); ok {
+		return "user:" + owner
+	}
+	return "peer:" + KeyByPeer(ctx)
+}
+
+// bucket is token bucket of single key
+type bucket struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// RateLimiter limits rate of calls separately for each key using token buckets.
+// Buckets idle long enough to refill completely are dropped, as new bucket behaves the same.
+type RateLimiter struct {
+	limit rate.Limit
+	burst int
+	key   KeyFunc
+	now   func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+// NewRateLimiter creates limiter allowing perSecond calls per key on average, with bursts up to burst calls
+func NewRateLimiter(perSecond float64, burst int, key KeyFunc) *RateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimiter{
+		limit:   rate.Limit(perSecond),
+		burst:   burst,
+		key:     key,
+		now:     time.Now,
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// NewRateLimiterKeyedBy creates limiter using RateLimitByPeer or RateLimitByUser keys
+func NewRateLimiterKeyedBy(keyBy string, perSecond float64, burst int) (*RateLimiter, error) {
+	switch keyBy {
+	case RateLimitByPeer:
+		return NewRateLimiter(perSecond, burst, KeyByPeer), nil
+	case RateLimitByUser:
+		return NewRateLimiter(perSecond, burst, KeyByUser), nil
+	default:
+		return nil, fmt.Errorf("unsupported rate limit key: '%s'", keyBy)
+	}
+}
+
+// Allow takes token from the bucket of the call's key, returns false if the bucket is empty
+func (l *RateLimiter) Allow(ctx context.Context) bool {
+	key := l.key(ctx)
+	now := l.now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sweep(now)
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{limiter: rate.NewLimiter(l.limit, l.burst)}
+		l.buckets[key] = b
+	}
+	b.lastSeen = now
+	return b.limiter.AllowN(now, 1)
+}
+
+// sweep drops buckets which have refilled completely, at most once per refill time; must be called with lock held
+func (l *RateLimiter) sweep(now time.Time) {
+	if l.limit <= 0 {
+		return
+	}
+	refill := time.Duration(float64(l.burst) / float64(l.limit) * float64(time.Second))
+	if now.Sub(l.lastSweep) < refill {
+		return
+	}
+	l.lastSweep = now
+	for key, b := range l.buckets {
+		if now.Sub(b.lastSeen) >= refill {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// check returns codes.ResourceExhausted error if the call exceeds the rate
+func (l *RateLimiter) check(ctx context.Context, method string) error {
+	if !l.Allow(ctx) {
+		return status.Errorf(codes.ResourceExhausted, "%s is rejected by rate limiter, retry later", method)
+	}
+	return nil
+}
+
+// UnaryServerInterceptor returns interceptor rejecting unary calls which exceed the rate
+func (l *RateLimiter) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := l.check(ctx, info.FullMethod); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor returns interceptor rejecting stream calls which exceed the rate.
+// Only opening of the stream takes token, not its messages.
+func (l *RateLimiter) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := l.check(stream.Context(), info.FullMethod); err != nil {
+			return err
+		}
+		return handler(srv, stream)
+	}
+}
@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/iproduct/coursego/10-grpc-todos/auth"
+	"google.golang.org/grpc/peer"
+)
+
+// peerContext returns context of call from the addr
+func peerContext(addr string) context.Context {
+	tcpAddr, _ := net.ResolveTCPAddr("tcp", addr)
+	return peer.NewContext(context.Background(), &peer.Peer{Addr: tcpAddr})
+}
+
+func TestRateLimiter_Allow(t *testing.T) {
+	now := time.Unix(1000, 0)
+	l := NewRateLimiter(1, 2, KeyByPeer)
+	l.now = func() time.Time { return now }
+	first, second := peerContext("10.0.0.1:5000"), peerContext("10.0.0.2:5000")
+
+	// burst is allowed at once, then bucket is empty
+	for i, want := range []bool{true, true, false} {
+		if got := l.Allow(first); got != want {
+			t.Errorf("Allow() call %d = %v, want %v", i, got, want)
+		}
+	}
+	// other port of the same host shares the bucket
+	if l.Allow(peerContext("10.0.0.1:6000")) {
+		t.Errorf("Allow() from other port of limited host = true, want false")
+	}
+	// other hosts have own buckets
+	if !l.Allow(second) {
+		t.Errorf("Allow() from other host = false, want true")
+	}
+
+	// bucket refills at the limit rate
+	now = now.Add(time.Second)
+	if !l.Allow(first) || l.Allow(first) {
+		t.Errorf("Allow() after 1s should allow exactly one call")
+	}
+
+	// idle buckets are dropped after they refill
+	now = now.Add(3 * time.Second)
+	l.Allow(second)
+	if _, ok := l.buckets["10.0.0.1"]; ok || len(l.buckets) != 1 {
+		t.Errorf("buckets after sweep = %v, want only 10.0.0.2", l.buckets)
+	}
+}
+
+func TestKeyByUser(t *testing.T) {
+	ctx := peerContext("10.0.0.1:5000")
+	if got := KeyByUser(ctx); got != "peer:10.0.0.1" {
+		t.Errorf("KeyByUser() without owner = %q, want %q", got, "peer:10.0.0.1")
+	}
+	if got := KeyByUser(auth.WithOwner(ctx, "alice")); got != "user:alice" {
+		t.Errorf("KeyByUser() = %q, want %q", got, "user:alice")
+	}
+}
+
+func TestNewRateLimiterKeyedBy(t *testing.T) {
+	for _, keyBy := range []string{RateLimitByPeer, RateLimitByUser} {
+		if _, err := NewRateLimiterKeyedBy(keyBy, 1, 1); err != nil {
+			t.Errorf("NewRateLimiterKeyedBy(%q) error = %v", keyBy, err)
+		}
+	}
+	if _, err := NewRateLimiterKeyedBy("method", 1, 1); err == nil {
+		t.Errorf("NewRateLimiterKeyedBy(%q) error = nil, want error", "method")
+	}
+}
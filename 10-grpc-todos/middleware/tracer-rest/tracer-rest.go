@@ -5,6 +5,7 @@ import (
 	"crypto/rand"
 	"encoding/base64"
 	"fmt"
+	"github.com/iproduct/coursego/10-grpc-todos/tracing"
 	"net/http"
 	"os"
 	"strings"
@@ -48,12 +49,14 @@ func init() {
 // request. A request ID is a string of the form "host.example.com/random-0001",
 // where "random" is a base62 random string that uniquely identifies this go
 // process, and where the last number is an atomically incremented request
-// counter.
+// counter. The request ID is attached to the request span too, if the request is traced.
 func AddRequestID(h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		myid := atomic.AddUint64(&reqID, 1)
 		ctx := r.Context()
-		ctx = context.WithValue(ctx, RequestIDKey, fmt.Sprintf("%s-%06d", prefix, myid))
+		id := fmt.Sprintf("%s-%06d", prefix, myid)
+		ctx = context.WithValue(ctx, RequestIDKey, id)
+		tracing.SetRequestID(ctx, id)
 		h.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
@@ -0,0 +1,42 @@
+package reminder
+
+import "time"
+
+// Clock provides current time and timers, so the scheduler can be driven by a fake clock in tests
+type Clock interface {
+	// Now returns current time
+	Now() time.Time
+	// NewTimer creates timer firing after duration d
+	NewTimer(d time.Duration) Timer
+}
+
+// Timer is a single event timer created by Clock
+type Timer interface {
+	// C returns channel receiving the time when timer fires
+	C() <-chan time.Time
+	// Stop prevents the timer from firing
+	Stop() bool
+}
+
+// SystemClock is Clock using the real time
+type SystemClock struct{}
+
+// Now returns current time
+func (SystemClock) Now() time.Time {
+	return time.Now()
+}
+
+// NewTimer creates real timer firing after duration d
+func (SystemClock) NewTimer(d time.Duration) Timer {
+	return systemTimer{time.NewTimer(d)}
+}
+
+// systemTimer adapts time.Timer to Timer interface
+type systemTimer struct {
+	*time.Timer
+}
+
+// C returns channel receiving the time when timer fires
+func (t systemTimer) C() <-chan time.Time {
+	return t.Timer.C
+}
@@ -0,0 +1,158 @@
+package reminder
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/iproduct/coursego/10-grpc-todos/generated/todo_service"
+	"go.uber.org/zap"
+)
+
+// Reminder is fired ToDo reminder
+type Reminder struct {
+	// ToDo which reminder was fired
+	ToDo *todo_service.ToDo
+	// FiredAt is time when the reminder was fired
+	FiredAt time.Time
+}
+
+// Notifier delivers fired reminders
+type Notifier interface {
+	// Notify delivers the reminder
+	Notify(ctx context.Context, r Reminder) error
+}
+
+// MultiNotifier delivers reminders using all its notifiers
+type MultiNotifier []Notifier
+
+// Notify delivers the reminder using all notifiers and returns the first error
+func (m MultiNotifier) Notify(ctx context.Context, r Reminder) error {
+	var first error
+	for _, n := range m {
+		if err := n.Notify(ctx, r); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// LogNotifier writes fired reminders to the log
+type LogNotifier struct {
+	Log *zap.Logger
+}
+
+// Notify logs the reminder
+func (n LogNotifier) Notify(ctx context.Context, r Reminder) error {
+	n.Log.Info("reminder fired",
+		zap.Int64("id", r.ToDo.Id),
+		zap.String("title", r.ToDo.Title),
+		zap.Time("reminder", r.ToDo.Reminder.AsTime()),
+		zap.Time("fired-at", r.FiredAt),
+	)
+	return nil
+}
+
+// WebhookNotifier posts fired reminders as JSON to an HTTP endpoint (usually local service)
+type WebhookNotifier struct {
+	url    string
+	client *http.Client
+}
+
+// webhookPayload is JSON body posted by WebhookNotifier
+type webhookPayload struct {
+	ID          int64     `json:"id"`
+	OwnerID     string    `json:"ownerId"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	Reminder    time.Time `json:"reminder"`
+	FiredAt     time.Time `json:"firedAt"`
+}
+
+// NewWebhookNotifier creates notifier posting reminders to given http(s) URL
+func NewWebhookNotifier(rawURL string) (*WebhookNotifier, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid webhook URL: '%s'", rawURL)
+	}
+	return &WebhookNotifier{url: rawURL, client: &http.Client{Timeout: 5 * time.Second}}, nil
+}
+
+// Notify posts the reminder to the webhook URL
+func (n *WebhookNotifier) Notify(ctx context.Context, r Reminder) error {
+	body, err := json.Marshal(webhookPayload{
+		ID:          r.ToDo.Id,
+		OwnerID:     r.ToDo.OwnerId,
+		Title:       r.ToDo.Title,
+		Description: r.ToDo.Description,
+		Reminder:    r.ToDo.Reminder.AsTime(),
+		FiredAt:     r.FiredAt,
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post reminder to webhook-> %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook responded with status %s", resp.Status)
+	}
+	return nil
+}
+
+// streamBuffer is number of reminders queued for a stream subscriber before new ones are dropped
+const streamBuffer = 16
+
+// StreamNotifier fans out fired reminders to subscribed gRPC streams
+type StreamNotifier struct {
+	mu   sync.Mutex
+	subs map[chan Reminder]struct{}
+}
+
+// NewStreamNotifier creates notifier without subscribers
+func NewStreamNotifier() *StreamNotifier {
+	return &StreamNotifier{subs: make(map[chan Reminder]struct{})}
+}
+
+// Subscribe returns channel receiving fired reminders and function ending the subscription
+func (n *StreamNotifier) Subscribe() (<-chan Reminder, func()) {
+	ch := make(chan Reminder, streamBuffer)
+	n.mu.Lock()
+	n.subs[ch] = struct{}{}
+	n.mu.Unlock()
+	return ch, func() {
+		n.mu.Lock()
+		delete(n.subs, ch)
+		n.mu.Unlock()
+	}
+}
+
+// Notify sends the reminder to all subscribers, skipping those which buffers are full
+func (n *StreamNotifier) Notify(ctx context.Context, r Reminder) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	dropped := 0
+	for ch := range n.subs {
+		select {
+		case ch <- r:
+		default:
+			dropped++
+		}
+	}
+	if dropped > 0 {
+		return fmt.Errorf("reminder for ToDo %d dropped for %d slow stream subscribers", r.ToDo.Id, dropped)
+	}
+	return nil
+}
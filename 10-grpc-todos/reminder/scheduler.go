@@ -0,0 +1,264 @@
+package reminder
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/iproduct/coursego/10-grpc-todos/events"
+	"github.com/iproduct/coursego/10-grpc-todos/generated/todo_service"
+	"github.com/iproduct/coursego/10-grpc-todos/store"
+	"go.uber.org/zap"
+)
+
+// loadPageSize is number of ToDos read from the store at once when loading upcoming reminders
+const loadPageSize = 500
+
+// item is scheduled reminder
+type item struct {
+	todo  *todo_service.ToDo
+	when  time.Time
+	index int
+}
+
+// queue is min-heap of reminders ordered by their time
+type queue []*item
+
+func (q queue) Len() int { return len(q) }
+func (q queue) Less(i, j int) bool {
+	if q[i].when.Equal(q[j].when) {
+		return q[i].todo.Id < q[j].todo.Id
+	}
+	return q[i].when.Before(q[j].when)
+}
+func (q queue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+func (q *queue) Push(x interface{}) {
+	it := x.(*item)
+	it.index = len(*q)
+	*q = append(*q, it)
+}
+func (q *queue) Pop() interface{} {
+	old := *q
+	it := old[len(old)-1]
+	old[len(old)-1] = nil
+	*q = old[:len(old)-1]
+	return it
+}
+
+// Scheduler fires ToDo reminders at their due time.
+// Upcoming reminders are loaded from the store on start and kept up to date
+// by following ToDo change events, so the schedule survives server restarts.
+type Scheduler struct {
+	store    store.ToDoStore
+	broker   *events.Broker
+	notifier Notifier
+	clock    Clock
+	log      *zap.Logger
+
+	mu    sync.Mutex
+	queue queue
+	items map[int64]*item
+}
+
+// NewScheduler creates reminder scheduler delivering fired reminders through notifier
+func NewScheduler(st store.ToDoStore, broker *events.Broker, notifier Notifier, clock Clock, logger *zap.Logger) *Scheduler {
+	return &Scheduler{
+		store:    st,
+		broker:   broker,
+		notifier: notifier,
+		clock:    clock,
+		log:      logger,
+		items:    make(map[int64]*item),
+	}
+}
+
+// Scheduled returns time when reminder of ToDo with given ID is going to fire, if it is scheduled
+func (s *Scheduler) Scheduled(id int64) (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	it, ok := s.items[id]
+	if !ok {
+		return time.Time{}, false
+	}
+	return it.when, true
+}
+
+// Run loads upcoming reminders and fires them until the context is cancelled
+func (s *Scheduler) Run(ctx context.Context) error {
+	// subscribe before loading, so changes made meanwhile are not missed
+	sub, err := s.broker.Subscribe(0)
+	if err != nil {
+		return err
+	}
+	defer func() { sub.Close() }()
+	revision := s.broker.Revision()
+	if err := s.load(ctx); err != nil {
+		return err
+	}
+
+	for {
+		var timer Timer
+		var fire <-chan time.Time
+		if next, ok := s.next(); ok {
+			timer = s.clock.NewTimer(next.Sub(s.clock.Now()))
+			fire = timer.C()
+		}
+
+		select {
+		case <-ctx.Done():
+			if timer != nil {
+				timer.Stop()
+			}
+			return nil
+		case ev, ok := <-sub.Events():
+			if ok {
+				revision = ev.Revision
+				s.apply(ev)
+				break
+			}
+			// dropped as too slow - resume from the last seen revision or reload everything
+			s.log.Warn("reminder scheduler fell behind ToDo changes", zap.Error(sub.Err()))
+			if sub, err = s.broker.Subscribe(revision); errors.Is(err, events.ErrCompacted) {
+				if sub, err = s.broker.Subscribe(0); err != nil {
+					return err
+				}
+				revision = s.broker.Revision()
+				err = s.load(ctx)
+			}
+			if err != nil {
+				return err
+			}
+		case <-fire:
+			s.fireDue(ctx)
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+// load replaces scheduled reminders with upcoming reminders read from the store
+func (s *Scheduler) load(ctx context.Context) error {
+	now := s.clock.Now()
+	s.mu.Lock()
+	s.queue = nil
+	s.items = make(map[int64]*item)
+	s.mu.Unlock()
+
+	q := store.Query{ReminderFrom: &now, OrderBy: store.OrderByReminder, Limit: loadPageSize}
+	for {
+		list, total, err := s.store.ReadAll(ctx, q)
+		if err != nil {
+			return fmt.Errorf("failed to load reminders-> %w", err)
+		}
+		for _, td := range list {
+			s.schedule(td, now)
+		}
+		q.Offset += len(list)
+		if len(list) == 0 || int64(q.Offset) >= total {
+			break
+		}
+	}
+	s.mu.Lock()
+	scheduled := len(s.items)
+	s.mu.Unlock()
+	s.log.Info("reminders loaded", zap.Int("scheduled", scheduled))
+	return nil
+}
+
+// apply updates the schedule according to ToDo change
+func (s *Scheduler) apply(ev *todo_service.ToDoEvent) {
+	switch ev.Type {
+	case todo_service.ToDoEvent_CREATED, todo_service.ToDoEvent_UPDATED, todo_service.ToDoEvent_RESTORED:
+		s.schedule(ev.ToDo, s.clock.Now())
+	case todo_service.ToDoEvent_DELETED:
+		s.cancel(ev.ToDo.Id)
+	}
+}
+
+// schedule adds or moves reminder of the ToDo, reminders in the past are cancelled
+func (s *Scheduler) schedule(td *todo_service.ToDo, now time.Time) {
+	if td.Reminder == nil || td.Reminder.AsTime().Before(now) {
+		s.cancel(td.Id)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	when := td.Reminder.AsTime()
+	if it, ok := s.items[td.Id]; ok {
+		it.todo, it.when = td, when
+		heap.Fix(&s.queue, it.index)
+		return
+	}
+	it := &item{todo: td, when: when}
+	heap.Push(&s.queue, it)
+	s.items[td.Id] = it
+}
+
+// cancel removes reminder of the ToDo with given ID
+func (s *Scheduler) cancel(id int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if it, ok := s.items[id]; ok {
+		heap.Remove(&s.queue, it.index)
+		delete(s.items, id)
+	}
+}
+
+// next returns time of the earliest scheduled reminder
+func (s *Scheduler) next() (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.queue) == 0 {
+		return time.Time{}, false
+	}
+	return s.queue[0].when, true
+}
+
+// fireDue delivers all reminders which time has come
+func (s *Scheduler) fireDue(ctx context.Context) {
+	now := s.clock.Now()
+	for {
+		s.mu.Lock()
+		if len(s.queue) == 0 || s.queue[0].when.After(now) {
+			s.mu.Unlock()
+			return
+		}
+		it := heap.Pop(&s.queue).(*item)
+		delete(s.items, it.todo.Id)
+		s.mu.Unlock()
+
+		if err := s.notifier.Notify(ctx, Reminder{ToDo: it.todo, FiredAt: now}); err != nil {
+			s.log.Error("failed to deliver reminder", zap.Int64("id", it.todo.Id), zap.Error(err))
+		}
+	}
+}
+
+// Start runs reminder scheduler in background until the context is cancelled.
+// Fired reminders are logged, posted to webhookURL (if not empty) and sent to the returned stream notifier.
+func Start(ctx context.Context, st store.ToDoStore, broker *events.Broker, webhookURL string, logger *zap.Logger) (*StreamNotifier, error) {
+	stream := NewStreamNotifier()
+	notifiers := MultiNotifier{LogNotifier{Log: logger}, stream}
+	if webhookURL != "" {
+		webhook, err := NewWebhookNotifier(webhookURL)
+		if err != nil {
+			return nil, err
+		}
+		notifiers = append(notifiers, webhook)
+	}
+
+	scheduler := NewScheduler(st, broker, notifiers, SystemClock{}, logger)
+	go func() {
+		if err := scheduler.Run(ctx); err != nil {
+			logger.Error("reminder scheduler stopped", zap.Error(err))
+		}
+	}()
+	return stream, nil
+}
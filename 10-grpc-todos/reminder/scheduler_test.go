@@ -0,0 +1,236 @@
+package reminder
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/iproduct/coursego/10-grpc-todos/events"
+	"github.com/iproduct/coursego/10-grpc-todos/generated/todo_service"
+	"github.com/iproduct/coursego/10-grpc-todos/store"
+	"go.uber.org/zap"
+)
+
+// fakeClock is Clock which time moves only when advanced by the test
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+type fakeTimer struct {
+	clock *fakeClock
+	when  time.Time
+	c     chan time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) NewTimer(d time.Duration) Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &fakeTimer{clock: c, when: c.now.Add(d), c: make(chan time.Time, 1)}
+	if d <= 0 {
+		t.c <- c.now
+	} else {
+		c.timers = append(c.timers, t)
+	}
+	return t
+}
+
+// Advance moves the time forward and fires due timers
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	pending := c.timers[:0]
+	for _, t := range c.timers {
+		if t.when.After(c.now) {
+			pending = append(pending, t)
+		} else {
+			t.c <- c.now
+		}
+	}
+	c.timers = pending
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	for i, other := range t.clock.timers {
+		if other == t {
+			t.clock.timers = append(t.clock.timers[:i], t.clock.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// recorder is Notifier collecting fired reminders
+type recorder struct {
+	fired chan Reminder
+}
+
+func (r *recorder) Notify(ctx context.Context, rem Reminder) error {
+	r.fired <- rem
+	return nil
+}
+
+// expectFired waits for reminder of the ToDo with given ID
+func (r *recorder) expectFired(t *testing.T, id int64) Reminder {
+	t.Helper()
+	select {
+	case rem := <-r.fired:
+		if rem.ToDo.Id != id {
+			t.Fatalf("fired reminder for ToDo %d, want %d", rem.ToDo.Id, id)
+		}
+		return rem
+	case <-time.After(time.Second):
+		t.Fatalf("reminder for ToDo %d was not fired", id)
+	}
+	return Reminder{}
+}
+
+// expectNone checks no reminder was fired
+func (r *recorder) expectNone(t *testing.T) {
+	t.Helper()
+	select {
+	case rem := <-r.fired:
+		t.Fatalf("unexpected reminder for ToDo %d", rem.ToDo.Id)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+// waitScheduled waits until the scheduler has reminder of the ToDo scheduled at given time (or not at all if zero)
+func waitScheduled(t *testing.T, s *Scheduler, id int64, want time.Time) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		when, ok := s.Scheduled(id)
+		if (want.IsZero() && !ok) || (ok && when.Equal(want)) {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("reminder for ToDo %d is not scheduled at %v", id, want)
+}
+
+type fixture struct {
+	clock     *fakeClock
+	store     store.ToDoStore
+	broker    *events.Broker
+	scheduler *Scheduler
+	notifier  *recorder
+}
+
+func newFixture(start time.Time) *fixture {
+	f := &fixture{
+		clock:    &fakeClock{now: start},
+		store:    store.NewMemoryStore(),
+		broker:   events.NewBroker(events.DefaultHistorySize),
+		notifier: &recorder{fired: make(chan Reminder, 10)},
+	}
+	f.scheduler = NewScheduler(f.store, f.broker, f.notifier, f.clock, zap.NewNop())
+	return f
+}
+
+// create stores ToDo with given reminder and publishes the change like the ToDo service does
+func (f *fixture) create(t *testing.T, title string, reminder time.Time) *todo_service.ToDo {
+	ts, _ := ptypes.TimestampProto(reminder)
+	td := &todo_service.ToDo{Title: title, Reminder: ts}
+	id, err := f.store.Create(context.Background(), td)
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	td.Id = id
+	f.broker.Publish(todo_service.ToDoEvent_CREATED, td)
+	return td
+}
+
+func (f *fixture) start(t *testing.T) func() {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- f.scheduler.Run(ctx) }()
+	return func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("Run() error = %v", err)
+		}
+	}
+}
+
+func TestScheduler_LoadsAndFiresInOrder(t *testing.T) {
+	start := time.Date(2022, 1, 10, 9, 0, 0, 0, time.UTC)
+	f := newFixture(start)
+	past := f.create(t, "past", start.Add(-time.Minute))
+	later := f.create(t, "later", start.Add(2*time.Hour))
+	sooner := f.create(t, "sooner", start.Add(time.Hour))
+
+	// reminders stored before start (e.g. before server restart) are loaded from the store
+	stop := f.start(t)
+	defer stop()
+	waitScheduled(t, f.scheduler, later.Id, start.Add(2*time.Hour))
+	waitScheduled(t, f.scheduler, sooner.Id, start.Add(time.Hour))
+	waitScheduled(t, f.scheduler, past.Id, time.Time{})
+
+	f.clock.Advance(59 * time.Minute)
+	f.notifier.expectNone(t)
+	f.clock.Advance(time.Minute)
+	rem := f.notifier.expectFired(t, sooner.Id)
+	if !rem.FiredAt.Equal(start.Add(time.Hour)) {
+		t.Errorf("FiredAt = %v, want %v", rem.FiredAt, start.Add(time.Hour))
+	}
+	f.clock.Advance(time.Hour)
+	f.notifier.expectFired(t, later.Id)
+	f.notifier.expectNone(t)
+}
+
+func TestScheduler_FollowsChanges(t *testing.T) {
+	start := time.Date(2022, 1, 10, 9, 0, 0, 0, time.UTC)
+	f := newFixture(start)
+	stop := f.start(t)
+	defer stop()
+
+	moved := f.create(t, "moved", start.Add(time.Hour))
+	deleted := f.create(t, "deleted", start.Add(time.Hour))
+	waitScheduled(t, f.scheduler, moved.Id, start.Add(time.Hour))
+	waitScheduled(t, f.scheduler, deleted.Id, start.Add(time.Hour))
+
+	// Update moves the reminder, Delete cancels it
+	moved.Reminder, _ = ptypes.TimestampProto(start.Add(3 * time.Hour))
+	f.broker.Publish(todo_service.ToDoEvent_UPDATED, moved)
+	f.broker.Publish(todo_service.ToDoEvent_DELETED, deleted)
+	waitScheduled(t, f.scheduler, moved.Id, start.Add(3*time.Hour))
+	waitScheduled(t, f.scheduler, deleted.Id, time.Time{})
+
+	f.clock.Advance(2 * time.Hour)
+	f.notifier.expectNone(t)
+	f.clock.Advance(time.Hour)
+	f.notifier.expectFired(t, moved.Id)
+}
+
+func TestStreamNotifier(t *testing.T) {
+	n := NewStreamNotifier()
+	ch, cancel := n.Subscribe()
+	rem := Reminder{ToDo: &todo_service.ToDo{Id: 1}, FiredAt: time.Now()}
+	if err := n.Notify(context.Background(), rem); err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+	if got := <-ch; got.ToDo.Id != 1 {
+		t.Errorf("received reminder for ToDo %d, want 1", got.ToDo.Id)
+	}
+	cancel()
+	if err := n.Notify(context.Background(), rem); err != nil || len(ch) != 0 {
+		t.Errorf("Notify() after cancel delivered reminder, error = %v", err)
+	}
+}
@@ -7,9 +7,13 @@ import (
 	logger_grpc "github.com/iproduct/coursego/10-grpc-todos/middleware/logger-grpc"
 	logger_rest "github.com/iproduct/coursego/10-grpc-todos/middleware/logger-rest"
 	tracer_rest "github.com/iproduct/coursego/10-grpc-todos/middleware/tracer-rest"
+	"github.com/iproduct/coursego/10-grpc-todos/tracing"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
 	"log"
 	"net/http"
 	"os"
@@ -17,24 +21,52 @@ import (
 	"time"
 )
 
+// forwardRequestID returns request ID as gRPC metadata, so the gRPC server can attach it to its spans
+func forwardRequestID(ctx context.Context, _ *http.Request) metadata.MD {
+	if id := tracer_rest.GetReqID(ctx); id != "" {
+		return metadata.Pairs(tracing.RequestIDMetadata, id)
+	}
+	return nil
+}
+
+// spanName names HTTP request span by method and path
+func spanName(_ string, r *http.Request) string {
+	return r.Method + " " + r.URL.Path
+}
+
+// NewHandler returns HTTP gateway handler with middleware, calling gRPC server at endpoint.
+// Each request runs in span, which is propagated to the gRPC server in call metadata.
+func NewHandler(ctx context.Context, logger *zap.Logger, endpoint string, opts ...grpc.DialOption) (http.Handler, error) {
+	// Authorization header is forwarded by the gateway as "authorization" gRPC metadata
+	mux := runtime.NewServeMux(runtime.WithMetadata(forwardRequestID))
+	opts = append(opts,
+		grpc.WithChainUnaryInterceptor(otelgrpc.UnaryClientInterceptor()),
+		grpc.WithChainStreamInterceptor(otelgrpc.StreamClientInterceptor()),
+	)
+	if err := todo_service.RegisterToDoServiceHandlerFromEndpoint(ctx, mux, endpoint, opts); err != nil {
+		return nil, err
+	}
+	return otelhttp.NewHandler(
+		tracer_rest.AddRequestID(
+			logger_rest.AddLogger(logger, mux)),
+		"rest-server", otelhttp.WithSpanNameFormatter(spanName)), nil
+}
+
 // RunServer runs HTTP/REST gateway
 func RunServer(ctx context.Context, grpcPort, httpPort string) error {
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
-	mux := runtime.NewServeMux()
-	opts := []grpc.DialOption{grpc.WithInsecure()}
-	if err := todo_service.RegisterToDoServiceHandlerFromEndpoint(ctx, mux, "localhost:"+grpcPort, opts); err != nil {
+	handler, err := NewHandler(ctx, logger_grpc.Log, "localhost:"+grpcPort, grpc.WithInsecure())
+	if err != nil {
 		//log.Fatalf("failed to start HTTP gateway: %v", err)
 		logger_grpc.Log.Fatal("failed to start HTTP gateway", zap.String("reason", err.Error()))
 	}
 
 	srv := &http.Server{
-		Addr:    ":" + httpPort,
-		//Handler: mux,
+		Addr: ":" + httpPort,
 		// add handler with middleware
-		Handler: tracer_rest.AddRequestID(
-			logger_rest.AddLogger(logger_grpc.Log, mux)),
+		Handler: handler,
 	}
 
 	// graceful shutdown
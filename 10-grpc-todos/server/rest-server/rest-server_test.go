@@ -0,0 +1,108 @@
+package rest_server
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/iproduct/coursego/10-grpc-todos/auth"
+	"github.com/iproduct/coursego/10-grpc-todos/events"
+	"github.com/iproduct/coursego/10-grpc-todos/generated/todo_service"
+	"github.com/iproduct/coursego/10-grpc-todos/middleware"
+	"github.com/iproduct/coursego/10-grpc-todos/service"
+	"github.com/iproduct/coursego/10-grpc-todos/store"
+	"github.com/iproduct/coursego/10-grpc-todos/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/test/bufconn"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+// requestID returns request ID attribute of the span
+func requestID(span sdktrace.ReadOnlySpan) string {
+	for _, attr := range span.Attributes() {
+		if attr.Key == tracing.RequestIDKey {
+			return attr.Value.AsString()
+		}
+	}
+	return ""
+}
+
+func TestNewHandler_Tracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	// gRPC server using SQL store
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	secret := []byte("secret")
+	verifier, _ := auth.NewHMACVerifier(secret)
+	lis := bufconn.Listen(1 << 20)
+	server := grpc.NewServer(middleware.Chain{Tracing: true, AuthFunc: verifier.AuthFunc}.ServerOptions()...)
+	todo_service.RegisterToDoServiceServer(server,
+		service.NewToDoServiceServer(store.NewSQLStore(db), events.NewBroker(events.DefaultHistorySize), nil))
+	go server.Serve(lis)
+	defer server.Stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	handler, err := NewHandler(ctx, zap.NewNop(), "bufnet", grpc.WithInsecure(),
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }))
+	if err != nil {
+		t.Fatalf("NewHandler() error = %v", err)
+	}
+
+	rows := sqlmock.NewRows([]string{"id", "title", "description", "reminder", "owner_id", "version", "deleted_at"}).
+		AddRow(1, "title", "description", time.Now().In(time.UTC), "alice", 1, nil)
+	mock.ExpectQuery("SELECT (.+) FROM ToDo").WithArgs(1, "alice").WillReturnRows(rows)
+
+	token, _ := auth.SignHMAC(secret, "alice", time.Minute)
+	req := httptest.NewRequest(http.MethodGet, "/v1/todo/1?api=v1", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, req)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("GET /v1/todo/1 status = %d, body = %s", resp.Code, resp.Body)
+	}
+
+	// spans of all tiers belong to single trace
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		spans[span.SpanKind().String()+" "+span.Name()] = span
+	}
+	httpSpan := spans["server GET /v1/todo/1"]
+	grpcSpan := spans["server v1.ToDoService/Read"]
+	sqlSpan := spans["client sql.Query"]
+	if httpSpan == nil || grpcSpan == nil || sqlSpan == nil {
+		t.Fatalf("recorded spans = %v, want HTTP, gRPC and SQL spans", spans)
+	}
+	traceID := httpSpan.SpanContext().TraceID()
+	for _, span := range []sdktrace.ReadOnlySpan{grpcSpan, sqlSpan} {
+		if span.SpanContext().TraceID() != traceID {
+			t.Errorf("span %q trace ID = %s, want %s", span.Name(), span.SpanContext().TraceID(), traceID)
+		}
+	}
+	if sqlSpan.Parent().SpanID() != grpcSpan.SpanContext().SpanID() {
+		t.Errorf("SQL span parent = %s, want gRPC server span %s", sqlSpan.Parent().SpanID(), grpcSpan.SpanContext().SpanID())
+	}
+
+	// request ID is attached to HTTP and gRPC server spans
+	id := requestID(httpSpan)
+	if id == "" {
+		t.Errorf("HTTP span has no request ID")
+	}
+	if got := requestID(grpcSpan); got != id {
+		t.Errorf("gRPC span request ID = %q, want %q", got, id)
+	}
+}
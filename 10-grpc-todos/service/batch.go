@@ -0,0 +1,300 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/iproduct/coursego/10-grpc-todos/generated/todo_service"
+	"github.com/iproduct/coursego/10-grpc-todos/store"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// maxBatchSize is maximum number of items in single batch request
+	maxBatchSize = 1000
+	// importChunkSize is number of imported ToDos committed in single transaction
+	importChunkSize = 500
+)
+
+// batchErrors collects failures of batch items
+type batchErrors []*todo_service.BatchItemError
+
+// add records failure of the item at index
+func (b *batchErrors) add(index int, id int64, code codes.Code, message string) {
+	*b = append(*b, &todo_service.BatchItemError{
+		Index:   int64(index),
+		Id:      id,
+		Code:    int32(code),
+		Message: message,
+	})
+}
+
+// addStoreError records failure of the item caused by store error
+func (b *batchErrors) addStoreError(index int, id int64, err error) {
+	st, _ := status.FromError(storeError(err, id))
+	b.add(index, id, st.Code(), st.Message())
+}
+
+// err returns status error with the failures attached as BatchError details, or nil if there are none.
+// Code of the first failure is used as the status code.
+func (b batchErrors) err(message string, committed int64) error {
+	if len(b) == 0 {
+		return nil
+	}
+	st := status.New(codes.Code(b[0].Code), message)
+	if detailed, err := st.WithDetails(&todo_service.BatchError{Errors: b, Committed: committed}); err == nil {
+		st = detailed
+	}
+	return st.Err()
+}
+
+// checkBatchSize checks number of items in batch request
+func checkBatchSize(n int) error {
+	if n > maxBatchSize {
+		return status.Errorf(codes.InvalidArgument, "batch of %d items exceeds maximum size %d", n, maxBatchSize)
+	}
+	return nil
+}
+
+// rolledBack returns message of failed batch status
+func rolledBack(failed batchErrors, n int) string {
+	return fmt.Sprintf("%d of %d batch items failed, no changes were made", len(failed), n)
+}
+
+// txError converts error returned from store transaction to gRPC status error
+func txError(err error) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	return storeError(err, 0)
+}
+
+// validateAll checks ToDo data of all batch items
+func validateAll(todos []*todo_service.ToDo) error {
+	var failed batchErrors
+	for i, td := range todos {
+		if err := validateToDo(td); err != nil {
+			failed.add(i, td.GetId(), codes.InvalidArgument, err.Error())
+		}
+	}
+	return failed.err(rolledBack(failed, len(todos)), 0)
+}
+
+// BatchCreate creates all todo tasks in single transaction
+func (s *toDoServiceServer) BatchCreate(ctx context.Context, req *todo_service.BatchCreateRequest) (*todo_service.BatchCreateResponse, error) {
+	// check if the API version requested by client-grpc is supported by grpc-server
+	if err := s.checkAPI(req.Api); err != nil {
+		return nil, err
+	}
+	ownerID, err := owner(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkBatchSize(len(req.ToDos)); err != nil {
+		return nil, err
+	}
+	if err := validateAll(req.ToDos); err != nil {
+		return nil, err
+	}
+
+	// insert ToDo entities
+	ids := make([]int64, len(req.ToDos))
+	err = s.store.InTx(ctx, func(tx store.Tx) error {
+		for i, td := range req.ToDos {
+			td.OwnerId = ownerID
+			id, err := tx.Create(ctx, td)
+			if err != nil {
+				var failed batchErrors
+				failed.addStoreError(i, 0, err)
+				return failed.err(rolledBack(failed, len(req.ToDos)), 0)
+			}
+			ids[i] = id
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, txError(err)
+	}
+
+	for i, td := range req.ToDos {
+		s.events.Publish(todo_service.ToDoEvent_CREATED, createdToDo(td, ids[i]))
+	}
+	return &todo_service.BatchCreateResponse{
+		Api: apiVersion,
+		Ids: ids,
+	}, nil
+}
+
+// BatchUpdate updates all todo tasks in single transaction, or none of them if any is not found or has changed version
+func (s *toDoServiceServer) BatchUpdate(ctx context.Context, req *todo_service.BatchUpdateRequest) (*todo_service.BatchUpdateResponse, error) {
+	// check if the API version requested by client-grpc is supported by grpc-server
+	if err := s.checkAPI(req.Api); err != nil {
+		return nil, err
+	}
+	ownerID, err := owner(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkBatchSize(len(req.ToDos)); err != nil {
+		return nil, err
+	}
+	if err := validateAll(req.ToDos); err != nil {
+		return nil, err
+	}
+
+	// update ToDo entities
+	var updated []*todo_service.ToDo
+	err = s.store.InTx(ctx, func(tx store.Tx) error {
+		var failed batchErrors
+		for i, td := range req.ToDos {
+			td.OwnerId = ownerID
+			u, err := update(ctx, tx, td, nil)
+			if err != nil {
+				failed.addStoreError(i, td.Id, err)
+				if !errors.Is(err, store.ErrNotFound) && !errors.Is(err, store.ErrConflict) {
+					break
+				}
+				continue
+			}
+			updated = append(updated, u)
+		}
+		return failed.err(rolledBack(failed, len(req.ToDos)), 0)
+	})
+	if err != nil {
+		return nil, txError(err)
+	}
+
+	for _, td := range updated {
+		s.events.Publish(todo_service.ToDoEvent_UPDATED, td)
+	}
+	return &todo_service.BatchUpdateResponse{
+		Api:     apiVersion,
+		Updated: int64(len(updated)),
+	}, nil
+}
+
+// BatchDelete deletes all todo tasks in single transaction, or none of them if any is not found
+func (s *toDoServiceServer) BatchDelete(ctx context.Context, req *todo_service.BatchDeleteRequest) (*todo_service.BatchDeleteResponse, error) {
+	// check if the API version requested by client-grpc is supported by grpc-server
+	if err := s.checkAPI(req.Api); err != nil {
+		return nil, err
+	}
+	ownerID, err := owner(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkBatchSize(len(req.Ids)); err != nil {
+		return nil, err
+	}
+
+	// delete ToDo entities, keeping their data for watchers
+	var deleted []*todo_service.ToDo
+	err = s.store.InTx(ctx, func(tx store.Tx) error {
+		var failed batchErrors
+		for i, id := range req.Ids {
+			td, err := tx.Read(ctx, ownerID, id)
+			if err == nil {
+				_, err = tx.Delete(ctx, ownerID, id)
+			}
+			if err != nil {
+				failed.addStoreError(i, id, err)
+				if !errors.Is(err, store.ErrNotFound) {
+					break
+				}
+				continue
+			}
+			deleted = append(deleted, td)
+		}
+		return failed.err(rolledBack(failed, len(req.Ids)), 0)
+	})
+	if err != nil {
+		return nil, txError(err)
+	}
+
+	for _, td := range deleted {
+		s.events.Publish(todo_service.ToDoEvent_DELETED, td)
+	}
+	return &todo_service.BatchDeleteResponse{
+		Api:     apiVersion,
+		Deleted: int64(len(deleted)),
+	}, nil
+}
+
+// ImportToDos creates todo tasks received from client stream.
+// Tasks are committed in chunks, so on failure the error details report how many of them were imported.
+func (s *toDoServiceServer) ImportToDos(stream todo_service.ToDoService_ImportToDosServer) error {
+	ctx := stream.Context()
+	ownerID, err := owner(ctx)
+	if err != nil {
+		return err
+	}
+
+	var ids []int64
+	chunk := make([]*todo_service.ToDo, 0, importChunkSize)
+	// commit inserts buffered chunk in single transaction
+	commit := func() error {
+		if len(chunk) == 0 {
+			return nil
+		}
+		chunkIDs := make([]int64, 0, len(chunk))
+		err := s.store.InTx(ctx, func(tx store.Tx) error {
+			for i, td := range chunk {
+				id, err := tx.Create(ctx, td)
+				if err != nil {
+					var failed batchErrors
+					failed.addStoreError(len(ids)+i, 0, err)
+					return failed.err(fmt.Sprintf("import failed, %d todo tasks were imported", len(ids)), int64(len(ids)))
+				}
+				chunkIDs = append(chunkIDs, id)
+			}
+			return nil
+		})
+		if err != nil {
+			return txError(err)
+		}
+		for i, td := range chunk {
+			s.events.Publish(todo_service.ToDoEvent_CREATED, createdToDo(td, chunkIDs[i]))
+		}
+		ids = append(ids, chunkIDs...)
+		chunk = chunk[:0]
+		return nil
+	}
+
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		// check if the API version requested by client-grpc is supported by grpc-server
+		if err := s.checkAPI(req.Api); err != nil {
+			return err
+		}
+		if err := validateToDo(req.ToDo); err != nil {
+			var failed batchErrors
+			failed.add(len(ids)+len(chunk), 0, codes.InvalidArgument, err.Error())
+			return failed.err(fmt.Sprintf("import failed, %d todo tasks were imported", len(ids)), int64(len(ids)))
+		}
+		req.ToDo.OwnerId = ownerID
+		chunk = append(chunk, req.ToDo)
+		if len(chunk) == importChunkSize {
+			if err := commit(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := commit(); err != nil {
+		return err
+	}
+
+	return stream.SendAndClose(&todo_service.ImportToDosResponse{
+		Api:      apiVersion,
+		Imported: int64(len(ids)),
+		Ids:      ids,
+	})
+}
@@ -0,0 +1,227 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/iproduct/coursego/10-grpc-todos/auth"
+	"github.com/iproduct/coursego/10-grpc-todos/events"
+	"github.com/iproduct/coursego/10-grpc-todos/generated/todo_service"
+	"github.com/iproduct/coursego/10-grpc-todos/store"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+// batchError returns BatchError details of the status error
+func batchError(t *testing.T, err error) *todo_service.BatchError {
+	t.Helper()
+	for _, d := range status.Convert(err).Details() {
+		if be, ok := d.(*todo_service.BatchError); ok {
+			return be
+		}
+	}
+	t.Fatalf("error %v has no BatchError details", err)
+	return nil
+}
+
+func Test_toDoServiceServer_Batch(t *testing.T) {
+	ctx := auth.WithOwner(context.Background(), testOwner)
+	s := NewToDoServiceServer(store.NewMemoryStore(), events.NewBroker(events.DefaultHistorySize), nil)
+	reminder, _ := ptypes.TimestampProto(time.Now().In(time.UTC))
+
+	created, err := s.BatchCreate(ctx, &todo_service.BatchCreateRequest{Api: "v1", ToDos: []*todo_service.ToDo{
+		{Title: "first", Reminder: reminder},
+		{Title: "second", Reminder: reminder},
+	}})
+	if err != nil || len(created.Ids) != 2 {
+		t.Fatalf("BatchCreate() = %v, %v, want 2 IDs", created, err)
+	}
+	first, second := created.Ids[0], created.Ids[1]
+
+	// invalid items are reported all at once
+	_, err = s.BatchCreate(ctx, &todo_service.BatchCreateRequest{Api: "v1", ToDos: []*todo_service.ToDo{
+		{Title: "invalid", Reminder: &timestamp.Timestamp{Seconds: 1, Nanos: -1}},
+		{Title: "valid", Reminder: reminder},
+		nil,
+	}})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("BatchCreate() error = %v, want InvalidArgument", err)
+	}
+	if be := batchError(t, err); len(be.Errors) != 2 || be.Errors[0].Index != 0 || be.Errors[1].Index != 2 {
+		t.Errorf("BatchCreate() error details = %v, want items 0 and 2", be)
+	}
+
+	// update with unknown ID changes nothing
+	_, err = s.BatchUpdate(ctx, &todo_service.BatchUpdateRequest{Api: "v1", ToDos: []*todo_service.ToDo{
+		{Id: first, Title: "first updated", Reminder: reminder},
+		{Id: 42, Title: "unknown", Reminder: reminder},
+	}})
+	if status.Code(err) != codes.NotFound {
+		t.Fatalf("BatchUpdate() error = %v, want NotFound", err)
+	}
+	if be := batchError(t, err); len(be.Errors) != 1 || be.Errors[0].Index != 1 || be.Errors[0].Id != 42 {
+		t.Errorf("BatchUpdate() error details = %v, want item 1 with ID 42", be)
+	}
+	if got, _ := s.Read(ctx, &todo_service.ReadRequest{Api: "v1", Id: first}); got.ToDo.Title != "first" {
+		t.Errorf("Read() after failed BatchUpdate() title = %q, want %q", got.ToDo.Title, "first")
+	}
+
+	updated, err := s.BatchUpdate(ctx, &todo_service.BatchUpdateRequest{Api: "v1", ToDos: []*todo_service.ToDo{
+		{Id: first, Title: "first updated", Reminder: reminder},
+		{Id: second, Title: "second updated", Reminder: reminder},
+	}})
+	if err != nil || updated.Updated != 2 {
+		t.Fatalf("BatchUpdate() = %v, %v, want 2 updated", updated, err)
+	}
+
+	// delete of foreign ToDo changes nothing
+	other := auth.WithOwner(context.Background(), "other")
+	_, err = s.BatchDelete(other, &todo_service.BatchDeleteRequest{Api: "v1", Ids: []int64{first}})
+	if status.Code(err) != codes.NotFound {
+		t.Fatalf("BatchDelete() of foreign ToDo error = %v, want NotFound", err)
+	}
+	_, err = s.BatchDelete(ctx, &todo_service.BatchDeleteRequest{Api: "v1", Ids: []int64{first, 42}})
+	if status.Code(err) != codes.NotFound {
+		t.Fatalf("BatchDelete() error = %v, want NotFound", err)
+	}
+	if _, err := s.Read(ctx, &todo_service.ReadRequest{Api: "v1", Id: first}); err != nil {
+		t.Errorf("Read() after failed BatchDelete() error = %v", err)
+	}
+
+	deleted, err := s.BatchDelete(ctx, &todo_service.BatchDeleteRequest{Api: "v1", Ids: []int64{first, second}})
+	if err != nil || deleted.Deleted != 2 {
+		t.Fatalf("BatchDelete() = %v, %v, want 2 deleted", deleted, err)
+	}
+
+	_, err = s.BatchDelete(ctx, &todo_service.BatchDeleteRequest{Api: "v1", Ids: make([]int64, maxBatchSize+1)})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("BatchDelete() of too big batch error = %v, want InvalidArgument", err)
+	}
+}
+
+func Test_toDoServiceServer_BatchCreate_Transaction(t *testing.T) {
+	ctx := auth.WithOwner(context.Background(), testOwner)
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	s := NewToDoServiceServer(store.NewSQLStore(db), events.NewBroker(events.DefaultHistorySize), nil)
+	tm := time.Now().In(time.UTC)
+	reminder, _ := ptypes.TimestampProto(tm)
+	req := &todo_service.BatchCreateRequest{Api: "v1", ToDos: []*todo_service.ToDo{
+		{Title: "first", Reminder: reminder},
+		{Title: "second", Reminder: reminder},
+	}}
+
+	// all inserts are committed together
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO ToDo").WithArgs("first", "", tm, testOwner).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT INTO ToDo").WithArgs("second", "", tm, testOwner).WillReturnResult(sqlmock.NewResult(2, 1))
+	mock.ExpectCommit()
+	if got, err := s.BatchCreate(ctx, req); err != nil || len(got.Ids) != 2 || got.Ids[1] != 2 {
+		t.Errorf("BatchCreate() = %v, %v, want IDs [1 2]", got, err)
+	}
+
+	// failed insert rolls back the previous ones
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO ToDo").WithArgs("first", "", tm, testOwner).WillReturnResult(sqlmock.NewResult(3, 1))
+	mock.ExpectExec("INSERT INTO ToDo").WithArgs("second", "", tm, testOwner).WillReturnError(errors.New("INSERT failed"))
+	mock.ExpectRollback()
+	_, err = s.BatchCreate(ctx, req)
+	if status.Code(err) != codes.Unknown {
+		t.Fatalf("BatchCreate() error = %v, want Unknown", err)
+	}
+	if be := batchError(t, err); len(be.Errors) != 1 || be.Errors[0].Index != 1 {
+		t.Errorf("BatchCreate() error details = %v, want item 1", be)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+// importStream is client stream of ToDos for ImportToDos
+type importStream struct {
+	grpc.ServerStream
+	ctx  context.Context
+	reqs []*todo_service.ImportToDosRequest
+	resp *todo_service.ImportToDosResponse
+}
+
+func (s *importStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *importStream) Recv() (*todo_service.ImportToDosRequest, error) {
+	if len(s.reqs) == 0 {
+		return nil, io.EOF
+	}
+	req := s.reqs[0]
+	s.reqs = s.reqs[1:]
+	return req, nil
+}
+
+func (s *importStream) SendAndClose(resp *todo_service.ImportToDosResponse) error {
+	s.resp = resp
+	return nil
+}
+
+func Test_toDoServiceServer_ImportToDos(t *testing.T) {
+	ctx := auth.WithOwner(context.Background(), testOwner)
+	st := store.NewMemoryStore()
+	broker := events.NewBroker(events.DefaultHistorySize)
+	s := NewToDoServiceServer(st, broker, nil)
+	reminder, _ := ptypes.TimestampProto(time.Now().In(time.UTC))
+	requests := func(n int) []*todo_service.ImportToDosRequest {
+		reqs := make([]*todo_service.ImportToDosRequest, n)
+		for i := range reqs {
+			reqs[i] = &todo_service.ImportToDosRequest{Api: "v1", ToDo: &todo_service.ToDo{Title: "imported", Reminder: reminder}}
+		}
+		return reqs
+	}
+
+	// import spanning several chunks
+	sub, err := broker.Subscribe(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+	stream := &importStream{ctx: ctx, reqs: requests(importChunkSize + 1)}
+	if err := s.ImportToDos(stream); err != nil {
+		t.Fatalf("ImportToDos() error = %v", err)
+	}
+	if stream.resp.Imported != importChunkSize+1 || len(stream.resp.Ids) != importChunkSize+1 {
+		t.Errorf("ImportToDos() imported %d with %d IDs, want %d", stream.resp.Imported, len(stream.resp.Ids), importChunkSize+1)
+	}
+	// created events carry the stored ToDos
+	if ev := <-sub.Events(); ev.Type != todo_service.ToDoEvent_CREATED || ev.ToDo.Id != stream.resp.Ids[0] || ev.ToDo.Version != 1 {
+		t.Errorf("first event = %v, want CREATED ToDo %d with version 1", ev, stream.resp.Ids[0])
+	}
+
+	// invalid item stops the import, keeping committed chunks
+	reqs := requests(importChunkSize + 2)
+	reqs[importChunkSize+1].ToDo.Reminder = &timestamp.Timestamp{Seconds: 1, Nanos: -1}
+	err = s.ImportToDos(&importStream{ctx: ctx, reqs: reqs})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("ImportToDos() error = %v, want InvalidArgument", err)
+	}
+	be := batchError(t, err)
+	if be.Committed != importChunkSize || len(be.Errors) != 1 || be.Errors[0].Index != importChunkSize+1 {
+		t.Errorf("ImportToDos() error details = %v, want %d committed and failed item %d", be, importChunkSize, importChunkSize+1)
+	}
+	if _, total, _ := st.ReadAll(ctx, store.Query{}); total != 2*importChunkSize+1 {
+		t.Errorf("store contains %d ToDos, want %d", total, 2*importChunkSize+1)
+	}
+
+	if err := s.ImportToDos(&importStream{ctx: context.Background()}); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("ImportToDos() without owner error = %v, want Unauthenticated", err)
+	}
+}
@@ -0,0 +1,129 @@
+package service
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/iproduct/coursego/10-grpc-todos/generated/todo_service"
+	"github.com/iproduct/coursego/10-grpc-todos/store"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// defaultPageSize is number of ToDos returned by ReadAll if page size is not specified
+	defaultPageSize = 100
+	// maxPageSize is maximum number of ToDos returned by single ReadAll call
+	maxPageSize = 1000
+)
+
+// encodePageToken creates opaque page token pointing at given offset
+func encodePageToken(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(offset)))
+}
+
+// decodePageToken returns offset encoded in page token, empty token means the first page
+func decodePageToken(token string) (int, error) {
+	if token == "" {
+		return 0, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return 0, err
+	}
+	offset, err := strconv.Atoi(string(data))
+	if err != nil || offset < 0 {
+		return 0, fmt.Errorf("invalid offset '%s'", data)
+	}
+	return offset, nil
+}
+
+// parseOrderBy parses sort specification in form "<field>[ asc|desc]"
+func parseOrderBy(orderBy string) (field string, desc bool, err error) {
+	parts := strings.Fields(strings.ToLower(orderBy))
+	if len(parts) == 0 {
+		return store.OrderByID, false, nil
+	}
+	if len(parts) > 2 {
+		return "", false, fmt.Errorf("expected '<field> [asc|desc]', got '%s'", orderBy)
+	}
+	switch parts[0] {
+	case store.OrderByID, store.OrderByTitle, store.OrderByReminder:
+		field = parts[0]
+	default:
+		return "", false, fmt.Errorf("unsupported sort field '%s'", parts[0])
+	}
+	if len(parts) == 2 {
+		switch parts[1] {
+		case "asc":
+		case "desc":
+			desc = true
+		default:
+			return "", false, fmt.Errorf("unsupported sort direction '%s'", parts[1])
+		}
+	}
+	return field, desc, nil
+}
+
+// pageQuery validates page size and token and converts them to store query
+func pageQuery(pageSize int32, pageToken string) (store.Query, error) {
+	var q store.Query
+	if pageSize < 0 {
+		return q, status.Error(codes.InvalidArgument, "pageSize must not be negative")
+	}
+	q.Limit = int(pageSize)
+	if q.Limit == 0 {
+		q.Limit = defaultPageSize
+	}
+	if q.Limit > maxPageSize {
+		q.Limit = maxPageSize
+	}
+
+	var err error
+	if q.Offset, err = decodePageToken(pageToken); err != nil {
+		return q, status.Error(codes.InvalidArgument, "pageToken is invalid-> "+err.Error())
+	}
+	return q, nil
+}
+
+// nextPageToken returns token of the page following the n ToDos returned for query, empty if there are no more
+func nextPageToken(q store.Query, n int, total int64) string {
+	if end := q.Offset + n; int64(end) < total {
+		return encodePageToken(end)
+	}
+	return ""
+}
+
+// readAllQuery validates ReadAll request and converts it to store query
+func readAllQuery(req *todo_service.ReadAllRequest) (store.Query, error) {
+	q, err := pageQuery(req.PageSize, req.PageToken)
+	if err != nil {
+		return q, err
+	}
+	if req.ShowDeleted {
+		q.Deleted = store.ShowDeleted
+	}
+	if q.OrderBy, q.Desc, err = parseOrderBy(req.OrderBy); err != nil {
+		return q, status.Error(codes.InvalidArgument, "orderBy is invalid-> "+err.Error())
+	}
+
+	q.Text = strings.TrimSpace(req.Filter)
+	if req.ReminderFrom != nil {
+		from, err := ptypes.Timestamp(req.ReminderFrom)
+		if err != nil {
+			return q, status.Error(codes.InvalidArgument, "reminderFrom field has invalid format-> "+err.Error())
+		}
+		q.ReminderFrom = &from
+	}
+	if req.ReminderTo != nil {
+		to, err := ptypes.Timestamp(req.ReminderTo)
+		if err != nil {
+			return q, status.Error(codes.InvalidArgument, "reminderTo field has invalid format-> "+err.Error())
+		}
+		q.ReminderTo = &to
+	}
+	return q, nil
+}
@@ -2,14 +2,19 @@ package service
 
 import (
 	"context"
-	"database/sql"
+	"errors"
 	"fmt"
-	"time"
 
 	"github.com/golang/protobuf/ptypes"
+	"github.com/iproduct/coursego/10-grpc-todos/auth"
+	"github.com/iproduct/coursego/10-grpc-todos/events"
 	"github.com/iproduct/coursego/10-grpc-todos/generated/todo_service"
+	"github.com/iproduct/coursego/10-grpc-todos/reminder"
+	"github.com/iproduct/coursego/10-grpc-todos/store"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
 )
 
 const (
@@ -19,13 +24,17 @@ const (
 
 // toDoServiceServer is implementation of v1.ToDoServiceServer proto interface
 type toDoServiceServer struct {
-	db *sql.DB
+	store     store.ToDoStore
+	events    *events.Broker
+	reminders *reminder.StreamNotifier
 	todo_service.UnimplementedToDoServiceServer
 }
 
-// NewToDoServiceServer creates ToDo service
-func NewToDoServiceServer(db *sql.DB) todo_service.ToDoServiceServer {
-	return &toDoServiceServer{db: db}
+// NewToDoServiceServer creates ToDo service using given storage backend.
+// Successful changes are published to the events broker.
+// Fired reminders are streamed from the reminders notifier (nil disables WatchReminders).
+func NewToDoServiceServer(st store.ToDoStore, broker *events.Broker, reminders *reminder.StreamNotifier) todo_service.ToDoServiceServer {
+	return &toDoServiceServer{store: st, events: broker, reminders: reminders}
 }
 
 // checkAPI checks if the API version requested by client-grpc is supported by grpc-server
@@ -40,13 +49,104 @@ func (s *toDoServiceServer) checkAPI(api string) error {
 	return nil
 }
 
-// connect returns SQL database connection from the pool
-func (s *toDoServiceServer) connect(ctx context.Context) (*sql.Conn, error) {
-	c, err := s.db.Conn(ctx)
+// owner returns ID of the authenticated user making the call
+func owner(ctx context.Context) (string, error) {
+	id, ok := auth.Owner(ctx)
+	if !ok {
+		return "", status.Error(codes.Unauthenticated, "request is not authenticated")
+	}
+	return id, nil
+}
+
+// validateToDo checks ToDo data sent by client
+func validateToDo(td *todo_service.ToDo) error {
+	if td == nil {
+		return errors.New("toDo field is missing")
+	}
+	if _, err := ptypes.Timestamp(td.Reminder); err != nil {
+		return fmt.Errorf("reminder field has invalid format-> %w", err)
+	}
+	return nil
+}
+
+// validateUpdate checks ToDo data and update mask sent by client, only fields listed in the mask are checked
+func validateUpdate(td *todo_service.ToDo, mask *fieldmaskpb.FieldMask) error {
+	if td == nil {
+		return errors.New("toDo field is missing")
+	}
+	if len(mask.GetPaths()) == 0 {
+		return validateToDo(td)
+	}
+	for _, path := range mask.GetPaths() {
+		switch path {
+		case "title", "description", "id", "ownerId", "version":
+		case "reminder":
+			if err := validateToDo(td); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("updateMask field has unknown path '%s'", path)
+		}
+	}
+	return nil
+}
+
+// merge returns copy of stored ToDo with the fields listed in mask (all if it is empty) taken from td.
+// ID, owner and version are never taken from td.
+func merge(stored, td *todo_service.ToDo, mask *fieldmaskpb.FieldMask) *todo_service.ToDo {
+	paths := mask.GetPaths()
+	if len(paths) == 0 {
+		paths = []string{"title", "description", "reminder"}
+	}
+	merged := proto.Clone(stored).(*todo_service.ToDo)
+	for _, path := range paths {
+		switch path {
+		case "title":
+			merged.Title = td.Title
+		case "description":
+			merged.Description = td.Description
+		case "reminder":
+			merged.Reminder = td.Reminder
+		}
+	}
+	return merged
+}
+
+// update merges td into ToDo stored in the transaction and returns the updated ToDo.
+// Nonzero td.Version must be equal to the stored version, otherwise store.ErrConflict is returned.
+func update(ctx context.Context, tx store.Tx, td *todo_service.ToDo, mask *fieldmaskpb.FieldMask) (*todo_service.ToDo, error) {
+	stored, err := tx.Read(ctx, td.OwnerId, td.Id)
 	if err != nil {
-		return nil, status.Error(codes.Unknown, "failed to connect to database-> "+err.Error())
+		return nil, err
 	}
-	return c, nil
+	if td.Version != 0 && td.Version != stored.Version {
+		return nil, store.ErrConflict
+	}
+	updated := merge(stored, td, mask)
+	if _, err := tx.Update(ctx, updated); err != nil {
+		return nil, err
+	}
+	updated.Version++
+	return updated, nil
+}
+
+// createdToDo returns copy of td as it was stored by create with the ID
+func createdToDo(td *todo_service.ToDo, id int64) *todo_service.ToDo {
+	created := proto.Clone(td).(*todo_service.ToDo)
+	created.Id = id
+	created.Version = 1
+	return created
+}
+
+// storeError converts store error to gRPC status error
+func storeError(err error, id int64) error {
+	if errors.Is(err, store.ErrNotFound) {
+		return status.Error(codes.NotFound, fmt.Sprintf("ToDo with ID='%d' is not found", id))
+	}
+	if errors.Is(err, store.ErrConflict) {
+		return status.Error(codes.Aborted, fmt.Sprintf("ToDo with ID='%d' was changed by another update, read it and retry", id))
+	}
+	return status.Error(codes.Unknown, err.Error())
 }
 
 // Create new todo task
@@ -55,31 +155,22 @@ func (s *toDoServiceServer) Create(ctx context.Context, req *todo_service.Create
 	if err := s.checkAPI(req.Api); err != nil {
 		return nil, err
 	}
-
-	// get SQL connection from pool
-	c, err := s.connect(ctx)
+	ownerID, err := owner(ctx)
 	if err != nil {
 		return nil, err
 	}
-	defer c.Close()
 
-	reminder, err := ptypes.Timestamp(req.ToDo.Reminder)
-	if err != nil {
-		return nil, status.Error(codes.InvalidArgument, "reminder field has invalid format-> "+err.Error())
+	if err := validateToDo(req.ToDo); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
 	}
 
 	// insert ToDo entity data
-	res, err := c.ExecContext(ctx, "INSERT INTO todo(`title`, `description`, `reminder`) VALUES(?, ?, ?)",
-		req.ToDo.Title, req.ToDo.Description, reminder)
+	req.ToDo.OwnerId = ownerID
+	id, err := s.store.Create(ctx, req.ToDo)
 	if err != nil {
-		return nil, status.Error(codes.Unknown, "failed to insert into ToDo-> "+err.Error())
-	}
-
-	// get ID of creates ToDo
-	id, err := res.LastInsertId()
-	if err != nil {
-		return nil, status.Error(codes.Unknown, "failed to retrieve id for created ToDo-> "+err.Error())
+		return nil, storeError(err, 0)
 	}
+	s.events.Publish(todo_service.ToDoEvent_CREATED, createdToDo(req.ToDo, id))
 
 	return &todo_service.CreateResponse{
 		Api: apiVersion,
@@ -93,124 +184,82 @@ func (s *toDoServiceServer) Read(ctx context.Context, req *todo_service.ReadRequ
 	if err := s.checkAPI(req.Api); err != nil {
 		return nil, err
 	}
-
-	// get SQL connection from pool
-	c, err := s.connect(ctx)
+	ownerID, err := owner(ctx)
 	if err != nil {
 		return nil, err
 	}
-	defer c.Close()
 
 	// query ToDo by ID
-	rows, err := c.QueryContext(ctx, "SELECT `ID`, `Title`, `Description`, `Reminder` FROM todo WHERE `ID`=?",
-		req.Id)
+	td, err := s.store.Read(ctx, ownerID, req.Id)
 	if err != nil {
-		return nil, status.Error(codes.Unknown, "failed to select from ToDo-> "+err.Error())
-	}
-	defer rows.Close()
-
-	if !rows.Next() {
-		if err := rows.Err(); err != nil {
-			return nil, status.Error(codes.Unknown, "failed to retrieve data from ToDo-> "+err.Error())
-		}
-		return nil, status.Error(codes.NotFound, fmt.Sprintf("ToDo with ID='%d' is not found",
-			req.Id))
-	}
-
-	// get ToDo data
-	var td todo_service.ToDo
-	var reminder time.Time
-	if err := rows.Scan(&td.Id, &td.Title, &td.Description, &reminder); err != nil {
-		return nil, status.Error(codes.Unknown, "failed to retrieve field values from ToDo row-> "+err.Error())
-	}
-	td.Reminder, err = ptypes.TimestampProto(reminder)
-	if err != nil {
-		return nil, status.Error(codes.Unknown, "reminder field has invalid format-> "+err.Error())
-	}
-
-	if rows.Next() {
-		return nil, status.Error(codes.Unknown, fmt.Sprintf("found multiple ToDo rows with ID='%d'",
-			req.Id))
+		return nil, storeError(err, req.Id)
 	}
 
 	return &todo_service.ReadResponse{
 		Api:  apiVersion,
-		ToDo: &td,
+		ToDo: td,
 	}, nil
 
 }
 
-// Update todo task
+// Update todo task fields listed in update mask (all fields if it is empty).
+// If the task version is given, the task must not be changed since that version.
 func (s *toDoServiceServer) Update(ctx context.Context, req *todo_service.UpdateRequest) (*todo_service.UpdateResponse, error) {
 	// check if the API version requested by client-grpc is supported by grpc-server
 	if err := s.checkAPI(req.Api); err != nil {
 		return nil, err
 	}
-
-	// get SQL connection from pool
-	c, err := s.connect(ctx)
+	ownerID, err := owner(ctx)
 	if err != nil {
 		return nil, err
 	}
-	defer c.Close()
 
-	reminder, err := ptypes.Timestamp(req.ToDo.Reminder)
-	if err != nil {
-		return nil, status.Error(codes.InvalidArgument, "reminder field has invalid format-> "+err.Error())
+	if err := validateUpdate(req.ToDo, req.UpdateMask); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
 	}
 
 	// update ToDo
-	res, err := c.ExecContext(ctx, "UPDATE ToDo SET `Title`=?, `Description`=?, `Reminder`=? WHERE `ID`=?",
-		req.ToDo.Title, req.ToDo.Description, reminder, req.ToDo.Id)
+	req.ToDo.OwnerId = ownerID
+	var updated *todo_service.ToDo
+	err = s.store.InTx(ctx, func(tx store.Tx) error {
+		updated, err = update(ctx, tx, req.ToDo, req.UpdateMask)
+		return err
+	})
 	if err != nil {
-		return nil, status.Error(codes.Unknown, "failed to update ToDo-> "+err.Error())
-	}
-
-	rows, err := res.RowsAffected()
-	if err != nil {
-		return nil, status.Error(codes.Unknown, "failed to retrieve rows affected value-> "+err.Error())
-	}
-
-	if rows == 0 {
-		return nil, status.Error(codes.NotFound, fmt.Sprintf("ToDo with ID='%d' is not found",
-			req.ToDo.Id))
+		return nil, storeError(err, req.ToDo.Id)
 	}
+	s.events.Publish(todo_service.ToDoEvent_UPDATED, updated)
 
 	return &todo_service.UpdateResponse{
 		Api:     apiVersion,
-		Updated: rows,
+		Updated: 1,
+		Version: updated.Version,
 	}, nil
 }
 
-// Delete todo task
+// Delete todo task, moving it to trash
 func (s *toDoServiceServer) Delete(ctx context.Context, req *todo_service.DeleteRequest) (*todo_service.DeleteResponse, error) {
 	// check if the API version requested by client-grpc is supported by grpc-server
 	if err := s.checkAPI(req.Api); err != nil {
 		return nil, err
 	}
-
-	// get SQL connection from pool
-	c, err := s.connect(ctx)
+	ownerID, err := owner(ctx)
 	if err != nil {
 		return nil, err
 	}
-	defer c.Close()
 
-	// delete ToDo
-	res, err := c.ExecContext(ctx, "DELETE FROM ToDo WHERE `ID`=?", req.Id)
+	// keep deleted ToDo data for watchers
+	deleted, err := s.store.Read(ctx, ownerID, req.Id)
 	if err != nil {
-		return nil, status.Error(codes.Unknown, "failed to delete ToDo-> "+err.Error())
+		return nil, storeError(err, req.Id)
 	}
 
-	rows, err := res.RowsAffected()
+	// delete ToDo
+	rows, err := s.store.Delete(ctx, ownerID, req.Id)
 	if err != nil {
-		return nil, status.Error(codes.Unknown, "failed to retrieve rows affected value-> "+err.Error())
-	}
-
-	if rows == 0 {
-		return nil, status.Error(codes.NotFound, fmt.Sprintf("ToDo with ID='%d' is not found",
-			req.Id))
+		return nil, storeError(err, req.Id)
 	}
+	s.events.Publish(todo_service.ToDoEvent_DELETED, deleted)
 
 	return &todo_service.DeleteResponse{
 		Api:     apiVersion,
@@ -218,47 +267,109 @@ func (s *toDoServiceServer) Delete(ctx context.Context, req *todo_service.Delete
 	}, nil
 }
 
-// Read all todo tasks
+// Read all todo tasks matching request filters, one page at a time
 func (s *toDoServiceServer) ReadAll(ctx context.Context, req *todo_service.ReadAllRequest) (*todo_service.ReadAllResponse, error) {
 	// check if the API version requested by client-grpc is supported by grpc-server
 	if err := s.checkAPI(req.Api); err != nil {
 		return nil, err
 	}
+	ownerID, err := owner(ctx)
+	if err != nil {
+		return nil, err
+	}
 
-	// get SQL connection from pool
-	c, err := s.connect(ctx)
+	q, err := readAllQuery(req)
 	if err != nil {
 		return nil, err
 	}
-	defer c.Close()
+	q.Owner = ownerID
 
-	// get ToDo list
-	rows, err := c.QueryContext(ctx, "SELECT `ID`, `Title`, `Description`, `Reminder` FROM ToDo")
+	// get ToDo list page
+	list, total, err := s.store.ReadAll(ctx, q)
 	if err != nil {
-		return nil, status.Error(codes.Unknown, "failed to select from ToDo-> "+err.Error())
+		return nil, storeError(err, 0)
 	}
-	defer rows.Close()
 
-	var reminder time.Time
-	list := []*todo_service.ToDo{}
-	for rows.Next() {
-		td := new(todo_service.ToDo)
-		if err := rows.Scan(&td.Id, &td.Title, &td.Description, &reminder); err != nil {
-			return nil, status.Error(codes.Unknown, "failed to retrieve field values from ToDo row-> "+err.Error())
-		}
-		td.Reminder, err = ptypes.TimestampProto(reminder)
-		if err != nil {
-			return nil, status.Error(codes.Unknown, "reminder field has invalid format-> "+err.Error())
+	return &todo_service.ReadAllResponse{
+		Api:           apiVersion,
+		ToDos:         list,
+		NextPageToken: nextPageToken(q, len(list), total),
+		TotalSize:     total,
+	}, nil
+}
+
+// WatchToDos streams caller's todo task changes, replaying retained changes after requested revision first
+func (s *toDoServiceServer) WatchToDos(req *todo_service.WatchRequest, stream todo_service.ToDoService_WatchToDosServer) error {
+	// check if the API version requested by client-grpc is supported by grpc-server
+	if err := s.checkAPI(req.Api); err != nil {
+		return err
+	}
+	ownerID, err := owner(stream.Context())
+	if err != nil {
+		return err
+	}
+
+	sub, err := s.events.Subscribe(req.FromRevision)
+	if err != nil {
+		return status.Error(codes.OutOfRange, fmt.Sprintf("can not resume from revision %d-> %v", req.FromRevision, err))
+	}
+	defer sub.Close()
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return status.FromContextError(stream.Context().Err()).Err()
+		case ev, ok := <-sub.Events():
+			if !ok {
+				return status.Error(codes.ResourceExhausted, fmt.Sprintf(
+					"watch stream dropped-> %v, resume from the last received revision", sub.Err()))
+			}
+			if ev.ToDo.OwnerId != ownerID {
+				continue
+			}
+			if err := stream.Send(&todo_service.WatchResponse{Api: apiVersion, Event: ev}); err != nil {
+				return err
+			}
 		}
-		list = append(list, td)
 	}
+}
 
-	if err := rows.Err(); err != nil {
-		return nil, status.Error(codes.Unknown, "failed to retrieve data from ToDo-> "+err.Error())
+// WatchReminders streams fired reminders of caller's todo tasks
+func (s *toDoServiceServer) WatchReminders(req *todo_service.WatchRemindersRequest, stream todo_service.ToDoService_WatchRemindersServer) error {
+	// check if the API version requested by client-grpc is supported by grpc-server
+	if err := s.checkAPI(req.Api); err != nil {
+		return err
+	}
+	ownerID, err := owner(stream.Context())
+	if err != nil {
+		return err
+	}
+	if s.reminders == nil {
+		return status.Error(codes.Unimplemented, "reminders are disabled")
 	}
 
-	return &todo_service.ReadAllResponse{
-		Api:   apiVersion,
-		ToDos: list,
-	}, nil
+	fired, cancel := s.reminders.Subscribe()
+	defer cancel()
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return status.FromContextError(stream.Context().Err()).Err()
+		case r := <-fired:
+			if r.ToDo.OwnerId != ownerID {
+				continue
+			}
+			firedAt, err := ptypes.TimestampProto(r.FiredAt)
+			if err != nil {
+				return status.Error(codes.Internal, "firedAt has invalid format-> "+err.Error())
+			}
+			if err := stream.Send(&todo_service.WatchRemindersResponse{
+				Api:     apiVersion,
+				ToDo:    r.ToDo,
+				FiredAt: firedAt,
+			}); err != nil {
+				return err
+			}
+		}
+	}
 }
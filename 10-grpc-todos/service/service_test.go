@@ -5,21 +5,32 @@ import (
 	"errors"
 	"github.com/golang/protobuf/ptypes"
 	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/iproduct/coursego/10-grpc-todos/auth"
+	"github.com/iproduct/coursego/10-grpc-todos/events"
 	"github.com/iproduct/coursego/10-grpc-todos/generated/todo_service"
+	"github.com/iproduct/coursego/10-grpc-todos/store"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
 	"gopkg.in/DATA-DOG/go-sqlmock.v1"
 	"reflect"
 	"testing"
 	"time"
 )
 
+// testOwner is ID of the authenticated user calling the service in tests
+const testOwner = "user-1"
+
 func Test_toDoServiceServer_Create(t *testing.T) {
-	ctx := context.Background()
+	ctx := auth.WithOwner(context.Background(), testOwner)
 	db, mock, err := sqlmock.New()
 	if err != nil {
 		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
 	}
 	defer db.Close()
-	s := NewToDoServiceServer(db)
+	s := NewToDoServiceServer(store.NewSQLStore(db), events.NewBroker(events.DefaultHistorySize), nil)
 	tm := time.Now().In(time.UTC)
 	reminder, _ := ptypes.TimestampProto(tm)
 
@@ -50,7 +61,7 @@ func Test_toDoServiceServer_Create(t *testing.T) {
 				},
 			},
 			mock: func() {
-				mock.ExpectExec("INSERT INTO todo").WithArgs("title", "description", tm).
+				mock.ExpectExec("INSERT INTO ToDo").WithArgs("title", "description", tm, testOwner).
 					WillReturnResult(sqlmock.NewResult(1, 1))
 			},
 			want: &todo_service.CreateResponse{
@@ -113,7 +124,7 @@ func Test_toDoServiceServer_Create(t *testing.T) {
 				},
 			},
 			mock: func() {
-				mock.ExpectExec("INSERT INTO todo").WithArgs("title", "description", tm).
+				mock.ExpectExec("INSERT INTO ToDo").WithArgs("title", "description", tm, testOwner).
 					WillReturnError(errors.New("INSERT failed"))
 			},
 			wantErr: true,
@@ -133,7 +144,7 @@ func Test_toDoServiceServer_Create(t *testing.T) {
 				},
 			},
 			mock: func() {
-				mock.ExpectExec("INSERT INTO todo").WithArgs("title", "description", tm).
+				mock.ExpectExec("INSERT INTO ToDo").WithArgs("title", "description", tm, testOwner).
 					WillReturnResult(sqlmock.NewErrorResult(errors.New("LastInsertId failed")))
 			},
 			wantErr: true,
@@ -155,13 +166,13 @@ func Test_toDoServiceServer_Create(t *testing.T) {
 }
 
 func Test_toDoServiceServer_Read(t *testing.T) {
-	ctx := context.Background()
+	ctx := auth.WithOwner(context.Background(), testOwner)
 	db, mock, err := sqlmock.New()
 	if err != nil {
 		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
 	}
 	defer db.Close()
-	s := NewToDoServiceServer(db)
+	s := NewToDoServiceServer(store.NewSQLStore(db), events.NewBroker(events.DefaultHistorySize), nil)
 	tm := time.Now().In(time.UTC)
 	reminder, _ := ptypes.TimestampProto(tm)
 
@@ -188,9 +199,9 @@ func Test_toDoServiceServer_Read(t *testing.T) {
 				},
 			},
 			mock: func() {
-				rows := sqlmock.NewRows([]string{"ID", "Title", "Description", "Reminder"}).
-					AddRow(1, "title", "description", tm)
-				mock.ExpectQuery("SELECT (.+) FROM todo").WithArgs(1).WillReturnRows(rows)
+				rows := sqlmock.NewRows([]string{"ID", "Title", "Description", "Reminder", "OwnerId", "Version", "DeletedAt"}).
+					AddRow(1, "title", "description", tm, testOwner, 1, nil)
+				mock.ExpectQuery("SELECT (.+) FROM ToDo").WithArgs(1, testOwner).WillReturnRows(rows)
 			},
 			want: &todo_service.ReadResponse{
 				Api: "v1",
@@ -199,6 +210,8 @@ func Test_toDoServiceServer_Read(t *testing.T) {
 					Title:       "title",
 					Description: "description",
 					Reminder:    reminder,
+					OwnerId:     testOwner,
+					Version:     1,
 				},
 			},
 		},
@@ -226,7 +239,7 @@ func Test_toDoServiceServer_Read(t *testing.T) {
 				},
 			},
 			mock: func() {
-				mock.ExpectQuery("SELECT (.+) FROM todo").WithArgs(1).
+				mock.ExpectQuery("SELECT (.+) FROM ToDo").WithArgs(1, testOwner).
 					WillReturnError(errors.New("SELECT failed"))
 			},
 			wantErr: true,
@@ -242,8 +255,8 @@ func Test_toDoServiceServer_Read(t *testing.T) {
 				},
 			},
 			mock: func() {
-				rows := sqlmock.NewRows([]string{"ID", "Title", "Description", "Reminder"})
-				mock.ExpectQuery("SELECT (.+) FROM todo").WithArgs(1).WillReturnRows(rows)
+				rows := sqlmock.NewRows([]string{"ID", "Title", "Description", "Reminder", "OwnerId", "Version", "DeletedAt"})
+				mock.ExpectQuery("SELECT (.+) FROM ToDo").WithArgs(1, testOwner).WillReturnRows(rows)
 			},
 			wantErr: true,
 		},
@@ -265,15 +278,22 @@ func Test_toDoServiceServer_Read(t *testing.T) {
 }
 
 func Test_toDoServiceServer_Update(t *testing.T) {
-	ctx := context.Background()
+	ctx := auth.WithOwner(context.Background(), testOwner)
 	db, mock, err := sqlmock.New()
 	if err != nil {
 		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
 	}
 	defer db.Close()
-	s := NewToDoServiceServer(db)
+	s := NewToDoServiceServer(store.NewSQLStore(db), events.NewBroker(events.DefaultHistorySize), nil)
 	tm := time.Now().In(time.UTC)
 	reminder, _ := ptypes.TimestampProto(tm)
+	// expectRead expects transaction reading stored ToDo with version 3
+	expectRead := func() {
+		mock.ExpectBegin()
+		rows := sqlmock.NewRows([]string{"ID", "Title", "Description", "Reminder", "OwnerId", "Version", "DeletedAt"}).
+			AddRow(1, "title", "description", tm, testOwner, 3, nil)
+		mock.ExpectQuery("SELECT (.+) FROM ToDo").WithArgs(1, testOwner).WillReturnRows(rows)
+	}
 
 	type args struct {
 		ctx context.Context
@@ -303,21 +323,51 @@ func Test_toDoServiceServer_Update(t *testing.T) {
 				},
 			},
 			mock: func() {
-				mock.ExpectExec("UPDATE ToDo").WithArgs("new title", "new description", tm, 1).
+				expectRead()
+				mock.ExpectExec("UPDATE ToDo").WithArgs("new title", "new description", tm, 1, testOwner, 3).
 					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
 			},
 			want: &todo_service.UpdateResponse{
 				Api:     "v1",
 				Updated: 1,
+				Version: 4,
 			},
 		},
 		{
-			name: "Unsupported API",
+			name: "OK with update mask and version",
 			s:    s,
 			args: args{
 				ctx: ctx,
 				req: &todo_service.UpdateRequest{
 					Api: "v1",
+					ToDo: &todo_service.ToDo{
+						Id:      1,
+						Title:   "new title",
+						Version: 3,
+					},
+					UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"title", "version"}},
+				},
+			},
+			mock: func() {
+				expectRead()
+				mock.ExpectExec("UPDATE ToDo").WithArgs("new title", "description", tm, 1, testOwner, 3).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
+			},
+			want: &todo_service.UpdateResponse{
+				Api:     "v1",
+				Updated: 1,
+				Version: 4,
+			},
+		},
+		{
+			name: "Unsupported API",
+			s:    s,
+			args: args{
+				ctx: ctx,
+				req: &todo_service.UpdateRequest{
+					Api: "v1000",
 					ToDo: &todo_service.ToDo{
 						Id:          1,
 						Title:       "new title",
@@ -350,6 +400,68 @@ func Test_toDoServiceServer_Update(t *testing.T) {
 			mock:    func() {},
 			wantErr: true,
 		},
+		{
+			name: "Unknown update mask path",
+			s:    s,
+			args: args{
+				ctx: ctx,
+				req: &todo_service.UpdateRequest{
+					Api:        "v1",
+					ToDo:       &todo_service.ToDo{Id: 1, Title: "new title"},
+					UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"priority"}},
+				},
+			},
+			mock:    func() {},
+			wantErr: true,
+		},
+		{
+			name: "Version conflict",
+			s:    s,
+			args: args{
+				ctx: ctx,
+				req: &todo_service.UpdateRequest{
+					Api: "v1",
+					ToDo: &todo_service.ToDo{
+						Id:          1,
+						Title:       "new title",
+						Description: "new description",
+						Reminder:    reminder,
+						Version:     2,
+					},
+				},
+			},
+			mock: func() {
+				expectRead()
+				mock.ExpectRollback()
+			},
+			wantErr: true,
+		},
+		{
+			name: "Concurrent update",
+			s:    s,
+			args: args{
+				ctx: ctx,
+				req: &todo_service.UpdateRequest{
+					Api: "v1",
+					ToDo: &todo_service.ToDo{
+						Id:          1,
+						Title:       "new title",
+						Description: "new description",
+						Reminder:    reminder,
+					},
+				},
+			},
+			mock: func() {
+				expectRead()
+				mock.ExpectExec("UPDATE ToDo").WithArgs("new title", "new description", tm, 1, testOwner, 3).
+					WillReturnResult(sqlmock.NewResult(1, 0))
+				rows := sqlmock.NewRows([]string{"ID", "Title", "Description", "Reminder", "OwnerId", "Version", "DeletedAt"}).
+					AddRow(1, "title", "description", tm, testOwner, 4, nil)
+				mock.ExpectQuery("SELECT (.+) FROM ToDo").WithArgs(1, testOwner).WillReturnRows(rows)
+				mock.ExpectRollback()
+			},
+			wantErr: true,
+		},
 		{
 			name: "UPDATE failed",
 			s:    s,
@@ -366,8 +478,10 @@ func Test_toDoServiceServer_Update(t *testing.T) {
 				},
 			},
 			mock: func() {
-				mock.ExpectExec("UPDATE ToDo").WithArgs("new title", "new description", tm, 1).
+				expectRead()
+				mock.ExpectExec("UPDATE ToDo").WithArgs("new title", "new description", tm, 1, testOwner, 3).
 					WillReturnError(errors.New("UPDATE failed"))
+				mock.ExpectRollback()
 			},
 			wantErr: true,
 		},
@@ -387,8 +501,10 @@ func Test_toDoServiceServer_Update(t *testing.T) {
 				},
 			},
 			mock: func() {
-				mock.ExpectExec("UPDATE ToDo").WithArgs("new title", "new description", tm, 1).
+				expectRead()
+				mock.ExpectExec("UPDATE ToDo").WithArgs("new title", "new description", tm, 1, testOwner, 3).
 					WillReturnResult(sqlmock.NewErrorResult(errors.New("RowsAffected failed")))
+				mock.ExpectRollback()
 			},
 			wantErr: true,
 		},
@@ -408,8 +524,10 @@ func Test_toDoServiceServer_Update(t *testing.T) {
 				},
 			},
 			mock: func() {
-				mock.ExpectExec("UPDATE ToDo").WithArgs("new title", "new description", tm, 1).
-					WillReturnResult(sqlmock.NewResult(1, 0))
+				mock.ExpectBegin()
+				rows := sqlmock.NewRows([]string{"ID", "Title", "Description", "Reminder", "OwnerId", "Version", "DeletedAt"})
+				mock.ExpectQuery("SELECT (.+) FROM ToDo").WithArgs(1, testOwner).WillReturnRows(rows)
+				mock.ExpectRollback()
 			},
 			wantErr: true,
 		},
@@ -425,18 +543,29 @@ func Test_toDoServiceServer_Update(t *testing.T) {
 			if err == nil && !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("toDoServiceServer.Update() = %v, want %v", got, tt.want)
 			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
 		})
 	}
 }
 
 func Test_toDoServiceServer_Delete(t *testing.T) {
-	ctx := context.Background()
+	ctx := auth.WithOwner(context.Background(), testOwner)
 	db, mock, err := sqlmock.New()
 	if err != nil {
 		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
 	}
 	defer db.Close()
-	s := NewToDoServiceServer(db)
+	s := NewToDoServiceServer(store.NewSQLStore(db), events.NewBroker(events.DefaultHistorySize), nil)
+	tm := time.Now().In(time.UTC)
+
+	// deleted ToDo is read first to publish its data to watchers
+	expectRead := func() {
+		rows := sqlmock.NewRows([]string{"ID", "Title", "Description", "Reminder", "OwnerId", "Version", "DeletedAt"}).
+			AddRow(1, "title", "description", tm, testOwner, 1, nil)
+		mock.ExpectQuery("SELECT (.+) FROM ToDo").WithArgs(1, testOwner).WillReturnRows(rows)
+	}
 
 	type args struct {
 		ctx context.Context
@@ -461,7 +590,8 @@ func Test_toDoServiceServer_Delete(t *testing.T) {
 				},
 			},
 			mock: func() {
-				mock.ExpectExec("DELETE FROM ToDo").WithArgs(1).
+				expectRead()
+				mock.ExpectExec("UPDATE ToDo SET deleted_at").WithArgs(sqlmock.AnyArg(), 1, testOwner).
 					WillReturnResult(sqlmock.NewResult(1, 1))
 			},
 			want: &todo_service.DeleteResponse{
@@ -493,7 +623,8 @@ func Test_toDoServiceServer_Delete(t *testing.T) {
 				},
 			},
 			mock: func() {
-				mock.ExpectExec("DELETE FROM ToDo").WithArgs(1).
+				expectRead()
+				mock.ExpectExec("UPDATE ToDo SET deleted_at").WithArgs(sqlmock.AnyArg(), 1, testOwner).
 					WillReturnError(errors.New("DELETE failed"))
 			},
 			wantErr: true,
@@ -509,7 +640,8 @@ func Test_toDoServiceServer_Delete(t *testing.T) {
 				},
 			},
 			mock: func() {
-				mock.ExpectExec("DELETE FROM ToDo").WithArgs(1).
+				expectRead()
+				mock.ExpectExec("UPDATE ToDo SET deleted_at").WithArgs(sqlmock.AnyArg(), 1, testOwner).
 					WillReturnResult(sqlmock.NewErrorResult(errors.New("RowsAffected failed")))
 			},
 			wantErr: true,
@@ -525,7 +657,24 @@ func Test_toDoServiceServer_Delete(t *testing.T) {
 				},
 			},
 			mock: func() {
-				mock.ExpectExec("DELETE FROM ToDo").WithArgs(1).
+				rows := sqlmock.NewRows([]string{"ID", "Title", "Description", "Reminder", "OwnerId", "Version", "DeletedAt"})
+				mock.ExpectQuery("SELECT (.+) FROM ToDo").WithArgs(1, testOwner).WillReturnRows(rows)
+			},
+			wantErr: true,
+		},
+		{
+			name: "Deleted concurrently",
+			s:    s,
+			args: args{
+				ctx: ctx,
+				req: &todo_service.DeleteRequest{
+					Api: "v1",
+					Id:  1,
+				},
+			},
+			mock: func() {
+				expectRead()
+				mock.ExpectExec("UPDATE ToDo SET deleted_at").WithArgs(sqlmock.AnyArg(), 1, testOwner).
 					WillReturnResult(sqlmock.NewResult(1, 0))
 			},
 			wantErr: true,
@@ -547,13 +696,13 @@ func Test_toDoServiceServer_Delete(t *testing.T) {
 }
 
 func Test_toDoServiceServer_ReadAll(t *testing.T) {
-	ctx := context.Background()
+	ctx := auth.WithOwner(context.Background(), testOwner)
 	db, mock, err := sqlmock.New()
 	if err != nil {
 		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
 	}
 	defer db.Close()
-	s := NewToDoServiceServer(db)
+	s := NewToDoServiceServer(store.NewSQLStore(db), events.NewBroker(events.DefaultHistorySize), nil)
 	tm1 := time.Now().In(time.UTC)
 	reminder1, _ := ptypes.TimestampProto(tm1)
 	tm2 := time.Now().In(time.UTC)
@@ -581,25 +730,32 @@ func Test_toDoServiceServer_ReadAll(t *testing.T) {
 				},
 			},
 			mock: func() {
-				rows := sqlmock.NewRows([]string{"ID", "Title", "Description", "Reminder"}).
-					AddRow(1, "title 1", "description 1", tm1).
-					AddRow(2, "title 2", "description 2", tm2)
-				mock.ExpectQuery("SELECT (.+) FROM ToDo").WillReturnRows(rows)
+				mock.ExpectQuery("SELECT COUNT(.+) FROM ToDo").
+					WillReturnRows(sqlmock.NewRows([]string{"COUNT(*)"}).AddRow(2))
+				rows := sqlmock.NewRows([]string{"ID", "Title", "Description", "Reminder", "OwnerId", "Version", "DeletedAt"}).
+					AddRow(1, "title 1", "description 1", tm1, testOwner, 1, nil).
+					AddRow(2, "title 2", "description 2", tm2, testOwner, 1, nil)
+				mock.ExpectQuery("SELECT (.+) FROM ToDo WHERE owner_id = \\? AND deleted_at IS NULL ORDER BY id ASC LIMIT").WithArgs(testOwner, 100, 0).WillReturnRows(rows)
 			},
 			want: &todo_service.ReadAllResponse{
-				Api: "v1",
+				Api:       "v1",
+				TotalSize: 2,
 				ToDos: []*todo_service.ToDo{
 					{
 						Id:          1,
 						Title:       "title 1",
 						Description: "description 1",
 						Reminder:    reminder1,
+						OwnerId:     testOwner,
+						Version:     1,
 					},
 					{
 						Id:          2,
 						Title:       "title 2",
 						Description: "description 2",
 						Reminder:    reminder2,
+						OwnerId:     testOwner,
+						Version:     1,
 					},
 				},
 			},
@@ -614,7 +770,9 @@ func Test_toDoServiceServer_ReadAll(t *testing.T) {
 				},
 			},
 			mock: func() {
-				rows := sqlmock.NewRows([]string{"ID", "Title", "Description", "Reminder"})
+				mock.ExpectQuery("SELECT COUNT(.+) FROM ToDo").
+					WillReturnRows(sqlmock.NewRows([]string{"COUNT(*)"}).AddRow(0))
+				rows := sqlmock.NewRows([]string{"ID", "Title", "Description", "Reminder", "OwnerId", "Version", "DeletedAt"})
 				mock.ExpectQuery("SELECT (.+) FROM ToDo").WillReturnRows(rows)
 			},
 			want: &todo_service.ReadAllResponse{
@@ -622,6 +780,71 @@ func Test_toDoServiceServer_ReadAll(t *testing.T) {
 				ToDos: []*todo_service.ToDo{},
 			},
 		},
+		{
+			name: "Filtered page",
+			s:    s,
+			args: args{
+				ctx: ctx,
+				req: &todo_service.ReadAllRequest{
+					Api:          "v1",
+					PageSize:     1,
+					PageToken:    "MQ",
+					Filter:       "Title_",
+					ReminderFrom: reminder1,
+					OrderBy:      "title desc",
+				},
+			},
+			mock: func() {
+				mock.ExpectQuery("SELECT COUNT(.+) FROM ToDo WHERE owner_id = (.+) LIKE (.+) AND reminder >= ?").
+					WithArgs(testOwner, "%title!_%", "%title!_%", tm1).
+					WillReturnRows(sqlmock.NewRows([]string{"COUNT(*)"}).AddRow(3))
+				rows := sqlmock.NewRows([]string{"ID", "Title", "Description", "Reminder", "OwnerId", "Version", "DeletedAt"}).
+					AddRow(2, "title_2", "description 2", tm2, testOwner, 1, nil)
+				mock.ExpectQuery("SELECT (.+) FROM ToDo WHERE (.+) ORDER BY title DESC, id DESC LIMIT").
+					WithArgs(testOwner, "%title!_%", "%title!_%", tm1, 1, 1).WillReturnRows(rows)
+			},
+			want: &todo_service.ReadAllResponse{
+				Api: "v1",
+				ToDos: []*todo_service.ToDo{
+					{
+						Id:          2,
+						Title:       "title_2",
+						Description: "description 2",
+						Reminder:    reminder2,
+						OwnerId:     testOwner,
+						Version:     1,
+					},
+				},
+				NextPageToken: "Mg",
+				TotalSize:     3,
+			},
+		},
+		{
+			name: "Invalid orderBy",
+			s:    s,
+			args: args{
+				ctx: ctx,
+				req: &todo_service.ReadAllRequest{
+					Api:     "v1",
+					OrderBy: "description",
+				},
+			},
+			mock:    func() {},
+			wantErr: true,
+		},
+		{
+			name: "Invalid pageToken",
+			s:    s,
+			args: args{
+				ctx: ctx,
+				req: &todo_service.ReadAllRequest{
+					Api:       "v1",
+					PageToken: "not a token",
+				},
+			},
+			mock:    func() {},
+			wantErr: true,
+		},
 		{
 			name: "Unsupported API",
 			s:    s,
@@ -649,3 +872,185 @@ func Test_toDoServiceServer_ReadAll(t *testing.T) {
 		})
 	}
 }
+
+// watchStream is fake server stream collecting sent WatchToDos responses
+type watchStream struct {
+	grpc.ServerStream
+	ctx  context.Context
+	sent chan *todo_service.WatchResponse
+}
+
+func (w *watchStream) Context() context.Context {
+	return w.ctx
+}
+
+func (w *watchStream) Send(resp *todo_service.WatchResponse) error {
+	w.sent <- resp
+	return nil
+}
+
+func Test_toDoServiceServer_WatchToDos(t *testing.T) {
+	ctx, cancel := context.WithCancel(auth.WithOwner(context.Background(), testOwner))
+	defer cancel()
+	broker := events.NewBroker(events.DefaultHistorySize)
+	s := NewToDoServiceServer(store.NewMemoryStore(), broker, nil)
+	reminder, _ := ptypes.TimestampProto(time.Now().In(time.UTC))
+
+	created, err := s.Create(ctx, &todo_service.CreateRequest{Api: "v1",
+		ToDo: &todo_service.ToDo{Title: "title", Description: "description", Reminder: reminder}})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	// resume after creation, so later changes are received no matter when the watcher subscribes
+	stream := &watchStream{ctx: ctx, sent: make(chan *todo_service.WatchResponse, 10)}
+	req := &todo_service.WatchRequest{Api: "v1", FromRevision: broker.Revision()}
+	done := make(chan error, 1)
+	go func() {
+		done <- s.WatchToDos(req, stream)
+	}()
+	if _, err := s.Update(ctx, &todo_service.UpdateRequest{Api: "v1",
+		ToDo: &todo_service.ToDo{Id: created.Id, Title: "new title", Reminder: reminder}}); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if _, err := s.Delete(ctx, &todo_service.DeleteRequest{Api: "v1", Id: created.Id}); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+
+	var got []todo_service.ToDoEvent_Type
+	for len(got) == 0 || got[len(got)-1] != todo_service.ToDoEvent_DELETED {
+		select {
+		case resp := <-stream.sent:
+			if resp.Event.ToDo.Id != created.Id {
+				t.Errorf("event for ToDo %d, want %d", resp.Event.ToDo.Id, created.Id)
+			}
+			got = append(got, resp.Event.Type)
+		case err := <-done:
+			t.Fatalf("WatchToDos() ended with %v", err)
+		case <-time.After(time.Second):
+			t.Fatalf("timeout waiting for events, got %v", got)
+		}
+	}
+	if len(got) != 2 || got[0] != todo_service.ToDoEvent_UPDATED {
+		t.Errorf("received events %v, want [UPDATED DELETED]", got)
+	}
+
+	cancel()
+	if err := <-done; status.Code(err) != codes.Canceled {
+		t.Errorf("WatchToDos() error = %v, want Canceled", err)
+	}
+
+	// resuming from a revision which was never published fails
+	err = s.WatchToDos(&todo_service.WatchRequest{Api: "v1", FromRevision: 1000}, stream)
+	if status.Code(err) != codes.OutOfRange {
+		t.Errorf("WatchToDos() error = %v, want OutOfRange", err)
+	}
+}
+
+func Test_toDoServiceServer_Ownership(t *testing.T) {
+	alice := auth.WithOwner(context.Background(), "alice")
+	bob, cancel := context.WithCancel(auth.WithOwner(context.Background(), "bob"))
+	defer cancel()
+	broker := events.NewBroker(events.DefaultHistorySize)
+	s := NewToDoServiceServer(store.NewMemoryStore(), broker, nil)
+	reminder, _ := ptypes.TimestampProto(time.Now().In(time.UTC))
+	newToDo := func(title string) *todo_service.ToDo {
+		// owner sent by client is ignored
+		return &todo_service.ToDo{Title: title, Reminder: reminder, OwnerId: "bob"}
+	}
+
+	// calls without authenticated user are rejected
+	if _, err := s.ReadAll(context.Background(), &todo_service.ReadAllRequest{Api: "v1"}); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("ReadAll() without owner error = %v, want Unauthenticated", err)
+	}
+
+	// bob watches his changes only
+	if _, err := s.Create(bob, &todo_service.CreateRequest{Api: "v1", ToDo: newToDo("bob's first")}); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	stream := &watchStream{ctx: bob, sent: make(chan *todo_service.WatchResponse, 10)}
+	req := &todo_service.WatchRequest{Api: "v1", FromRevision: broker.Revision()}
+	done := make(chan error, 1)
+	go func() {
+		done <- s.WatchToDos(req, stream)
+	}()
+
+	created, err := s.Create(alice, &todo_service.CreateRequest{Api: "v1", ToDo: newToDo("alice's")})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if got, err := s.Read(alice, &todo_service.ReadRequest{Api: "v1", Id: created.Id}); err != nil || got.ToDo.OwnerId != "alice" {
+		t.Errorf("Read() by owner = %v, %v, want ToDo owned by alice", got, err)
+	}
+
+	// ToDos of other users are not found
+	if _, err := s.Read(bob, &todo_service.ReadRequest{Api: "v1", Id: created.Id}); status.Code(err) != codes.NotFound {
+		t.Errorf("Read() of foreign ToDo error = %v, want NotFound", err)
+	}
+	foreign := newToDo("stolen")
+	foreign.Id = created.Id
+	if _, err := s.Update(bob, &todo_service.UpdateRequest{Api: "v1", ToDo: foreign}); status.Code(err) != codes.NotFound {
+		t.Errorf("Update() of foreign ToDo error = %v, want NotFound", err)
+	}
+	if _, err := s.Delete(bob, &todo_service.DeleteRequest{Api: "v1", Id: created.Id}); status.Code(err) != codes.NotFound {
+		t.Errorf("Delete() of foreign ToDo error = %v, want NotFound", err)
+	}
+	if got, err := s.ReadAll(bob, &todo_service.ReadAllRequest{Api: "v1"}); err != nil || got.TotalSize != 1 {
+		t.Errorf("ReadAll() by other user = %v, %v, want his ToDo only", got, err)
+	}
+
+	own, err := s.Create(bob, &todo_service.CreateRequest{Api: "v1", ToDo: newToDo("bob's")})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	select {
+	case resp := <-stream.sent:
+		if resp.Event.ToDo.Id != own.Id {
+			t.Errorf("bob received event for ToDo %d, want %d", resp.Event.ToDo.Id, own.Id)
+		}
+	case err := <-done:
+		t.Fatalf("WatchToDos() ended with %v", err)
+	case <-time.After(time.Second):
+		t.Fatalf("timeout waiting for bob's event")
+	}
+	cancel()
+	<-done
+}
+
+func Test_toDoServiceServer_Update_Version(t *testing.T) {
+	ctx := auth.WithOwner(context.Background(), testOwner)
+	s := NewToDoServiceServer(store.NewMemoryStore(), events.NewBroker(events.DefaultHistorySize), nil)
+	reminder, _ := ptypes.TimestampProto(time.Now().In(time.UTC))
+	created, err := s.Create(ctx, &todo_service.CreateRequest{Api: "v1",
+		ToDo: &todo_service.ToDo{Title: "title", Description: "description", Reminder: reminder}})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	// two clients update version 1, the second one is rejected
+	first := &todo_service.ToDo{Id: created.Id, Title: "first", Description: "description", Reminder: reminder, Version: 1}
+	if got, err := s.Update(ctx, &todo_service.UpdateRequest{Api: "v1", ToDo: first}); err != nil || got.Version != 2 {
+		t.Fatalf("Update() = %v, %v, want version 2", got, err)
+	}
+	second := &todo_service.ToDo{Id: created.Id, Title: "second", Description: "description", Reminder: reminder, Version: 1}
+	if _, err := s.Update(ctx, &todo_service.UpdateRequest{Api: "v1", ToDo: second}); status.Code(err) != codes.Aborted {
+		t.Errorf("Update() of stale version error = %v, want Aborted", err)
+	}
+	_, err = s.BatchUpdate(ctx, &todo_service.BatchUpdateRequest{Api: "v1", ToDos: []*todo_service.ToDo{second}})
+	if status.Code(err) != codes.Aborted {
+		t.Errorf("BatchUpdate() of stale version error = %v, want Aborted", err)
+	}
+
+	// update mask changes listed fields only
+	patch := &todo_service.UpdateRequest{Api: "v1",
+		ToDo:       &todo_service.ToDo{Id: created.Id, Description: "patched", Version: 2},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"id", "description", "version"}}}
+	if got, err := s.Update(ctx, patch); err != nil || got.Version != 3 {
+		t.Fatalf("Update() with mask = %v, %v, want version 3", got, err)
+	}
+	got, _ := s.Read(ctx, &todo_service.ReadRequest{Api: "v1", Id: created.Id})
+	want := &todo_service.ToDo{Id: created.Id, Title: "first", Description: "patched", Reminder: reminder, OwnerId: testOwner, Version: 3}
+	if !proto.Equal(got.ToDo, want) {
+		t.Errorf("Read() after Update() with mask = %v, want %v", got.ToDo, want)
+	}
+}
@@ -0,0 +1,100 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/iproduct/coursego/10-grpc-todos/generated/todo_service"
+	"github.com/iproduct/coursego/10-grpc-todos/store"
+)
+
+// ListTrash returns deleted todo tasks, most recently deleted first, one page at a time
+func (s *toDoServiceServer) ListTrash(ctx context.Context, req *todo_service.ListTrashRequest) (*todo_service.ListTrashResponse, error) {
+	// check if the API version requested by client-grpc is supported by grpc-server
+	if err := s.checkAPI(req.Api); err != nil {
+		return nil, err
+	}
+	ownerID, err := owner(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	q, err := pageQuery(req.PageSize, req.PageToken)
+	if err != nil {
+		return nil, err
+	}
+	q.Owner = ownerID
+	q.Deleted = store.OnlyDeleted
+	q.OrderBy, q.Desc = store.OrderByDeletedAt, true
+
+	// get deleted ToDo list page
+	list, total, err := s.store.ReadAll(ctx, q)
+	if err != nil {
+		return nil, storeError(err, 0)
+	}
+
+	return &todo_service.ListTrashResponse{
+		Api:           apiVersion,
+		ToDos:         list,
+		NextPageToken: nextPageToken(q, len(list), total),
+		TotalSize:     total,
+	}, nil
+}
+
+// Restore deleted todo task from trash
+func (s *toDoServiceServer) Restore(ctx context.Context, req *todo_service.RestoreRequest) (*todo_service.RestoreResponse, error) {
+	// check if the API version requested by client-grpc is supported by grpc-server
+	if err := s.checkAPI(req.Api); err != nil {
+		return nil, err
+	}
+	ownerID, err := owner(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// restore ToDo, reading its data for watchers
+	var restored *todo_service.ToDo
+	err = s.store.InTx(ctx, func(tx store.Tx) error {
+		if _, err := tx.Restore(ctx, ownerID, req.Id); err != nil {
+			return err
+		}
+		restored, err = tx.Read(ctx, ownerID, req.Id)
+		return err
+	})
+	if err != nil {
+		return nil, storeError(err, req.Id)
+	}
+	s.events.Publish(todo_service.ToDoEvent_RESTORED, restored)
+
+	return &todo_service.RestoreResponse{
+		Api:      apiVersion,
+		Restored: 1,
+	}, nil
+}
+
+// Purge permanently deletes todo task from trash, or all tasks in trash
+func (s *toDoServiceServer) Purge(ctx context.Context, req *todo_service.PurgeRequest) (*todo_service.PurgeResponse, error) {
+	// check if the API version requested by client-grpc is supported by grpc-server
+	if err := s.checkAPI(req.Api); err != nil {
+		return nil, err
+	}
+	ownerID, err := owner(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows int64
+	if req.All {
+		rows, err = s.store.PurgeDeleted(ctx, ownerID, time.Now())
+	} else {
+		rows, err = s.store.Purge(ctx, ownerID, req.Id)
+	}
+	if err != nil {
+		return nil, storeError(err, req.Id)
+	}
+
+	return &todo_service.PurgeResponse{
+		Api:    apiVersion,
+		Purged: rows,
+	}, nil
+}
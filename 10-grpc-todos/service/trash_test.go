@@ -0,0 +1,96 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/iproduct/coursego/10-grpc-todos/auth"
+	"github.com/iproduct/coursego/10-grpc-todos/events"
+	"github.com/iproduct/coursego/10-grpc-todos/generated/todo_service"
+	"github.com/iproduct/coursego/10-grpc-todos/store"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func Test_toDoServiceServer_Trash(t *testing.T) {
+	ctx := auth.WithOwner(context.Background(), testOwner)
+	broker := events.NewBroker(events.DefaultHistorySize)
+	s := NewToDoServiceServer(store.NewMemoryStore(), broker, nil)
+	reminder, _ := ptypes.TimestampProto(time.Now().In(time.UTC))
+	var ids []int64
+	for _, title := range []string{"first", "second", "third"} {
+		created, err := s.Create(ctx, &todo_service.CreateRequest{Api: "v1", ToDo: &todo_service.ToDo{Title: title, Reminder: reminder}})
+		if err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+		ids = append(ids, created.Id)
+	}
+	for _, id := range ids[:2] {
+		if _, err := s.Delete(ctx, &todo_service.DeleteRequest{Api: "v1", Id: id}); err != nil {
+			t.Fatalf("Delete() error = %v", err)
+		}
+	}
+
+	// deleted ToDos are hidden by default
+	if _, err := s.Read(ctx, &todo_service.ReadRequest{Api: "v1", Id: ids[0]}); status.Code(err) != codes.NotFound {
+		t.Errorf("Read() of deleted ToDo error = %v, want NotFound", err)
+	}
+	if got, err := s.ReadAll(ctx, &todo_service.ReadAllRequest{Api: "v1"}); err != nil || got.TotalSize != 1 {
+		t.Errorf("ReadAll() = %v, %v, want 1 ToDo", got, err)
+	}
+	if got, err := s.ReadAll(ctx, &todo_service.ReadAllRequest{Api: "v1", ShowDeleted: true}); err != nil || got.TotalSize != 3 {
+		t.Errorf("ReadAll() with deleted = %v, %v, want 3 ToDos", got, err)
+	}
+
+	// trash lists the most recently deleted first
+	trash, err := s.ListTrash(ctx, &todo_service.ListTrashRequest{Api: "v1", PageSize: 1})
+	if err != nil || trash.TotalSize != 2 || len(trash.ToDos) != 1 || trash.ToDos[0].Id != ids[1] || trash.NextPageToken == "" {
+		t.Fatalf("ListTrash() = %v, %v, want first page with ToDo %d", trash, err, ids[1])
+	}
+	if trash.ToDos[0].DeletedAt == nil {
+		t.Errorf("ListTrash() ToDo has no deletedAt")
+	}
+	other := auth.WithOwner(context.Background(), "other")
+	if got, err := s.ListTrash(other, &todo_service.ListTrashRequest{Api: "v1"}); err != nil || got.TotalSize != 0 {
+		t.Errorf("ListTrash() by other user = %v, %v, want empty trash", got, err)
+	}
+
+	// restored ToDo is back and watchers are notified
+	rev := broker.Revision()
+	if _, err := s.Restore(other, &todo_service.RestoreRequest{Api: "v1", Id: ids[0]}); status.Code(err) != codes.NotFound {
+		t.Errorf("Restore() of foreign ToDo error = %v, want NotFound", err)
+	}
+	if got, err := s.Restore(ctx, &todo_service.RestoreRequest{Api: "v1", Id: ids[0]}); err != nil || got.Restored != 1 {
+		t.Fatalf("Restore() = %v, %v, want 1 restored", got, err)
+	}
+	if _, err := s.Read(ctx, &todo_service.ReadRequest{Api: "v1", Id: ids[0]}); err != nil {
+		t.Errorf("Read() of restored ToDo error = %v", err)
+	}
+	sub, _ := broker.Subscribe(rev)
+	defer sub.Close()
+	if ev := <-sub.Events(); ev.Type != todo_service.ToDoEvent_RESTORED || ev.ToDo.Id != ids[0] {
+		t.Errorf("event after Restore() = %v, want RESTORED of ToDo %d", ev, ids[0])
+	}
+
+	// purged ToDos are gone for good
+	if _, err := s.Purge(ctx, &todo_service.PurgeRequest{Api: "v1", Id: ids[2]}); status.Code(err) != codes.NotFound {
+		t.Errorf("Purge() of live ToDo error = %v, want NotFound", err)
+	}
+	if got, err := s.Purge(ctx, &todo_service.PurgeRequest{Api: "v1", Id: ids[1]}); err != nil || got.Purged != 1 {
+		t.Errorf("Purge() = %v, %v, want 1 purged", got, err)
+	}
+	if _, err := s.Restore(ctx, &todo_service.RestoreRequest{Api: "v1", Id: ids[1]}); status.Code(err) != codes.NotFound {
+		t.Errorf("Restore() of purged ToDo error = %v, want NotFound", err)
+	}
+	if _, err := s.Delete(ctx, &todo_service.DeleteRequest{Api: "v1", Id: ids[0]}); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if got, err := s.Purge(ctx, &todo_service.PurgeRequest{Api: "v1", All: true}); err != nil || got.Purged != 1 {
+		t.Errorf("Purge() of all = %v, %v, want 1 purged", got, err)
+	}
+	if got, err := s.ReadAll(ctx, &todo_service.ReadAllRequest{Api: "v1", ShowDeleted: true}); err != nil || got.TotalSize != 1 {
+		t.Errorf("ReadAll() after Purge() = %v, %v, want 1 ToDo", got, err)
+	}
+}
@@ -7,6 +7,12 @@ CREATE TABLE `ToDo`
     `title`       varchar(200)    DEFAULT NULL,
     `description` varchar(1024)   DEFAULT NULL,
     `reminder`    timestamp  NULL DEFAULT NULL,
+    `owner_id`    varchar(64)     NOT NULL DEFAULT '',
+    `version`     bigint(20)      NOT NULL DEFAULT 1,
+    `deleted_at`  timestamp  NULL DEFAULT NULL,
     PRIMARY KEY (`id`),
-    UNIQUE KEY `ID_UNIQUE` (`id`)
+    UNIQUE KEY `ID_UNIQUE` (`id`),
+    KEY `IDX_REMINDER` (`reminder`),
+    KEY `IDX_OWNER` (`owner_id`),
+    KEY `IDX_DELETED_AT` (`deleted_at`)
 );
\ No newline at end of file
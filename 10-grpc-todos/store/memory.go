@@ -0,0 +1,278 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/iproduct/coursego/10-grpc-todos/generated/todo_service"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// memoryTx implements ToDo operations on ToDos map without locking
+type memoryTx struct {
+	nextID int64
+	todos  map[int64]*todo_service.ToDo
+}
+
+// MemoryStore is ToDoStore implementation keeping ToDos in a map.
+// It is safe for concurrent use. Stored and returned ToDos are copies,
+// so callers can not modify the store contents by accident.
+type MemoryStore struct {
+	mu   sync.RWMutex
+	data memoryTx
+}
+
+// NewMemoryStore creates empty in-memory ToDoStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{data: memoryTx{todos: make(map[int64]*todo_service.ToDo)}}
+}
+
+// Create inserts new ToDo with version 1 and returns its generated ID
+func (s *MemoryStore) Create(ctx context.Context, td *todo_service.ToDo) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data.Create(ctx, td)
+}
+
+// Read returns owner's ToDo by ID or ErrNotFound
+func (s *MemoryStore) Read(ctx context.Context, owner string, id int64) (*todo_service.ToDo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.data.Read(ctx, owner, id)
+}
+
+// Update overwrites data of ToDo owned by td.OwnerId if its stored version is td.Version, and increases the version.
+// Returns number of updated entities, ErrNotFound, or ErrConflict if the stored version differs.
+func (s *MemoryStore) Update(ctx context.Context, td *todo_service.ToDo) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data.Update(ctx, td)
+}
+
+// Delete moves owner's ToDo to trash and returns number of deleted entities or ErrNotFound
+func (s *MemoryStore) Delete(ctx context.Context, owner string, id int64) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data.Delete(ctx, owner, id)
+}
+
+// Restore moves owner's ToDo back from trash and returns number of restored entities or ErrNotFound
+func (s *MemoryStore) Restore(ctx context.Context, owner string, id int64) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data.Restore(ctx, owner, id)
+}
+
+// Purge removes owner's ToDo from trash permanently and returns number of purged entities or ErrNotFound
+func (s *MemoryStore) Purge(ctx context.Context, owner string, id int64) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data.Purge(ctx, owner, id)
+}
+
+// PurgeDeleted permanently removes ToDos deleted before given time and returns their number.
+// Empty owner means ToDos of all owners.
+func (s *MemoryStore) PurgeDeleted(ctx context.Context, owner string, before time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var purged int64
+	for id, td := range s.data.todos {
+		if td.DeletedAt != nil && td.DeletedAt.AsTime().Before(before) && (owner == "" || td.OwnerId == owner) {
+			delete(s.data.todos, id)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+// InTx runs fn on a copy of the store data, which replaces the data if fn returns nil.
+// Other operations wait until the transaction ends.
+func (s *MemoryStore) InTx(ctx context.Context, fn func(tx Tx) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// stored ToDos are never modified in place, so copying the map is enough
+	tx := &memoryTx{nextID: s.data.nextID, todos: make(map[int64]*todo_service.ToDo, len(s.data.todos))}
+	for id, td := range s.data.todos {
+		tx.todos[id] = td
+	}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	s.data = *tx
+	return nil
+}
+
+// Create inserts new ToDo with version 1 and returns its generated ID
+func (t *memoryTx) Create(ctx context.Context, td *todo_service.ToDo) (int64, error) {
+	t.nextID++
+	stored := proto.Clone(td).(*todo_service.ToDo)
+	stored.Id = t.nextID
+	stored.Version = 1
+	stored.DeletedAt = nil
+	t.todos[stored.Id] = stored
+	return stored.Id, nil
+}
+
+// Read returns owner's ToDo by ID or ErrNotFound
+func (t *memoryTx) Read(ctx context.Context, owner string, id int64) (*todo_service.ToDo, error) {
+	td, ok := t.find(owner, id, false)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return proto.Clone(td).(*todo_service.ToDo), nil
+}
+
+// find returns owner's ToDo by ID, if it is in the trash or not as requested
+func (t *memoryTx) find(owner string, id int64, deleted bool) (*todo_service.ToDo, bool) {
+	td, ok := t.todos[id]
+	if !ok || td.OwnerId != owner || (td.DeletedAt != nil) != deleted {
+		return nil, false
+	}
+	return td, true
+}
+
+// Update overwrites data of ToDo owned by td.OwnerId if its stored version is td.Version, and increases the version.
+// Returns number of updated entities, ErrNotFound, or ErrConflict if the stored version differs.
+func (t *memoryTx) Update(ctx context.Context, td *todo_service.ToDo) (int64, error) {
+	stored, ok := t.find(td.OwnerId, td.Id, false)
+	if !ok {
+		return 0, ErrNotFound
+	}
+	if stored.Version != td.Version {
+		return 0, ErrConflict
+	}
+	updated := proto.Clone(td).(*todo_service.ToDo)
+	updated.Version++
+	updated.DeletedAt = nil
+	t.todos[td.Id] = updated
+	return 1, nil
+}
+
+// Delete moves owner's ToDo to trash and returns number of deleted entities or ErrNotFound
+func (t *memoryTx) Delete(ctx context.Context, owner string, id int64) (int64, error) {
+	td, ok := t.find(owner, id, false)
+	if !ok {
+		return 0, ErrNotFound
+	}
+	deleted := proto.Clone(td).(*todo_service.ToDo)
+	deleted.DeletedAt = timestamppb.Now()
+	t.todos[id] = deleted
+	return 1, nil
+}
+
+// Restore moves owner's ToDo back from trash and returns number of restored entities or ErrNotFound
+func (t *memoryTx) Restore(ctx context.Context, owner string, id int64) (int64, error) {
+	td, ok := t.find(owner, id, true)
+	if !ok {
+		return 0, ErrNotFound
+	}
+	restored := proto.Clone(td).(*todo_service.ToDo)
+	restored.DeletedAt = nil
+	t.todos[id] = restored
+	return 1, nil
+}
+
+// Purge removes owner's ToDo from trash permanently and returns number of purged entities or ErrNotFound
+func (t *memoryTx) Purge(ctx context.Context, owner string, id int64) (int64, error) {
+	if _, ok := t.find(owner, id, true); !ok {
+		return 0, ErrNotFound
+	}
+	delete(t.todos, id)
+	return 1, nil
+}
+
+// ReadAll returns page of ToDos selected and sorted by the query,
+// together with the total number of ToDos matching the query filters
+func (s *MemoryStore) ReadAll(ctx context.Context, q Query) ([]*todo_service.ToDo, int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	list := make([]*todo_service.ToDo, 0, len(s.data.todos))
+	for _, td := range s.data.todos {
+		if matches(td, q) {
+			list = append(list, td)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if q.Desc {
+			return less(list[j], list[i], q.OrderBy)
+		}
+		return less(list[i], list[j], q.OrderBy)
+	})
+
+	total := int64(len(list))
+	if q.Offset >= len(list) {
+		list = nil
+	} else {
+		list = list[q.Offset:]
+	}
+	if q.Limit > 0 && len(list) > q.Limit {
+		list = list[:q.Limit]
+	}
+	page := make([]*todo_service.ToDo, len(list))
+	for i, td := range list {
+		page[i] = proto.Clone(td).(*todo_service.ToDo)
+	}
+	return page, total, nil
+}
+
+// Close does nothing for in-memory store
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+// matches checks if ToDo satisfies query filters
+func matches(td *todo_service.ToDo, q Query) bool {
+	if q.Owner != "" && td.OwnerId != q.Owner {
+		return false
+	}
+	switch q.Deleted {
+	case HideDeleted:
+		if td.DeletedAt != nil {
+			return false
+		}
+	case OnlyDeleted:
+		if td.DeletedAt == nil {
+			return false
+		}
+	}
+	if q.Text != "" {
+		text := strings.ToLower(q.Text)
+		if !strings.Contains(strings.ToLower(td.Title), text) &&
+			!strings.Contains(strings.ToLower(td.Description), text) {
+			return false
+		}
+	}
+	reminder := td.Reminder.AsTime()
+	if q.ReminderFrom != nil && reminder.Before(*q.ReminderFrom) {
+		return false
+	}
+	if q.ReminderTo != nil && !reminder.Before(*q.ReminderTo) {
+		return false
+	}
+	return true
+}
+
+// less compares ToDos by given sort field, using ID as tie-breaker
+func less(a, b *todo_service.ToDo, orderBy string) bool {
+	switch orderBy {
+	case OrderByTitle:
+		if a.Title != b.Title {
+			return a.Title < b.Title
+		}
+	case OrderByReminder:
+		ra, rb := a.Reminder.AsTime(), b.Reminder.AsTime()
+		if !ra.Equal(rb) {
+			return ra.Before(rb)
+		}
+	case OrderByDeletedAt:
+		da, db := a.DeletedAt.AsTime(), b.DeletedAt.AsTime()
+		if !da.Equal(db) {
+			return da.Before(db)
+		}
+	}
+	return a.Id < b.Id
+}
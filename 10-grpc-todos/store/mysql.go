@@ -0,0 +1,20 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+
+	// mysql driver
+	_ "github.com/go-sql-driver/mysql"
+)
+
+// OpenMySQL opens MySQL database using given DSN.
+// The schema is expected to exist already (see sql/create.sql).
+// Add parseTime=true parameter to the DSN to parse date/time columns.
+func OpenMySQL(dsn string) (*SQLStore, error) {
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %v", err)
+	}
+	return NewSQLStore(db), nil
+}
@@ -0,0 +1,318 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/iproduct/coursego/10-grpc-todos/generated/todo_service"
+)
+
+// querier executes statements directly on database or inside transaction
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// sqlTx implements ToDo operations using database or transaction
+type sqlTx struct {
+	q querier
+}
+
+// SQLStore is ToDoStore implementation using database/sql.
+// Statements use only portable SQL, so the same implementation works with MySQL and SQLite.
+type SQLStore struct {
+	sqlTx
+	db *sql.DB
+}
+
+// NewSQLStore creates ToDoStore using already opened database
+func NewSQLStore(db *sql.DB) *SQLStore {
+	return &SQLStore{sqlTx: sqlTx{q: tracedQuerier{q: db}}, db: db}
+}
+
+// DB returns underlying database handle
+func (s *SQLStore) DB() *sql.DB {
+	return s.db
+}
+
+// Create inserts new ToDo with version 1 and returns its generated ID
+func (s sqlTx) Create(ctx context.Context, td *todo_service.ToDo) (int64, error) {
+	reminder, err := ptypes.Timestamp(td.Reminder)
+	if err != nil {
+		return 0, fmt.Errorf("reminder field has invalid format-> %w", err)
+	}
+
+	// insert ToDo entity data
+	res, err := s.q.ExecContext(ctx, "INSERT INTO ToDo(title, description, reminder, owner_id, version) VALUES(?, ?, ?, ?, 1)",
+		td.Title, td.Description, reminder, td.OwnerId)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert into ToDo-> %w", err)
+	}
+
+	// get ID of creates ToDo
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to retrieve id for created ToDo-> %w", err)
+	}
+	return id, nil
+}
+
+// Read returns owner's ToDo by ID or ErrNotFound
+func (s sqlTx) Read(ctx context.Context, owner string, id int64) (*todo_service.ToDo, error) {
+	// query ToDo by ID
+	rows, err := s.q.QueryContext(ctx, "SELECT "+toDoColumns+" FROM ToDo WHERE id=? AND owner_id=? AND deleted_at IS NULL", id, owner)
+	if err != nil {
+		return nil, fmt.Errorf("failed to select from ToDo-> %w", err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("failed to retrieve data from ToDo-> %w", err)
+		}
+		return nil, ErrNotFound
+	}
+
+	// get ToDo data
+	td, err := scanToDo(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	if rows.Next() {
+		return nil, fmt.Errorf("found multiple ToDo rows with ID='%d'", id)
+	}
+	return td, nil
+}
+
+// Update overwrites data of ToDo owned by td.OwnerId if its stored version is td.Version, and increases the version.
+// Returns number of updated entities, ErrNotFound, or ErrConflict if the stored version differs.
+func (s sqlTx) Update(ctx context.Context, td *todo_service.ToDo) (int64, error) {
+	reminder, err := ptypes.Timestamp(td.Reminder)
+	if err != nil {
+		return 0, fmt.Errorf("reminder field has invalid format-> %w", err)
+	}
+
+	// update ToDo, if it was not changed since the version
+	res, err := s.q.ExecContext(ctx, "UPDATE ToDo SET title=?, description=?, reminder=?, version=version+1 WHERE id=? AND owner_id=? AND version=? AND deleted_at IS NULL",
+		td.Title, td.Description, reminder, td.Id, td.OwnerId, td.Version)
+	if err != nil {
+		return 0, fmt.Errorf("failed to update ToDo-> %w", err)
+	}
+	rows, err := rowsAffected(res)
+	if errors.Is(err, ErrNotFound) {
+		// tell missing ToDo from changed one
+		if _, err := s.Read(ctx, td.OwnerId, td.Id); err != nil {
+			return 0, err
+		}
+		return 0, ErrConflict
+	}
+	return rows, err
+}
+
+// Delete moves owner's ToDo to trash and returns number of deleted entities or ErrNotFound
+func (s sqlTx) Delete(ctx context.Context, owner string, id int64) (int64, error) {
+	// mark ToDo as deleted
+	res, err := s.q.ExecContext(ctx, "UPDATE ToDo SET deleted_at=? WHERE id=? AND owner_id=? AND deleted_at IS NULL",
+		time.Now().UTC(), id, owner)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete ToDo-> %w", err)
+	}
+	return rowsAffected(res)
+}
+
+// Restore moves owner's ToDo back from trash and returns number of restored entities or ErrNotFound
+func (s sqlTx) Restore(ctx context.Context, owner string, id int64) (int64, error) {
+	res, err := s.q.ExecContext(ctx, "UPDATE ToDo SET deleted_at=NULL WHERE id=? AND owner_id=? AND deleted_at IS NOT NULL",
+		id, owner)
+	if err != nil {
+		return 0, fmt.Errorf("failed to restore ToDo-> %w", err)
+	}
+	return rowsAffected(res)
+}
+
+// Purge removes owner's ToDo from trash permanently and returns number of purged entities or ErrNotFound
+func (s sqlTx) Purge(ctx context.Context, owner string, id int64) (int64, error) {
+	res, err := s.q.ExecContext(ctx, "DELETE FROM ToDo WHERE id=? AND owner_id=? AND deleted_at IS NOT NULL", id, owner)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge ToDo-> %w", err)
+	}
+	return rowsAffected(res)
+}
+
+// PurgeDeleted permanently removes ToDos deleted before given time and returns their number.
+// Empty owner means ToDos of all owners.
+func (s *SQLStore) PurgeDeleted(ctx context.Context, owner string, before time.Time) (int64, error) {
+	statement := "DELETE FROM ToDo WHERE deleted_at < ?"
+	args := []interface{}{before.UTC()}
+	if owner != "" {
+		statement += " AND owner_id = ?"
+		args = append(args, owner)
+	}
+	res, err := s.q.ExecContext(ctx, statement, args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge deleted ToDos-> %w", err)
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to retrieve rows affected value-> %w", err)
+	}
+	return rows, nil
+}
+
+// InTx runs fn in database transaction, which is committed if fn returns nil and rolled back otherwise.
+// Statements of the transaction are traced as children of the transaction span.
+func (s *SQLStore) InTx(ctx context.Context, fn func(tx Tx) error) (err error) {
+	ctx, span := tracer.Start(ctx, "sql.Tx")
+	defer func() { endSpan(span, err) }()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction-> %w", err)
+	}
+	// rollback does nothing after successful commit
+	defer tx.Rollback()
+
+	if err := fn(sqlTx{q: tracedQuerier{q: tx}}); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction-> %w", err)
+	}
+	return nil
+}
+
+// ReadAll returns page of ToDos selected and sorted by the query,
+// together with the total number of ToDos matching the query filters
+func (s *SQLStore) ReadAll(ctx context.Context, q Query) ([]*todo_service.ToDo, int64, error) {
+	where, args := whereClause(q)
+
+	// count all matching ToDos
+	var total int64
+	if err := s.q.QueryRowContext(ctx, "SELECT COUNT(*) FROM ToDo"+where, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count ToDo rows-> %w", err)
+	}
+
+	// get ToDo list
+	statement := "SELECT " + toDoColumns + " FROM ToDo" + where + orderByClause(q)
+	if q.Limit > 0 {
+		statement += " LIMIT ? OFFSET ?"
+		args = append(args, q.Limit, q.Offset)
+	}
+	rows, err := s.q.QueryContext(ctx, statement, args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to select from ToDo-> %w", err)
+	}
+	defer rows.Close()
+
+	list := []*todo_service.ToDo{}
+	for rows.Next() {
+		td, err := scanToDo(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		list = append(list, td)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("failed to retrieve data from ToDo-> %w", err)
+	}
+	return list, total, nil
+}
+
+// Close closes underlying database
+func (s *SQLStore) Close() error {
+	return s.db.Close()
+}
+
+// toDoColumns are ToDo table columns in order read by scanToDo
+const toDoColumns = "id, title, description, reminder, owner_id, version, deleted_at"
+
+// scanToDo reads ToDo from current row
+func scanToDo(rows *sql.Rows) (*todo_service.ToDo, error) {
+	td := new(todo_service.ToDo)
+	var reminder time.Time
+	var deletedAt sql.NullTime
+	if err := rows.Scan(&td.Id, &td.Title, &td.Description, &reminder, &td.OwnerId, &td.Version, &deletedAt); err != nil {
+		return nil, fmt.Errorf("failed to retrieve field values from ToDo row-> %w", err)
+	}
+	var err error
+	td.Reminder, err = ptypes.TimestampProto(reminder)
+	if err != nil {
+		return nil, fmt.Errorf("reminder field has invalid format-> %w", err)
+	}
+	if deletedAt.Valid {
+		if td.DeletedAt, err = ptypes.TimestampProto(deletedAt.Time); err != nil {
+			return nil, fmt.Errorf("deleted_at field has invalid format-> %w", err)
+		}
+	}
+	return td, nil
+}
+
+// likeEscaper escapes LIKE wildcards using '!' as escape character (works in both MySQL and SQLite)
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+// whereClause builds WHERE clause and its arguments from query filters
+func whereClause(q Query) (string, []interface{}) {
+	var conds []string
+	var args []interface{}
+	if q.Owner != "" {
+		conds = append(conds, "owner_id = ?")
+		args = append(args, q.Owner)
+	}
+	switch q.Deleted {
+	case HideDeleted:
+		conds = append(conds, "deleted_at IS NULL")
+	case OnlyDeleted:
+		conds = append(conds, "deleted_at IS NOT NULL")
+	}
+	if q.Text != "" {
+		pattern := "%" + likeEscaper.Replace(strings.ToLower(q.Text)) + "%"
+		conds = append(conds, "(LOWER(title) LIKE ? ESCAPE '!' OR LOWER(description) LIKE ? ESCAPE '!')")
+		args = append(args, pattern, pattern)
+	}
+	if q.ReminderFrom != nil {
+		conds = append(conds, "reminder >= ?")
+		args = append(args, q.ReminderFrom.UTC())
+	}
+	if q.ReminderTo != nil {
+		conds = append(conds, "reminder < ?")
+		args = append(args, q.ReminderTo.UTC())
+	}
+	if len(conds) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conds, " AND "), args
+}
+
+// orderByClause builds ORDER BY clause, using ID as tie-breaker for stable paging
+func orderByClause(q Query) string {
+	dir := " ASC"
+	if q.Desc {
+		dir = " DESC"
+	}
+	switch q.OrderBy {
+	case OrderByTitle, OrderByReminder, OrderByDeletedAt:
+		return " ORDER BY " + q.OrderBy + dir + ", id" + dir
+	default:
+		return " ORDER BY id" + dir
+	}
+}
+
+// rowsAffected returns number of affected rows or ErrNotFound if there are none
+func rowsAffected(res sql.Result) (int64, error) {
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to retrieve rows affected value-> %w", err)
+	}
+	if rows == 0 {
+		return 0, ErrNotFound
+	}
+	return rows, nil
+}
@@ -0,0 +1,42 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+
+	// pure-Go sqlite driver
+	_ "modernc.org/sqlite"
+)
+
+// sqliteSchema creates ToDo table if it does not exist yet
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS ToDo
+(
+    id          INTEGER PRIMARY KEY AUTOINCREMENT,
+    title       VARCHAR(200)  DEFAULT NULL,
+    description VARCHAR(1024) DEFAULT NULL,
+    reminder    TIMESTAMP NULL DEFAULT NULL,
+    owner_id    VARCHAR(64)   NOT NULL DEFAULT '',
+    version     BIGINT        NOT NULL DEFAULT 1,
+    deleted_at  TIMESTAMP NULL DEFAULT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_todo_reminder ON ToDo (reminder);
+CREATE INDEX IF NOT EXISTS idx_todo_owner ON ToDo (owner_id);
+CREATE INDEX IF NOT EXISTS idx_todo_deleted_at ON ToDo (deleted_at)`
+
+// OpenSQLite opens (and creates if needed) SQLite database file at path.
+// Use ":memory:" path for a private in-memory database.
+func OpenSQLite(path string) (*SQLStore, error) {
+	// purge and reminder queries compare stored times as text
+	db, err := sql.Open("sqlite", path+"?_time_format=sqlite")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %v", err)
+	}
+	// one connection serializes writes and keeps single ":memory:" database
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create database schema: %v", err)
+	}
+	return NewSQLStore(db), nil
+}
@@ -0,0 +1,120 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/iproduct/coursego/10-grpc-todos/generated/todo_service"
+)
+
+const (
+	// MySQL selects ToDoStore backed by MySQL database
+	MySQL = "mysql"
+	// SQLite selects ToDoStore backed by pure-Go SQLite database
+	SQLite = "sqlite"
+	// Memory selects in-memory ToDoStore (data is lost on restart)
+	Memory = "memory"
+)
+
+const (
+	// OrderByID sorts ToDos by ID
+	OrderByID = "id"
+	// OrderByTitle sorts ToDos by title
+	OrderByTitle = "title"
+	// OrderByReminder sorts ToDos by reminder time
+	OrderByReminder = "reminder"
+	// OrderByDeletedAt sorts ToDos by time of deletion
+	OrderByDeletedAt = "deleted_at"
+)
+
+// DeletedFilter selects ToDos by their deletion state
+type DeletedFilter int
+
+const (
+	// HideDeleted selects ToDos which are not deleted
+	HideDeleted DeletedFilter = iota
+	// ShowDeleted selects both deleted ToDos and ToDos which are not deleted
+	ShowDeleted
+	// OnlyDeleted selects deleted ToDos (the trash)
+	OnlyDeleted
+)
+
+// ErrNotFound is returned when ToDo with requested ID does not exist in the store or belongs to another owner
+var ErrNotFound = errors.New("todo not found")
+
+// ErrConflict is returned when updated ToDo was changed since the version being updated
+var ErrConflict = errors.New("todo version conflict")
+
+// Tx is set of ToDo operations available both directly on the store and inside its transactions.
+// Every ToDo belongs to an owner, ToDos of other owners are reported as not found.
+// Deleted ToDos are kept in trash until they are purged, only Restore and Purge find them.
+type Tx interface {
+	// Create inserts new ToDo owned by td.OwnerId with version 1 and returns its generated ID
+	Create(ctx context.Context, td *todo_service.ToDo) (int64, error)
+	// Read returns owner's ToDo by ID or ErrNotFound
+	Read(ctx context.Context, owner string, id int64) (*todo_service.ToDo, error)
+	// Update overwrites data of ToDo owned by td.OwnerId if its stored version is td.Version, and increases the version.
+	// Returns number of updated entities, ErrNotFound, or ErrConflict if the stored version differs.
+	Update(ctx context.Context, td *todo_service.ToDo) (int64, error)
+	// Delete moves owner's ToDo to trash and returns number of deleted entities or ErrNotFound
+	Delete(ctx context.Context, owner string, id int64) (int64, error)
+	// Restore moves owner's ToDo back from trash and returns number of restored entities or ErrNotFound
+	Restore(ctx context.Context, owner string, id int64) (int64, error)
+	// Purge removes owner's ToDo from trash permanently and returns number of purged entities or ErrNotFound
+	Purge(ctx context.Context, owner string, id int64) (int64, error)
+}
+
+// ToDoStore is storage backend used by ToDo service
+type ToDoStore interface {
+	Tx
+	// InTx runs fn in a transaction, which is committed if fn returns nil and rolled back otherwise.
+	// The store itself must not be used by fn, only the given transaction.
+	InTx(ctx context.Context, fn func(tx Tx) error) error
+	// ReadAll returns page of ToDos selected and sorted by the query,
+	// together with the total number of ToDos matching the query filters
+	ReadAll(ctx context.Context, q Query) ([]*todo_service.ToDo, int64, error)
+	// PurgeDeleted permanently removes ToDos deleted before given time and returns their number.
+	// Empty owner means ToDos of all owners.
+	PurgeDeleted(ctx context.Context, owner string, before time.Time) (int64, error)
+	// Close releases resources held by the store
+	Close() error
+}
+
+// Query selects, sorts and pages ToDos returned by ReadAll
+type Query struct {
+	// Owner selects ToDos of given owner, empty means ToDos of all owners
+	Owner string
+	// Text selects ToDos which title or description contains it (case insensitive)
+	Text string
+	// ReminderFrom selects ToDos with reminder at or after it, if not nil
+	ReminderFrom *time.Time
+	// ReminderTo selects ToDos with reminder before it, if not nil
+	ReminderTo *time.Time
+	// OrderBy is sort field: OrderByID (default), OrderByTitle, OrderByReminder or OrderByDeletedAt
+	OrderBy string
+	// Deleted selects ToDos by deletion state, deleted ToDos are hidden by default
+	Deleted DeletedFilter
+	// Desc reverses the sort order
+	Desc bool
+	// Offset is number of matching ToDos to skip
+	Offset int
+	// Limit is maximum number of ToDos to return, 0 means no limit
+	Limit int
+}
+
+// Open creates ToDoStore of given kind: MySQL, SQLite or Memory.
+// dsn is the driver specific data source name (ignored for Memory).
+func Open(kind, dsn string) (ToDoStore, error) {
+	switch kind {
+	case MySQL:
+		return OpenMySQL(dsn)
+	case SQLite:
+		return OpenSQLite(dsn)
+	case Memory:
+		return NewMemoryStore(), nil
+	default:
+		return nil, fmt.Errorf("unsupported store type: '%s'", kind)
+	}
+}
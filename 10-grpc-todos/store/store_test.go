@@ -0,0 +1,364 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/iproduct/coursego/10-grpc-todos/generated/todo_service"
+	"google.golang.org/protobuf/proto"
+)
+
+// stores returns all ToDoStore implementations which do not need external database server
+func stores(t *testing.T) map[string]ToDoStore {
+	sqlite, err := OpenSQLite(":memory:")
+	if err != nil {
+		t.Fatalf("failed to open SQLite store: %v", err)
+	}
+	return map[string]ToDoStore{
+		Memory: NewMemoryStore(),
+		SQLite: sqlite,
+	}
+}
+
+// owner is owner of ToDos created by tests
+const owner = "alice"
+
+func newToDo(title string) *todo_service.ToDo {
+	return newToDoAt(title, time.Now())
+}
+
+func newToDoAt(title string, at time.Time) *todo_service.ToDo {
+	reminder, _ := ptypes.TimestampProto(at.In(time.UTC).Truncate(time.Microsecond))
+	return &todo_service.ToDo{
+		Title:       title,
+		Description: title + " description",
+		Reminder:    reminder,
+		OwnerId:     owner,
+	}
+}
+
+func TestToDoStore_CRUD(t *testing.T) {
+	ctx := context.Background()
+	for name, st := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			defer st.Close()
+
+			td1, td2 := newToDo("first"), newToDo("second")
+			id1, err := st.Create(ctx, td1)
+			if err != nil {
+				t.Fatalf("Create() error = %v", err)
+			}
+			id2, err := st.Create(ctx, td2)
+			if err != nil {
+				t.Fatalf("Create() error = %v", err)
+			}
+			if id1 == id2 {
+				t.Fatalf("Create() returned duplicate ID %d", id1)
+			}
+
+			got, err := st.Read(ctx, owner, id1)
+			if err != nil {
+				t.Fatalf("Read() error = %v", err)
+			}
+			td1.Id, td1.Version = id1, 1
+			if !proto.Equal(got, td1) {
+				t.Errorf("Read() = %v, want %v", got, td1)
+			}
+
+			td1.Title = "first updated"
+			if n, err := st.Update(ctx, td1); err != nil || n != 1 {
+				t.Fatalf("Update() = %d, %v, want 1, nil", n, err)
+			}
+			if got, _ = st.Read(ctx, owner, id1); got.Title != "first updated" || got.Version != 2 {
+				t.Errorf("Read() after Update() title = %q, version = %d, want %q, 2", got.Title, got.Version, "first updated")
+			}
+
+			list, total, err := st.ReadAll(ctx, Query{})
+			if err != nil || total != 2 {
+				t.Fatalf("ReadAll() total = %d, error = %v, want 2, nil", total, err)
+			}
+			if len(list) != 2 || list[0].Id != id1 || list[1].Id != id2 {
+				t.Errorf("ReadAll() = %v, want ToDos with IDs %d, %d", list, id1, id2)
+			}
+
+			if n, err := st.Delete(ctx, owner, id1); err != nil || n != 1 {
+				t.Fatalf("Delete() = %d, %v, want 1, nil", n, err)
+			}
+			if _, err := st.Read(ctx, owner, id1); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Read() after Delete() error = %v, want ErrNotFound", err)
+			}
+		})
+	}
+}
+
+func TestToDoStore_NotFound(t *testing.T) {
+	ctx := context.Background()
+	for name, st := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			defer st.Close()
+
+			if _, err := st.Read(ctx, owner, 42); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Read() error = %v, want ErrNotFound", err)
+			}
+			td := newToDo("missing")
+			td.Id = 42
+			if _, err := st.Update(ctx, td); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Update() error = %v, want ErrNotFound", err)
+			}
+			if _, err := st.Delete(ctx, owner, 42); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Delete() error = %v, want ErrNotFound", err)
+			}
+		})
+	}
+}
+
+func TestToDoStore_Version(t *testing.T) {
+	ctx := context.Background()
+	for name, st := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			defer st.Close()
+
+			td := newToDo("versioned")
+			id, err := st.Create(ctx, td)
+			if err != nil {
+				t.Fatalf("Create() error = %v", err)
+			}
+			td.Id, td.Version = id, 1
+			if _, err := st.Update(ctx, td); err != nil {
+				t.Fatalf("Update() error = %v", err)
+			}
+
+			// second update of the same version is rejected
+			td.Title = "stale"
+			if _, err := st.Update(ctx, td); !errors.Is(err, ErrConflict) {
+				t.Errorf("Update() of stale version error = %v, want ErrConflict", err)
+			}
+			got, _ := st.Read(ctx, owner, id)
+			if got.Title != "versioned" || got.Version != 2 {
+				t.Errorf("Read() after conflict = %v, want title %q and version 2", got, "versioned")
+			}
+
+			// conflict is checked in transactions too
+			err = st.InTx(ctx, func(tx Tx) error {
+				_, err := tx.Update(ctx, td)
+				return err
+			})
+			if !errors.Is(err, ErrConflict) {
+				t.Errorf("InTx() Update() of stale version error = %v, want ErrConflict", err)
+			}
+		})
+	}
+}
+
+func TestToDoStore_Trash(t *testing.T) {
+	ctx := context.Background()
+	for name, st := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			defer st.Close()
+
+			id1, _ := st.Create(ctx, newToDo("first"))
+			id2, _ := st.Create(ctx, newToDo("second"))
+			if _, err := st.Restore(ctx, owner, id1); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Restore() of live ToDo error = %v, want ErrNotFound", err)
+			}
+			if _, err := st.Purge(ctx, owner, id1); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Purge() of live ToDo error = %v, want ErrNotFound", err)
+			}
+
+			// deleted ToDos are hidden, unless requested
+			for _, id := range []int64{id1, id2} {
+				if _, err := st.Delete(ctx, owner, id); err != nil {
+					t.Fatalf("Delete() error = %v", err)
+				}
+			}
+			if _, err := st.Delete(ctx, owner, id1); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Delete() of deleted ToDo error = %v, want ErrNotFound", err)
+			}
+			if _, total, _ := st.ReadAll(ctx, Query{}); total != 0 {
+				t.Errorf("ReadAll() total = %d, want 0", total)
+			}
+			if _, total, _ := st.ReadAll(ctx, Query{Deleted: ShowDeleted}); total != 2 {
+				t.Errorf("ReadAll() with deleted total = %d, want 2", total)
+			}
+			trash, _, err := st.ReadAll(ctx, Query{Deleted: OnlyDeleted, OrderBy: OrderByDeletedAt})
+			if err != nil || len(trash) != 2 || trash[0].DeletedAt == nil {
+				t.Fatalf("ReadAll() of trash = %v, %v, want 2 deleted ToDos", trash, err)
+			}
+
+			// restored ToDo is back, purged one is gone
+			if n, err := st.Restore(ctx, owner, id1); err != nil || n != 1 {
+				t.Fatalf("Restore() = %d, %v, want 1, nil", n, err)
+			}
+			if got, err := st.Read(ctx, owner, id1); err != nil || got.DeletedAt != nil {
+				t.Errorf("Read() after Restore() = %v, %v, want live ToDo", got, err)
+			}
+			if n, err := st.Purge(ctx, owner, id2); err != nil || n != 1 {
+				t.Fatalf("Purge() = %d, %v, want 1, nil", n, err)
+			}
+			if _, err := st.Restore(ctx, owner, id2); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Restore() of purged ToDo error = %v, want ErrNotFound", err)
+			}
+
+			// only ToDos deleted before the time are purged
+			st.Delete(ctx, owner, id1)
+			if n, err := st.PurgeDeleted(ctx, "", time.Now().Add(-time.Hour)); err != nil || n != 0 {
+				t.Errorf("PurgeDeleted() of old ToDos = %d, %v, want 0, nil", n, err)
+			}
+			if n, err := st.PurgeDeleted(ctx, "bob", time.Now().Add(time.Hour)); err != nil || n != 0 {
+				t.Errorf("PurgeDeleted() of other owner = %d, %v, want 0, nil", n, err)
+			}
+			if n, err := st.PurgeDeleted(ctx, "", time.Now().Add(time.Hour)); err != nil || n != 1 {
+				t.Errorf("PurgeDeleted() = %d, %v, want 1, nil", n, err)
+			}
+			if _, total, _ := st.ReadAll(ctx, Query{Deleted: ShowDeleted}); total != 0 {
+				t.Errorf("ReadAll() after PurgeDeleted() total = %d, want 0", total)
+			}
+		})
+	}
+}
+
+func TestToDoStore_Owner(t *testing.T) {
+	ctx := context.Background()
+	for name, st := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			defer st.Close()
+
+			td := newToDo("alice's")
+			id, err := st.Create(ctx, td)
+			if err != nil {
+				t.Fatalf("Create() error = %v", err)
+			}
+			other := newToDo("bob's")
+			other.OwnerId = "bob"
+			if _, err := st.Create(ctx, other); err != nil {
+				t.Fatalf("Create() error = %v", err)
+			}
+
+			// ToDos of other owners are not found
+			if _, err := st.Read(ctx, "bob", id); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Read() by other owner error = %v, want ErrNotFound", err)
+			}
+			td.Id, td.OwnerId, td.Title = id, "bob", "stolen"
+			if _, err := st.Update(ctx, td); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Update() by other owner error = %v, want ErrNotFound", err)
+			}
+			if _, err := st.Delete(ctx, "bob", id); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Delete() by other owner error = %v, want ErrNotFound", err)
+			}
+			if got, err := st.Read(ctx, owner, id); err != nil || got.Title != "alice's" {
+				t.Errorf("Read() by owner = %v, %v, want unchanged ToDo", got, err)
+			}
+
+			if list, total, err := st.ReadAll(ctx, Query{Owner: owner}); err != nil || total != 1 || list[0].Id != id {
+				t.Errorf("ReadAll() by owner = %v (total %d), %v, want only ToDo %d", list, total, err, id)
+			}
+			if _, total, err := st.ReadAll(ctx, Query{}); err != nil || total != 2 {
+				t.Errorf("ReadAll() of all owners total = %d, %v, want 2", total, err)
+			}
+		})
+	}
+}
+
+func TestToDoStore_InTx(t *testing.T) {
+	ctx := context.Background()
+	for name, st := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			defer st.Close()
+
+			kept, err := st.Create(ctx, newToDo("kept"))
+			if err != nil {
+				t.Fatalf("Create() error = %v", err)
+			}
+
+			// failed transaction leaves no changes
+			errFailed := errors.New("failed")
+			err = st.InTx(ctx, func(tx Tx) error {
+				if _, err := tx.Create(ctx, newToDo("rolled back")); err != nil {
+					return err
+				}
+				if _, err := tx.Delete(ctx, owner, kept); err != nil {
+					return err
+				}
+				if _, err := tx.Read(ctx, owner, kept); !errors.Is(err, ErrNotFound) {
+					t.Errorf("Read() in transaction after Delete() error = %v, want ErrNotFound", err)
+				}
+				return errFailed
+			})
+			if !errors.Is(err, errFailed) {
+				t.Fatalf("InTx() error = %v, want %v", err, errFailed)
+			}
+			if list, _, _ := st.ReadAll(ctx, Query{}); len(list) != 1 || list[0].Id != kept {
+				t.Errorf("ReadAll() after rollback = %v, want only ToDo %d", list, kept)
+			}
+
+			// successful transaction commits all changes
+			var created int64
+			err = st.InTx(ctx, func(tx Tx) error {
+				if created, err = tx.Create(ctx, newToDo("committed")); err != nil {
+					return err
+				}
+				_, err := tx.Delete(ctx, owner, kept)
+				return err
+			})
+			if err != nil {
+				t.Fatalf("InTx() error = %v", err)
+			}
+			if list, _, _ := st.ReadAll(ctx, Query{}); len(list) != 1 || list[0].Id != created {
+				t.Errorf("ReadAll() after commit = %v, want only ToDo %d", list, created)
+			}
+		})
+	}
+}
+
+func TestToDoStore_ReadAllQuery(t *testing.T) {
+	ctx := context.Background()
+	base := time.Date(2022, 1, 10, 9, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	from, to := base.Add(day), base.Add(4*day)
+	for name, st := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			defer st.Close()
+
+			// IDs 1..5 with reminders base, base+1d, ... base+4d
+			for i, title := range []string{"Buy milk", "Write report", "Buy bread", "Call mom", "Buy 100% juice"} {
+				if _, err := st.Create(ctx, newToDoAt(title, base.Add(time.Duration(i)*day))); err != nil {
+					t.Fatalf("Create() error = %v", err)
+				}
+			}
+
+			tests := []struct {
+				name      string
+				q         Query
+				wantIDs   []int64
+				wantTotal int64
+			}{
+				{"all", Query{}, []int64{1, 2, 3, 4, 5}, 5},
+				{"text case insensitive", Query{Text: "BUY"}, []int64{1, 3, 5}, 3},
+				{"text with wildcard", Query{Text: "100%"}, []int64{5}, 1},
+				{"reminder range", Query{ReminderFrom: &from, ReminderTo: &to}, []int64{2, 3, 4}, 3},
+				{"order by title desc", Query{OrderBy: OrderByTitle, Desc: true}, []int64{2, 4, 1, 3, 5}, 5},
+				{"order by reminder desc", Query{OrderBy: OrderByReminder, Desc: true}, []int64{5, 4, 3, 2, 1}, 5},
+				{"page", Query{Offset: 1, Limit: 2}, []int64{2, 3}, 5},
+				{"page past end", Query{Offset: 10, Limit: 2}, nil, 5},
+				{"filtered page", Query{Text: "buy", Offset: 2, Limit: 2}, []int64{5}, 3},
+			}
+			for _, tt := range tests {
+				list, total, err := st.ReadAll(ctx, tt.q)
+				if err != nil {
+					t.Fatalf("%s: ReadAll() error = %v", tt.name, err)
+				}
+				var ids []int64
+				for _, td := range list {
+					ids = append(ids, td.Id)
+				}
+				if total != tt.wantTotal || !reflect.DeepEqual(ids, tt.wantIDs) {
+					t.Errorf("%s: ReadAll() = %v (total %d), want %v (total %d)", tt.name, ids, total, tt.wantIDs, tt.wantTotal)
+				}
+			}
+		})
+	}
+}
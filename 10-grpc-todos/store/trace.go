@@ -0,0 +1,56 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer creates spans of SQL statements, it records nothing until tracing is initialized
+var tracer = otel.Tracer("github.com/iproduct/coursego/10-grpc-todos/store")
+
+// tracedQuerier executes statements in child spans of the context's span
+type tracedQuerier struct {
+	q querier
+}
+
+// startSpan starts span of the SQL statement
+func startSpan(ctx context.Context, name, query string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBStatementKey.String(query)))
+}
+
+// endSpan ends span recording the statement error
+func endSpan(span trace.Span, err error) {
+	if err != nil && err != sql.ErrNoRows {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func (t tracedQuerier) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	ctx, span := startSpan(ctx, "sql.Exec", query)
+	res, err := t.q.ExecContext(ctx, query, args...)
+	endSpan(span, err)
+	return res, err
+}
+
+func (t tracedQuerier) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	ctx, span := startSpan(ctx, "sql.Query", query)
+	rows, err := t.q.QueryContext(ctx, query, args...)
+	endSpan(span, err)
+	return rows, err
+}
+
+func (t tracedQuerier) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	ctx, span := startSpan(ctx, "sql.QueryRow", query)
+	row := t.q.QueryRowContext(ctx, query, args...)
+	endSpan(span, row.Err())
+	return row
+}
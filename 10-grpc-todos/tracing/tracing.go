@@ -0,0 +1,74 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// Stdout is tracing output writing spans to standard output
+	Stdout = "stdout"
+
+	// RequestIDKey is span attribute holding ID of the HTTP request which started the trace
+	RequestIDKey = attribute.Key("request.id")
+	// RequestIDMetadata is gRPC metadata key used by the HTTP gateway to forward request ID
+	RequestIDMetadata = "x-request-id"
+)
+
+// Init installs global tracer provider exporting spans of the service as JSON to w,
+// and W3C trace context propagation. Returned function flushes and stops the provider.
+func Init(serviceName string, w io.Writer) (func(context.Context) error, error) {
+	exporter, err := stdouttrace.New(stdouttrace.WithWriter(w), stdouttrace.WithPrettyPrint())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create span exporter-> %w", err)
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceNameKey.String(serviceName))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return provider.Shutdown, nil
+}
+
+// Start initializes tracing with spans written to output: Stdout, file path, or empty string to disable tracing.
+// Returned function flushes and stops tracing.
+func Start(serviceName, output string) (func(context.Context) error, error) {
+	switch output {
+	case "":
+		return func(context.Context) error { return nil }, nil
+	case Stdout:
+		return Init(serviceName, os.Stdout)
+	}
+	f, err := os.OpenFile(output, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open tracing output-> %w", err)
+	}
+	shutdown, err := Init(serviceName, f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return func(ctx context.Context) error {
+		defer f.Close()
+		return shutdown(ctx)
+	}, nil
+}
+
+// SetRequestID attaches request ID to the current span of the context
+func SetRequestID(ctx context.Context, id string) {
+	if id != "" {
+		trace.SpanFromContext(ctx).SetAttributes(RequestIDKey.String(id))
+	}
+}
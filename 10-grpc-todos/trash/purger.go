@@ -0,0 +1,79 @@
+package trash
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/iproduct/coursego/10-grpc-todos/store"
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultRetention is time deleted ToDos are kept in trash before they are purged
+	DefaultRetention = 30 * 24 * time.Hour
+	// DefaultInterval is time between purges
+	DefaultInterval = time.Hour
+)
+
+// Purger permanently removes ToDos of all owners, which are in trash longer than retention
+type Purger struct {
+	store     store.ToDoStore
+	retention time.Duration
+	interval  time.Duration
+	now       func() time.Time
+	log       *zap.Logger
+}
+
+// NewPurger creates purger removing ToDos deleted more than retention ago, every interval.
+// Both retention and interval must be positive.
+func NewPurger(st store.ToDoStore, retention, interval time.Duration, logger *zap.Logger) (*Purger, error) {
+	if retention <= 0 {
+		return nil, fmt.Errorf("invalid trash retention %v: must be positive", retention)
+	}
+	if interval <= 0 {
+		return nil, fmt.Errorf("invalid trash purge interval %v: must be positive", interval)
+	}
+	return &Purger{
+		store:     st,
+		retention: retention,
+		interval:  interval,
+		now:       time.Now,
+		log:       logger,
+	}, nil
+}
+
+// PurgeOnce removes ToDos deleted more than retention ago and returns their number
+func (p *Purger) PurgeOnce(ctx context.Context) (int64, error) {
+	return p.store.PurgeDeleted(ctx, "", p.now().Add(-p.retention))
+}
+
+// Run purges trash immediately and then every interval, until ctx is done
+func (p *Purger) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		purged, err := p.PurgeOnce(ctx)
+		if err != nil {
+			p.log.Error("failed to purge trash", zap.Error(err))
+		} else if purged > 0 {
+			p.log.Info("trash purged", zap.Int64("purged", purged))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Start runs purger in background until ctx is done
+func Start(ctx context.Context, st store.ToDoStore, retention, interval time.Duration, logger *zap.Logger) (*Purger, error) {
+	p, err := NewPurger(st, retention, interval, logger)
+	if err != nil {
+		return nil, err
+	}
+	go p.Run(ctx)
+	return p, nil
+}
@@ -0,0 +1,54 @@
+package trash
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/iproduct/coursego/10-grpc-todos/generated/todo_service"
+	"github.com/iproduct/coursego/10-grpc-todos/store"
+	"go.uber.org/zap"
+)
+
+func TestPurger_PurgeOnce(t *testing.T) {
+	ctx := context.Background()
+	st := store.NewMemoryStore()
+	reminder, _ := ptypes.TimestampProto(time.Now())
+	var ids []int64
+	for _, owner := range []string{"alice", "bob", "bob"} {
+		id, err := st.Create(ctx, &todo_service.ToDo{Title: owner + "'s", Reminder: reminder, OwnerId: owner})
+		if err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+		ids = append(ids, id)
+	}
+	st.Delete(ctx, "alice", ids[0])
+	st.Delete(ctx, "bob", ids[1])
+
+	p, err := NewPurger(st, time.Hour, time.Minute, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := p.PurgeOnce(ctx); err != nil || n != 0 {
+		t.Errorf("PurgeOnce() before retention = %d, %v, want 0, nil", n, err)
+	}
+
+	// deleted ToDos of all owners are purged after retention, live ones are kept
+	p.now = func() time.Time { return time.Now().Add(time.Hour + time.Second) }
+	if n, err := p.PurgeOnce(ctx); err != nil || n != 2 {
+		t.Errorf("PurgeOnce() after retention = %d, %v, want 2, nil", n, err)
+	}
+	if _, total, _ := st.ReadAll(ctx, store.Query{Deleted: store.ShowDeleted}); total != 1 {
+		t.Errorf("store contains %d ToDos after purge, want 1", total)
+	}
+}
+
+func TestNewPurger_InvalidDurations(t *testing.T) {
+	st := store.NewMemoryStore()
+	for _, d := range []struct{ retention, interval time.Duration }{{time.Hour, 0}, {time.Hour, -time.Minute}, {0, time.Minute}} {
+		if _, err := NewPurger(st, d.retention, d.interval, zap.NewNop()); err == nil {
+			t.Errorf("NewPurger(%v, %v) error = nil, want error", d.retention, d.interval)
+		}
+	}
+}
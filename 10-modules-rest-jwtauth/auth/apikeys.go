@@ -0,0 +1,40 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"strings"
+)
+
+// APIKeyPrefix starts all API keys, so they are recognized e.g. by secret scanners
+const APIKeyPrefix = "uk_"
+
+// NewAPIKey returns random API key sent to the client, its public prefix used for lookup,
+// and its hash kept in the repository. Key format is uk_<prefix>.<secret>.
+func NewAPIKey() (key, prefix, hash string, err error) {
+	if prefix, err = random(6); err != nil {
+		return "", "", "", err
+	}
+	secret, err := random(32)
+	if err != nil {
+		return "", "", "", err
+	}
+	key = APIKeyPrefix + prefix + "." + secret
+	return key, prefix, HashToken(key), nil
+}
+
+// APIKeyLookupPrefix returns public prefix of the API key, or false if the key is malformed
+func APIKeyLookupPrefix(key string) (string, bool) {
+	if !strings.HasPrefix(key, APIKeyPrefix) {
+		return "", false
+	}
+	parts := strings.SplitN(key[len(APIKeyPrefix):], ".", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", false
+	}
+	return parts[0], true
+}
+
+// APIKeyMatches checks in constant time if the API key has the hash
+func APIKeyMatches(key, hash string) bool {
+	return subtle.ConstantTimeCompare([]byte(HashToken(key)), []byte(hash)) == 1
+}
@@ -0,0 +1,218 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+const (
+	// EnvSecret is environment variable with HMAC secret signing the tokens
+	EnvSecret = "JWT_SECRET"
+	// EnvKeyDir is environment variable with directory of <kid>.pem RSA or ECDSA key files
+	EnvKeyDir = "JWT_KEY_DIR"
+	// EnvSigningKeyID is environment variable with kid of the key file signing new tokens
+	EnvSigningKeyID = "JWT_SIGNING_KID"
+	// HMACKeyID is kid of the HMAC secret
+	HMACKeyID = "hmac"
+)
+
+// Key is JWT signing or verification key identified by kid
+type Key struct {
+	ID     string
+	Method jwt.SigningMethod
+	// Private signs tokens, it is nil for verification only keys
+	Private interface{}
+	// Public verifies tokens
+	Public interface{}
+}
+
+// Keys signs tokens with current key and verifies them with any key found by kid header.
+// Old keys are kept for verification while tokens signed by them are valid, which allows rotation.
+type Keys struct {
+	signing *Key
+	byID    map[string]*Key
+}
+
+// NewKeys creates key set signing with key identified by signingID
+func NewKeys(signingID string, keys ...*Key) (*Keys, error) {
+	k := &Keys{byID: make(map[string]*Key)}
+	for _, key := range keys {
+		if _, ok := k.byID[key.ID]; ok {
+			return nil, fmt.Errorf("duplicate key ID: '%s'", key.ID)
+		}
+		k.byID[key.ID] = key
+	}
+	signing, ok := k.byID[signingID]
+	if !ok {
+		return nil, fmt.Errorf("signing key '%s' not found", signingID)
+	}
+	if signing.Private == nil {
+		return nil, fmt.Errorf("signing key '%s' is not a private key", signingID)
+	}
+	k.signing = signing
+	return k, nil
+}
+
+// HMACKey returns HS256 key with the secret
+func HMACKey(id string, secret []byte) *Key {
+	return &Key{ID: id, Method: jwt.SigningMethodHS256, Private: secret, Public: secret}
+}
+
+// ParseKey parses PEM encoded RSA or ECDSA private key, public key or certificate
+func ParseKey(id string, data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, jwt.ErrKeyMustBePEMEncoded
+	}
+	parsed, err := parseDER(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("key '%s' is not an RSA or ECDSA key", id)
+	}
+
+	switch key := parsed.(type) {
+	case *rsa.PrivateKey:
+		return &Key{ID: id, Method: jwt.SigningMethodRS256, Private: key, Public: &key.PublicKey}, nil
+	case *rsa.PublicKey:
+		return &Key{ID: id, Method: jwt.SigningMethodRS256, Public: key}, nil
+	case *ecdsa.PrivateKey:
+		method, err := ecdsaMethod(key.Curve)
+		if err != nil {
+			return nil, err
+		}
+		return &Key{ID: id, Method: method, Private: key, Public: &key.PublicKey}, nil
+	case *ecdsa.PublicKey:
+		method, err := ecdsaMethod(key.Curve)
+		if err != nil {
+			return nil, err
+		}
+		return &Key{ID: id, Method: method, Public: key}, nil
+	default:
+		return nil, fmt.Errorf("key '%s' is not an RSA or ECDSA key", id)
+	}
+}
+
+// parseDER parses DER encoded private key, public key or certificate
+func parseDER(der []byte) (interface{}, error) {
+	if key, err := x509.ParsePKCS8PrivateKey(der); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(der); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKIXPublicKey(der); err == nil {
+		return key, nil
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	return cert.PublicKey, nil
+}
+
+// ecdsaMethod returns ECDSA signing method matching the curve
+func ecdsaMethod(curve elliptic.Curve) (jwt.SigningMethod, error) {
+	switch curve {
+	case elliptic.P256():
+		return jwt.SigningMethodES256, nil
+	case elliptic.P384():
+		return jwt.SigningMethodES384, nil
+	case elliptic.P521():
+		return jwt.SigningMethodES512, nil
+	default:
+		return nil, fmt.Errorf("unsupported ECDSA curve: %s", curve.Params().Name)
+	}
+}
+
+// LoadKeyDir loads <kid>.pem key files from the directory.
+// If signingID is empty, the directory must contain single private key.
+func LoadKeyDir(dir, signingID string) (*Keys, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no key files found in '%s'", dir)
+	}
+	requestedID := signingID
+	var keys []*Key
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		key, err := ParseKey(strings.TrimSuffix(filepath.Base(file), ".pem"), data)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+		if requestedID == "" && key.Private != nil {
+			if signingID != "" {
+				return nil, fmt.Errorf("several private keys in '%s', set %s", dir, EnvSigningKeyID)
+			}
+			signingID = key.ID
+		}
+	}
+	return NewKeys(signingID, keys...)
+}
+
+// LoadKeysFromEnv loads keys from the directory in JWT_KEY_DIR, or uses HMAC secret in JWT_SECRET.
+// Without both, random secret is generated, so the tokens do not survive restart.
+func LoadKeysFromEnv() (*Keys, error) {
+	if dir := os.Getenv(EnvKeyDir); dir != "" {
+		return LoadKeyDir(dir, os.Getenv(EnvSigningKeyID))
+	}
+	secret := []byte(os.Getenv(EnvSecret))
+	if len(secret) == 0 {
+		log.Printf("Neither %s nor %s is set, signing tokens with random secret", EnvKeyDir, EnvSecret)
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, err
+		}
+	}
+	return NewKeys(HMACKeyID, HMACKey(HMACKeyID, secret))
+}
+
+// Sign returns token with the claims signed by current signing key
+func (k *Keys) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(k.signing.Method, claims)
+	token.Header["kid"] = k.signing.ID
+	return token.SignedString(k.signing.Private)
+}
+
+// Parse verifies the token and parses its claims.
+// Tokens without kid header are verified by current signing key.
+func (k *Keys) Parse(token string, claims jwt.Claims) error {
+	_, err := jwt.ParseWithClaims(token, claims, k.keyFunc)
+	return err
+}
+
+// keyFunc returns verification key of the token, checking it is signed by the key's method
+func (k *Keys) keyFunc(token *jwt.Token) (interface{}, error) {
+	key := k.signing
+	if kid, ok := token.Header["kid"]; ok {
+		id, _ := kid.(string)
+		if key, ok = k.byID[id]; !ok {
+			return nil, fmt.Errorf("unknown signing key '%v'", kid)
+		}
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, errors.New("unexpected signing method " + token.Method.Alg())
+	}
+	return key.Public, nil
+}
@@ -0,0 +1,117 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// writeKey writes PEM encoded DER key to <kid>.pem file in dir
+func writeKey(t *testing.T, dir, kid, blockType string, der []byte) {
+	t.Helper()
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := ioutil.WriteFile(filepath.Join(dir, kid+".pem"), data, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestKeys_HMAC(t *testing.T) {
+	keys, err := NewKeys(HMACKeyID, HMACKey(HMACKeyID, []byte("s3cret")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := keys.Sign(&jwt.StandardClaims{Subject: "user"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims := &jwt.StandardClaims{}
+	if err := keys.Parse(token, claims); err != nil || claims.Subject != "user" {
+		t.Errorf("Parse() = %v, %v, want subject 'user'", claims, err)
+	}
+
+	other, _ := NewKeys(HMACKeyID, HMACKey(HMACKeyID, []byte("other")))
+	if err := other.Parse(token, &jwt.StandardClaims{}); err == nil {
+		t.Errorf("Parse() of token signed with other secret succeeded")
+	}
+}
+
+func TestLoadKeyDir_Rotation(t *testing.T) {
+	dir := t.TempDir()
+	oldKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeKey(t, dir, "2021-old", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(oldKey))
+	oldKeys, err := LoadKeyDir(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldToken, err := oldKeys.Sign(&jwt.StandardClaims{Subject: "old"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// new ECDSA key signs, old RSA key is kept to verify
+	newKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, _ := x509.MarshalECPrivateKey(newKey)
+	writeKey(t, dir, "2022-new", "EC PRIVATE KEY", der)
+	if _, err := LoadKeyDir(dir, ""); err == nil {
+		t.Errorf("LoadKeyDir() with several private keys and no signing kid succeeded")
+	}
+	keys, err := LoadKeyDir(dir, "2022-new")
+	if err != nil {
+		t.Fatal(err)
+	}
+	newToken, err := keys.Sign(&jwt.StandardClaims{Subject: "new"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, _ := jwt.Parse(newToken, nil)
+	if parsed.Header["kid"] != "2022-new" || parsed.Method != jwt.SigningMethodES256 {
+		t.Errorf("Sign() header = %v, want kid '2022-new' and ES256", parsed.Header)
+	}
+	for _, token := range []string{oldToken, newToken} {
+		if err := keys.Parse(token, &jwt.StandardClaims{}); err != nil {
+			t.Errorf("Parse() error = %v", err)
+		}
+	}
+	if err := oldKeys.Parse(newToken, &jwt.StandardClaims{}); err == nil {
+		t.Errorf("Parse() of token signed with unknown kid succeeded")
+	}
+}
+
+func TestKeys_RejectsAlgorithmMismatch(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	public := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	verifier, err := ParseKey("rsa", public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewKeys("rsa", verifier); err == nil {
+		t.Errorf("NewKeys() signing with public key succeeded")
+	}
+	signer, _ := NewKeys("rsa", &Key{ID: "rsa", Method: jwt.SigningMethodRS256, Private: key, Public: &key.PublicKey})
+
+	// HS256 token signed with the public key bytes must not verify against the RSA key
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, &jwt.StandardClaims{Subject: "admin"})
+	forged.Header["kid"] = "rsa"
+	token, _ := forged.SignedString(public)
+	if err := signer.Parse(token, &jwt.StandardClaims{}); err == nil {
+		t.Errorf("Parse() of HS256 token for RSA key succeeded")
+	}
+}
@@ -0,0 +1,212 @@
+package auth
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// Throttle tracks failed logins per account and per client IP, blocking further attempts for a while
+type Throttle interface {
+	// Allow returns how long login attempts to the account from the IP are blocked, 0 if they are allowed.
+	// Allowed attempt is reserved until it is recorded by Failure or Success, so that concurrent attempts
+	// can not bypass the backoff.
+	Allow(email, ip string) (time.Duration, error)
+	// Failure records failed login attempt
+	Failure(email, ip string) error
+	// Success records successful login, or correct password, clearing failures of the account.
+	// Failures of the IP are kept, so attacker can not clear them logging in own account.
+	Success(email, ip string) error
+	// Unlock clears failures and lockout of the account
+	Unlock(email string) error
+}
+
+// ThrottlePolicy configures backoff and lockout after failed logins
+type ThrottlePolicy struct {
+	// BaseDelay blocks attempts after the first failure, it doubles with each next failure up to MaxDelay
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// MaxFailures is number of account failures which lock the account for Lockout time
+	MaxFailures int
+	Lockout     time.Duration
+	// MaxIPFailures is number of failures from single IP, to any accounts, which lock the IP for Lockout time
+	MaxIPFailures int
+}
+
+// DefaultThrottlePolicy locks account after 5 failures and IP after 20 failures for 15 minutes
+var DefaultThrottlePolicy = ThrottlePolicy{
+	BaseDelay:     time.Second,
+	MaxDelay:      time.Minute,
+	MaxFailures:   5,
+	Lockout:       15 * time.Minute,
+	MaxIPFailures: 20,
+}
+
+// attemptTimeout is time after which reserved attempts are considered abandoned
+const attemptTimeout = 30 * time.Second
+
+// failures is failed attempts record of single account or IP
+type failures struct {
+	count        int
+	lastFailure  time.Time
+	blockedUntil time.Time
+	// attempts allowed and not recorded yet
+	inFlight    int
+	lastAttempt time.Time
+}
+
+// MemoryThrottle is Throttle keeping failures in memory
+type MemoryThrottle struct {
+	policy ThrottlePolicy
+	now    func() time.Time
+
+	mu        sync.Mutex
+	accounts  map[string]*failures
+	ips       map[string]*failures
+	lastSweep time.Time
+}
+
+func NewMemoryThrottle(policy ThrottlePolicy) *MemoryThrottle {
+	return &MemoryThrottle{
+		policy:   policy,
+		now:      time.Now,
+		accounts: make(map[string]*failures),
+		ips:      make(map[string]*failures),
+	}
+}
+
+// Allow returns longer of account and IP block times. Account allows single attempt at a time,
+// IP as many as its remaining failures before lockout; otherwise attempts are blocked for a second.
+func (t *MemoryThrottle) Allow(email, ip string) (time.Duration, error) {
+	now := t.now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.sweep(now)
+	account := t.record(t.accounts, accountKey(email), now)
+	wait := t.blocked(account, now)
+	if account.inFlight > 0 && wait < time.Second {
+		wait = time.Second
+	}
+	var address *failures
+	if ip != "" {
+		address = t.record(t.ips, ip, now)
+		if ipWait := t.blocked(address, now); ipWait > wait {
+			wait = ipWait
+		}
+		if address.count+address.inFlight >= t.policy.MaxIPFailures && wait < time.Second {
+			wait = time.Second
+		}
+	}
+	if wait > 0 {
+		return wait, nil
+	}
+	for _, f := range []*failures{account, address} {
+		if f != nil {
+			f.inFlight++
+			f.lastAttempt = now
+		}
+	}
+	return 0, nil
+}
+
+// Failure increases failures of the account and the IP, blocking them with exponential backoff or lockout
+func (t *MemoryThrottle) Failure(email, ip string) error {
+	now := t.now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.sweep(now)
+	t.fail(t.accounts, accountKey(email), t.policy.MaxFailures, now)
+	if ip != "" {
+		t.fail(t.ips, ip, t.policy.MaxIPFailures, now)
+	}
+	return nil
+}
+
+// Success clears failures of the account and releases the attempt of the IP
+func (t *MemoryThrottle) Success(email, ip string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.accounts, accountKey(email))
+	if f, ok := t.ips[ip]; ok && f.inFlight > 0 {
+		f.inFlight--
+	}
+	return nil
+}
+
+// Unlock clears failures and lockout of the account
+func (t *MemoryThrottle) Unlock(email string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.accounts, accountKey(email))
+	return nil
+}
+
+// blocked returns remaining block time of the record; must be called with lock held
+func (t *MemoryThrottle) blocked(f *failures, now time.Time) time.Duration {
+	if f == nil || !now.Before(f.blockedUntil) {
+		return 0
+	}
+	return f.blockedUntil.Sub(now)
+}
+
+// record returns record of the key, creating it if needed. Attempts reserved longer than attemptTimeout ago
+// are dropped. Must be called with lock held.
+func (t *MemoryThrottle) record(records map[string]*failures, key string, now time.Time) *failures {
+	f, ok := records[key]
+	if !ok {
+		f = &failures{}
+		records[key] = f
+	}
+	if now.Sub(f.lastAttempt) > attemptTimeout {
+		f.inFlight = 0
+	}
+	return f
+}
+
+// fail records failure under the key, releasing its attempt; must be called with lock held.
+// Failures older than lockout time are forgotten.
+func (t *MemoryThrottle) fail(records map[string]*failures, key string, maxFailures int, now time.Time) {
+	f := t.record(records, key, now)
+	if f.inFlight > 0 {
+		f.inFlight--
+	}
+	if now.Sub(f.lastFailure) > t.policy.Lockout {
+		f.count = 0
+	}
+	f.count++
+	f.lastFailure = now
+	if f.count >= maxFailures {
+		f.blockedUntil = now.Add(t.policy.Lockout)
+		return
+	}
+	delay := t.policy.BaseDelay
+	for i := 1; i < f.count && delay < t.policy.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > t.policy.MaxDelay {
+		delay = t.policy.MaxDelay
+	}
+	f.blockedUntil = now.Add(delay)
+}
+
+// sweep drops records which are neither blocked nor remembered any more, at most once per lockout time;
+// must be called with lock held
+func (t *MemoryThrottle) sweep(now time.Time) {
+	if now.Sub(t.lastSweep) < t.policy.Lockout {
+		return
+	}
+	t.lastSweep = now
+	for _, records := range []map[string]*failures{t.accounts, t.ips} {
+		for key, f := range records {
+			if now.Sub(f.lastFailure) > t.policy.Lockout && !now.Before(f.blockedUntil) &&
+				(f.inFlight == 0 || now.Sub(f.lastAttempt) > attemptTimeout) {
+				delete(records, key)
+			}
+		}
+	}
+}
+
+// accountKey returns case insensitive key of the account email
+func accountKey(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
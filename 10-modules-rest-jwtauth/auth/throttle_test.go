@@ -0,0 +1,104 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemoryThrottle(t *testing.T) {
+	now := time.Date(2022, 1, 1, 12, 0, 0, 0, time.UTC)
+	throttle := NewMemoryThrottle(ThrottlePolicy{
+		BaseDelay:     time.Second,
+		MaxDelay:      4 * time.Second,
+		MaxFailures:   5,
+		Lockout:       time.Hour,
+		MaxIPFailures: 8,
+	})
+	throttle.now = func() time.Time { return now }
+	allow := func(email, ip string) time.Duration {
+		t.Helper()
+		wait, err := throttle.Allow(email, ip)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return wait
+	}
+
+	// exponential backoff capped at max delay
+	for i, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 4 * time.Second} {
+		throttle.Failure("user@mydomain.com", "10.0.0.1")
+		if got := allow("USER@mydomain.com", "10.0.0.2"); got != want {
+			t.Errorf("Allow() after %d failures = %v, want %v", i+1, got, want)
+		}
+		now = now.Add(want)
+	}
+	if got := allow("user@mydomain.com", "10.0.0.1"); got != 0 {
+		t.Errorf("Allow() after backoff = %v, want 0", got)
+	}
+
+	// lockout after max failures
+	throttle.Failure("user@mydomain.com", "10.0.0.1")
+	if got := allow("user@mydomain.com", "10.0.0.2"); got != time.Hour {
+		t.Errorf("Allow() after lockout = %v, want %v", got, time.Hour)
+	}
+	if got := allow("other@mydomain.com", "10.0.0.2"); got != 0 {
+		t.Errorf("Allow() of other account = %v, want 0", got)
+	}
+	throttle.Unlock("user@mydomain.com")
+	if got := allow("user@mydomain.com", "10.0.0.2"); got != 0 {
+		t.Errorf("Allow() after unlock = %v, want 0", got)
+	}
+
+	// IP failures to different accounts lock the IP, success does not clear them
+	for i := 0; i < 3; i++ {
+		throttle.Failure("user"+string(rune('a'+i))+"@mydomain.com", "10.0.0.1")
+	}
+	throttle.Success("other@mydomain.com", "10.0.0.1")
+	if got := allow("other@mydomain.com", "10.0.0.1"); got != time.Hour {
+		t.Errorf("Allow() from locked IP = %v, want %v", got, time.Hour)
+	}
+	if got := allow("other@mydomain.com", "10.0.0.2"); got != 0 {
+		t.Errorf("Allow() from other IP = %v, want 0", got)
+	}
+
+	// failures are forgotten after lockout time
+	now = now.Add(2 * time.Hour)
+	throttle.Failure("user@mydomain.com", "10.0.0.3")
+	if got := allow("user@mydomain.com", "10.0.0.3"); got != time.Second {
+		t.Errorf("Allow() after old failures = %v, want %v", got, time.Second)
+	}
+}
+
+func TestMemoryThrottle_ConcurrentAttempts(t *testing.T) {
+	now := time.Date(2022, 1, 1, 12, 0, 0, 0, time.UTC)
+	throttle := NewMemoryThrottle(ThrottlePolicy{MaxFailures: 5, Lockout: time.Hour, MaxIPFailures: 2})
+	throttle.now = func() time.Time { return now }
+
+	// account allows single attempt at a time
+	if wait, _ := throttle.Allow("user@mydomain.com", "10.0.0.1"); wait != 0 {
+		t.Fatalf("Allow() = %v, want 0", wait)
+	}
+	if wait, _ := throttle.Allow("USER@mydomain.com", "10.0.0.2"); wait != time.Second {
+		t.Errorf("Allow() during attempt = %v, want %v", wait, time.Second)
+	}
+	throttle.Failure("user@mydomain.com", "10.0.0.1")
+	if wait, _ := throttle.Allow("user@mydomain.com", "10.0.0.2"); wait != 0 {
+		t.Errorf("Allow() after failure = %v, want 0", wait)
+	}
+	throttle.Success("user@mydomain.com", "10.0.0.2")
+
+	// IP allows as many attempts as failures left before lockout
+	if wait, _ := throttle.Allow("other@mydomain.com", "10.0.0.1"); wait != 0 {
+		t.Errorf("Allow() from IP with failure left = %v, want 0", wait)
+	}
+	if wait, _ := throttle.Allow("third@mydomain.com", "10.0.0.1"); wait != time.Second {
+		t.Errorf("Allow() from IP with attempts reserved up to lockout = %v, want %v", wait, time.Second)
+	}
+
+	// abandoned attempts are released after timeout
+	throttle.Allow("abandoned@mydomain.com", "10.0.0.3")
+	now = now.Add(attemptTimeout + time.Second)
+	if wait, _ := throttle.Allow("abandoned@mydomain.com", "10.0.0.3"); wait != 0 {
+		t.Errorf("Allow() after abandoned attempt = %v, want 0", wait)
+	}
+}
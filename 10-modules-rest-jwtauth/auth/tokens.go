@@ -0,0 +1,36 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+)
+
+// NewID returns random URL safe ID, used for token IDs and refresh token families
+func NewID() (string, error) {
+	return random(16)
+}
+
+// NewRefreshToken returns random refresh token sent to the client and its hash kept in the repository
+func NewRefreshToken() (token, hash string, err error) {
+	if token, err = random(32); err != nil {
+		return "", "", err
+	}
+	return token, HashToken(token), nil
+}
+
+// HashToken returns hex encoded SHA-256 hash of the refresh token
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// random returns n random bytes encoded with URL safe base64
+func random(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,77 @@
+package dao
+
+import (
+	"math"
+	"strings"
+	"time"
+
+	"github.com/iproduct/coursego/10-modules-rest-jwtauth/model"
+)
+
+// AuditQuery selects audit entries by actor, target user and time range [From, To).
+// Zero fields do not filter, zero Limit means no limit.
+type AuditQuery struct {
+	ActorID  int
+	TargetID int
+	From     time.Time
+	To       time.Time
+	Offset   int
+	Limit    int
+}
+
+// Matches checks if the entry passes query filters
+func (q *AuditQuery) Matches(entry *model.AuditEntry) bool {
+	return (q.ActorID == 0 || entry.ActorID == q.ActorID) &&
+		(q.TargetID == 0 || entry.TargetID == q.TargetID) &&
+		(q.From.IsZero() || !entry.Time.Before(q.From)) &&
+		(q.To.IsZero() || entry.Time.Before(q.To))
+}
+
+// Apply filters and paginates entries in memory by the query, starting from the latest entry
+func (q *AuditQuery) Apply(entries []model.AuditEntry) []model.AuditEntry {
+	selected := []model.AuditEntry{}
+	skip := q.Offset
+	for i := len(entries) - 1; i >= 0 && (q.Limit <= 0 || len(selected) < q.Limit); i-- {
+		if !q.Matches(&entries[i]) {
+			continue
+		}
+		if skip > 0 {
+			skip--
+			continue
+		}
+		selected = append(selected, entries[i])
+	}
+	return selected
+}
+
+// SQL returns SQL WHERE, ORDER BY, LIMIT and OFFSET clauses of the query and their arguments,
+// ordering entries from the latest one. Times are compared in UTC, as they are stored.
+func (q *AuditQuery) SQL() (string, []interface{}) {
+	conditions := []string{}
+	args := []interface{}{}
+	if q.ActorID != 0 {
+		conditions = append(conditions, "actor_id = ?")
+		args = append(args, q.ActorID)
+	}
+	if q.TargetID != 0 {
+		conditions = append(conditions, "target_id = ?")
+		args = append(args, q.TargetID)
+	}
+	if !q.From.IsZero() {
+		conditions = append(conditions, "time >= ?")
+		args = append(args, q.From.UTC())
+	}
+	if !q.To.IsZero() {
+		conditions = append(conditions, "time < ?")
+		args = append(args, q.To.UTC())
+	}
+	clauses := ""
+	if len(conditions) > 0 {
+		clauses = " WHERE " + strings.Join(conditions, " AND ")
+	}
+	limit := q.Limit
+	if limit <= 0 {
+		limit = math.MaxInt32
+	}
+	return clauses + " ORDER BY id DESC LIMIT ? OFFSET ?", append(args, limit, q.Offset)
+}
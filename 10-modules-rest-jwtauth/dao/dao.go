@@ -1,13 +1,90 @@
 package dao
 
-import "github.com/iproduct/coursego/10-modules-rest-jwtauth/model"
+import (
+	"errors"
+	"time"
 
+	"github.com/iproduct/coursego/10-modules-rest-jwtauth/model"
+)
+
+// ErrDuplicateEmail is returned when creating user with email of another user
+var ErrDuplicateEmail = errors.New("user with this email already exists")
+
+// ErrTokenUsed is returned when rotating refresh token which was already rotated or revoked
+var ErrTokenUsed = errors.New("refresh token was already used")
+
+// ErrTokenRevoked is returned when consuming token ID which was already revoked
+var ErrTokenRevoked = errors.New("token was already revoked")
+
+// UserRepo stores users, methods finding single user return sql.ErrNoRows if it does not exist
 type UserRepo interface {
-	FindAll(start, count int) ([]model.User, error)
+	// FindAll returns users selected, sorted and paginated by the query
+	FindAll(q *UserQuery) ([]model.User, error)
 	FindByID(id int) (*model.User, error)
 	FindByEmail(email string) (*model.User, error)
 	Create(user *model.User) (*model.User, error)
 	Update(user *model.User) (*model.User, error)
 	DeleteByID(id int) (*model.User, error)
-	Count() (int, error)
+	// Count returns number of users passing the query filters, ignoring its pagination
+	Count(q *UserQuery) (int, error)
+}
+
+// RefreshTokenRepo stores issued refresh tokens by their hashes
+type RefreshTokenRepo interface {
+	// Create stores new refresh token
+	Create(token *model.RefreshToken) error
+	// FindByHash returns refresh token with the hash, or sql.ErrNoRows if there is none
+	FindByHash(hash string) (*model.RefreshToken, error)
+	// Rotate marks token with the hash as replaced by next token and stores next token,
+	// returns ErrTokenUsed if the token was already replaced or revoked
+	Rotate(hash string, next *model.RefreshToken) error
+	// RevokeFamily revokes all refresh tokens of the family
+	RevokeFamily(family string) error
+	// RevokeUser revokes all refresh tokens of the user
+	RevokeUser(userID int) error
+}
+
+// RevocationRepo is list of revoked access token IDs, kept until the tokens expire
+type RevocationRepo interface {
+	Revoke(tokenID string, expiresAt time.Time) error
+	IsRevoked(tokenID string) (bool, error)
+	// Consume adds token ID to revocation list, returns ErrTokenRevoked if it is already there
+	Consume(tokenID string, expiresAt time.Time) error
+}
+
+// LoginAuditRepo stores audit records of logins
+type LoginAuditRepo interface {
+	Record(event *model.LoginEvent) error
+	// FindAll returns records starting from the latest one
+	FindAll(start, count int) ([]model.LoginEvent, error)
+}
+
+// UserAuditRepo stores audit log of changes of users
+type UserAuditRepo interface {
+	// Record stores audit entry, setting its ID
+	Record(entry *model.AuditEntry) error
+	// Find returns entries selected by the query starting from the latest one
+	Find(q *AuditQuery) ([]model.AuditEntry, error)
+}
+
+// IdentityRepo links subjects of external OpenID Connect providers to users
+type IdentityRepo interface {
+	// FindUserID returns ID of the user linked to the provider subject, or sql.ErrNoRows if there is none
+	FindUserID(issuer, subject string) (int, error)
+	// Link links the provider subject to the user, replacing previous link
+	Link(issuer, subject string, userID int) error
+}
+
+// APIKeyRepo stores API keys of users
+type APIKeyRepo interface {
+	// Create stores new API key, setting its ID
+	Create(key *model.APIKey) error
+	// FindByPrefix returns API key with the public prefix, or sql.ErrNoRows if there is none
+	FindByPrefix(prefix string) (*model.APIKey, error)
+	// FindByUser returns all API keys of the user, including revoked ones
+	FindByUser(userID int) ([]model.APIKey, error)
+	// Revoke revokes API key of the user, returns sql.ErrNoRows if the user has no such key
+	Revoke(userID, id int) error
+	// Touch sets last time the API key was used
+	Touch(id int, usedAt time.Time) error
 }
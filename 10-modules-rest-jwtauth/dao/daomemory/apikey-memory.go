@@ -0,0 +1,82 @@
+package daomemory
+
+import (
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/iproduct/coursego/10-modules-rest-jwtauth/model"
+)
+
+// APIKeyRepoMemory stores API keys in memory
+type APIKeyRepoMemory struct {
+	mu   sync.Mutex
+	keys []model.APIKey
+}
+
+// Create stores new API key, setting its ID
+func (k *APIKeyRepoMemory) Create(key *model.APIKey) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	key.ID = len(k.keys) + 1
+	k.keys = append(k.keys, cloneAPIKey(*key))
+	return nil
+}
+
+// FindByPrefix returns API key with the public prefix
+func (k *APIKeyRepoMemory) FindByPrefix(prefix string) (*model.APIKey, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	for _, key := range k.keys {
+		if key.Prefix == prefix {
+			key = cloneAPIKey(key)
+			return &key, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+// FindByUser returns all API keys of the user
+func (k *APIKeyRepoMemory) FindByUser(userID int) ([]model.APIKey, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	keys := []model.APIKey{}
+	for _, key := range k.keys {
+		if key.UserID == userID {
+			keys = append(keys, cloneAPIKey(key))
+		}
+	}
+	return keys, nil
+}
+
+// Revoke revokes API key of the user
+func (k *APIKeyRepoMemory) Revoke(userID, id int) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if id < 1 || id > len(k.keys) || k.keys[id-1].UserID != userID {
+		return sql.ErrNoRows
+	}
+	k.keys[id-1].Revoked = true
+	return nil
+}
+
+// Touch sets last time the API key was used
+func (k *APIKeyRepoMemory) Touch(id int, usedAt time.Time) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if id < 1 || id > len(k.keys) {
+		return sql.ErrNoRows
+	}
+	k.keys[id-1].LastUsedAt = &usedAt
+	return nil
+}
+
+// cloneAPIKey copies the key, so callers can not modify stored scopes
+func cloneAPIKey(key model.APIKey) model.APIKey {
+	key.Scopes = append([]string{}, key.Scopes...)
+	return key
+}
+
+func NewAPIKeyRepoMemory() *APIKeyRepoMemory {
+	return &APIKeyRepoMemory{}
+}
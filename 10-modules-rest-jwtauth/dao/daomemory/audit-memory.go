@@ -0,0 +1,37 @@
+package daomemory
+
+import (
+	"sync"
+
+	"github.com/iproduct/coursego/10-modules-rest-jwtauth/model"
+)
+
+// LoginAuditRepoMemory stores login audit records in memory
+type LoginAuditRepoMemory struct {
+	mu     sync.Mutex
+	events []model.LoginEvent
+}
+
+// Record stores audit record, setting its ID
+func (l *LoginAuditRepoMemory) Record(event *model.LoginEvent) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	event.ID = len(l.events) + 1
+	l.events = append(l.events, *event)
+	return nil
+}
+
+// FindAll returns audit records starting from the latest one
+func (l *LoginAuditRepoMemory) FindAll(start, count int) ([]model.LoginEvent, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	events := []model.LoginEvent{}
+	for i := len(l.events) - 1 - start; i >= 0 && len(events) < count; i-- {
+		events = append(events, l.events[i])
+	}
+	return events, nil
+}
+
+func NewLoginAuditRepoMemory() *LoginAuditRepoMemory {
+	return &LoginAuditRepoMemory{}
+}
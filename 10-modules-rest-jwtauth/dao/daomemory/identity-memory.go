@@ -0,0 +1,35 @@
+package daomemory
+
+import (
+	"database/sql"
+	"sync"
+)
+
+// IdentityRepoMemory stores links of OpenID Connect provider subjects to users in memory
+type IdentityRepoMemory struct {
+	mu    sync.Mutex
+	links map[[2]string]int
+}
+
+// FindUserID returns ID of the user linked to the provider subject
+func (i *IdentityRepoMemory) FindUserID(issuer, subject string) (int, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	userID, ok := i.links[[2]string{issuer, subject}]
+	if !ok {
+		return 0, sql.ErrNoRows
+	}
+	return userID, nil
+}
+
+// Link links the provider subject to the user
+func (i *IdentityRepoMemory) Link(issuer, subject string, userID int) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.links[[2]string{issuer, subject}] = userID
+	return nil
+}
+
+func NewIdentityRepoMemory() *IdentityRepoMemory {
+	return &IdentityRepoMemory{links: make(map[[2]string]int)}
+}
@@ -0,0 +1,119 @@
+package daomemory
+
+import (
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/iproduct/coursego/10-modules-rest-jwtauth/dao"
+	"github.com/iproduct/coursego/10-modules-rest-jwtauth/model"
+)
+
+// TokenRepoMemory stores refresh tokens and revoked access token IDs in memory
+type TokenRepoMemory struct {
+	mu      sync.Mutex
+	tokens  map[string]model.RefreshToken
+	revoked map[string]time.Time
+}
+
+// Create stores new refresh token
+func (t *TokenRepoMemory) Create(token *model.RefreshToken) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.tokens[token.Hash] = *token
+	return nil
+}
+
+// FindByHash returns refresh token with the hash
+func (t *TokenRepoMemory) FindByHash(hash string) (*model.RefreshToken, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	token, ok := t.tokens[hash]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return &token, nil
+}
+
+// Rotate replaces refresh token with next one
+func (t *TokenRepoMemory) Rotate(hash string, next *model.RefreshToken) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	token, ok := t.tokens[hash]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	if token.ReplacedBy != "" || token.Revoked {
+		return dao.ErrTokenUsed
+	}
+	token.ReplacedBy = next.Hash
+	t.tokens[hash] = token
+	t.tokens[next.Hash] = *next
+	return nil
+}
+
+// RevokeFamily revokes all refresh tokens of the family
+func (t *TokenRepoMemory) RevokeFamily(family string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for hash, token := range t.tokens {
+		if token.Family == family {
+			token.Revoked = true
+			t.tokens[hash] = token
+		}
+	}
+	return nil
+}
+
+// RevokeUser revokes all refresh tokens of the user
+func (t *TokenRepoMemory) RevokeUser(userID int) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for hash, token := range t.tokens {
+		if token.UserID == userID {
+			token.Revoked = true
+			t.tokens[hash] = token
+		}
+	}
+	return nil
+}
+
+// Revoke adds access token ID to revocation list, dropping expired entries
+func (t *TokenRepoMemory) Revoke(tokenID string, expiresAt time.Time) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	for id, exp := range t.revoked {
+		if exp.Before(now) {
+			delete(t.revoked, id)
+		}
+	}
+	t.revoked[tokenID] = expiresAt
+	return nil
+}
+
+// Consume adds token ID to revocation list, failing if it is already there
+func (t *TokenRepoMemory) Consume(tokenID string, expiresAt time.Time) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if exp, ok := t.revoked[tokenID]; ok && !exp.Before(time.Now()) {
+		return dao.ErrTokenRevoked
+	}
+	t.revoked[tokenID] = expiresAt
+	return nil
+}
+
+// IsRevoked checks if access token ID is in revocation list
+func (t *TokenRepoMemory) IsRevoked(tokenID string) (bool, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, ok := t.revoked[tokenID]
+	return ok, nil
+}
+
+func NewTokenRepoMemory() *TokenRepoMemory {
+	return &TokenRepoMemory{
+		tokens:  make(map[string]model.RefreshToken),
+		revoked: make(map[string]time.Time),
+	}
+}
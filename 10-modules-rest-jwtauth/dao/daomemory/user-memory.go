@@ -0,0 +1,126 @@
+package daomemory
+
+import (
+	"database/sql"
+	"strings"
+	"sync"
+
+	"github.com/iproduct/coursego/10-modules-rest-jwtauth/dao"
+	"github.com/iproduct/coursego/10-modules-rest-jwtauth/model"
+)
+
+// UserRepoMemory stores users in memory.
+// Like the unique index of SQL databases, emails are unique regardless of letter case.
+type UserRepoMemory struct {
+	mu     sync.RWMutex
+	users  map[int]model.User
+	nextID int
+}
+
+// FindAll returns users selected, sorted and paginated by the query
+func (u *UserRepoMemory) FindAll(q *dao.UserQuery) ([]model.User, error) {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	users := make([]model.User, 0, len(u.users))
+	for _, user := range u.users {
+		users = append(users, clone(user))
+	}
+	return q.Apply(users), nil
+}
+
+// FindByID returns user by user ID or sql.ErrNoRows otherwise
+func (u *UserRepoMemory) FindByID(id int) (*model.User, error) {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	user, ok := u.users[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	user = clone(user)
+	return &user, nil
+}
+
+// FindByEmail returns user by email or sql.ErrNoRows otherwise
+func (u *UserRepoMemory) FindByEmail(email string) (*model.User, error) {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	user, ok := u.findByEmail(email)
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	user = clone(user)
+	return &user, nil
+}
+
+// Create creates and returns new user with autogenerated ID, or dao.ErrDuplicateEmail if the email is used
+func (u *UserRepoMemory) Create(user *model.User) (*model.User, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if _, ok := u.findByEmail(user.Email); ok {
+		return nil, dao.ErrDuplicateEmail
+	}
+	u.nextID++
+	user.ID = u.nextID
+	u.users[user.ID] = clone(*user)
+	return user, nil
+}
+
+// Update updates existing user data, except the email
+func (u *UserRepoMemory) Update(user *model.User) (*model.User, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	old, ok := u.users[user.ID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	updated := clone(*user)
+	updated.Email = old.Email
+	u.users[user.ID] = updated
+	updated = clone(updated)
+	return &updated, nil
+}
+
+// DeleteByID removes and returns user with specified ID or sql.ErrNoRows otherwise
+func (u *UserRepoMemory) DeleteByID(id int) (*model.User, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	user, ok := u.users[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	delete(u.users, id)
+	return &user, nil
+}
+
+// Count returns the count of users passing the query filters
+func (u *UserRepoMemory) Count(q *dao.UserQuery) (int, error) {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	count := 0
+	for _, user := range u.users {
+		if q.Matches(&user) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// findByEmail finds user with the email ignoring letter case; must be called with lock held
+func (u *UserRepoMemory) findByEmail(email string) (model.User, bool) {
+	for _, user := range u.users {
+		if strings.EqualFold(user.Email, email) {
+			return user, true
+		}
+	}
+	return model.User{}, false
+}
+
+// clone copies the user, so callers can not modify stored roles
+func clone(user model.User) model.User {
+	user.Roles = append([]string{}, user.Roles...)
+	return user
+}
+
+func NewUserRepoMemory() *UserRepoMemory {
+	return &UserRepoMemory{users: make(map[int]model.User)}
+}
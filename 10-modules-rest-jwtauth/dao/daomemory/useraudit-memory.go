@@ -0,0 +1,34 @@
+package daomemory
+
+import (
+	"sync"
+
+	"github.com/iproduct/coursego/10-modules-rest-jwtauth/dao"
+	"github.com/iproduct/coursego/10-modules-rest-jwtauth/model"
+)
+
+// UserAuditRepoMemory stores audit log of user changes in memory
+type UserAuditRepoMemory struct {
+	mu      sync.Mutex
+	entries []model.AuditEntry
+}
+
+// Record stores audit entry, setting its ID
+func (u *UserAuditRepoMemory) Record(entry *model.AuditEntry) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	entry.ID = len(u.entries) + 1
+	u.entries = append(u.entries, *entry)
+	return nil
+}
+
+// Find returns entries selected by the query starting from the latest one
+func (u *UserAuditRepoMemory) Find(q *dao.AuditQuery) ([]model.AuditEntry, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return q.Apply(u.entries), nil
+}
+
+func NewUserAuditRepoMemory() *UserAuditRepoMemory {
+	return &UserAuditRepoMemory{}
+}
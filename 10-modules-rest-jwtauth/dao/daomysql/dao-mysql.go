@@ -3,18 +3,25 @@ package daomysql
 import (
 	"database/sql"
 	"fmt"
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/go-sql-driver/mysql"
+	"github.com/iproduct/coursego/10-modules-rest-jwtauth/dao"
 	"github.com/iproduct/coursego/10-modules-rest-jwtauth/model"
 	"log"
+	"strings"
 )
 
+// errDuplicateEntry is MySQL error number of unique index violation
+const errDuplicateEntry = 1062
+
 type UserRepoMysql struct {
 	db *sql.DB
 }
 
-func (u UserRepoMysql) FindAll(start, count int) ([]model.User, error) {
-	statement := "SELECT id, name, email, password, age, active FROM users LIMIT ? OFFSET ?"
-	rows, err := u.db.Query(statement, count, start)
+//FindAll returns users selected, sorted and paginated by the query
+func (u UserRepoMysql) FindAll(q *dao.UserQuery) ([]model.User, error) {
+	clauses, args := q.SQL()
+	statement := "SELECT id, name, email, password, age, active, roles FROM users" + clauses
+	rows, err := u.db.Query(statement, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -22,10 +29,12 @@ func (u UserRepoMysql) FindAll(start, count int) ([]model.User, error) {
 	users := []model.User{}
 	for rows.Next() {
 		var user model.User
-		err := rows.Scan(&user.ID, &user.Name, &user.Email, &user.Password, &user.Age, &user.Active)
+		var roles string
+		err := rows.Scan(&user.ID, &user.Name, &user.Email, &user.Password, &user.Age, &user.Active, &roles)
 		if err != nil {
 			return nil, err
 		}
+		user.Roles = splitRoles(roles)
 		users = append(users, user)
 	}
 	rows.Close()
@@ -38,29 +47,36 @@ func (u UserRepoMysql) FindAll(start, count int) ([]model.User, error) {
 //FindById return users by user ID or error otherwise
 func (u *UserRepoMysql) FindByID(id int) (*model.User, error) {
 	user := &model.User{}
-	statement := "SELECT id, name, email, password, age, active FROM users WHERE id= ?"
-	err := u.db.QueryRow(statement, id).Scan(&user.ID, &user.Name, &user.Email, &user.Password, &user.Age, &user.Active)
+	var roles string
+	statement := "SELECT id, name, email, password, age, active, roles FROM users WHERE id= ?"
+	err := u.db.QueryRow(statement, id).Scan(&user.ID, &user.Name, &user.Email, &user.Password, &user.Age, &user.Active, &roles)
 	if err != nil {
 		return nil, err
 	}
+	user.Roles = splitRoles(roles)
 	return user, nil
 }
 
 func (u UserRepoMysql) FindByEmail(email string) (*model.User, error) {
 	user := &model.User{}
-	statement := "SELECT id, name, email, password, age, active FROM users WHERE email= ?"
-	err := u.db.QueryRow(statement, email).Scan(&user.ID, &user.Name, &user.Email, &user.Password, &user.Age, &user.Active)
+	var roles string
+	statement := "SELECT id, name, email, password, age, active, roles FROM users WHERE email= ?"
+	err := u.db.QueryRow(statement, email).Scan(&user.ID, &user.Name, &user.Email, &user.Password, &user.Age, &user.Active, &roles)
 	if err != nil {
 		return nil, err
 	}
+	user.Roles = splitRoles(roles)
 	return user, nil
 }
 
 //Create creates and returns new user with autogenerated ID
 func (u *UserRepoMysql) Create(user *model.User) (*model.User, error) {
-	statement := "INSERT INTO users(name, email, password, age, active) VALUES(?, ?, ?, ?, ?)"
-	result, err := u.db.Exec(statement, user.Name, user.Email, user.Password, user.Age, user.Active)
+	statement := "INSERT INTO users(name, email, password, age, active, roles) VALUES(?, ?, ?, ?, ?, ?)"
+	result, err := u.db.Exec(statement, user.Name, user.Email, user.Password, user.Age, user.Active, joinRoles(user.Roles))
 	if err != nil {
+		if me, ok := err.(*mysql.MySQLError); ok && me.Number == errDuplicateEntry {
+			return nil, dao.ErrDuplicateEmail
+		}
 		return nil, err
 	}
 	id, err := result.LastInsertId()
@@ -74,8 +90,8 @@ func (u *UserRepoMysql) Create(user *model.User) (*model.User, error) {
 
 //Update updates existing user data
 func (u *UserRepoMysql) Update(user *model.User) (*model.User, error) {
-	statement := "UPDATE users SET name=?, password=?, age=?, active=? WHERE id=? "
-	_, err := u.db.Exec(statement, user.Name, user.Password, user.Age, user.Active, user.ID)
+	statement := "UPDATE users SET name=?, password=?, age=?, active=?, roles=? WHERE id=? "
+	_, err := u.db.Exec(statement, user.Name, user.Password, user.Age, user.Active, joinRoles(user.Roles), user.ID)
 	if err != nil {
 		return nil, err
 	}
@@ -92,10 +108,11 @@ func (u *UserRepoMysql) DeleteByID(id int) (*model.User, error) {
 	return user, err
 }
 
-//Count returns the count of users in DB
-func (u *UserRepoMysql) Count() (int, error) {
+//Count returns the count of users in DB passing the query filters
+func (u *UserRepoMysql) Count(q *dao.UserQuery) (int, error) {
 	var count int
-	err := u.db.QueryRow("SELECT COUNT(*) FROM users").Scan(&count)
+	where, args := q.Where()
+	err := u.db.QueryRow("SELECT COUNT(*) FROM users"+where, args...).Scan(&count)
 	if err != nil {
 		return 0, err
 	}
@@ -104,12 +121,27 @@ func (u *UserRepoMysql) Count() (int, error) {
 }
 
 func NewUserRepoMysql(user, password, dbname string) *UserRepoMysql {
-	connectionString := fmt.Sprintf("%s:%s@/%s", user, password, dbname)
-	repo := &UserRepoMysql{}
-	var err error
-	repo.db, err = sql.Open("mysql", connectionString)
+	return &UserRepoMysql{db: openDB(user, password, dbname)}
+}
+
+// joinRoles returns roles stored as comma separated list
+func joinRoles(roles []string) string {
+	return strings.Join(roles, ",")
+}
+
+// splitRoles returns roles from comma separated list
+func splitRoles(roles string) []string {
+	if roles == "" {
+		return []string{}
+	}
+	return strings.Split(roles, ",")
+}
+
+func openDB(user, password, dbname string) *sql.DB {
+	connectionString := fmt.Sprintf("%s:%s@/%s?parseTime=true", user, password, dbname)
+	db, err := sql.Open("mysql", connectionString)
 	if err != nil {
 		log.Fatal(err)
 	}
-	return repo
+	return db
 }
@@ -0,0 +1,28 @@
+package daomysql
+
+import (
+	"database/sql"
+)
+
+// IdentityRepoMysql stores links of OpenID Connect provider subjects to users in MySQL
+type IdentityRepoMysql struct {
+	db *sql.DB
+}
+
+// FindUserID returns ID of the user linked to the provider subject
+func (i *IdentityRepoMysql) FindUserID(issuer, subject string) (int, error) {
+	var userID int
+	err := i.db.QueryRow("SELECT user_id FROM user_identities WHERE issuer=? AND subject=?", issuer, subject).Scan(&userID)
+	return userID, err
+}
+
+// Link links the provider subject to the user
+func (i *IdentityRepoMysql) Link(issuer, subject string, userID int) error {
+	statement := "INSERT INTO user_identities(issuer, subject, user_id) VALUES(?, ?, ?) ON DUPLICATE KEY UPDATE user_id=VALUES(user_id)"
+	_, err := i.db.Exec(statement, issuer, subject, userID)
+	return err
+}
+
+func NewIdentityRepoMysql(user, password, dbname string) *IdentityRepoMysql {
+	return &IdentityRepoMysql{db: openDB(user, password, dbname)}
+}
@@ -0,0 +1,118 @@
+package daomysql
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/iproduct/coursego/10-modules-rest-jwtauth/dao"
+	"github.com/iproduct/coursego/10-modules-rest-jwtauth/model"
+)
+
+// TokenRepoMysql stores refresh tokens and revoked access token IDs in MySQL
+type TokenRepoMysql struct {
+	db *sql.DB
+}
+
+// Create stores new refresh token
+func (t *TokenRepoMysql) Create(token *model.RefreshToken) error {
+	return createRefreshToken(t.db, token)
+}
+
+// FindByHash returns refresh token with the hash
+func (t *TokenRepoMysql) FindByHash(hash string) (*model.RefreshToken, error) {
+	token := &model.RefreshToken{}
+	var replacedBy sql.NullString
+	statement := "SELECT token_hash, family, user_id, expires_at, replaced_by, revoked FROM refresh_tokens WHERE token_hash= ?"
+	err := t.db.QueryRow(statement, hash).Scan(&token.Hash, &token.Family, &token.UserID, &token.ExpiresAt, &replacedBy, &token.Revoked)
+	if err != nil {
+		return nil, err
+	}
+	token.ReplacedBy = replacedBy.String
+	return token, nil
+}
+
+// Rotate replaces refresh token with next one in single transaction
+func (t *TokenRepoMysql) Rotate(hash string, next *model.RefreshToken) error {
+	tx, err := t.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	statement := "UPDATE refresh_tokens SET replaced_by=? WHERE token_hash=? AND replaced_by IS NULL AND revoked=FALSE"
+	result, err := tx.Exec(statement, next.Hash, hash)
+	if err != nil {
+		return err
+	}
+	if rows, err := result.RowsAffected(); err != nil {
+		return err
+	} else if rows == 0 {
+		return dao.ErrTokenUsed
+	}
+	if err := createRefreshToken(tx, next); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// RevokeFamily revokes all refresh tokens of the family
+func (t *TokenRepoMysql) RevokeFamily(family string) error {
+	_, err := t.db.Exec("UPDATE refresh_tokens SET revoked=TRUE WHERE family=?", family)
+	return err
+}
+
+// RevokeUser revokes all refresh tokens of the user
+func (t *TokenRepoMysql) RevokeUser(userID int) error {
+	_, err := t.db.Exec("UPDATE refresh_tokens SET revoked=TRUE WHERE user_id=?", userID)
+	return err
+}
+
+// Revoke adds access token ID to revocation list, dropping expired entries
+func (t *TokenRepoMysql) Revoke(tokenID string, expiresAt time.Time) error {
+	if _, err := t.db.Exec("DELETE FROM revoked_tokens WHERE expires_at < ?", time.Now()); err != nil {
+		return err
+	}
+	_, err := t.db.Exec("INSERT IGNORE INTO revoked_tokens(jti, expires_at) VALUES(?, ?)", tokenID, expiresAt)
+	return err
+}
+
+// Consume adds token ID to revocation list, failing if another request already added it
+func (t *TokenRepoMysql) Consume(tokenID string, expiresAt time.Time) error {
+	if _, err := t.db.Exec("DELETE FROM revoked_tokens WHERE expires_at < ?", time.Now()); err != nil {
+		return err
+	}
+	result, err := t.db.Exec("INSERT IGNORE INTO revoked_tokens(jti, expires_at) VALUES(?, ?)", tokenID, expiresAt)
+	if err != nil {
+		return err
+	}
+	if rows, err := result.RowsAffected(); err != nil {
+		return err
+	} else if rows == 0 {
+		return dao.ErrTokenRevoked
+	}
+	return nil
+}
+
+// IsRevoked checks if access token ID is in revocation list
+func (t *TokenRepoMysql) IsRevoked(tokenID string) (bool, error) {
+	var count int
+	err := t.db.QueryRow("SELECT COUNT(*) FROM revoked_tokens WHERE jti=?", tokenID).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// execer is common interface of sql.DB and sql.Tx
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+func createRefreshToken(db execer, token *model.RefreshToken) error {
+	statement := "INSERT INTO refresh_tokens(token_hash, family, user_id, expires_at, revoked) VALUES(?, ?, ?, ?, ?)"
+	_, err := db.Exec(statement, token.Hash, token.Family, token.UserID, token.ExpiresAt, token.Revoked)
+	return err
+}
+
+func NewTokenRepoMysql(user, password, dbname string) *TokenRepoMysql {
+	return &TokenRepoMysql{db: openDB(user, password, dbname)}
+}
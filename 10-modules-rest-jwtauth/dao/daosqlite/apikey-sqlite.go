@@ -0,0 +1,97 @@
+package daosqlite
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/iproduct/coursego/10-modules-rest-jwtauth/model"
+)
+
+const apiKeyColumns = "id, user_id, name, prefix, key_hash, scopes, created_at, last_used_at, revoked"
+
+// APIKeyRepoSqlite stores API keys in SQLite
+type APIKeyRepoSqlite struct {
+	db *sql.DB
+}
+
+// Create stores new API key, setting its ID
+func (k *APIKeyRepoSqlite) Create(key *model.APIKey) error {
+	statement := "INSERT INTO api_keys(user_id, name, prefix, key_hash, scopes, created_at, revoked) VALUES(?, ?, ?, ?, ?, ?, ?)"
+	result, err := k.db.Exec(statement, key.UserID, key.Name, key.Prefix, key.Hash, joinRoles(key.Scopes), key.CreatedAt, key.Revoked)
+	if err != nil {
+		return err
+	}
+	id, err := result.LastInsertId()
+	key.ID = int(id)
+	return err
+}
+
+// FindByPrefix returns API key with the public prefix
+func (k *APIKeyRepoSqlite) FindByPrefix(prefix string) (*model.APIKey, error) {
+	rows, err := k.db.Query("SELECT "+apiKeyColumns+" FROM api_keys WHERE prefix=?", prefix)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := scanAPIKeys(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return &keys[0], nil
+}
+
+// FindByUser returns all API keys of the user
+func (k *APIKeyRepoSqlite) FindByUser(userID int) ([]model.APIKey, error) {
+	rows, err := k.db.Query("SELECT "+apiKeyColumns+" FROM api_keys WHERE user_id=? ORDER BY id", userID)
+	if err != nil {
+		return nil, err
+	}
+	return scanAPIKeys(rows)
+}
+
+// Revoke revokes API key of the user
+func (k *APIKeyRepoSqlite) Revoke(userID, id int) error {
+	result, err := k.db.Exec("UPDATE api_keys SET revoked=TRUE WHERE id=? AND user_id=?", id, userID)
+	if err != nil {
+		return err
+	}
+	if rows, err := result.RowsAffected(); err != nil {
+		return err
+	} else if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// Touch sets last time the API key was used
+func (k *APIKeyRepoSqlite) Touch(id int, usedAt time.Time) error {
+	_, err := k.db.Exec("UPDATE api_keys SET last_used_at=? WHERE id=?", usedAt, id)
+	return err
+}
+
+// scanAPIKeys reads and closes rows selected with apiKeyColumns
+func scanAPIKeys(rows *sql.Rows) ([]model.APIKey, error) {
+	defer rows.Close()
+	keys := []model.APIKey{}
+	for rows.Next() {
+		var key model.APIKey
+		var scopes string
+		var lastUsed sql.NullTime
+		err := rows.Scan(&key.ID, &key.UserID, &key.Name, &key.Prefix, &key.Hash, &scopes, &key.CreatedAt, &lastUsed, &key.Revoked)
+		if err != nil {
+			return nil, err
+		}
+		key.Scopes = splitRoles(scopes)
+		if lastUsed.Valid {
+			key.LastUsedAt = &lastUsed.Time
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+func NewAPIKeyRepoSqlite(db *sql.DB) *APIKeyRepoSqlite {
+	return &APIKeyRepoSqlite{db: db}
+}
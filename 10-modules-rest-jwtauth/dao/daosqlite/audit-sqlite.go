@@ -0,0 +1,51 @@
+package daosqlite
+
+import (
+	"database/sql"
+
+	"github.com/iproduct/coursego/10-modules-rest-jwtauth/model"
+)
+
+// LoginAuditRepoSqlite stores login audit records in SQLite
+type LoginAuditRepoSqlite struct {
+	db *sql.DB
+}
+
+// Record stores audit record, setting its ID
+func (l *LoginAuditRepoSqlite) Record(event *model.LoginEvent) error {
+	statement := "INSERT INTO login_audit(time, event, email, user_id, ip, reason) VALUES(?, ?, ?, ?, ?, ?)"
+	userID := sql.NullInt64{Int64: int64(event.UserID), Valid: event.UserID != 0}
+	result, err := l.db.Exec(statement, event.Time, event.Event, event.Email, userID, event.IP, event.Reason)
+	if err != nil {
+		return err
+	}
+	id, err := result.LastInsertId()
+	event.ID = int(id)
+	return err
+}
+
+// FindAll returns audit records starting from the latest one
+func (l *LoginAuditRepoSqlite) FindAll(start, count int) ([]model.LoginEvent, error) {
+	statement := "SELECT id, time, event, email, user_id, ip, reason FROM login_audit ORDER BY id DESC LIMIT ? OFFSET ?"
+	rows, err := l.db.Query(statement, count, start)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	events := []model.LoginEvent{}
+	for rows.Next() {
+		var event model.LoginEvent
+		var userID sql.NullInt64
+		err := rows.Scan(&event.ID, &event.Time, &event.Event, &event.Email, &userID, &event.IP, &event.Reason)
+		if err != nil {
+			return nil, err
+		}
+		event.UserID = int(userID.Int64)
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+func NewLoginAuditRepoSqlite(db *sql.DB) *LoginAuditRepoSqlite {
+	return &LoginAuditRepoSqlite{db: db}
+}
@@ -0,0 +1,257 @@
+package daosqlite
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/iproduct/coursego/10-modules-rest-jwtauth/dao"
+	"github.com/iproduct/coursego/10-modules-rest-jwtauth/model"
+)
+
+func TestUserRepoSqlite(t *testing.T) {
+	db, err := Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	users := NewUserRepoSqlite(db)
+
+	user := &model.User{Name: "User 1", Email: "user1@mydomain.com", Password: "secret", Age: 20, Active: true, Roles: []string{model.RoleAdmin, model.RoleUser}}
+	if _, err := users.Create(user); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := users.Create(&model.User{Name: "User 2", Email: "USER1@mydomain.com", Password: "secret", Age: 30}); err != dao.ErrDuplicateEmail {
+		t.Errorf("Create with used email error = %v, want %v", err, dao.ErrDuplicateEmail)
+	}
+	found, err := users.FindByEmail("user1@mydomain.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.ID != user.ID || len(found.Roles) != 2 || !found.Active {
+		t.Errorf("FindByEmail = %+v, want %+v", found, user)
+	}
+}
+
+// TestUserRepoSqlite_FindAll checks SQL queries select the same users as in-memory queries
+func TestUserRepoSqlite_FindAll(t *testing.T) {
+	db, err := Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	users := NewUserRepoSqlite(db)
+	all := []model.User{
+		{Name: "Ann", Email: "ann@mydomain.com", Age: 30, Active: true},
+		{Name: "bob", Email: "bob@other.com", Age: 20},
+		{Name: "Bobby", Email: "bobby@mydomain.com", Age: 30, Active: true},
+		{Name: "Carl_1", Email: "carl@mydomain.com", Age: 40, Active: true},
+		{Name: "ann", Email: "ann2@mydomain.com", Age: 30},
+	}
+	for i := range all {
+		if _, err := users.Create(&all[i]); err != nil {
+			t.Fatal(err)
+		}
+		all[i].Roles = []string{}
+	}
+
+	active, maxAge := true, 30
+	queries := []dao.UserQuery{
+		{},
+		{Name: "bob"},
+		{Name: "_"},
+		{Email: "MYDOMAIN", Active: &active, MaxAge: &maxAge},
+		{Sort: []dao.SortField{{Field: dao.FieldAge, Desc: true}, {Field: dao.FieldName}}},
+		{Sort: []dao.SortField{{Field: dao.FieldName}}, After: &all[0], Limit: 2},
+		{Sort: []dao.SortField{{Field: dao.FieldActive}, {Field: dao.FieldEmail, Desc: true}}, After: &all[2]},
+		{Offset: 1, Limit: 2},
+	}
+	for _, q := range queries {
+		found, err := users.FindAll(&q)
+		if err != nil {
+			t.Fatalf("FindAll(%+v): %v", q, err)
+		}
+		if want := q.Apply(all); !reflect.DeepEqual(found, want) {
+			t.Errorf("FindAll(%+v) = %v, want %v", q, found, want)
+		}
+		count, err := users.Count(&q)
+		if want := len((&dao.UserQuery{Name: q.Name, Email: q.Email, Active: q.Active, MaxAge: q.MaxAge}).Apply(all)); err != nil || count != want {
+			t.Errorf("Count(%+v) = %d, %v, want %d", q, count, err, want)
+		}
+	}
+}
+
+// createUser creates user with ID 1 referenced by other rows
+func createUser(t *testing.T, db *sql.DB) {
+	t.Helper()
+	if _, err := NewUserRepoSqlite(db).Create(&model.User{Name: "User 1", Email: "user1@mydomain.com", Password: "secret", Age: 20}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTokenRepoSqlite_Rotate(t *testing.T) {
+	db, err := Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	tokens := NewTokenRepoSqlite(db)
+	createUser(t, db)
+
+	exp := time.Now().Add(time.Hour)
+	first := &model.RefreshToken{Hash: "h1", Family: "f", UserID: 1, ExpiresAt: exp}
+	if err := tokens.Create(first); err != nil {
+		t.Fatal(err)
+	}
+	if err := tokens.Rotate("h1", &model.RefreshToken{Hash: "h2", Family: "f", UserID: 1, ExpiresAt: exp}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tokens.Rotate("h1", &model.RefreshToken{Hash: "h3", Family: "f", UserID: 1, ExpiresAt: exp}); err != dao.ErrTokenUsed {
+		t.Errorf("second Rotate error = %v, want %v", err, dao.ErrTokenUsed)
+	}
+	if err := tokens.Revoke("jti", exp); err != nil {
+		t.Fatal(err)
+	}
+	if err := tokens.Revoke("jti", exp); err != nil {
+		t.Errorf("repeated Revoke error = %v", err)
+	}
+	if revoked, err := tokens.IsRevoked("jti"); err != nil || !revoked {
+		t.Errorf("IsRevoked = %v, %v, want true", revoked, err)
+	}
+	if err := tokens.Consume("action", exp); err != nil {
+		t.Fatal(err)
+	}
+	if err := tokens.Consume("action", exp); err != dao.ErrTokenRevoked {
+		t.Errorf("second Consume error = %v, want %v", err, dao.ErrTokenRevoked)
+	}
+
+	if err := tokens.RevokeUser(1); err != nil {
+		t.Fatal(err)
+	}
+	if found, err := tokens.FindByHash("h2"); err != nil || !found.Revoked {
+		t.Errorf("FindByHash after RevokeUser = %+v, %v, want revoked token", found, err)
+	}
+}
+
+func TestAPIKeyRepoSqlite(t *testing.T) {
+	db, err := Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	keys := NewAPIKeyRepoSqlite(db)
+	createUser(t, db)
+
+	key := &model.APIKey{UserID: 1, Name: "ci", Prefix: "abcdefgh", Hash: "hash", Scopes: []string{model.ScopeUsersRead}, CreatedAt: time.Now()}
+	if err := keys.Create(key); err != nil {
+		t.Fatal(err)
+	}
+	used := time.Now().Add(time.Minute).Round(time.Millisecond)
+	if err := keys.Touch(key.ID, used); err != nil {
+		t.Fatal(err)
+	}
+	found, err := keys.FindByPrefix("abcdefgh")
+	if err != nil || found.LastUsedAt == nil || !found.LastUsedAt.Equal(used) || !reflect.DeepEqual(found.Scopes, key.Scopes) {
+		t.Errorf("FindByPrefix = %+v, %v, want key used at %v", found, err, used)
+	}
+	if err := keys.Revoke(2, key.ID); err != sql.ErrNoRows {
+		t.Errorf("Revoke of other user key error = %v, want %v", err, sql.ErrNoRows)
+	}
+	if err := keys.Revoke(1, key.ID); err != nil {
+		t.Fatal(err)
+	}
+	if list, err := keys.FindByUser(1); err != nil || len(list) != 1 || !list[0].Revoked {
+		t.Errorf("FindByUser = %+v, %v, want revoked key", list, err)
+	}
+}
+
+// TestUserAuditRepoSqlite checks SQL queries select the same audit entries as in-memory queries
+func TestUserAuditRepoSqlite(t *testing.T) {
+	db, err := Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	audit := NewUserAuditRepoSqlite(db)
+	start := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	all := []model.AuditEntry{
+		{Time: start, ActorID: 1, Action: model.UserUpdated, TargetID: 1,
+			Diff: map[string]model.FieldChange{"password": {Before: model.Redacted, After: model.Redacted}}},
+		{Time: start.Add(time.Minute), ActorID: 2, Action: model.UserUpdated, TargetID: 1,
+			Diff: map[string]model.FieldChange{"name": {Before: "User 1", After: "User One"}}},
+		{Time: start.Add(2 * time.Minute), ActorID: 2, Action: model.UserDeleted, TargetID: 3,
+			Diff: map[string]model.FieldChange{"active": {Before: true, After: nil}}},
+	}
+	for i := range all {
+		if err := audit.Record(&all[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	queries := []dao.AuditQuery{
+		{},
+		{ActorID: 2},
+		{ActorID: 2, TargetID: 1},
+		{From: start.Add(time.Minute)},
+		{From: start.Add(30 * time.Second).In(time.FixedZone("EET", 2*3600)), To: start.Add(2 * time.Minute)},
+		{Offset: 1, Limit: 1},
+	}
+	for _, q := range queries {
+		found, err := audit.Find(&q)
+		if err != nil {
+			t.Fatalf("Find(%+v): %v", q, err)
+		}
+		if got, want := auditIDs(found), auditIDs(q.Apply(all)); !reflect.DeepEqual(got, want) {
+			t.Errorf("Find(%+v) = %v, want %v", q, got, want)
+		}
+	}
+	found, _ := audit.Find(&dao.AuditQuery{TargetID: 3})
+	if len(found) != 1 || !found[0].Time.Equal(all[2].Time) || !reflect.DeepEqual(found[0].Diff, all[2].Diff) {
+		t.Errorf("Find = %+v, want %+v", found, all[2])
+	}
+}
+
+// auditIDs returns IDs of audit entries
+func auditIDs(entries []model.AuditEntry) []int {
+	ids := []int{}
+	for _, entry := range entries {
+		ids = append(ids, entry.ID)
+	}
+	return ids
+}
+
+func TestDeleteUserCascades(t *testing.T) {
+	db, err := Open(":memory:?_pragma=busy_timeout(1000)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	users := NewUserRepoSqlite(db)
+	user, err := users.Create(&model.User{Name: "User 1", Email: "user1@mydomain.com", Password: "secret", Age: 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := NewTokenRepoSqlite(db).Create(&model.RefreshToken{Hash: "hash", Family: "family", UserID: user.ID, ExpiresAt: time.Now().Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewIdentityRepoSqlite(db).Link("https://idp", "subject", user.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewAPIKeyRepoSqlite(db).Create(&model.APIKey{UserID: user.ID, Name: "ci", Prefix: "abcd1234", Hash: "hash", CreatedAt: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := users.DeleteByID(user.ID); err != nil {
+		t.Fatal(err)
+	}
+	for _, table := range []string{"refresh_tokens", "user_identities", "api_keys"} {
+		var count int
+		if err := db.QueryRow("SELECT COUNT(*) FROM " + table).Scan(&count); err != nil {
+			t.Fatal(err)
+		}
+		if count != 0 {
+			t.Errorf("%s has %d rows of deleted user, want 0", table, count)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package daosqlite
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	// pure-Go sqlite driver
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// schema creates tables if they do not exist yet, emails are unique regardless of letter case as in MySQL
+const schema = `
+CREATE TABLE IF NOT EXISTS users (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name VARCHAR(50) NOT NULL,
+    email VARCHAR(50) NOT NULL COLLATE NOCASE,
+    password VARCHAR(120) NOT NULL,
+    age INT NOT NULL,
+    active BOOLEAN DEFAULT TRUE,
+    roles VARCHAR(100) NOT NULL DEFAULT 'user'
+);
+CREATE UNIQUE INDEX IF NOT EXISTS uidx_email ON users (email);
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    token_hash CHAR(64) PRIMARY KEY,
+    family VARCHAR(32) NOT NULL,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    expires_at DATETIME NOT NULL,
+    replaced_by CHAR(64) NULL,
+    revoked BOOLEAN NOT NULL DEFAULT FALSE
+);
+CREATE INDEX IF NOT EXISTS idx_refresh_family ON refresh_tokens (family);
+CREATE TABLE IF NOT EXISTS revoked_tokens (
+    jti VARCHAR(32) PRIMARY KEY,
+    expires_at DATETIME NOT NULL
+);
+CREATE TABLE IF NOT EXISTS login_audit (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    time DATETIME NOT NULL,
+    event VARCHAR(20) NOT NULL,
+    email VARCHAR(50) NOT NULL,
+    user_id INT NULL,
+    ip VARCHAR(45) NOT NULL,
+    reason VARCHAR(100) NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS idx_login_audit_email ON login_audit (email);
+CREATE TABLE IF NOT EXISTS audit_log (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    time DATETIME NOT NULL,
+    actor_id INT NOT NULL,
+    action VARCHAR(20) NOT NULL,
+    target_id INT NOT NULL,
+    diff TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_audit_log_actor ON audit_log (actor_id);
+CREATE INDEX IF NOT EXISTS idx_audit_log_target ON audit_log (target_id);
+CREATE TABLE IF NOT EXISTS user_identities (
+    issuer VARCHAR(255) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    PRIMARY KEY (issuer, subject)
+);
+CREATE TABLE IF NOT EXISTS api_keys (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(50) NOT NULL,
+    prefix CHAR(8) NOT NULL UNIQUE,
+    key_hash CHAR(64) NOT NULL,
+    scopes VARCHAR(100) NOT NULL,
+    created_at DATETIME NOT NULL,
+    last_used_at DATETIME NULL,
+    revoked BOOLEAN NOT NULL DEFAULT FALSE
+);
+CREATE INDEX IF NOT EXISTS idx_api_keys_user ON api_keys (user_id)`
+
+// Open opens (and creates if needed) SQLite database file at path.
+// Use ":memory:" path for a private in-memory database.
+func Open(path string) (*sql.DB, error) {
+	name, err := dataSourceName(path)
+	if err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("sqlite", name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %v", err)
+	}
+	// all repos share one connection, and so one ":memory:" database
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create database schema: %v", err)
+	}
+	return db, nil
+}
+
+// dataSourceName adds driver parameters to parameters of the path
+func dataSourceName(path string) (string, error) {
+	file, query := path, ""
+	if i := strings.IndexByte(path, '?'); i >= 0 {
+		file, query = path[:i], path[i+1:]
+	}
+	params, err := url.ParseQuery(query)
+	if err != nil {
+		return "", fmt.Errorf("invalid database path %q: %v", path, err)
+	}
+	// audit and token expiry queries compare stored times
+	params.Set("_time_format", "sqlite")
+	// cascades deletes of users to their tokens, identities and keys
+	params.Add("_pragma", "foreign_keys(1)")
+	return file + "?" + params.Encode(), nil
+}
+
+// isUniqueViolation checks if the error is caused by unique index violation
+func isUniqueViolation(err error) bool {
+	var se *sqlite.Error
+	return errors.As(err, &se) && se.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE
+}
+
+// joinRoles returns roles stored as comma separated list
+func joinRoles(roles []string) string {
+	return strings.Join(roles, ",")
+}
+
+// splitRoles returns roles from comma separated list
+func splitRoles(roles string) []string {
+	if roles == "" {
+		return []string{}
+	}
+	return strings.Split(roles, ",")
+}
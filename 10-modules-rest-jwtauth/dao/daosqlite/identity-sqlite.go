@@ -0,0 +1,27 @@
+package daosqlite
+
+import (
+	"database/sql"
+)
+
+// IdentityRepoSqlite stores links of OpenID Connect provider subjects to users in SQLite
+type IdentityRepoSqlite struct {
+	db *sql.DB
+}
+
+// FindUserID returns ID of the user linked to the provider subject
+func (i *IdentityRepoSqlite) FindUserID(issuer, subject string) (int, error) {
+	var userID int
+	err := i.db.QueryRow("SELECT user_id FROM user_identities WHERE issuer=? AND subject=?", issuer, subject).Scan(&userID)
+	return userID, err
+}
+
+// Link links the provider subject to the user
+func (i *IdentityRepoSqlite) Link(issuer, subject string, userID int) error {
+	_, err := i.db.Exec("INSERT OR REPLACE INTO user_identities(issuer, subject, user_id) VALUES(?, ?, ?)", issuer, subject, userID)
+	return err
+}
+
+func NewIdentityRepoSqlite(db *sql.DB) *IdentityRepoSqlite {
+	return &IdentityRepoSqlite{db: db}
+}
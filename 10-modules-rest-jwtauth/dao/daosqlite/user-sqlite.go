@@ -0,0 +1,110 @@
+package daosqlite
+
+import (
+	"database/sql"
+
+	"github.com/iproduct/coursego/10-modules-rest-jwtauth/dao"
+	"github.com/iproduct/coursego/10-modules-rest-jwtauth/model"
+)
+
+const userColumns = "id, name, email, password, age, active, roles"
+
+// UserRepoSqlite stores users in SQLite
+type UserRepoSqlite struct {
+	db *sql.DB
+}
+
+// scanner is common interface of sql.Row and sql.Rows
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanUser scans user row selected with userColumns
+func scanUser(row scanner) (*model.User, error) {
+	user := &model.User{}
+	var roles string
+	if err := row.Scan(&user.ID, &user.Name, &user.Email, &user.Password, &user.Age, &user.Active, &roles); err != nil {
+		return nil, err
+	}
+	user.Roles = splitRoles(roles)
+	return user, nil
+}
+
+// FindAll returns users selected, sorted and paginated by the query
+func (u *UserRepoSqlite) FindAll(q *dao.UserQuery) ([]model.User, error) {
+	clauses, args := q.SQL()
+	rows, err := u.db.Query("SELECT "+userColumns+" FROM users"+clauses, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	users := []model.User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, *user)
+	}
+	return users, rows.Err()
+}
+
+// FindByID returns user by user ID or sql.ErrNoRows otherwise
+func (u *UserRepoSqlite) FindByID(id int) (*model.User, error) {
+	return scanUser(u.db.QueryRow("SELECT "+userColumns+" FROM users WHERE id= ?", id))
+}
+
+// FindByEmail returns user by email or sql.ErrNoRows otherwise
+func (u *UserRepoSqlite) FindByEmail(email string) (*model.User, error) {
+	return scanUser(u.db.QueryRow("SELECT "+userColumns+" FROM users WHERE email= ?", email))
+}
+
+// Create creates and returns new user with autogenerated ID, or dao.ErrDuplicateEmail if the email is used
+func (u *UserRepoSqlite) Create(user *model.User) (*model.User, error) {
+	statement := "INSERT INTO users(name, email, password, age, active, roles) VALUES(?, ?, ?, ?, ?, ?)"
+	result, err := u.db.Exec(statement, user.Name, user.Email, user.Password, user.Age, user.Active, joinRoles(user.Roles))
+	if err != nil {
+		if isUniqueViolation(err) {
+			return nil, dao.ErrDuplicateEmail
+		}
+		return nil, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	user.ID = int(id)
+	return user, nil
+}
+
+// Update updates existing user data, except the email
+func (u *UserRepoSqlite) Update(user *model.User) (*model.User, error) {
+	statement := "UPDATE users SET name=?, password=?, age=?, active=?, roles=? WHERE id=?"
+	_, err := u.db.Exec(statement, user.Name, user.Password, user.Age, user.Active, joinRoles(user.Roles), user.ID)
+	if err != nil {
+		return nil, err
+	}
+	return u.FindByID(user.ID)
+}
+
+// DeleteByID removes and returns user with specified ID or sql.ErrNoRows otherwise
+func (u *UserRepoSqlite) DeleteByID(id int) (*model.User, error) {
+	user, err := u.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	_, err = u.db.Exec("DELETE FROM users WHERE id=?", id)
+	return user, err
+}
+
+// Count returns the count of users passing the query filters
+func (u *UserRepoSqlite) Count(q *dao.UserQuery) (int, error) {
+	var count int
+	where, args := q.Where()
+	err := u.db.QueryRow("SELECT COUNT(*) FROM users"+where, args...).Scan(&count)
+	return count, err
+}
+
+func NewUserRepoSqlite(db *sql.DB) *UserRepoSqlite {
+	return &UserRepoSqlite{db: db}
+}
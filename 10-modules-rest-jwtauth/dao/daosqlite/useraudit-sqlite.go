@@ -0,0 +1,57 @@
+package daosqlite
+
+import (
+	"database/sql"
+	"encoding/json"
+
+	"github.com/iproduct/coursego/10-modules-rest-jwtauth/dao"
+	"github.com/iproduct/coursego/10-modules-rest-jwtauth/model"
+)
+
+// UserAuditRepoSqlite stores audit log of user changes in SQLite, diffs are stored as JSON
+type UserAuditRepoSqlite struct {
+	db *sql.DB
+}
+
+// Record stores audit entry, setting its ID
+func (u *UserAuditRepoSqlite) Record(entry *model.AuditEntry) error {
+	diff, err := json.Marshal(entry.Diff)
+	if err != nil {
+		return err
+	}
+	statement := "INSERT INTO audit_log(time, actor_id, action, target_id, diff) VALUES(?, ?, ?, ?, ?)"
+	result, err := u.db.Exec(statement, entry.Time.UTC(), entry.ActorID, entry.Action, entry.TargetID, string(diff))
+	if err != nil {
+		return err
+	}
+	id, err := result.LastInsertId()
+	entry.ID = int(id)
+	return err
+}
+
+// Find returns entries selected by the query starting from the latest one
+func (u *UserAuditRepoSqlite) Find(q *dao.AuditQuery) ([]model.AuditEntry, error) {
+	clauses, args := q.SQL()
+	rows, err := u.db.Query("SELECT id, time, actor_id, action, target_id, diff FROM audit_log"+clauses, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	entries := []model.AuditEntry{}
+	for rows.Next() {
+		var entry model.AuditEntry
+		var diff string
+		if err := rows.Scan(&entry.ID, &entry.Time, &entry.ActorID, &entry.Action, &entry.TargetID, &diff); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(diff), &entry.Diff); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+func NewUserAuditRepoSqlite(db *sql.DB) *UserAuditRepoSqlite {
+	return &UserAuditRepoSqlite{db: db}
+}
@@ -0,0 +1,269 @@
+package dao
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/iproduct/coursego/10-modules-rest-jwtauth/model"
+)
+
+// Sortable user fields
+const (
+	FieldID     = "id"
+	FieldName   = "name"
+	FieldEmail  = "email"
+	FieldAge    = "age"
+	FieldActive = "active"
+)
+
+// sortColumns are SQL expressions of sortable fields, names and emails are sorted regardless of letter case
+var sortColumns = map[string]string{
+	FieldID:     "id",
+	FieldName:   "LOWER(name)",
+	FieldEmail:  "LOWER(email)",
+	FieldAge:    "age",
+	FieldActive: "active",
+}
+
+// SortField is single field of sort order
+type SortField struct {
+	Field string
+	Desc  bool
+}
+
+// ParseSort parses comma separated list of fields, descending fields are prefixed with '-', e.g. "-age,name"
+func ParseSort(spec string) ([]SortField, error) {
+	fields := []SortField{}
+	if spec == "" {
+		return fields, nil
+	}
+	for _, name := range strings.Split(spec, ",") {
+		field := SortField{Field: strings.TrimSpace(name)}
+		if strings.HasPrefix(field.Field, "-") {
+			field.Field, field.Desc = field.Field[1:], true
+		} else {
+			field.Field = strings.TrimPrefix(field.Field, "+")
+		}
+		if _, ok := sortColumns[field.Field]; !ok {
+			return nil, fmt.Errorf("invalid sort field: %q", field.Field)
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+// FormatSort returns sort order in ParseSort format
+func FormatSort(fields []SortField) string {
+	names := make([]string, len(fields))
+	for i, field := range fields {
+		names[i] = field.Field
+		if field.Desc {
+			names[i] = "-" + field.Field
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+// UserQuery specifies filtering, sorting and pagination of users.
+// Zero value selects all users ordered by ID.
+type UserQuery struct {
+	// Name and Email filter users containing the substrings, regardless of letter case
+	Name  string
+	Email string
+	// Active filters users by active flag if not nil
+	Active *bool
+	// MinAge and MaxAge filter users by age range, including the limits, if not nil
+	MinAge *int
+	MaxAge *int
+	// Sort is sort order, ID is always used as last sort field so the order is unique
+	Sort []SortField
+	// After selects users following this one in sort order (keyset pagination), if not nil
+	After *model.User
+	// Offset skips number of users, Limit limits number of users returned if positive
+	Offset int
+	Limit  int
+}
+
+// Order returns sort order of the query ending with ID
+func (q *UserQuery) Order() []SortField {
+	order := append([]SortField{}, q.Sort...)
+	for _, field := range order {
+		if field.Field == FieldID {
+			return order
+		}
+	}
+	return append(order, SortField{Field: FieldID})
+}
+
+// Matches checks if the user passes query filters
+func (q *UserQuery) Matches(user *model.User) bool {
+	return containsFold(user.Name, q.Name) &&
+		containsFold(user.Email, q.Email) &&
+		(q.Active == nil || user.Active == *q.Active) &&
+		(q.MinAge == nil || user.Age >= *q.MinAge) &&
+		(q.MaxAge == nil || user.Age <= *q.MaxAge)
+}
+
+// Compare returns negative number if user a precedes user b in sort order of the query, positive if it follows it,
+// and 0 if they are equal
+func (q *UserQuery) Compare(a, b *model.User) int {
+	for _, field := range q.Order() {
+		c := compareValues(fieldValue(a, field.Field), fieldValue(b, field.Field))
+		if field.Desc {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// Apply filters, sorts and paginates users in memory by the query
+func (q *UserQuery) Apply(users []model.User) []model.User {
+	selected := []model.User{}
+	for i := range users {
+		if q.Matches(&users[i]) && (q.After == nil || q.Compare(&users[i], q.After) > 0) {
+			selected = append(selected, users[i])
+		}
+	}
+	sort.Slice(selected, func(i, j int) bool { return q.Compare(&selected[i], &selected[j]) < 0 })
+	if q.Offset >= len(selected) {
+		return []model.User{}
+	}
+	selected = selected[q.Offset:]
+	if q.Limit > 0 && q.Limit < len(selected) {
+		selected = selected[:q.Limit]
+	}
+	return selected
+}
+
+// Where returns SQL WHERE clause of query filters, without keyset pagination, and its arguments.
+// Clause is empty if there are no filters.
+func (q *UserQuery) Where() (string, []interface{}) {
+	return q.where(false)
+}
+
+// SQL returns SQL WHERE, ORDER BY, LIMIT and OFFSET clauses of the query and their arguments.
+// The clauses are standard SQL supported by both MySQL and SQLite.
+func (q *UserQuery) SQL() (string, []interface{}) {
+	clauses, args := q.where(true)
+	order := q.Order()
+	columns := make([]string, len(order))
+	for i, field := range order {
+		columns[i] = sortColumns[field.Field]
+		if field.Desc {
+			columns[i] += " DESC"
+		}
+	}
+	clauses += " ORDER BY " + strings.Join(columns, ", ") + " LIMIT ? OFFSET ?"
+	limit := q.Limit
+	if limit <= 0 {
+		limit = math.MaxInt32
+	}
+	return clauses, append(args, limit, q.Offset)
+}
+
+func (q *UserQuery) where(keyset bool) (string, []interface{}) {
+	conditions := []string{}
+	args := []interface{}{}
+	if q.Name != "" {
+		conditions = append(conditions, "LOWER(name) LIKE ? ESCAPE '!'")
+		args = append(args, likePattern(q.Name))
+	}
+	if q.Email != "" {
+		conditions = append(conditions, "LOWER(email) LIKE ? ESCAPE '!'")
+		args = append(args, likePattern(q.Email))
+	}
+	if q.Active != nil {
+		conditions = append(conditions, "active = ?")
+		args = append(args, *q.Active)
+	}
+	if q.MinAge != nil {
+		conditions = append(conditions, "age >= ?")
+		args = append(args, *q.MinAge)
+	}
+	if q.MaxAge != nil {
+		conditions = append(conditions, "age <= ?")
+		args = append(args, *q.MaxAge)
+	}
+	if keyset && q.After != nil {
+		condition, keysetArgs := q.keyset()
+		conditions = append(conditions, condition)
+		args = append(args, keysetArgs...)
+	}
+	if len(conditions) == 0 {
+		return "", args
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// keyset returns condition selecting rows after q.After in sort order:
+// (f1 > v1) OR (f1 = v1 AND f2 > v2) OR ...
+func (q *UserQuery) keyset() (string, []interface{}) {
+	order := q.Order()
+	alternatives := make([]string, len(order))
+	args := []interface{}{}
+	for i, field := range order {
+		terms := []string{}
+		for _, prev := range order[:i] {
+			terms = append(terms, sortColumns[prev.Field]+" = ?")
+			args = append(args, fieldValue(q.After, prev.Field))
+		}
+		op := " > ?"
+		if field.Desc {
+			op = " < ?"
+		}
+		terms = append(terms, sortColumns[field.Field]+op)
+		args = append(args, fieldValue(q.After, field.Field))
+		alternatives[i] = "(" + strings.Join(terms, " AND ") + ")"
+	}
+	return "(" + strings.Join(alternatives, " OR ") + ")", args
+}
+
+// fieldValue returns value of the user field as it is sorted
+func fieldValue(user *model.User, field string) interface{} {
+	switch field {
+	case FieldName:
+		return strings.ToLower(user.Name)
+	case FieldEmail:
+		return strings.ToLower(user.Email)
+	case FieldAge:
+		return user.Age
+	case FieldActive:
+		return user.Active
+	default:
+		return user.ID
+	}
+}
+
+func compareValues(a, b interface{}) int {
+	switch a := a.(type) {
+	case string:
+		return strings.Compare(a, b.(string))
+	case int:
+		return a - b.(int)
+	case bool:
+		switch {
+		case a == b.(bool):
+			return 0
+		case a:
+			return 1
+		default:
+			return -1
+		}
+	}
+	return 0
+}
+
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+// likePattern returns LIKE pattern matching lower case substring, escaping LIKE wildcards with '!'
+func likePattern(substr string) string {
+	escaped := strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(strings.ToLower(substr))
+	return "%" + escaped + "%"
+}
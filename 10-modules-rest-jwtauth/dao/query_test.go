@@ -0,0 +1,61 @@
+package dao
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/iproduct/coursego/10-modules-rest-jwtauth/model"
+)
+
+var queryUsers = []model.User{
+	{ID: 1, Name: "Ann", Email: "ann@mydomain.com", Age: 30, Active: true},
+	{ID: 2, Name: "bob", Email: "bob@other.com", Age: 20, Active: false},
+	{ID: 3, Name: "Bobby", Email: "bobby@mydomain.com", Age: 30, Active: true},
+	{ID: 4, Name: "Carl_1", Email: "carl@mydomain.com", Age: 40, Active: true},
+}
+
+func ids(users []model.User) []int {
+	result := []int{}
+	for _, user := range users {
+		result = append(result, user.ID)
+	}
+	return result
+}
+
+func TestParseSort(t *testing.T) {
+	fields, err := ParseSort("-age, name")
+	want := []SortField{{Field: FieldAge, Desc: true}, {Field: FieldName}}
+	if err != nil || !reflect.DeepEqual(fields, want) {
+		t.Errorf("ParseSort = %v, %v, want %v", fields, err, want)
+	}
+	if FormatSort(fields) != "-age,name" {
+		t.Errorf("FormatSort = %q, want %q", FormatSort(fields), "-age,name")
+	}
+	if _, err := ParseSort("password"); err == nil {
+		t.Error("ParseSort(password) succeeded, want error")
+	}
+}
+
+func TestUserQuery_Apply(t *testing.T) {
+	active, minAge := true, 25
+	tests := []struct {
+		name  string
+		query UserQuery
+		want  []int
+	}{
+		{"all by ID", UserQuery{}, []int{1, 2, 3, 4}},
+		{"name ignoring case", UserQuery{Name: "BOB"}, []int{2, 3}},
+		{"name with wildcard", UserQuery{Name: "_"}, []int{4}},
+		{"email, active and age", UserQuery{Email: "mydomain", Active: &active, MinAge: &minAge}, []int{1, 3, 4}},
+		{"sort by age desc and name", UserQuery{Sort: []SortField{{Field: FieldAge, Desc: true}, {Field: FieldName}}}, []int{4, 1, 3, 2}},
+		{"after user", UserQuery{Sort: []SortField{{Field: FieldAge}}, After: &queryUsers[0]}, []int{3, 4}},
+		{"offset and limit", UserQuery{Offset: 1, Limit: 2}, []int{2, 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ids(tt.query.Apply(queryUsers)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Apply = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package mail
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// EnvSMTPAddr is environment variable with host:port of SMTP server
+	EnvSMTPAddr = "MAIL_SMTP_ADDR"
+	// EnvSMTPUser is environment variable with SMTP username, empty for servers without authentication
+	EnvSMTPUser = "MAIL_SMTP_USER"
+	// EnvSMTPPassword is environment variable with SMTP password
+	EnvSMTPPassword = "MAIL_SMTP_PASSWORD"
+	// EnvFrom is environment variable with sender address
+	EnvFrom = "MAIL_FROM"
+	// EnvDir is environment variable with directory mails are written to instead of sending them
+	EnvDir = "MAIL_DIR"
+)
+
+// Message is plain text mail message
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends mail messages
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// format returns the message in RFC 5322 format
+func format(from string, msg Message) []byte {
+	// header values must not break the header lines
+	header := strings.NewReplacer("\r", "", "\n", "")
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", header.Replace(from))
+	fmt.Fprintf(&b, "To: %s\r\n", header.Replace(msg.To))
+	fmt.Fprintf(&b, "Subject: %s\r\n", header.Replace(msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
+
+// SMTPMailer sends mails through SMTP server
+type SMTPMailer struct {
+	Addr string
+	From string
+	// Auth authenticates to the server, nil for servers without authentication
+	Auth smtp.Auth
+}
+
+func (m *SMTPMailer) Send(msg Message) error {
+	return smtp.SendMail(m.Addr, m.Auth, m.From, []string{msg.To}, format(m.From, msg))
+}
+
+// NewSMTPMailer creates mailer using PLAIN authentication if username is not empty
+func NewSMTPMailer(addr, username, password, from string) *SMTPMailer {
+	m := &SMTPMailer{Addr: addr, From: from}
+	if username != "" {
+		host := addr
+		if i := strings.LastIndex(addr, ":"); i >= 0 {
+			host = addr[:i]
+		}
+		m.Auth = smtp.PlainAuth("", username, password, host)
+	}
+	return m
+}
+
+// FileMailer writes mails to .eml files in directory, for local runs
+type FileMailer struct {
+	Dir  string
+	From string
+}
+
+func (m *FileMailer) Send(msg Message) error {
+	if err := os.MkdirAll(m.Dir, 0700); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%d-%s.eml", time.Now().UnixNano(), strings.NewReplacer("@", "_at_", "/", "_").Replace(msg.To))
+	return ioutil.WriteFile(filepath.Join(m.Dir, name), format(m.From, msg), 0600)
+}
+
+// MemoryMailer keeps sent mails in memory, for tests
+type MemoryMailer struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+func (m *MemoryMailer) Send(msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+// Messages returns mails sent to the address
+func (m *MemoryMailer) Messages(to string) []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var messages []Message
+	for _, msg := range m.messages {
+		if msg.To == to {
+			messages = append(messages, msg)
+		}
+	}
+	return messages
+}
+
+// FromEnv returns SMTP mailer if MAIL_SMTP_ADDR is set, or file mailer writing to MAIL_DIR
+// (default mails directory in temp directory) otherwise
+func FromEnv() Mailer {
+	from := os.Getenv(EnvFrom)
+	if from == "" {
+		from = "no-reply@localhost"
+	}
+	if addr := os.Getenv(EnvSMTPAddr); addr != "" {
+		return NewSMTPMailer(addr, os.Getenv(EnvSMTPUser), os.Getenv(EnvSMTPPassword), from)
+	}
+	dir := os.Getenv(EnvDir)
+	if dir == "" {
+		dir = filepath.Join(os.TempDir(), "mails")
+	}
+	log.Printf("%s is not set, writing mails to %s", EnvSMTPAddr, dir)
+	return &FileMailer{Dir: dir, From: from}
+}
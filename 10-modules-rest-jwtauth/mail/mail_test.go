@@ -0,0 +1,88 @@
+package mail
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// serveSMTP accepts single SMTP session on the listener, sending received DATA to the channel
+func serveSMTP(t *testing.T, l net.Listener, data chan<- string) {
+	conn, err := l.Accept()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+	reply("220 localhost ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		switch cmd := strings.ToUpper(strings.TrimSpace(line)); {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			reply("250 localhost")
+		case cmd == "DATA":
+			reply("354 end with .")
+			var b strings.Builder
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil || line == ".\r\n" {
+					break
+				}
+				b.WriteString(line)
+			}
+			data <- b.String()
+			reply("250 OK")
+		case cmd == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+func TestSMTPMailer(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	data := make(chan string, 1)
+	go serveSMTP(t, l, data)
+
+	m := NewSMTPMailer(l.Addr().String(), "", "", "app@mydomain.com")
+	err = m.Send(Message{To: "user1@mydomain.com", Subject: "Hello\r\nBcc: x@y.com", Body: "line 1\nline 2"})
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	got := <-data
+	for _, want := range []string{"From: app@mydomain.com\r\n", "To: user1@mydomain.com\r\n", "Subject: HelloBcc: x@y.com\r\n", "\r\n\r\nline 1\r\nline 2"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("sent mail %q does not contain %q", got, want)
+		}
+	}
+}
+
+func TestFileMailer(t *testing.T) {
+	dir := t.TempDir()
+	m := &FileMailer{Dir: filepath.Join(dir, "mails"), From: "app@mydomain.com"}
+	if err := m.Send(Message{To: "user1@mydomain.com", Subject: "Hello", Body: "body"}); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "mails", "*.eml"))
+	if len(files) != 1 {
+		t.Fatalf("mail files = %v, want 1", files)
+	}
+	data, _ := ioutil.ReadFile(files[0])
+	if !strings.Contains(string(data), "To: user1@mydomain.com\r\n") || !strings.HasSuffix(string(data), "body") {
+		t.Errorf("mail file = %q", data)
+	}
+}
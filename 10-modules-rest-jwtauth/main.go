@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"github.com/iproduct/coursego/10-modules-rest-jwtauth/rest"
 	"log"
@@ -12,9 +13,17 @@ import (
 )
 
 func main() {
+	cfg := rest.Config{}
+	flag.StringVar(&cfg.DBType, "db-type", rest.MySQL, "database type: mysql, sqlite or memory")
+	flag.StringVar(&cfg.DBUser, "db-user", "root", "MySQL user")
+	flag.StringVar(&cfg.DBPassword, "db-password", "root", "MySQL password")
+	flag.StringVar(&cfg.DBName, "db-name", "go_rest_api", "MySQL database name")
+	flag.StringVar(&cfg.SQLitePath, "sqlite-path", "go_rest_api.db", "SQLite database file")
+	flag.Parse()
+
 	fmt.Println("Staring REST User Service ...")
 	a := rest.App{}
-	a.Init("root", "root", "go_rest_api")
+	a.Init(cfg)
 	done := make(chan os.Signal, 1)
 	signal.Notify(done, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
 	a.Run(":8080")
@@ -1,24 +1,166 @@
 package model
 
-import "github.com/dgrijalva/jwt-go"
+import (
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+const (
+	// RoleAdmin is role of users managing all users
+	RoleAdmin = "admin"
+	// RoleUser is default role of registered users
+	RoleUser = "user"
+)
 
 type User struct {
-	ID       int    `json:"id" validate:"numeric,gte=0"`
-	Name     string `json:"name" validate:"required,min=5,max=30"`
-	Email    string `json:"email" validate:"required,email"`
-	Password string `json:"password,omitempty"`
-	Age      int    `json:"age" validate:"required,numeric,gte=0,lte=130"`
-	Active   bool   `json:"active"`
+	ID       int      `json:"id" validate:"numeric,gte=0"`
+	Name     string   `json:"name" validate:"required,min=5,max=30"`
+	Email    string   `json:"email" validate:"required,email"`
+	Password string   `json:"password,omitempty"`
+	Age      int      `json:"age" validate:"required,numeric,gte=0,lte=130"`
+	Active   bool     `json:"active"`
+	Roles    []string `json:"roles" validate:"dive,oneof=admin user"`
 }
 
 type UserToken struct {
+	UserID int      `json:"id"`
+	Name   string   `json:"name"`
+	Email  string   `json:"email"`
+	Roles  []string `json:"roles"`
+	// Scopes limit requests authenticated by API key with APIKeyID, access tokens are not limited
+	Scopes   []string `json:"-"`
+	APIKeyID int      `json:"-"`
+	jwt.StandardClaims
+}
+
+const (
+	// VerifyEmailAction is audience of email verification tokens
+	VerifyEmailAction = "verify_email"
+	// ResetPasswordAction is audience of password reset tokens
+	ResetPasswordAction = "reset_password"
+	// OIDCLoginAction is audience of OpenID Connect login state tokens
+	OIDCLoginAction = "oidc_login"
+)
+
+// ActionToken is claims of single use token mailed to the user, its Audience is the action it allows
+type ActionToken struct {
 	UserID int    `json:"id"`
-	Name   string `json:"name"`
 	Email  string `json:"email"`
 	jwt.StandardClaims
 }
 
+// OIDCState is claims of token keeping OpenID Connect login state in the browser cookie until provider callback
+type OIDCState struct {
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	jwt.StandardClaims
+}
+
+// EmailRequest requests mail with action token to the address
+type EmailRequest struct {
+	Email string `json:"email"`
+}
+
+// ActionRequest confirms action with mailed token, Password is new password for password reset
+type ActionRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password,omitempty"`
+}
+
 type UserLogin struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
 }
+
+// RefreshToken is stored refresh token, identified by hash of the token value sent to the client.
+// Tokens rotated from the same login share Family, so reuse of a rotated token revokes them all.
+type RefreshToken struct {
+	Hash       string
+	Family     string
+	UserID     int
+	ExpiresAt  time.Time
+	ReplacedBy string
+	Revoked    bool
+}
+
+// TokenRequest carries refresh token sent by the client to /refresh and /logout
+type TokenRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+const (
+	// LoginSucceeded is audit event of successful login
+	LoginSucceeded = "login_succeeded"
+	// LoginFailed is audit event of login with invalid credentials
+	LoginFailed = "login_failed"
+	// LoginThrottled is audit event of login rejected after too many failures
+	LoginThrottled = "login_throttled"
+	// AccountUnlocked is audit event of account unlocked by admin
+	AccountUnlocked = "account_unlocked"
+)
+
+// LoginEvent is audit record of login attempt or account unlock
+type LoginEvent struct {
+	ID     int       `json:"id"`
+	Time   time.Time `json:"time"`
+	Event  string    `json:"event"`
+	Email  string    `json:"email"`
+	UserID int       `json:"userId,omitempty"`
+	IP     string    `json:"ip"`
+	Reason string    `json:"reason,omitempty"`
+}
+
+const (
+	// ScopeUsersRead allows API key to read users
+	ScopeUsersRead = "users:read"
+	// ScopeUsersWrite allows API key to create, update and delete users
+	ScopeUsersWrite = "users:write"
+)
+
+// APIKey is API key of machine clients acting as the user, identified by hash of the key value sent
+// to the client. Prefix is public part of the key used to find it.
+type APIKey struct {
+	ID         int        `json:"id"`
+	UserID     int        `json:"userId"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Hash       string     `json:"-"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	Revoked    bool       `json:"revoked"`
+}
+
+// APIKeyRequest requests new API key
+type APIKeyRequest struct {
+	Name   string   `json:"name" validate:"required,max=50"`
+	Scopes []string `json:"scopes" validate:"required,min=1,dive,oneof=users:read users:write"`
+}
+
+const (
+	// UserUpdated is audit action of user update
+	UserUpdated = "user_updated"
+	// UserDeleted is audit action of user deletion
+	UserDeleted = "user_deleted"
+	// Redacted replaces values of secret fields, e.g. password hashes, in audit diffs
+	Redacted = "[redacted]"
+)
+
+// FieldChange is value of user field before and after the change, nil if the field did not exist
+type FieldChange struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// AuditEntry is audit record of action of the actor changing the target user.
+// Diff holds changed fields by their JSON names.
+type AuditEntry struct {
+	ID       int                    `json:"id"`
+	Time     time.Time              `json:"time"`
+	ActorID  int                    `json:"actorId"`
+	Action   string                 `json:"action"`
+	TargetID int                    `json:"targetId"`
+	Diff     map[string]FieldChange `json:"diff"`
+}
@@ -0,0 +1,323 @@
+// Package oidc implements OpenID Connect relying party using authorization code flow with PKCE
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+const (
+	// EnvIssuer is environment variable with issuer URL of the provider, OIDC login is disabled if it is empty
+	EnvIssuer = "OIDC_ISSUER"
+	// EnvClientID is environment variable with client ID registered at the provider
+	EnvClientID = "OIDC_CLIENT_ID"
+	// EnvClientSecret is environment variable with client secret, empty for public clients
+	EnvClientSecret = "OIDC_CLIENT_SECRET"
+	// EnvRedirectURL is environment variable with callback URL registered at the provider
+	EnvRedirectURL = "OIDC_REDIRECT_URL"
+
+	// clockSkew is allowed difference of provider and app clocks when validating ID token times
+	clockSkew = time.Minute
+)
+
+// Config configures the provider and the client
+type Config struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	// Scopes are requested in addition to "openid", defaults to "email" and "profile"
+	Scopes []string
+	// Client sends requests to the provider, defaults to http.DefaultClient
+	Client *http.Client
+}
+
+// ConfigFromEnv returns provider configuration of environment variables, and false if OIDC is not configured.
+// Redirect URL defaults to /oidc/callback of the base URL.
+func ConfigFromEnv(baseURL string) (Config, bool) {
+	cfg := Config{
+		Issuer:       os.Getenv(EnvIssuer),
+		ClientID:     os.Getenv(EnvClientID),
+		ClientSecret: os.Getenv(EnvClientSecret),
+		RedirectURL:  os.Getenv(EnvRedirectURL),
+	}
+	if cfg.RedirectURL == "" {
+		cfg.RedirectURL = baseURL + "/oidc/callback"
+	}
+	return cfg, cfg.Issuer != "" && cfg.ClientID != ""
+}
+
+// metadata is provider metadata published at /.well-known/openid-configuration
+type metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Provider is OpenID Connect provider. Its metadata are discovered on first use, so the app can start
+// while the provider is not available.
+type Provider struct {
+	cfg Config
+
+	mu       sync.Mutex
+	metadata *metadata
+	keys     map[string]interface{}
+}
+
+func NewProvider(cfg Config) *Provider {
+	if cfg.Client == nil {
+		cfg.Client = http.DefaultClient
+	}
+	if cfg.Scopes == nil {
+		cfg.Scopes = []string{"email", "profile"}
+	}
+	cfg.Issuer = strings.TrimSuffix(cfg.Issuer, "/")
+	return &Provider{cfg: cfg}
+}
+
+// Issuer returns issuer URL of the provider
+func (p *Provider) Issuer() string {
+	return p.cfg.Issuer
+}
+
+// NewVerifier returns random PKCE code verifier
+func NewVerifier() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Challenge returns S256 PKCE code challenge of the verifier
+func Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// AuthCodeURL returns provider URL the user is redirected to for authentication
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	m, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	params := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.cfg.ClientID},
+		"redirect_uri":          {p.cfg.RedirectURL},
+		"scope":                 {strings.Join(append([]string{"openid"}, p.cfg.Scopes...), " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {Challenge(verifier)},
+		"code_challenge_method": {"S256"},
+	}
+	separator := "?"
+	if strings.Contains(m.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return m.AuthorizationEndpoint + separator + params.Encode(), nil
+}
+
+// Exchange exchanges authorization code for tokens and returns claims of verified ID token
+func (p *Provider) Exchange(ctx context.Context, code, verifier, nonce string) (*Claims, error) {
+	m, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.cfg.RedirectURL},
+		"client_id":     {p.cfg.ClientID},
+		"code_verifier": {verifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.cfg.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+	}
+	resp := struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}{}
+	if err := p.do(req, &resp); err != nil && resp.Error == "" {
+		return nil, fmt.Errorf("token request failed: %v", err)
+	}
+	if resp.Error != "" {
+		return nil, fmt.Errorf("token request failed: %s %s", resp.Error, resp.ErrorDescription)
+	}
+	if resp.IDToken == "" {
+		return nil, errors.New("token response does not contain id_token")
+	}
+	return p.Verify(ctx, resp.IDToken, nonce)
+}
+
+// Verify verifies ID token signature, issuer, audience, times and nonce, and returns its claims
+func (p *Provider) Verify(ctx context.Context, idToken, nonce string) (*Claims, error) {
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(idToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, err := p.key(ctx, kid)
+		if err != nil {
+			return nil, err
+		}
+		if !methodMatches(token.Method, key) {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return key, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid ID token: %v", err)
+	}
+	switch {
+	case claims.Issuer != p.cfg.Issuer:
+		return nil, fmt.Errorf("invalid ID token issuer: %q", claims.Issuer)
+	case !claims.Audience.contains(p.cfg.ClientID):
+		return nil, errors.New("ID token is not issued to this client")
+	case claims.Nonce != nonce:
+		return nil, errors.New("invalid ID token nonce")
+	case claims.Subject == "":
+		return nil, errors.New("ID token has no subject")
+	}
+	return claims, nil
+}
+
+// discover fetches and caches provider metadata
+func (p *Provider) discover(ctx context.Context) (*metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.metadata != nil {
+		return p.metadata, nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.cfg.Issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+	m := &metadata{}
+	if err := p.do(req, m); err != nil {
+		return nil, fmt.Errorf("provider discovery failed: %v", err)
+	}
+	if m.Issuer != p.cfg.Issuer {
+		return nil, fmt.Errorf("provider discovery failed: issuer %q does not match %q", m.Issuer, p.cfg.Issuer)
+	}
+	if m.AuthorizationEndpoint == "" || m.TokenEndpoint == "" || m.JWKSURI == "" {
+		return nil, errors.New("provider discovery failed: missing endpoints")
+	}
+	p.metadata = m
+	return m, nil
+}
+
+// key returns provider public key by kid, fetching provider keys again if it is not known, as keys are rotated
+func (p *Provider) key(ctx context.Context, kid string) (interface{}, error) {
+	p.mu.Lock()
+	key, ok := p.keys[kid]
+	p.mu.Unlock()
+	if ok {
+		return key, nil
+	}
+	m, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, m.JWKSURI, nil)
+	if err != nil {
+		return nil, err
+	}
+	set := &jwks{}
+	if err := p.do(req, set); err != nil {
+		return nil, fmt.Errorf("fetching provider keys failed: %v", err)
+	}
+	keys := set.publicKeys()
+	p.mu.Lock()
+	p.keys = keys
+	p.mu.Unlock()
+	if key, ok = keys[kid]; !ok {
+		return nil, fmt.Errorf("unknown key ID: %q", kid)
+	}
+	return key, nil
+}
+
+// do sends request to the provider and decodes JSON response, also for error status
+func (p *Provider) do(req *http.Request, v interface{}) error {
+	resp, err := p.cfg.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	decodeErr := json.Unmarshal(body, v)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s %s: %s", req.Method, req.URL, resp.Status)
+	}
+	return decodeErr
+}
+
+// Claims are ID token claims used by the app
+type Claims struct {
+	Issuer        string   `json:"iss"`
+	Subject       string   `json:"sub"`
+	Audience      audience `json:"aud"`
+	ExpiresAt     int64    `json:"exp"`
+	IssuedAt      int64    `json:"iat"`
+	Nonce         string   `json:"nonce"`
+	Email         string   `json:"email"`
+	EmailVerified bool     `json:"email_verified"`
+	Name          string   `json:"name"`
+}
+
+// Valid checks ID token times
+func (c *Claims) Valid() error {
+	now := time.Now()
+	if c.ExpiresAt == 0 || now.After(time.Unix(c.ExpiresAt, 0).Add(clockSkew)) {
+		return errors.New("token is expired")
+	}
+	if now.Add(clockSkew).Before(time.Unix(c.IssuedAt, 0)) {
+		return errors.New("token used before issued")
+	}
+	return nil
+}
+
+// audience is aud claim, which is single string or array of strings
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+	return json.Unmarshal(data, (*[]string)(a))
+}
+
+func (a audience) contains(clientID string) bool {
+	for _, aud := range a {
+		if aud == clientID {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,82 @@
+package oidc_test
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/iproduct/coursego/10-modules-rest-jwtauth/oidc"
+	"github.com/iproduct/coursego/10-modules-rest-jwtauth/oidc/oidctest"
+)
+
+func TestProvider_Verify(t *testing.T) {
+	idp, err := oidctest.NewProvider("client", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idp.Close()
+	p := oidc.NewProvider(idp.Config("http://localhost/callback"))
+	user := oidctest.User{Subject: "sub", Email: "user@example.com", EmailVerified: true}
+	ctx := context.Background()
+
+	claims, err := p.Verify(ctx, idp.IDToken(user, "client", "n1", time.Now().Add(time.Hour)), "n1")
+	if err != nil || claims.Subject != "sub" || claims.Email != user.Email || !claims.EmailVerified {
+		t.Errorf("Verify = %+v, %v, want claims of %+v", claims, err, user)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"other audience", idp.IDToken(user, "other", "n1", time.Now().Add(time.Hour))},
+		{"other nonce", idp.IDToken(user, "client", "n2", time.Now().Add(time.Hour))},
+		{"expired", idp.IDToken(user, "client", "n1", time.Now().Add(-time.Hour))},
+		{"unsigned", strings.Join(strings.Split(idp.IDToken(user, "client", "n1", time.Now().Add(time.Hour)), ".")[:2], ".") + "."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := p.Verify(ctx, tt.token, "n1"); err == nil {
+				t.Error("Verify succeeded, want error")
+			}
+		})
+	}
+}
+
+func TestProvider_ExchangeChecksVerifier(t *testing.T) {
+	idp, err := oidctest.NewProvider("client", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idp.Close()
+	idp.SetUser(oidctest.User{Subject: "sub", Email: "user@example.com"})
+	p := oidc.NewProvider(idp.Config("http://localhost/callback"))
+	ctx := context.Background()
+
+	verifier, _ := oidc.NewVerifier()
+	authURL, err := p.AuthCodeURL(ctx, "state", "nonce", verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := idp.Client()
+	client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	code := func() string {
+		resp, err := client.Get(authURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		location, _ := resp.Location()
+		return location.Query().Get("code")
+	}
+
+	other, _ := oidc.NewVerifier()
+	if _, err := p.Exchange(ctx, code(), other, "nonce"); err == nil {
+		t.Error("Exchange with wrong verifier succeeded, want error")
+	}
+	claims, err := p.Exchange(ctx, code(), verifier, "nonce")
+	if err != nil || claims.Subject != "sub" {
+		t.Errorf("Exchange = %+v, %v, want claims of sub", claims, err)
+	}
+}
@@ -0,0 +1,204 @@
+package rest
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gorilla/mux"
+	"github.com/iproduct/coursego/10-modules-rest-jwtauth/auth"
+	"github.com/iproduct/coursego/10-modules-rest-jwtauth/model"
+)
+
+// APIKeyTouchInterval limits how often last use time of API key is updated
+const APIKeyTouchInterval = time.Minute
+
+var errInvalidAPIKey = errors.New("invalid API key")
+
+// Authenticate is middleware accepting JWT access tokens ("Authorization: Bearer <token>") as JwtVerify does,
+// and API keys ("Authorization: ApiKey <key>"). API keys allow only requests permitted by their scopes.
+func (a *App) Authenticate(next http.Handler) http.Handler {
+	jwtVerify := a.JwtVerify(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scheme, key := authorization(r)
+		if !strings.EqualFold(scheme, "ApiKey") {
+			jwtVerify.ServeHTTP(w, r)
+			return
+		}
+		claims, err := a.verifyAPIKey(key)
+		if err != nil {
+			if err == errInvalidAPIKey {
+				respondWithError(w, r, http.StatusUnauthorized, "Invalid API key")
+			} else {
+				respondWithError(w, r, http.StatusInternalServerError, err.Error())
+			}
+			return
+		}
+		if !hasAnyRole(claims.Scopes, requiredScope(r.Method)) {
+			respondWithError(w, r, http.StatusForbidden, "API key scope does not allow this request")
+			return
+		}
+		ctx := context.WithValue(r.Context(), "user", claims)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// requiredScope returns API key scope needed for requests with the method
+func requiredScope(method string) string {
+	if method == http.MethodGet || method == http.MethodHead {
+		return model.ScopeUsersRead
+	}
+	return model.ScopeUsersWrite
+}
+
+// verifyAPIKey returns claims of the active user owning valid API key, and records its use
+func (a *App) verifyAPIKey(value string) (*model.UserToken, error) {
+	prefix, ok := auth.APIKeyLookupPrefix(value)
+	if !ok {
+		return nil, errInvalidAPIKey
+	}
+	key, err := a.APIKeys.FindByPrefix(prefix)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errInvalidAPIKey
+		}
+		return nil, err
+	}
+	if key.Revoked || !auth.APIKeyMatches(value, key.Hash) {
+		return nil, errInvalidAPIKey
+	}
+	user, err := a.Users.FindByID(key.UserID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errInvalidAPIKey
+		}
+		return nil, err
+	}
+	if !user.Active {
+		return nil, errInvalidAPIKey
+	}
+	if now := time.Now(); key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= APIKeyTouchInterval {
+		if err := a.APIKeys.Touch(key.ID, now); err != nil {
+			log.Printf("Error recording use of API key %d: %v", key.ID, err)
+		}
+	}
+	// roles are taken from the user, so role changes apply to existing keys
+	return &model.UserToken{
+		UserID:   user.ID,
+		Name:     user.Name,
+		Email:    user.Email,
+		Roles:    user.Roles,
+		Scopes:   key.Scopes,
+		APIKeyID: key.ID,
+	}, nil
+}
+
+// RequireAccessToken is middleware refusing requests authenticated by API key, e.g. API key management,
+// so leaked key can not be used to create more keys. It must be used after Authenticate.
+func RequireAccessToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if claims := userClaims(r); claims == nil || claims.APIKeyID != 0 {
+			respondWithError(w, r, http.StatusForbidden, "Access token required")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// apiKeyOwner returns the user of {id} path variable, responding with error if the user does not exist
+func (a *App) apiKeyOwner(w http.ResponseWriter, r *http.Request) (*model.User, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid user ID")
+		return nil, false
+	}
+	user, err := a.Users.FindByID(id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, r, http.StatusNotFound, "User not found")
+		} else {
+			respondWithError(w, r, http.StatusInternalServerError, err.Error())
+		}
+		return nil, false
+	}
+	return user, true
+}
+
+// getAPIKeys returns all API keys of the user, without their values
+func (a *App) getAPIKeys(w http.ResponseWriter, r *http.Request) {
+	user, ok := a.apiKeyOwner(w, r)
+	if !ok {
+		return
+	}
+	keys, err := a.APIKeys.FindByUser(user.ID)
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	respondWithJSON(w, http.StatusOK, keys)
+}
+
+// createAPIKey creates API key of the user. The key value is returned only in this response.
+func (a *App) createAPIKey(w http.ResponseWriter, r *http.Request) {
+	user, ok := a.apiKeyOwner(w, r)
+	if !ok {
+		return
+	}
+	req := &model.APIKeyRequest{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if err := a.Validator.Struct(req); err != nil {
+		errs := err.(validator.ValidationErrors)
+		respondWithValidationError(w, r, errs.Translate(a.Translator))
+		return
+	}
+	value, prefix, hash, err := auth.NewAPIKey()
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	key := &model.APIKey{
+		UserID:    user.ID,
+		Name:      req.Name,
+		Prefix:    prefix,
+		Hash:      hash,
+		Scopes:    req.Scopes,
+		CreatedAt: time.Now(),
+	}
+	if err := a.APIKeys.Create(key); err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, map[string]interface{}{"key": value, "apiKey": key})
+}
+
+// revokeAPIKey revokes API key of the user
+func (a *App) revokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	user, ok := a.apiKeyOwner(w, r)
+	if !ok {
+		return
+	}
+	keyID, err := strconv.Atoi(mux.Vars(r)["keyId"])
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid API key ID")
+		return
+	}
+	if err := a.APIKeys.Revoke(user.ID, keyID); err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, r, http.StatusNotFound, "API key not found")
+		} else {
+			respondWithError(w, r, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]string{"message": "revoked"})
+}
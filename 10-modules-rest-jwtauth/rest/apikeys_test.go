@@ -0,0 +1,101 @@
+package rest
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/iproduct/coursego/10-modules-rest-jwtauth/model"
+)
+
+// sendAPIKey calls the app authenticated by the API key, returning response code
+func sendAPIKey(a *App, method, path, key string, payload interface{}) int {
+	body, _ := json.Marshal(payload)
+	req, _ := http.NewRequest(method, path, bytes.NewBuffer(body))
+	req.Header.Set("Authorization", "ApiKey "+key)
+	rr := httptest.NewRecorder()
+	a.Router.ServeHTTP(rr, req)
+	return rr.Code
+}
+
+// createTestAPIKey creates API key of the user with the scopes and returns its value and ID
+func createTestAPIKey(t *testing.T, a *App, token string, userID int, scopes ...string) (string, int) {
+	t.Helper()
+	path := "/auth/users/" + strconv.Itoa(userID) + "/api-keys"
+	code, resp := post(a, path, token, model.APIKeyRequest{Name: "automation", Scopes: scopes})
+	if code != http.StatusCreated {
+		t.Fatalf("POST %s = %d %v", path, code, resp)
+	}
+	return resp["key"].(string), int(resp["apiKey"].(map[string]interface{})["id"].(float64))
+}
+
+func TestAPIKey_Scopes(t *testing.T) {
+	a := newTestApp(t)
+	token := login(t, a, "user1@mydomain.com", "user1")
+	readKey, _ := createTestAPIKey(t, a, token, 1, model.ScopeUsersRead)
+	writeKey, _ := createTestAPIKey(t, a, token, 1, model.ScopeUsersRead, model.ScopeUsersWrite)
+	update := model.User{ID: 1, Name: "User One", Email: "user1@mydomain.com", Age: 21, Active: true}
+
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		key     string
+		payload interface{}
+		want    int
+	}{
+		{"read own user", http.MethodGet, "/auth/users/1", readKey, nil, http.StatusOK},
+		{"read other user", http.MethodGet, "/auth/users/2", readKey, nil, http.StatusForbidden},
+		{"update with read scope", http.MethodPut, "/auth/users/1", readKey, update, http.StatusForbidden},
+		{"update with write scope", http.MethodPut, "/auth/users/1", writeKey, update, http.StatusOK},
+		{"list API keys", http.MethodGet, "/auth/users/1/api-keys", writeKey, nil, http.StatusForbidden},
+		{"create API key", http.MethodPost, "/auth/users/1/api-keys", writeKey,
+			model.APIKeyRequest{Name: "more", Scopes: []string{model.ScopeUsersWrite}}, http.StatusForbidden},
+		{"unknown key", http.MethodGet, "/auth/users/1", readKey + "x", nil, http.StatusUnauthorized},
+		{"malformed key", http.MethodGet, "/auth/users/1", "secret", nil, http.StatusUnauthorized},
+		{"logout", http.MethodPost, "/logout", readKey, nil, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sendAPIKey(a, tt.method, tt.path, tt.key, tt.payload); got != tt.want {
+				t.Errorf("%s %s = %d, want %d", tt.method, tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAPIKey_Revoke(t *testing.T) {
+	a := newTestApp(t)
+	token := login(t, a, "user1@mydomain.com", "user1")
+	key, id := createTestAPIKey(t, a, token, 1, model.ScopeUsersRead)
+	if code := sendAPIKey(a, http.MethodGet, "/auth/users/1", key, nil); code != http.StatusOK {
+		t.Fatalf("GET with API key = %d, want %d", code, http.StatusOK)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, "/auth/users/1/api-keys", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rr := httptest.NewRecorder()
+	a.Router.ServeHTTP(rr, req)
+	var keys []map[string]interface{}
+	json.Unmarshal(rr.Body.Bytes(), &keys)
+	if rr.Code != http.StatusOK || len(keys) != 1 || keys[0]["lastUsedAt"] == nil || keys[0]["key"] != nil {
+		t.Errorf("GET api-keys = %d %v, want used key without value", rr.Code, keys)
+	}
+
+	if code := send(a, http.MethodDelete, "/auth/users/2/api-keys/1", token); code != http.StatusForbidden {
+		t.Errorf("revoking key of other user = %d, want %d", code, http.StatusForbidden)
+	}
+	admin := login(t, a, "admin@mydomain.com", "admin")
+	if code := send(a, http.MethodDelete, "/auth/users/2/api-keys/1", admin); code != http.StatusNotFound {
+		t.Errorf("revoking key under other user = %d, want %d", code, http.StatusNotFound)
+	}
+	if code := send(a, http.MethodDelete, "/auth/users/1/api-keys/1", token); code != http.StatusOK {
+		t.Errorf("revoking own key = %d, want %d", code, http.StatusOK)
+	}
+	if code := sendAPIKey(a, http.MethodGet, "/auth/users/1", key, nil); code != http.StatusUnauthorized {
+		t.Errorf("GET with revoked API key %d = %d, want %d", id, code, http.StatusUnauthorized)
+	}
+}
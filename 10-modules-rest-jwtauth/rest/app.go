@@ -5,33 +5,71 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
-	"github.com/dgrijalva/jwt-go"
 	"github.com/go-playground/locales/en"
 	ut "github.com/go-playground/universal-translator"
 	"github.com/go-playground/validator/v10"
 	en_translations "github.com/go-playground/validator/v10/translations/en"
 	"github.com/gorilla/mux"
+	"github.com/iproduct/coursego/10-modules-rest-jwtauth/auth"
 	"github.com/iproduct/coursego/10-modules-rest-jwtauth/dao"
-	"github.com/iproduct/coursego/10-modules-rest-jwtauth/dao/daomysql"
+	"github.com/iproduct/coursego/10-modules-rest-jwtauth/mail"
 	"github.com/iproduct/coursego/10-modules-rest-jwtauth/model"
+	"github.com/iproduct/coursego/10-modules-rest-jwtauth/oidc"
+	"github.com/iproduct/coursego/problem"
 	"golang.org/x/crypto/bcrypt"
 	"log"
 	"net/http"
+	"os"
 	"strconv"
-	"time"
 )
 
 type App struct {
-	Router     *mux.Router
-	Users      dao.UserRepo
-	Validator  *validator.Validate
-	Translator ut.Translator
-	Server     *http.Server
+	Router        *mux.Router
+	Users         dao.UserRepo
+	RefreshTokens dao.RefreshTokenRepo
+	Revocations   dao.RevocationRepo
+	Keys          *auth.Keys
+	Throttle      auth.Throttle
+	LoginAudit    dao.LoginAuditRepo
+	UserAudit     dao.UserAuditRepo
+	Identities    dao.IdentityRepo
+	APIKeys       dao.APIKeyRepo
+	// OIDC is OpenID Connect provider users can login with, nil if it is not configured
+	OIDC          *oidc.Provider
+	Mailer        mail.Mailer
+	// BaseURL is public URL of the app used in mailed links
+	BaseURL       string
+	Validator     *validator.Validate
+	Translator    ut.Translator
+	Server        *http.Server
 }
 
-func (a *App) Init(user, password, dbname string) {
-	a.Users = daomysql.NewUserRepoMysql(user, password, dbname)
+func (a *App) Init(cfg Config) {
+	if err := a.initRepos(cfg); err != nil {
+		log.Fatal(err)
+	}
+	a.Throttle = auth.NewMemoryThrottle(auth.DefaultThrottlePolicy)
+	a.Mailer = mail.FromEnv()
+	if a.BaseURL = os.Getenv("APP_BASE_URL"); a.BaseURL == "" {
+		a.BaseURL = "http://localhost:8080"
+	}
+	if oidcConfig, ok := oidc.ConfigFromEnv(a.BaseURL); ok {
+		a.OIDC = oidc.NewProvider(oidcConfig)
+	}
+
+	// Load token signing keys configured by environment
+	var err error
+	if a.Keys, err = auth.LoadKeysFromEnv(); err != nil {
+		log.Fatal(err)
+	}
 
+	a.initValidator()
+
+	a.Router = mux.NewRouter()
+	a.initializeRoutes()
+}
+
+func (a *App) initValidator() {
 	// Create and configure validator and translator
 	a.Validator = validator.New()
 	eng := en.New()
@@ -47,9 +85,8 @@ func (a *App) Init(user, password, dbname string) {
 	if err := en_translations.RegisterDefaultTranslations(a.Validator, a.Translator); err != nil {
 		log.Fatal(err)
 	}
-
-	a.Router = mux.NewRouter()
-	a.initializeRoutes()
+	// Report invalid fields by their JSON names
+	a.Validator.RegisterTagNameFunc(problem.JSONFieldName)
 }
 
 func (a *App) Run(addr string) {
@@ -71,20 +108,37 @@ func (a *App) Shutdown(ctx context.Context) error {
 }
 
 func (a *App) initializeRoutes() {
-	a.Router.HandleFunc("/users", a.getUsers).Methods(http.MethodGet)
+	// Errors are problem details with ID of the request
+	a.Router.Use(problem.RequestID)
+	a.Router.NotFoundHandler = problem.RequestID(problem.NotFoundHandler)
+	a.Router.MethodNotAllowedHandler = problem.RequestID(problem.MethodNotAllowedHandler)
+	// Self-registration, other user routes require authentication
 	a.Router.HandleFunc("/users", a.createUser).Methods("POST")
-	a.Router.HandleFunc("/users/{id:[0-9]+}", a.getUser).Methods("GET")
-	a.Router.HandleFunc("/users/{id:[0-9]+}", a.updateUser).Methods("PUT")
-	a.Router.HandleFunc("/users/{id:[0-9]+}", a.deleteUser).Methods("DELETE")
 	a.Router.HandleFunc("/login", a.login).Methods("POST")
+	a.Router.HandleFunc("/refresh", a.refresh).Methods("POST")
+	a.Router.HandleFunc("/verify-email/request", a.requestVerification).Methods("POST")
+	a.Router.HandleFunc("/verify-email/confirm", a.confirmVerification).Methods("GET", "POST")
+	a.Router.HandleFunc("/password-reset/request", a.requestPasswordReset).Methods("POST")
+	a.Router.HandleFunc("/password-reset/confirm", a.confirmPasswordReset).Methods("POST")
+	if a.OIDC != nil {
+		a.Router.HandleFunc("/oidc/login", a.oidcLogin).Methods("GET")
+		a.Router.HandleFunc("/oidc/callback", a.oidcCallback).Methods("GET")
+	}
+	a.Router.Handle("/logout", a.JwtVerify(http.HandlerFunc(a.logout))).Methods("POST")
 	// Auth route
 	s := a.Router.PathPrefix("/auth").Subrouter()
-	s.Use(JwtVerify)
-	s.HandleFunc("/users", a.getUsers).Methods(http.MethodGet)
-	s.HandleFunc("/users", a.createUser).Methods("POST")
-	s.HandleFunc("/users/{id:[0-9]+}", a.getUser).Methods("GET")
-	s.HandleFunc("/users/{id:[0-9]+}", a.updateUser).Methods("PUT")
-	s.HandleFunc("/users/{id:[0-9]+}", a.deleteUser).Methods("DELETE")
+	s.Use(a.Authenticate)
+	adminOnly := RequireRoles(model.RoleAdmin)
+	s.Handle("/users", adminOnly(http.HandlerFunc(a.getUsers))).Methods(http.MethodGet)
+	s.Handle("/users", adminOnly(http.HandlerFunc(a.createUser))).Methods("POST")
+	s.Handle("/users/{id:[0-9]+}", SelfOrAdmin(http.HandlerFunc(a.getUser))).Methods("GET")
+	s.Handle("/users/{id:[0-9]+}", SelfOrAdmin(http.HandlerFunc(a.updateUser))).Methods("PUT")
+	s.Handle("/users/{id:[0-9]+}", adminOnly(http.HandlerFunc(a.deleteUser))).Methods("DELETE")
+	s.Handle("/audit", adminOnly(http.HandlerFunc(a.getAudit))).Methods(http.MethodGet)
+	s.Handle("/users/{id:[0-9]+}/unlock", adminOnly(http.HandlerFunc(a.unlockUser))).Methods("POST")
+	s.Handle("/users/{id:[0-9]+}/api-keys", SelfOrAdmin(RequireAccessToken(http.HandlerFunc(a.getAPIKeys)))).Methods("GET")
+	s.Handle("/users/{id:[0-9]+}/api-keys", SelfOrAdmin(RequireAccessToken(http.HandlerFunc(a.createAPIKey)))).Methods("POST")
+	s.Handle("/users/{id:[0-9]+}/api-keys/{keyId:[0-9]+}", SelfOrAdmin(RequireAccessToken(http.HandlerFunc(a.revokeAPIKey)))).Methods("DELETE")
 
 }
 
@@ -92,94 +146,66 @@ func (a *App) login(w http.ResponseWriter, r *http.Request) {
 	userCredentials := &model.UserLogin{}
 	err := json.NewDecoder(r.Body).Decode(userCredentials)
 	if err != nil {
-		fmt.Printf("Error logging user %v: %v", userCredentials, err)
-		var resp = map[string]interface{}{"status": false, "message": "Invalid request"}
-		json.NewEncoder(w).Encode(resp)
+		respondWithError(w, r, http.StatusBadRequest, "Invalid request payload")
 		return
 	}
-	resp, err := a.checkEmailPassword(w, userCredentials.Email, userCredentials.Password)
+	ip := clientIP(r)
+	if !a.checkThrottle(w, r, userCredentials.Email, ip) {
+		return
+	}
+	resp, err := a.checkEmailPassword(w, r, userCredentials.Email, userCredentials.Password, ip)
 	if err == nil {
-		json.NewEncoder(w).Encode(resp)
+		respondWithJSON(w, http.StatusOK, resp)
 	}
 }
 
-func (a *App) checkEmailPassword(w http.ResponseWriter, email, password string) (map[string]interface{}, error) {
+func (a *App) checkEmailPassword(w http.ResponseWriter, r *http.Request, email, password, ip string) (map[string]interface{}, error) {
 	user, err := a.Users.FindByEmail(email)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Email address not found")
+		a.loginFailed(email, 0, ip, "email address not found")
+		respondWithError(w, r, http.StatusUnauthorized, "Email address not found")
 		return nil, err
 	}
-	expiresAt := time.Now().Add(time.Minute * 10).Unix()
 
 	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password))
-	if err != nil && err == bcrypt.ErrMismatchedHashAndPassword { //Password does not match!
-		respondWithError(w, http.StatusUnauthorized, "Invalid login credentials. Please try again")
+	if err != nil { //Password does not match!
+		a.loginFailed(email, user.ID, ip, "invalid password")
+		respondWithError(w, r, http.StatusUnauthorized, "Invalid login credentials. Please try again")
 		return nil, err
 	}
-
-	claims := &model.UserToken{
-		UserID: user.ID,
-		Name:   user.Name,
-		Email:  user.Email,
-		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: expiresAt,
-			Issuer:    "test",
-		},
-	}
-
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-
-	tokenString, error := token.SignedString([]byte("secret"))
-	if error != nil {
-		fmt.Println(error)
+	if !user.Active {
+		// the password is correct, so the attempt is not a failure
+		if err := a.Throttle.Success(email, ip); err != nil {
+			log.Printf("Error recording login of %s: %v", email, err)
+		}
+		a.audit(model.LoginFailed, email, user.ID, ip, "account not active")
+		respondWithError(w, r, http.StatusForbidden, "Account is not active. Please verify your email address")
+		return nil, errInactive
 	}
+	a.loginSucceeded(user, ip)
 
-	var resp = map[string]interface{}{"status": false, "message": "logged in"}
-	resp["token"] = tokenString //Store the token in the response
-	// remove user password
-	user.Password = ""
-
-	resp["user"] = user
-	return resp, nil
-}
-
-// User handlers
-func (a *App) getUsers(w http.ResponseWriter, r *http.Request) {
-	count, err := strconv.Atoi(r.FormValue("count"))
-	if err != nil && r.FormValue("count") != "" {
-		respondWithError(w, http.StatusBadRequest, "Invalid request count parameter")
-		return
-	}
-	start, err := strconv.Atoi(r.FormValue("start"))
-	if err != nil && r.FormValue("start") != "" {
-		respondWithError(w, http.StatusBadRequest, "Invalid request start parameter")
-		return
-	}
-	start--
-	if count > 20 || count < 1 {
-		count = 20
-	}
-	if start < 0 {
-		start = 0
-	}
-	users, err := a.Users.FindAll(start, count)
+	// Start new family of refresh tokens
+	family, err := auth.NewID()
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, err.Error())
-		return
+		respondWithError(w, r, http.StatusInternalServerError, err.Error())
+		return nil, err
 	}
-	// remove user passwords
-	for i := range users {
-		users[i].Password = ""
+	resp, err := a.issueTokens(user, family, "")
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, err.Error())
+		return nil, err
 	}
-	respondWithJSON(w, http.StatusOK, users)
+	resp["message"] = "logged in"
+	return resp, nil
 }
 
+// User handlers
 func (a *App) createUser(w http.ResponseWriter, r *http.Request) {
 	user := &model.User{}
 
 	decoder := json.NewDecoder(r.Body)
 	if err := decoder.Decode(user); err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		respondWithError(w, r, http.StatusBadRequest, "Invalid request payload")
 		return
 	}
 
@@ -188,23 +214,40 @@ func (a *App) createUser(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		// translate all error at once
 		errs := err.(validator.ValidationErrors)
-		respondWithValidationError(errs.Translate(a.Translator), w)
+		respondWithValidationError(w, r, errs.Translate(a.Translator))
 		return
 	}
 
+	// Only admins can assign roles and activate users, others verify their email
+	if len(user.Roles) == 0 || !isAdmin(r) {
+		user.Roles = []string{model.RoleUser}
+	}
+	if !isAdmin(r) {
+		user.Active = false
+	}
+
 	// Hash the pasword with bcrypt
 	pass, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
 	if err != nil {
 		fmt.Println(err)
-		respondWithError(w, http.StatusInternalServerError, "Password Encryption  failed")
+		respondWithError(w, r, http.StatusInternalServerError, "Password Encryption  failed")
 		return
 	}
 	user.Password = string(pass)
 
 	if user, err = a.Users.Create(user); err != nil {
-		respondWithError(w, http.StatusInternalServerError, err.Error())
+		if err == dao.ErrDuplicateEmail {
+			respondWithError(w, r, http.StatusConflict, "Email address is already registered")
+			return
+		}
+		respondWithError(w, r, http.StatusInternalServerError, err.Error())
 		return
 	}
+	if !user.Active {
+		if err := a.sendVerification(user); err != nil {
+			log.Printf("Error sending verification mail to %s: %v", user.Email, err)
+		}
+	}
 	// remove user password
 	user.Password = ""
 
@@ -215,7 +258,7 @@ func (a *App) getUser(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, err := strconv.Atoi(vars["id"])
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		respondWithError(w, r, http.StatusBadRequest, "Invalid user ID")
 		return
 	}
 
@@ -223,9 +266,9 @@ func (a *App) getUser(w http.ResponseWriter, r *http.Request) {
 	if user, err = a.Users.FindByID(id); err != nil {
 		switch err {
 		case sql.ErrNoRows:
-			respondWithError(w, http.StatusNotFound, "User not found")
+			respondWithError(w, r, http.StatusNotFound, "User not found")
 		default:
-			respondWithError(w, http.StatusInternalServerError, err.Error())
+			respondWithError(w, r, http.StatusInternalServerError, err.Error())
 		}
 		return
 	}
@@ -239,14 +282,14 @@ func (a *App) updateUser(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, err := strconv.Atoi(vars["id"])
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		respondWithError(w, r, http.StatusBadRequest, "Invalid user ID")
 		return
 	}
 
 	user := &model.User{}
 	decoder := json.NewDecoder(r.Body)
 	if err := decoder.Decode(user); err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid resquest payload")
+		respondWithError(w, r, http.StatusBadRequest, "Invalid resquest payload")
 		return
 	}
 	// Validate User struct
@@ -254,12 +297,12 @@ func (a *App) updateUser(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		// translate all error at once
 		errs := err.(validator.ValidationErrors)
-		respondWithValidationError(errs.Translate(a.Translator), w)
+		respondWithValidationError(w, r, errs.Translate(a.Translator))
 		return
 	}
 
 	if user.ID != id {
-		respondWithError(w, http.StatusBadRequest, "ID in URL path is different from ID in request payload")
+		respondWithError(w, r, http.StatusBadRequest, "ID in URL path is different from ID in request payload")
 		return
 	}
 
@@ -267,9 +310,9 @@ func (a *App) updateUser(w http.ResponseWriter, r *http.Request) {
 	oldUser, err := a.Users.FindByID(id)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			respondWithError(w, http.StatusNotFound, fmt.Sprintf("user with ID='%d' does not exist", id))
+			respondWithError(w, r, http.StatusNotFound, fmt.Sprintf("user with ID='%d' does not exist", id))
 		} else {
-			respondWithError(w, http.StatusInternalServerError, err.Error())
+			respondWithError(w, r, http.StatusInternalServerError, err.Error())
 		}
 		return
 	}
@@ -280,7 +323,7 @@ func (a *App) updateUser(w http.ResponseWriter, r *http.Request) {
 		pass, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
 		if err != nil {
 			fmt.Println(err)
-			respondWithError(w, http.StatusInternalServerError, "Password Encryption  failed")
+			respondWithError(w, r, http.StatusInternalServerError, "Password Encryption  failed")
 			return
 		}
 		user.Password = string(pass)
@@ -288,11 +331,20 @@ func (a *App) updateUser(w http.ResponseWriter, r *http.Request) {
 		user.Password = oldUser.Password
 	}
 
+	// Only admins can change roles and activate users
+	if len(user.Roles) == 0 || !isAdmin(r) {
+		user.Roles = oldUser.Roles
+	}
+	if !isAdmin(r) && !oldUser.Active {
+		user.Active = false
+	}
+
 	// Do update user
 	if user, err = a.Users.Update(user); err != nil {
-		respondWithError(w, http.StatusInternalServerError, err.Error())
+		respondWithError(w, r, http.StatusInternalServerError, err.Error())
 		return
 	}
+	a.auditChange(r, model.UserUpdated, oldUser, user)
 	// remove user password
 	user.Password = ""
 
@@ -303,19 +355,20 @@ func (a *App) deleteUser(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, err := strconv.Atoi(vars["id"])
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid User ID")
+		respondWithError(w, r, http.StatusBadRequest, "Invalid User ID")
 		return
 	}
 	// Do delete user in DB
 	user, err := a.Users.DeleteByID(id)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			respondWithError(w, http.StatusNotFound, fmt.Sprintf("user with ID='%d' does not exist", id))
+			respondWithError(w, r, http.StatusNotFound, fmt.Sprintf("user with ID='%d' does not exist", id))
 		} else {
-			respondWithError(w, http.StatusInternalServerError, err.Error())
+			respondWithError(w, r, http.StatusInternalServerError, err.Error())
 		}
 		return
 	}
+	a.auditChange(r, model.UserDeleted, user, nil)
 	// remove user password
 	user.Password = ""
 
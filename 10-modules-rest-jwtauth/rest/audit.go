@@ -0,0 +1,139 @@
+package rest
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"reflect"
+	"time"
+
+	"github.com/iproduct/coursego/10-modules-rest-jwtauth/dao"
+	"github.com/iproduct/coursego/10-modules-rest-jwtauth/model"
+)
+
+// userFields returns audited fields of the user by their JSON names, or no fields if the user is nil
+func userFields(user *model.User) map[string]interface{} {
+	if user == nil {
+		return map[string]interface{}{}
+	}
+	return map[string]interface{}{
+		"name":     user.Name,
+		"email":    user.Email,
+		"password": user.Password,
+		"age":      user.Age,
+		"active":   user.Active,
+		"roles":    user.Roles,
+	}
+}
+
+// userDiff returns fields changed between before and after user, nil user means it did not exist.
+// Password hashes are replaced by model.Redacted, so the diff shows only that the password changed.
+func userDiff(before, after *model.User) map[string]model.FieldChange {
+	old, current := userFields(before), userFields(after)
+	diff := map[string]model.FieldChange{}
+	for _, fields := range []map[string]interface{}{old, current} {
+		for name := range fields {
+			if _, done := diff[name]; done || reflect.DeepEqual(old[name], current[name]) {
+				continue
+			}
+			change := model.FieldChange{Before: old[name], After: current[name]}
+			if name == "password" {
+				change = model.FieldChange{Before: redact(old[name]), After: redact(current[name])}
+			}
+			diff[name] = change
+		}
+	}
+	return diff
+}
+
+// redact returns model.Redacted instead of the secret value, or nil if there is none
+func redact(value interface{}) interface{} {
+	if value == nil {
+		return nil
+	}
+	return model.Redacted
+}
+
+// auditChange records the action of the request user changing the target user, actor ID is 0 if the request is
+// not authenticated. Failures to record it are logged only.
+func (a *App) auditChange(r *http.Request, action string, before, after *model.User) {
+	entry := &model.AuditEntry{
+		Time:   time.Now(),
+		Action: action,
+		Diff:   userDiff(before, after),
+	}
+	if claims := userClaims(r); claims != nil {
+		entry.ActorID = claims.UserID
+	}
+	if before != nil {
+		entry.TargetID = before.ID
+	} else if after != nil {
+		entry.TargetID = after.ID
+	}
+	if err := a.UserAudit.Record(entry); err != nil {
+		log.Printf("Error recording %s audit entry of user %d: %v", action, entry.TargetID, err)
+	}
+}
+
+// parseAuditQuery returns audit query of request parameters: actor and target user IDs,
+// time range from (inclusive) and to (exclusive) in RFC 3339 format, count of entries and start position counted from 1
+func parseAuditQuery(r *http.Request) (*dao.AuditQuery, error) {
+	params := r.URL.Query()
+	q := &dao.AuditQuery{Limit: DefaultPageSize}
+	var err error
+	if actor, err := parseOptionalInt(params, "actor"); err != nil {
+		return nil, err
+	} else if actor != nil {
+		q.ActorID = *actor
+	}
+	if target, err := parseOptionalInt(params, "target"); err != nil {
+		return nil, err
+	} else if target != nil {
+		q.TargetID = *target
+	}
+	if q.From, err = parseOptionalTime(params, "from"); err != nil {
+		return nil, err
+	}
+	if q.To, err = parseOptionalTime(params, "to"); err != nil {
+		return nil, err
+	}
+	if count, err := parseOptionalInt(params, "count"); err != nil {
+		return nil, err
+	} else if count != nil && *count >= 1 && *count <= DefaultPageSize {
+		q.Limit = *count
+	}
+	if start, err := parseOptionalInt(params, "start"); err != nil {
+		return nil, err
+	} else if start != nil && *start > 1 {
+		q.Offset = *start - 1
+	}
+	return q, nil
+}
+
+func parseOptionalTime(params url.Values, name string) (time.Time, error) {
+	value := params.Get(name)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid %s parameter: %q", name, value)
+	}
+	return t, nil
+}
+
+// getAudit returns page of audit entries of user changes, starting from the latest one (see parseAuditQuery)
+func (a *App) getAudit(w http.ResponseWriter, r *http.Request) {
+	q, err := parseAuditQuery(r)
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid request: "+err.Error())
+		return
+	}
+	entries, err := a.UserAudit.Find(q)
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	respondWithJSON(w, http.StatusOK, entries)
+}
@@ -0,0 +1,106 @@
+package rest
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/iproduct/coursego/10-modules-rest-jwtauth/model"
+)
+
+func TestUserDiff(t *testing.T) {
+	before := &model.User{ID: 1, Name: "User 1", Email: "user1@mydomain.com", Password: "hash1", Age: 20, Roles: []string{model.RoleUser}}
+	after := *before
+	after.Age = 21
+	after.Password = "hash2"
+
+	diff := userDiff(before, &after)
+	if len(diff) != 2 || diff["age"].Before != 20 || diff["age"].After != 21 {
+		t.Errorf("update diff = %v, want age and password changes", diff)
+	}
+	if diff["password"].Before != model.Redacted || diff["password"].After != model.Redacted {
+		t.Errorf("password change = %v, want redacted values", diff["password"])
+	}
+
+	diff = userDiff(before, nil)
+	if len(diff) != 6 || diff["email"].Before != before.Email || diff["email"].After != nil {
+		t.Errorf("delete diff = %v, want all fields removed", diff)
+	}
+	if diff["password"].Before != model.Redacted {
+		t.Errorf("deleted password = %v, want redacted value", diff["password"].Before)
+	}
+}
+
+// getAuditEntries returns audit entries of the query, failing the test if the request fails
+func getAuditEntries(t *testing.T, a *App, query, bearer string) []model.AuditEntry {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, "/auth/audit"+query, nil)
+	req.Header.Set("Authorization", "Bearer "+bearer)
+	rr := httptest.NewRecorder()
+	a.Router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("GET /auth/audit%s = %d %s", query, rr.Code, rr.Body)
+	}
+	if strings.Contains(rr.Body.String(), "$2a$") {
+		t.Errorf("audit log contains password hash: %s", rr.Body)
+	}
+	var entries []model.AuditEntry
+	if err := json.Unmarshal(rr.Body.Bytes(), &entries); err != nil {
+		t.Fatal(err)
+	}
+	return entries
+}
+
+func TestUserAudit(t *testing.T) {
+	a := newTestApp(t)
+	user := login(t, a, "user1@mydomain.com", "user1")
+	admin := login(t, a, "admin@mydomain.com", "admin")
+	start := time.Now()
+
+	update := model.User{ID: 1, Name: "User One", Email: "user1@mydomain.com", Password: "secret", Age: 20, Active: true}
+	body, _ := json.Marshal(update)
+	req, _ := http.NewRequest(http.MethodPut, "/auth/users/1", bytes.NewBuffer(body))
+	req.Header.Set("Authorization", "Bearer "+user)
+	rr := httptest.NewRecorder()
+	a.Router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("update = %d %s", rr.Code, rr.Body)
+	}
+	if code := send(a, http.MethodDelete, "/auth/users/1", admin); code != http.StatusOK {
+		t.Fatalf("delete = %d, want %d", code, http.StatusOK)
+	}
+
+	entries := getAuditEntries(t, a, "", admin)
+	if len(entries) != 2 {
+		t.Fatalf("audit has %d entries, want 2", len(entries))
+	}
+	if e := entries[0]; e.Action != model.UserDeleted || e.ActorID != 2 || e.TargetID != 1 {
+		t.Errorf("latest entry = %+v, want deletion of user 1 by user 2", e)
+	}
+	updated := entries[1]
+	if updated.Action != model.UserUpdated || updated.ActorID != 1 || updated.TargetID != 1 {
+		t.Errorf("first entry = %+v, want update of user 1 by user 1", updated)
+	}
+	if len(updated.Diff) != 2 || updated.Diff["name"].After != "User One" ||
+		updated.Diff["password"].After != model.Redacted {
+		t.Errorf("update diff = %v, want name and redacted password changes", updated.Diff)
+	}
+
+	if entries := getAuditEntries(t, a, "?actor=1&target=1", admin); len(entries) != 1 || entries[0].Action != model.UserUpdated {
+		t.Errorf("entries of actor 1 = %+v, want the update", entries)
+	}
+	from := start.Add(-time.Minute).Format(time.RFC3339)
+	if entries := getAuditEntries(t, a, "?to="+from, admin); len(entries) != 0 {
+		t.Errorf("entries before %s = %+v, want none", from, entries)
+	}
+	if code := send(a, http.MethodGet, "/auth/audit", user); code != http.StatusForbidden {
+		t.Errorf("audit read by user = %d, want %d", code, http.StatusForbidden)
+	}
+	if code := send(a, http.MethodGet, "/auth/audit?from=yesterday", admin); code != http.StatusBadRequest {
+		t.Errorf("audit with invalid time = %d, want %d", code, http.StatusBadRequest)
+	}
+}
@@ -2,39 +2,41 @@ package rest
 
 import (
 	"context"
-	"github.com/dgrijalva/jwt-go"
 	"github.com/iproduct/coursego/10-modules-rest-jwtauth/model"
 	"net/http"
 	"strings"
 )
 
-func JwtVerify(next http.Handler) http.Handler {
+func (a *App) JwtVerify(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		const BEARER_SCHEMA = "Bearer "
-		//var header = r.Header.Get("x-access-token") //Grab the token from the header
-		var header = r.Header.Get("Authorization") //Grab the token from the header
-
-		var token string
-		if header == "" || len(header) <= len(BEARER_SCHEMA) {
-			respondWithError(w, http.StatusUnauthorized, "Missing auth token")
-			return
-		}
-		token = header[len(BEARER_SCHEMA):]
-		token = strings.TrimSpace(token)
-
-		if token == "" {
+		scheme, token := authorization(r)
+		if !strings.EqualFold(scheme, "Bearer") || token == "" {
 			//Token is missing, returns with error code 401 Unauthorized
-			respondWithError(w, http.StatusUnauthorized, "Missing auth token")
+			respondWithError(w, r, http.StatusUnauthorized, "Missing auth token")
 			return
 		}
 		claims := &model.UserToken{}
 
-		_, err := jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
-			return []byte("secret"), nil
-		})
+		err := a.Keys.Parse(token, claims)
+
+		if err != nil {
+			respondWithError(w, r, http.StatusUnauthorized, err.Error())
+			return
+		}
+		// Mailed action tokens have audience and are not access tokens
+		if claims.Audience != "" {
+			respondWithError(w, r, http.StatusUnauthorized, "Invalid auth token")
+			return
+		}
 
+		// Reject tokens revoked by logout before they expire
+		revoked, err := a.Revocations.IsRevoked(claims.Id)
 		if err != nil {
-			respondWithError(w, http.StatusUnauthorized, err.Error())
+			respondWithError(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if revoked {
+			respondWithError(w, r, http.StatusUnauthorized, "Token is revoked")
 			return
 		}
 
@@ -42,3 +44,13 @@ func JwtVerify(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
+
+// authorization returns scheme and credentials of the request Authorization header
+func authorization(r *http.Request) (scheme, credentials string) {
+	header := strings.TrimSpace(r.Header.Get("Authorization"))
+	parts := strings.SplitN(header, " ", 2)
+	if len(parts) != 2 {
+		return parts[0], ""
+	}
+	return parts[0], strings.TrimSpace(parts[1])
+}
@@ -0,0 +1,70 @@
+package rest
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/iproduct/coursego/10-modules-rest-jwtauth/model"
+)
+
+// userClaims returns token claims of the user authenticated by JwtVerify, or nil if there are none
+func userClaims(r *http.Request) *model.UserToken {
+	claims, _ := r.Context().Value("user").(*model.UserToken)
+	return claims
+}
+
+// hasAnyRole checks if any of the user roles is among wanted roles
+func hasAnyRole(roles []string, wanted ...string) bool {
+	for _, role := range roles {
+		for _, w := range wanted {
+			if role == w {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isAdmin checks if the request is authenticated by admin
+func isAdmin(r *http.Request) bool {
+	claims := userClaims(r)
+	return claims != nil && hasAnyRole(claims.Roles, model.RoleAdmin)
+}
+
+// RequireRoles returns middleware allowing only requests of users having any of the roles.
+// It must be used after JwtVerify.
+func RequireRoles(roles ...string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims := userClaims(r)
+			if claims == nil {
+				respondWithError(w, r, http.StatusUnauthorized, "Missing auth token")
+				return
+			}
+			if !hasAnyRole(claims.Roles, roles...) {
+				respondWithError(w, r, http.StatusForbidden, "Access denied")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// SelfOrAdmin is middleware allowing only requests of admins, and of users whose ID is the {id} path variable.
+// It must be used after JwtVerify.
+func SelfOrAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims := userClaims(r)
+		if claims == nil {
+			respondWithError(w, r, http.StatusUnauthorized, "Missing auth token")
+			return
+		}
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if !hasAnyRole(claims.Roles, model.RoleAdmin) && (err != nil || id != claims.UserID) {
+			respondWithError(w, r, http.StatusForbidden, "Access denied")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
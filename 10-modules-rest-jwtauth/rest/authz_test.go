@@ -0,0 +1,65 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/iproduct/coursego/10-modules-rest-jwtauth/model"
+)
+
+// login returns access token of the user
+func login(t *testing.T, a *App, email, password string) string {
+	t.Helper()
+	code, resp := post(a, "/login", "", model.UserLogin{Email: email, Password: password})
+	if code != http.StatusOK {
+		t.Fatalf("login of %s = %d %v", email, code, resp)
+	}
+	return resp["token"].(string)
+}
+
+func TestAuthorization(t *testing.T) {
+	a := newTestApp(t)
+	user := login(t, a, "user1@mydomain.com", "user1")
+	admin := login(t, a, "admin@mydomain.com", "admin")
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		want   int
+	}{
+		{"user reads self", http.MethodGet, "/auth/users/1", user, http.StatusOK},
+		{"user reads other", http.MethodGet, "/auth/users/2", user, http.StatusForbidden},
+		{"user lists users", http.MethodGet, "/auth/users", user, http.StatusForbidden},
+		{"user deletes other", http.MethodDelete, "/auth/users/2", user, http.StatusForbidden},
+		{"user deletes self", http.MethodDelete, "/auth/users/1", user, http.StatusForbidden},
+		{"admin reads other", http.MethodGet, "/auth/users/1", admin, http.StatusOK},
+		{"admin lists users", http.MethodGet, "/auth/users", admin, http.StatusOK},
+		{"admin reads missing", http.MethodGet, "/auth/users/3", admin, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := send(a, tt.method, tt.path, tt.token); got != tt.want {
+				t.Errorf("%s %s = %d, want %d", tt.method, tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthorization_ErrorBody(t *testing.T) {
+	a := newTestApp(t)
+	req, _ := http.NewRequest(http.MethodGet, "/auth/users/2", nil)
+	req.Header.Set("Authorization", "Bearer "+login(t, a, "user1@mydomain.com", "user1"))
+	rr := httptest.NewRecorder()
+	a.Router.ServeHTTP(rr, req)
+
+	var m map[string]interface{}
+	json.Unmarshal(rr.Body.Bytes(), &m)
+	if rr.Code != http.StatusForbidden || m["detail"] != "Access denied" || m["traceId"] == nil ||
+		rr.Header().Get("Content-Type") != "application/problem+json" {
+		t.Errorf("response = %d %v, want %d problem with detail 'Access denied'", rr.Code, m, http.StatusForbidden)
+	}
+}
@@ -0,0 +1,67 @@
+package rest
+
+import (
+	"fmt"
+
+	"github.com/iproduct/coursego/10-modules-rest-jwtauth/dao/daomemory"
+	"github.com/iproduct/coursego/10-modules-rest-jwtauth/dao/daomysql"
+	"github.com/iproduct/coursego/10-modules-rest-jwtauth/dao/daosqlite"
+)
+
+// Supported database types
+const (
+	MySQL  = "mysql"
+	SQLite = "sqlite"
+	Memory = "memory"
+)
+
+// Config selects and configures the database used by the app
+type Config struct {
+	// DBType is one of MySQL (default), SQLite or Memory
+	DBType     string
+	DBUser     string
+	DBPassword string
+	DBName     string
+	// SQLitePath is SQLite database file, ":memory:" for in-memory database
+	SQLitePath string
+}
+
+// initRepos creates repositories of configured database type
+func (a *App) initRepos(cfg Config) error {
+	switch cfg.DBType {
+	case MySQL, "":
+		a.Users = daomysql.NewUserRepoMysql(cfg.DBUser, cfg.DBPassword, cfg.DBName)
+		tokens := daomysql.NewTokenRepoMysql(cfg.DBUser, cfg.DBPassword, cfg.DBName)
+		a.RefreshTokens = tokens
+		a.Revocations = tokens
+		a.LoginAudit = daomysql.NewLoginAuditRepoMysql(cfg.DBUser, cfg.DBPassword, cfg.DBName)
+		a.UserAudit = daomysql.NewUserAuditRepoMysql(cfg.DBUser, cfg.DBPassword, cfg.DBName)
+		a.Identities = daomysql.NewIdentityRepoMysql(cfg.DBUser, cfg.DBPassword, cfg.DBName)
+		a.APIKeys = daomysql.NewAPIKeyRepoMysql(cfg.DBUser, cfg.DBPassword, cfg.DBName)
+	case SQLite:
+		db, err := daosqlite.Open(cfg.SQLitePath)
+		if err != nil {
+			return err
+		}
+		a.Users = daosqlite.NewUserRepoSqlite(db)
+		tokens := daosqlite.NewTokenRepoSqlite(db)
+		a.RefreshTokens = tokens
+		a.Revocations = tokens
+		a.LoginAudit = daosqlite.NewLoginAuditRepoSqlite(db)
+		a.UserAudit = daosqlite.NewUserAuditRepoSqlite(db)
+		a.Identities = daosqlite.NewIdentityRepoSqlite(db)
+		a.APIKeys = daosqlite.NewAPIKeyRepoSqlite(db)
+	case Memory:
+		a.Users = daomemory.NewUserRepoMemory()
+		tokens := daomemory.NewTokenRepoMemory()
+		a.RefreshTokens = tokens
+		a.Revocations = tokens
+		a.LoginAudit = daomemory.NewLoginAuditRepoMemory()
+		a.UserAudit = daomemory.NewUserAuditRepoMemory()
+		a.Identities = daomemory.NewIdentityRepoMemory()
+		a.APIKeys = daomemory.NewAPIKeyRepoMemory()
+	default:
+		return fmt.Errorf("unsupported database type: %q", cfg.DBType)
+	}
+	return nil
+}
@@ -0,0 +1,205 @@
+package rest
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/iproduct/coursego/10-modules-rest-jwtauth/auth"
+	"github.com/iproduct/coursego/10-modules-rest-jwtauth/model"
+	"github.com/iproduct/coursego/10-modules-rest-jwtauth/oidc"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// OIDCStateTTL is time the user has to login at the provider
+	OIDCStateTTL = 10 * time.Minute
+	// oidcStateCookie keeps login state between login redirect and provider callback
+	oidcStateCookie = "oidc_state"
+)
+
+var errUnverifiedEmail = errors.New("email address is registered, but it is not verified by the provider")
+
+// oidcLogin redirects to the provider login page, keeping the state, nonce and PKCE verifier in signed cookie.
+// The verifier is readable only by the browser which started the login, as the cookie is HttpOnly.
+func (a *App) oidcLogin(w http.ResponseWriter, r *http.Request) {
+	state := &model.OIDCState{}
+	var err error
+	if state.State, err = auth.NewID(); err == nil {
+		if state.Nonce, err = auth.NewID(); err == nil {
+			state.Verifier, err = oidc.NewVerifier()
+		}
+	}
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	now := time.Now()
+	state.StandardClaims = jwt.StandardClaims{
+		Audience:  model.OIDCLoginAction,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(OIDCStateTTL).Unix(),
+	}
+	signed, err := a.Keys.Sign(state)
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	redirect, err := a.OIDC.AuthCodeURL(r.Context(), state.State, state.Nonce, state.Verifier)
+	if err != nil {
+		log.Printf("Error starting OIDC login: %v", err)
+		respondWithError(w, r, http.StatusBadGateway, "Identity provider is not available")
+		return
+	}
+	a.setOIDCStateCookie(w, signed, int(OIDCStateTTL.Seconds()))
+	http.Redirect(w, r, redirect, http.StatusFound)
+}
+
+// oidcCallback exchanges authorization code for ID token, logs in linked user, links user with the same
+// verified email or creates new user, and responds with the app tokens as login does
+func (a *App) oidcCallback(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	if e := params.Get("error"); e != "" {
+		respondWithError(w, r, http.StatusUnauthorized, fmt.Sprintf("Login failed: %s %s", e, params.Get("error_description")))
+		return
+	}
+	cookie, err := r.Cookie(oidcStateCookie)
+	state := &model.OIDCState{}
+	if err != nil || a.Keys.Parse(cookie.Value, state) != nil || state.Audience != model.OIDCLoginAction ||
+		params.Get("state") == "" || params.Get("state") != state.State {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid or expired login state")
+		return
+	}
+	// state is single use
+	a.setOIDCStateCookie(w, "", -1)
+
+	ip := clientIP(r)
+	claims, err := a.OIDC.Exchange(r.Context(), params.Get("code"), state.Verifier, state.Nonce)
+	if err != nil {
+		log.Printf("Error exchanging OIDC authorization code: %v", err)
+		a.audit(model.LoginFailed, "", 0, ip, "oidc: "+truncate(err.Error(), 90))
+		respondWithError(w, r, http.StatusUnauthorized, "Login failed")
+		return
+	}
+	user, err := a.oidcUser(claims)
+	if err != nil {
+		a.audit(model.LoginFailed, claims.Email, 0, ip, "oidc: "+truncate(err.Error(), 90))
+		if err == errUnverifiedEmail {
+			respondWithError(w, r, http.StatusConflict, "Account with this email already exists. Please login with password")
+		} else {
+			respondWithError(w, r, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+	if !user.Active {
+		a.audit(model.LoginFailed, user.Email, user.ID, ip, "account not active")
+		respondWithError(w, r, http.StatusForbidden, "Account is not active. Please verify your email address")
+		return
+	}
+	a.audit(model.LoginSucceeded, user.Email, user.ID, ip, "oidc")
+
+	family, err := auth.NewID()
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	resp, err := a.issueTokens(user, family, "")
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	resp["message"] = "logged in"
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+// oidcUser returns user linked to the provider subject. If there is none, user with the same email is linked
+// if the provider verified the email, or new user is created.
+func (a *App) oidcUser(claims *oidc.Claims) (*model.User, error) {
+	issuer := a.OIDC.Issuer()
+	userID, err := a.Identities.FindUserID(issuer, claims.Subject)
+	if err == nil {
+		user, err := a.Users.FindByID(userID)
+		if err != sql.ErrNoRows {
+			return user, err
+		}
+	} else if err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	if claims.Email == "" {
+		return nil, errors.New("provider did not return email address")
+	}
+	user, err := a.Users.FindByEmail(claims.Email)
+	switch {
+	case err == nil && !claims.EmailVerified:
+		return nil, errUnverifiedEmail
+	case err == sql.ErrNoRows:
+		if user, err = a.createOIDCUser(claims); err != nil {
+			return nil, err
+		}
+	case err != nil:
+		return nil, err
+	}
+	if err := a.Identities.Link(issuer, claims.Subject, user.ID); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// createOIDCUser creates user with random password, which is active if the provider verified the email
+func (a *App) createOIDCUser(claims *oidc.Claims) (*model.User, error) {
+	password, err := auth.NewID()
+	if err != nil {
+		return nil, err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+	name := claims.Name
+	if name == "" {
+		name = strings.SplitN(claims.Email, "@", 2)[0]
+	}
+	user, err := a.Users.Create(&model.User{
+		Name:     name,
+		Email:    claims.Email,
+		Password: string(hash),
+		Active:   claims.EmailVerified,
+		Roles:    []string{model.RoleUser},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !user.Active {
+		if err := a.sendVerification(user); err != nil {
+			log.Printf("Error sending verification mail to %s: %v", user.Email, err)
+		}
+	}
+	return user, nil
+}
+
+// setOIDCStateCookie sets or, with negative maxAge, removes the login state cookie
+func (a *App) setOIDCStateCookie(w http.ResponseWriter, value string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    value,
+		Path:     "/oidc",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(a.BaseURL, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// truncate shortens text to n bytes, so it fits in audit reason
+func truncate(text string, n int) string {
+	if len(text) <= n {
+		return text
+	}
+	return text[:n]
+}
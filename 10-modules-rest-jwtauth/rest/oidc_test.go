@@ -0,0 +1,112 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/iproduct/coursego/10-modules-rest-jwtauth/oidc"
+	"github.com/iproduct/coursego/10-modules-rest-jwtauth/oidc/oidctest"
+)
+
+// newOIDCTestApp returns test app with OpenID Connect login at stub provider
+func newOIDCTestApp(t *testing.T) (*App, *oidctest.Provider) {
+	t.Helper()
+	idp, err := oidctest.NewProvider("jwtauth", "client-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(idp.Close)
+	a := newTestApp(t)
+	a.OIDC = oidc.NewProvider(idp.Config(a.BaseURL + "/oidc/callback"))
+	a.Router = mux.NewRouter()
+	a.initializeRoutes()
+	return a, idp
+}
+
+// oidcLogin goes through login redirects, the provider authenticating its current user,
+// and returns app callback response
+func oidcLogin(t *testing.T, a *App, idp *oidctest.Provider) *httptest.ResponseRecorder {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	a.Router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/oidc/login", nil))
+	if rr.Code != http.StatusFound || len(rr.Result().Cookies()) != 1 {
+		t.Fatalf("GET /oidc/login = %d %s, want redirect with state cookie", rr.Code, rr.Body)
+	}
+	client := idp.Client()
+	client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	resp, err := client.Get(rr.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("provider authorization = %s, want redirect", resp.Status)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, resp.Header.Get("Location"), nil)
+	req.AddCookie(rr.Result().Cookies()[0])
+	callback := httptest.NewRecorder()
+	a.Router.ServeHTTP(callback, req)
+	return callback
+}
+
+func TestOIDCLogin_CreatesUser(t *testing.T) {
+	a, idp := newOIDCTestApp(t)
+	idp.SetUser(oidctest.User{Subject: "sub-1", Email: "new@example.com", Name: "New User", EmailVerified: true})
+
+	for i := 0; i < 2; i++ {
+		rr := oidcLogin(t, a, idp)
+		var resp map[string]interface{}
+		json.Unmarshal(rr.Body.Bytes(), &resp)
+		if rr.Code != http.StatusOK || resp["token"] == nil || resp["refresh_token"] == nil {
+			t.Fatalf("login %d = %d %v, want tokens", i+1, rr.Code, resp)
+		}
+		user := resp["user"].(map[string]interface{})
+		if user["id"] != 3.0 || user["email"] != "new@example.com" {
+			t.Errorf("login %d user = %v, want new user 3", i+1, user)
+		}
+		if code := send(a, http.MethodGet, "/auth/users/3", resp["token"].(string)); code != http.StatusOK {
+			t.Errorf("GET /auth/users/3 with OIDC login token = %d, want %d", code, http.StatusOK)
+		}
+	}
+	if userID, err := a.Identities.FindUserID(idp.URL, "sub-1"); err != nil || userID != 3 {
+		t.Errorf("identity link = %d, %v, want user 3", userID, err)
+	}
+}
+
+func TestOIDCLogin_LinksUser(t *testing.T) {
+	a, idp := newOIDCTestApp(t)
+
+	idp.SetUser(oidctest.User{Subject: "sub-1", Email: "user1@mydomain.com", EmailVerified: false})
+	if rr := oidcLogin(t, a, idp); rr.Code != http.StatusConflict {
+		t.Errorf("login with unverified email of existing user = %d, want %d", rr.Code, http.StatusConflict)
+	}
+
+	idp.SetUser(oidctest.User{Subject: "sub-1", Email: "user1@mydomain.com", EmailVerified: true})
+	rr := oidcLogin(t, a, idp)
+	var resp map[string]interface{}
+	json.Unmarshal(rr.Body.Bytes(), &resp)
+	if rr.Code != http.StatusOK || resp["user"].(map[string]interface{})["id"] != 1.0 {
+		t.Errorf("login with verified email = %d %v, want user 1", rr.Code, resp)
+	}
+}
+
+func TestOIDCLogin_InvalidState(t *testing.T) {
+	a, idp := newOIDCTestApp(t)
+	idp.SetUser(oidctest.User{Subject: "sub-1", Email: "new@example.com", EmailVerified: true})
+
+	rr := httptest.NewRecorder()
+	a.Router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/oidc/callback?code=abc&state=forged", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("callback without state cookie = %d, want %d", rr.Code, http.StatusBadRequest)
+	}
+
+	// ID token with other nonce is refused
+	idp.Nonce = "replayed"
+	if rr := oidcLogin(t, a, idp); rr.Code != http.StatusUnauthorized {
+		t.Errorf("login with wrong nonce = %d, want %d", rr.Code, http.StatusUnauthorized)
+	}
+}
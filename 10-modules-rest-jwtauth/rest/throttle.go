@@ -0,0 +1,94 @@
+package rest
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/iproduct/coursego/10-modules-rest-jwtauth/model"
+)
+
+// clientIP returns host of the request remote address
+func clientIP(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// checkThrottle responds with 429 Too Many Requests and returns false if logins to the account from the IP are blocked
+func (a *App) checkThrottle(w http.ResponseWriter, r *http.Request, email, ip string) bool {
+	wait, err := a.Throttle.Allow(email, ip)
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, err.Error())
+		return false
+	}
+	if wait > 0 {
+		a.audit(model.LoginThrottled, email, 0, ip, fmt.Sprintf("blocked for %v", wait.Round(time.Second)))
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		respondWithError(w, r, http.StatusTooManyRequests, "Too many failed login attempts. Please try again later")
+		return false
+	}
+	return true
+}
+
+// loginFailed records failed login for throttling and audit
+func (a *App) loginFailed(email string, userID int, ip, reason string) {
+	if err := a.Throttle.Failure(email, ip); err != nil {
+		log.Printf("Error recording login failure of %s: %v", email, err)
+	}
+	a.audit(model.LoginFailed, email, userID, ip, reason)
+}
+
+// loginSucceeded records successful login for throttling and audit
+func (a *App) loginSucceeded(user *model.User, ip string) {
+	if err := a.Throttle.Success(user.Email, ip); err != nil {
+		log.Printf("Error recording login of %s: %v", user.Email, err)
+	}
+	a.audit(model.LoginSucceeded, user.Email, user.ID, ip, "")
+}
+
+// audit records login audit event, failures to record it are logged only
+func (a *App) audit(event, email string, userID int, ip, reason string) {
+	err := a.LoginAudit.Record(&model.LoginEvent{
+		Time:   time.Now(),
+		Event:  event,
+		Email:  email,
+		UserID: userID,
+		IP:     ip,
+		Reason: reason,
+	})
+	if err != nil {
+		log.Printf("Error recording %s audit event of %s: %v", event, email, err)
+	}
+}
+
+// unlockUser clears failed logins and lockout of the user account
+func (a *App) unlockUser(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	user, err := a.Users.FindByID(id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, r, http.StatusNotFound, "User not found")
+		} else {
+			respondWithError(w, r, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+	if err := a.Throttle.Unlock(user.Email); err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	a.audit(model.AccountUnlocked, user.Email, user.ID, clientIP(r), fmt.Sprintf("unlocked by user %d", userClaims(r).UserID))
+	respondWithJSON(w, http.StatusOK, map[string]string{"message": "unlocked"})
+}
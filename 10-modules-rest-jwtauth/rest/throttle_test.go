@@ -0,0 +1,113 @@
+package rest
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/iproduct/coursego/10-modules-rest-jwtauth/auth"
+	"github.com/iproduct/coursego/10-modules-rest-jwtauth/dao"
+	"github.com/iproduct/coursego/10-modules-rest-jwtauth/dao/daomemory"
+	"github.com/iproduct/coursego/10-modules-rest-jwtauth/model"
+)
+
+func TestLoginThrottling(t *testing.T) {
+	a := newTestApp(t)
+	audit := daomemory.NewLoginAuditRepoMemory()
+	a.LoginAudit = audit
+	a.Throttle = auth.NewMemoryThrottle(auth.ThrottlePolicy{MaxFailures: 3, Lockout: time.Hour, MaxIPFailures: 100})
+	wrong := model.UserLogin{Email: "user1@mydomain.com", Password: "wrong"}
+
+	for i := 0; i < 3; i++ {
+		if code, _ := post(a, "/login", "", wrong); code != http.StatusUnauthorized {
+			t.Fatalf("login %d with wrong password = %d, want %d", i+1, code, http.StatusUnauthorized)
+		}
+	}
+	// locked account rejects even correct password
+	code, resp := post(a, "/login", "", model.UserLogin{Email: "user1@mydomain.com", Password: "user1"})
+	if code != http.StatusTooManyRequests {
+		t.Fatalf("login of locked account = %d %v, want %d", code, resp, http.StatusTooManyRequests)
+	}
+
+	if code := send(a, http.MethodPost, "/auth/users/1/unlock", login(t, a, "admin@mydomain.com", "admin")); code != http.StatusOK {
+		t.Fatalf("unlock = %d, want %d", code, http.StatusOK)
+	}
+	login(t, a, "user1@mydomain.com", "user1")
+
+	events, _ := audit.FindAll(0, 10)
+	want := []string{model.LoginSucceeded, model.AccountUnlocked, model.LoginSucceeded, model.LoginThrottled,
+		model.LoginFailed, model.LoginFailed, model.LoginFailed}
+	if len(events) != len(want) {
+		t.Fatalf("audit has %d events, want %d", len(events), len(want))
+	}
+	for i, event := range events {
+		if event.Event != want[i] {
+			t.Errorf("audit event %d = %s, want %s", i, event.Event, want[i])
+		}
+	}
+	if events[4].UserID != 1 || events[4].Reason != "invalid password" {
+		t.Errorf("failed login audit = %+v, want user 1 with invalid password", events[4])
+	}
+}
+
+func TestLoginThrottling_Backoff(t *testing.T) {
+	a := newTestApp(t)
+	if code, _ := post(a, "/login", "", model.UserLogin{Email: "unknown@mydomain.com", Password: "x"}); code != http.StatusUnauthorized {
+		t.Fatalf("login of unknown user = %d, want %d", code, http.StatusUnauthorized)
+	}
+	if code, _ := post(a, "/login", "", model.UserLogin{Email: "unknown@mydomain.com", Password: "x"}); code != http.StatusTooManyRequests {
+		t.Errorf("immediate retry = %d, want %d", code, http.StatusTooManyRequests)
+	}
+	if code, _ := post(a, "/login", "", model.UserLogin{Email: "user1@mydomain.com", Password: "user1"}); code != http.StatusOK {
+		t.Errorf("login of other account = %d, want %d", code, http.StatusOK)
+	}
+}
+
+// slowUserRepo delays finding users, so that concurrent requests overlap
+type slowUserRepo struct {
+	dao.UserRepo
+}
+
+func (u slowUserRepo) FindByEmail(email string) (*model.User, error) {
+	time.Sleep(20 * time.Millisecond)
+	return u.UserRepo.FindByEmail(email)
+}
+
+func (u slowUserRepo) FindByID(id int) (*model.User, error) {
+	time.Sleep(20 * time.Millisecond)
+	return u.UserRepo.FindByID(id)
+}
+
+func TestLoginThrottling_Concurrent(t *testing.T) {
+	a := newTestApp(t)
+	a.Users = slowUserRepo{a.Users}
+	a.Throttle = auth.NewMemoryThrottle(auth.ThrottlePolicy{MaxFailures: 3, Lockout: time.Hour, MaxIPFailures: 100})
+	wrong := model.UserLogin{Email: "user1@mydomain.com", Password: "wrong"}
+
+	codes := make(chan int, 20)
+	var wg sync.WaitGroup
+	for i := 0; i < cap(codes); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			code, _ := post(a, "/login", "", wrong)
+			codes <- code
+		}()
+	}
+	wg.Wait()
+	close(codes)
+	failures := 0
+	for code := range codes {
+		switch code {
+		case http.StatusUnauthorized:
+			failures++
+		case http.StatusTooManyRequests:
+		default:
+			t.Errorf("concurrent login = %d, want %d or %d", code, http.StatusUnauthorized, http.StatusTooManyRequests)
+		}
+	}
+	if failures > 3 {
+		t.Errorf("%d concurrent logins checked the password, want at most 3", failures)
+	}
+}
@@ -0,0 +1,177 @@
+package rest
+
+import (
+	"database/sql"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/iproduct/coursego/10-modules-rest-jwtauth/auth"
+	"github.com/iproduct/coursego/10-modules-rest-jwtauth/dao"
+	"github.com/iproduct/coursego/10-modules-rest-jwtauth/model"
+)
+
+const (
+	// AccessTokenTTL is validity time of access tokens
+	AccessTokenTTL = 10 * time.Minute
+	// RefreshTokenTTL is validity time of refresh tokens, each refresh issues new one
+	RefreshTokenTTL = 7 * 24 * time.Hour
+)
+
+// issueTokens returns login response with new access token and refresh token of the family.
+// If previousHash is not empty, the refresh token with that hash is rotated to the new one.
+func (a *App) issueTokens(user *model.User, family, previousHash string) (map[string]interface{}, error) {
+	tokenID, err := auth.NewID()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	claims := &model.UserToken{
+		UserID: user.ID,
+		Name:   user.Name,
+		Email:  user.Email,
+		Roles:  user.Roles,
+		StandardClaims: jwt.StandardClaims{
+			Id:        tokenID,
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(AccessTokenTTL).Unix(),
+			Issuer:    "test",
+		},
+	}
+	tokenString, err := a.Keys.Sign(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, hash, err := auth.NewRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+	next := &model.RefreshToken{
+		Hash:      hash,
+		Family:    family,
+		UserID:    user.ID,
+		ExpiresAt: now.Add(RefreshTokenTTL),
+	}
+	if previousHash == "" {
+		err = a.RefreshTokens.Create(next)
+	} else {
+		err = a.RefreshTokens.Rotate(previousHash, next)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var resp = map[string]interface{}{}
+	resp["token"] = tokenString //Store the token in the response
+	resp["refresh_token"] = refreshToken
+	resp["expires_in"] = int(AccessTokenTTL.Seconds())
+	// remove user password
+	user.Password = ""
+
+	resp["user"] = user
+	return resp, nil
+}
+
+// refresh exchanges refresh token for new access and refresh tokens.
+// Refresh token can be used only once, its reuse means it was stolen, so all tokens of its family are revoked.
+func (a *App) refresh(w http.ResponseWriter, r *http.Request) {
+	req := &model.TokenRequest{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil || req.RefreshToken == "" {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	hash := auth.HashToken(req.RefreshToken)
+	stored, err := a.RefreshTokens.FindByHash(hash)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, r, http.StatusUnauthorized, "Invalid refresh token")
+		} else {
+			respondWithError(w, r, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+	if stored.ReplacedBy != "" {
+		a.revokeReused(w, r, stored)
+		return
+	}
+	if stored.Revoked {
+		respondWithError(w, r, http.StatusUnauthorized, "Refresh token is revoked")
+		return
+	}
+	if time.Now().After(stored.ExpiresAt) {
+		respondWithError(w, r, http.StatusUnauthorized, "Refresh token is expired")
+		return
+	}
+
+	user, err := a.Users.FindByID(stored.UserID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, r, http.StatusUnauthorized, "User not found")
+		} else {
+			respondWithError(w, r, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+	// sessions of deactivated users end
+	if !user.Active {
+		if err := a.RefreshTokens.RevokeFamily(stored.Family); err != nil {
+			respondWithError(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+		respondWithError(w, r, http.StatusForbidden, "Account is not active")
+		return
+	}
+	resp, err := a.issueTokens(user, stored.Family, hash)
+	if err != nil {
+		if err == dao.ErrTokenUsed { // concurrent refresh with the same token
+			a.revokeReused(w, r, stored)
+		} else {
+			respondWithError(w, r, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+	resp["message"] = "refreshed"
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+// revokeReused revokes family of reused refresh token
+func (a *App) revokeReused(w http.ResponseWriter, r *http.Request, stored *model.RefreshToken) {
+	if err := a.RefreshTokens.RevokeFamily(stored.Family); err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	respondWithError(w, r, http.StatusUnauthorized, "Refresh token reuse detected, please log in again")
+}
+
+// logout revokes the access token of the request, and the family of refresh token sent in the payload
+func (a *App) logout(w http.ResponseWriter, r *http.Request) {
+	claims := userClaims(r)
+	req := &model.TokenRequest{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil && err != io.EOF {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if err := a.Revocations.Revoke(claims.Id, time.Unix(claims.ExpiresAt, 0)); err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if req.RefreshToken != "" {
+		stored, err := a.RefreshTokens.FindByHash(auth.HashToken(req.RefreshToken))
+		if err != nil && err != sql.ErrNoRows {
+			respondWithError(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+		// refresh tokens of other users are ignored
+		if err == nil && stored.UserID == claims.UserID {
+			if err := a.RefreshTokens.RevokeFamily(stored.Family); err != nil {
+				respondWithError(w, r, http.StatusInternalServerError, err.Error())
+				return
+			}
+		}
+	}
+	respondWithJSON(w, http.StatusOK, map[string]string{"message": "logged out"})
+}
@@ -0,0 +1,209 @@
+package rest
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/iproduct/coursego/10-modules-rest-jwtauth/auth"
+	"github.com/iproduct/coursego/10-modules-rest-jwtauth/dao"
+	"github.com/iproduct/coursego/10-modules-rest-jwtauth/dao/daomemory"
+	"github.com/iproduct/coursego/10-modules-rest-jwtauth/mail"
+	"github.com/iproduct/coursego/10-modules-rest-jwtauth/model"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// userRepoStub is UserRepo keeping users in slice
+type userRepoStub struct {
+	dao.UserRepo
+	users []model.User
+}
+
+func (u *userRepoStub) FindByID(id int) (*model.User, error) {
+	for _, user := range u.users {
+		if user.ID == id {
+			return &user, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (u *userRepoStub) FindByEmail(email string) (*model.User, error) {
+	for _, user := range u.users {
+		if user.Email == email {
+			return &user, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (u *userRepoStub) FindAll(q *dao.UserQuery) ([]model.User, error) {
+	return q.Apply(u.users), nil
+}
+
+func (u *userRepoStub) Count(q *dao.UserQuery) (int, error) {
+	return len(q.Apply(u.users)), nil
+}
+
+func (u *userRepoStub) Create(user *model.User) (*model.User, error) {
+	user.ID = len(u.users) + 1
+	u.users = append(u.users, *user)
+	return user, nil
+}
+
+func (u *userRepoStub) Update(user *model.User) (*model.User, error) {
+	for i := range u.users {
+		if u.users[i].ID == user.ID {
+			u.users[i] = *user
+			return user, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (u *userRepoStub) DeleteByID(id int) (*model.User, error) {
+	for i, user := range u.users {
+		if user.ID == id {
+			u.users = append(u.users[:i], u.users[i+1:]...)
+			return &user, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func newTestApp(t *testing.T) *App {
+	t.Helper()
+	hash := func(password string) string {
+		pass, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(pass)
+	}
+	keys, err := auth.NewKeys(auth.HMACKeyID, auth.HMACKey(auth.HMACKeyID, []byte("s3cret")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens := daomemory.NewTokenRepoMemory()
+	a := &App{
+		Users: &userRepoStub{users: []model.User{
+			{ID: 1, Name: "User 1", Email: "user1@mydomain.com", Password: hash("user1"), Age: 20, Active: true, Roles: []string{model.RoleUser}},
+			{ID: 2, Name: "Admin", Email: "admin@mydomain.com", Password: hash("admin"), Age: 30, Active: true, Roles: []string{model.RoleAdmin, model.RoleUser}},
+		}},
+		RefreshTokens: tokens,
+		Revocations:   tokens,
+		Keys:          keys,
+		Throttle:      auth.NewMemoryThrottle(auth.DefaultThrottlePolicy),
+		LoginAudit:    daomemory.NewLoginAuditRepoMemory(),
+		UserAudit:     daomemory.NewUserAuditRepoMemory(),
+		Identities:    daomemory.NewIdentityRepoMemory(),
+		APIKeys:       daomemory.NewAPIKeyRepoMemory(),
+		Mailer:        &mail.MemoryMailer{},
+		BaseURL:       "http://localhost:8080",
+		Router:        mux.NewRouter(),
+	}
+	a.initValidator()
+	a.initializeRoutes()
+	return a
+}
+
+// post sends JSON payload to the app, returning response code and decoded body
+func post(a *App, path, bearer string, payload interface{}) (int, map[string]interface{}) {
+	body, _ := json.Marshal(payload)
+	req, _ := http.NewRequest(http.MethodPost, path, bytes.NewBuffer(body))
+	if bearer != "" {
+		req.Header.Set("Authorization", "Bearer "+bearer)
+	}
+	rr := httptest.NewRecorder()
+	a.Router.ServeHTTP(rr, req)
+	var m map[string]interface{}
+	json.Unmarshal(rr.Body.Bytes(), &m)
+	return rr.Code, m
+}
+
+// send calls the app with the access token, returning response code
+func send(a *App, method, path, bearer string) int {
+	req, _ := http.NewRequest(method, path, nil)
+	req.Header.Set("Authorization", "Bearer "+bearer)
+	rr := httptest.NewRecorder()
+	a.Router.ServeHTTP(rr, req)
+	return rr.Code
+}
+
+func TestRefreshRotation(t *testing.T) {
+	a := newTestApp(t)
+	code, login := post(a, "/login", "", model.UserLogin{Email: "user1@mydomain.com", Password: "user1"})
+	if code != http.StatusOK || login["token"] == nil || login["refresh_token"] == nil {
+		t.Fatalf("login = %d %v, want tokens", code, login)
+	}
+	// errors are problem details, success has no legacy status field
+	if _, ok := login["status"]; ok {
+		t.Errorf("login = %v, want no status field", login)
+	}
+	first := login["refresh_token"].(string)
+
+	code, refreshed := post(a, "/refresh", "", model.TokenRequest{RefreshToken: first})
+	if code != http.StatusOK || refreshed["refresh_token"] == first {
+		t.Fatalf("refresh = %d %v, want rotated token", code, refreshed)
+	}
+	second := refreshed["refresh_token"].(string)
+	if code := send(a, http.MethodGet, "/auth/users/1", refreshed["token"].(string)); code != http.StatusOK {
+		t.Errorf("GET /auth/users/1 with refreshed token = %d, want %d", code, http.StatusOK)
+	}
+
+	// reuse of rotated token revokes the whole family
+	if code, _ := post(a, "/refresh", "", model.TokenRequest{RefreshToken: first}); code != http.StatusUnauthorized {
+		t.Errorf("refresh with reused token = %d, want %d", code, http.StatusUnauthorized)
+	}
+	if code, _ := post(a, "/refresh", "", model.TokenRequest{RefreshToken: second}); code != http.StatusUnauthorized {
+		t.Errorf("refresh with token of revoked family = %d, want %d", code, http.StatusUnauthorized)
+	}
+	if code, _ := post(a, "/refresh", "", model.TokenRequest{RefreshToken: "unknown"}); code != http.StatusUnauthorized {
+		t.Errorf("refresh with unknown token = %d, want %d", code, http.StatusUnauthorized)
+	}
+}
+
+func TestRefresh_InactiveUser(t *testing.T) {
+	a := newTestApp(t)
+	_, login := post(a, "/login", "", model.UserLogin{Email: "user1@mydomain.com", Password: "user1"})
+	refreshToken := login["refresh_token"].(string)
+	user, _ := a.Users.FindByID(1)
+	user.Active = false
+	a.Users.Update(user)
+
+	if code, _ := post(a, "/refresh", "", model.TokenRequest{RefreshToken: refreshToken}); code != http.StatusForbidden {
+		t.Errorf("refresh of inactive user = %d, want %d", code, http.StatusForbidden)
+	}
+	// the family stays revoked when the user is activated again
+	user.Active = true
+	a.Users.Update(user)
+	if code, _ := post(a, "/refresh", "", model.TokenRequest{RefreshToken: refreshToken}); code != http.StatusUnauthorized {
+		t.Errorf("refresh with token of deactivated session = %d, want %d", code, http.StatusUnauthorized)
+	}
+}
+
+func TestLogout(t *testing.T) {
+	a := newTestApp(t)
+	_, login := post(a, "/login", "", model.UserLogin{Email: "user1@mydomain.com", Password: "user1"})
+	token, refreshToken := login["token"].(string), login["refresh_token"].(string)
+	if code := send(a, http.MethodGet, "/auth/users/1", token); code != http.StatusOK {
+		t.Fatalf("GET /auth/users/1 before logout = %d, want %d", code, http.StatusOK)
+	}
+
+	if code, _ := post(a, "/logout", token, model.TokenRequest{RefreshToken: refreshToken}); code != http.StatusOK {
+		t.Fatalf("logout = %d, want %d", code, http.StatusOK)
+	}
+	if code := send(a, http.MethodGet, "/auth/users/1", token); code != http.StatusUnauthorized {
+		t.Errorf("GET /auth/users/1 after logout = %d, want %d", code, http.StatusUnauthorized)
+	}
+	if code, _ := post(a, "/refresh", "", model.TokenRequest{RefreshToken: refreshToken}); code != http.StatusUnauthorized {
+		t.Errorf("refresh after logout = %d, want %d", code, http.StatusUnauthorized)
+	}
+	if code, _ := post(a, "/logout", "", nil); code != http.StatusUnauthorized {
+		t.Errorf("logout without token = %d, want %d", code, http.StatusUnauthorized)
+	}
+}
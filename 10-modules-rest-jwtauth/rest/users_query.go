@@ -0,0 +1,174 @@
+package rest
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/iproduct/coursego/10-modules-rest-jwtauth/dao"
+	"github.com/iproduct/coursego/10-modules-rest-jwtauth/model"
+)
+
+const (
+	// DefaultPageSize is number of users returned if count parameter is missing, it is also the maximum
+	DefaultPageSize = 20
+	// TotalCountHeader is response header with number of users passing the filters
+	TotalCountHeader = "X-Total-Count"
+)
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// cursor is position in the list of users, it holds the sort order and sort key of the last user in the page
+type cursor struct {
+	Sort   string `json:"s"`
+	ID     int    `json:"i"`
+	Name   string `json:"n,omitempty"`
+	Email  string `json:"e,omitempty"`
+	Age    int    `json:"a,omitempty"`
+	Active bool   `json:"ac,omitempty"`
+}
+
+// encodeCursor returns opaque cursor pointing after the user in the query sort order
+func encodeCursor(q *dao.UserQuery, user *model.User) string {
+	c := cursor{Sort: dao.FormatSort(q.Sort), ID: user.ID}
+	for _, field := range q.Sort {
+		switch field.Field {
+		case dao.FieldName:
+			c.Name = user.Name
+		case dao.FieldEmail:
+			c.Email = user.Email
+		case dao.FieldAge:
+			c.Age = user.Age
+		case dao.FieldActive:
+			c.Active = user.Active
+		}
+	}
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor returns the user the cursor points after, the cursor must be created with the same sort order
+func decodeCursor(q *dao.UserQuery, value string) (*model.User, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+	c := cursor{}
+	if err := json.Unmarshal(data, &c); err != nil || c.Sort != dao.FormatSort(q.Sort) {
+		return nil, errInvalidCursor
+	}
+	return &model.User{ID: c.ID, Name: c.Name, Email: c.Email, Age: c.Age, Active: c.Active}, nil
+}
+
+// parseUserQuery returns user query of request parameters:
+// name and email substrings, active flag, min_age and max_age, sort fields (e.g. "-age,name"),
+// count of users per page, cursor returned in Link header of previous page, or start position counted from 1.
+func parseUserQuery(r *http.Request) (*dao.UserQuery, error) {
+	params := r.URL.Query()
+	q := &dao.UserQuery{
+		Name:  params.Get("name"),
+		Email: params.Get("email"),
+		Limit: DefaultPageSize,
+	}
+	var err error
+	if value := params.Get("active"); value != "" {
+		active, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid active parameter: %q", value)
+		}
+		q.Active = &active
+	}
+	if q.MinAge, err = parseOptionalInt(params, "min_age"); err != nil {
+		return nil, err
+	}
+	if q.MaxAge, err = parseOptionalInt(params, "max_age"); err != nil {
+		return nil, err
+	}
+	if q.Sort, err = dao.ParseSort(params.Get("sort")); err != nil {
+		return nil, err
+	}
+	if count, err := parseOptionalInt(params, "count"); err != nil {
+		return nil, err
+	} else if count != nil && *count >= 1 && *count <= DefaultPageSize {
+		q.Limit = *count
+	}
+	if value := params.Get("cursor"); value != "" {
+		if q.After, err = decodeCursor(q, value); err != nil {
+			return nil, err
+		}
+	} else if start, err := parseOptionalInt(params, "start"); err != nil {
+		return nil, err
+	} else if start != nil && *start > 1 {
+		q.Offset = *start - 1
+	}
+	return q, nil
+}
+
+func parseOptionalInt(params url.Values, name string) (*int, error) {
+	value := params.Get(name)
+	if value == "" {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s parameter: %q", name, value)
+	}
+	return &n, nil
+}
+
+// pageLinks returns Link header value with first page and, if there is one, next page URLs
+func (a *App) pageLinks(r *http.Request, next string) string {
+	params := r.URL.Query()
+	params.Del("cursor")
+	params.Del("start")
+	link := func(rel string) string {
+		return fmt.Sprintf(`<%s%s?%s>; rel="%s"`, a.BaseURL, r.URL.Path, params.Encode(), rel)
+	}
+	links := []string{link("first")}
+	if next != "" {
+		params.Set("cursor", next)
+		links = append(links, link("next"))
+	}
+	return strings.Join(links, ", ")
+}
+
+// getUsers returns page of users selected and sorted by query parameters (see parseUserQuery).
+// Total count of selected users is returned in X-Total-Count header, and first and next page URLs in Link header.
+func (a *App) getUsers(w http.ResponseWriter, r *http.Request) {
+	q, err := parseUserQuery(r)
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid request: "+err.Error())
+		return
+	}
+	total, err := a.Users.Count(q)
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	// fetch one more user to find if there is next page
+	pageSize := q.Limit
+	q.Limit++
+	users, err := a.Users.FindAll(q)
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	q.Limit = pageSize
+	next := ""
+	if len(users) > pageSize {
+		users = users[:pageSize]
+		next = encodeCursor(q, &users[pageSize-1])
+	}
+	// remove user passwords
+	for i := range users {
+		users[i].Password = ""
+	}
+	w.Header().Set(TotalCountHeader, strconv.Itoa(total))
+	w.Header().Set("Link", a.pageLinks(r, next))
+	respondWithJSON(w, http.StatusOK, users)
+}
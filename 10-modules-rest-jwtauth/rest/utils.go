@@ -2,21 +2,20 @@ package rest
 
 import (
 	"encoding/json"
-	"github.com/go-playground/validator/v10"
 	"net/http"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/iproduct/coursego/problem"
 )
 
-func respondWithError(w http.ResponseWriter, code int, message string) {
-	respondWithJSON(w, code, map[string]string{"error": message})
+// respondWithError responds with application/problem+json problem details
+func respondWithError(w http.ResponseWriter, r *http.Request, code int, message string) {
+	problem.Error(w, r, code, message)
 }
 
-func respondWithValidationError(fields validator.ValidationErrorsTranslations, w http.ResponseWriter) {
-	//Create a new map and fill it
-	response := make(map[string]interface{})
-	response["status"] = "error"
-	response["message"] = "validation error"
-	response["errors"] = fields
-	respondWithJSON(w, http.StatusUnprocessableEntity, response)
+// respondWithValidationError responds with problem details listing invalid fields
+func respondWithValidationError(w http.ResponseWriter, r *http.Request, fields validator.ValidationErrorsTranslations) {
+	problem.ValidationError(w, r, fields)
 }
 
 func respondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
@@ -0,0 +1,236 @@
+package rest
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/go-playground/validator/v10"
+	"github.com/iproduct/coursego/10-modules-rest-jwtauth/auth"
+	"github.com/iproduct/coursego/10-modules-rest-jwtauth/dao"
+	"github.com/iproduct/coursego/10-modules-rest-jwtauth/mail"
+	"github.com/iproduct/coursego/10-modules-rest-jwtauth/model"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// VerifyEmailTTL is validity time of email verification tokens
+	VerifyEmailTTL = 24 * time.Hour
+	// ResetPasswordTTL is validity time of password reset tokens
+	ResetPasswordTTL = time.Hour
+)
+
+var (
+	errInactive     = errors.New("account is not active")
+	errInvalidToken = errors.New("invalid or expired token")
+)
+
+// issueActionToken returns signed token allowing the action to the user
+func (a *App) issueActionToken(user *model.User, action string, ttl time.Duration) (string, error) {
+	tokenID, err := auth.NewID()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	return a.Keys.Sign(&model.ActionToken{
+		UserID: user.ID,
+		Email:  user.Email,
+		StandardClaims: jwt.StandardClaims{
+			Id:        tokenID,
+			Audience:  action,
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(ttl).Unix(),
+			Issuer:    "test",
+		},
+	})
+}
+
+// useActionToken verifies the action token and consumes it, so it can be used only once
+// even by concurrent requests. It returns the user the token was issued to.
+func (a *App) useActionToken(token, action string) (*model.User, error) {
+	claims := &model.ActionToken{}
+	if err := a.Keys.Parse(token, claims); err != nil || claims.Audience != action || claims.Id == "" {
+		return nil, errInvalidToken
+	}
+	user, err := a.Users.FindByID(claims.UserID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errInvalidToken
+		}
+		return nil, err
+	}
+	// tokens mailed to previous email address are not valid
+	if user.Email != claims.Email {
+		return nil, errInvalidToken
+	}
+	if err := a.Revocations.Consume(claims.Id, time.Unix(claims.ExpiresAt, 0)); err != nil {
+		if err == dao.ErrTokenRevoked {
+			return nil, errInvalidToken
+		}
+		return nil, err
+	}
+	return user, nil
+}
+
+// respondWithTokenError responds to failed useActionToken
+func respondWithTokenError(w http.ResponseWriter, r *http.Request, err error) {
+	if err == errInvalidToken {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid or expired token")
+	} else {
+		respondWithError(w, r, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// sendVerification mails email verification link to the user
+func (a *App) sendVerification(user *model.User) error {
+	token, err := a.issueActionToken(user, model.VerifyEmailAction, VerifyEmailTTL)
+	if err != nil {
+		return err
+	}
+	return a.Mailer.Send(mail.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Hello %s,\n\nPlease verify your email address by opening:\n%s/verify-email/confirm?token=%s\n\n"+
+			"The link is valid for %v.\n", user.Name, a.BaseURL, url.QueryEscape(token), VerifyEmailTTL),
+	})
+}
+
+// sendPasswordReset mails password reset token to the user
+func (a *App) sendPasswordReset(user *model.User) error {
+	token, err := a.issueActionToken(user, model.ResetPasswordAction, ResetPasswordTTL)
+	if err != nil {
+		return err
+	}
+	return a.Mailer.Send(mail.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hello %s,\n\nTo set new password, POST it with the token to %s/password-reset/confirm\n"+
+			"Token: %s\n\nThe token is valid for %v. If you did not request password reset, ignore this mail.\n",
+			user.Name, a.BaseURL, token, ResetPasswordTTL),
+	})
+}
+
+// decodeEmailRequest decodes requested email address, responding with error if it is missing
+func decodeEmailRequest(w http.ResponseWriter, r *http.Request) (string, bool) {
+	req := &model.EmailRequest{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil || req.Email == "" {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid request payload")
+		return "", false
+	}
+	return req.Email, true
+}
+
+// respondMailRequested responds the same way whether the account exists or not, so it can not be discovered
+func respondMailRequested(w http.ResponseWriter) {
+	respondWithJSON(w, http.StatusAccepted, map[string]string{"message": "If the account exists, mail was sent to it"})
+}
+
+// requestVerification mails new email verification link to inactive user
+func (a *App) requestVerification(w http.ResponseWriter, r *http.Request) {
+	email, ok := decodeEmailRequest(w, r)
+	if !ok {
+		return
+	}
+	user, err := a.Users.FindByEmail(email)
+	if err != nil && err != sql.ErrNoRows {
+		respondWithError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if err == nil && !user.Active {
+		if err := a.sendVerification(user); err != nil {
+			log.Printf("Error sending verification mail to %s: %v", user.Email, err)
+		}
+	}
+	respondMailRequested(w)
+}
+
+// confirmVerification activates user with email verification token sent as token query parameter or in payload
+func (a *App) confirmVerification(w http.ResponseWriter, r *http.Request) {
+	req := &model.ActionRequest{Token: r.URL.Query().Get("token")}
+	if req.Token == "" {
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil || req.Token == "" {
+			respondWithError(w, r, http.StatusBadRequest, "Invalid request payload")
+			return
+		}
+	}
+	user, err := a.useActionToken(req.Token, model.VerifyEmailAction)
+	if err != nil {
+		respondWithTokenError(w, r, err)
+		return
+	}
+	user.Active = true
+	if _, err = a.Users.Update(user); err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]string{"message": "email verified"})
+}
+
+// requestPasswordReset mails password reset token to the user
+func (a *App) requestPasswordReset(w http.ResponseWriter, r *http.Request) {
+	email, ok := decodeEmailRequest(w, r)
+	if !ok {
+		return
+	}
+	user, err := a.Users.FindByEmail(email)
+	if err != nil && err != sql.ErrNoRows {
+		respondWithError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if err == nil {
+		if err := a.sendPasswordReset(user); err != nil {
+			log.Printf("Error sending password reset mail to %s: %v", user.Email, err)
+		}
+	}
+	respondMailRequested(w)
+}
+
+// confirmPasswordReset sets new password of the user with password reset token
+func (a *App) confirmPasswordReset(w http.ResponseWriter, r *http.Request) {
+	req := &model.ActionRequest{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil || req.Token == "" {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	password := struct {
+		Password string `json:"password" validate:"required,min=6"`
+	}{req.Password}
+	if err := a.Validator.Struct(password); err != nil {
+		errs := err.(validator.ValidationErrors)
+		respondWithValidationError(w, r, errs.Translate(a.Translator))
+		return
+	}
+	user, err := a.useActionToken(req.Token, model.ResetPasswordAction)
+	if err != nil {
+		respondWithTokenError(w, r, err)
+		return
+	}
+
+	// Hash the pasword with bcrypt
+	pass, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, "Password Encryption  failed")
+		return
+	}
+	user.Password = string(pass)
+	if _, err = a.Users.Update(user); err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	// sessions started with the old password are ended
+	if err := a.RefreshTokens.RevokeUser(user.ID); err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	// user proved access to the mailbox, so lockout after forgotten password is lifted
+	if err := a.Throttle.Unlock(user.Email); err != nil {
+		log.Printf("Error unlocking %s: %v", user.Email, err)
+	}
+	respondWithJSON(w, http.StatusOK, map[string]string{"message": "password changed"})
+}
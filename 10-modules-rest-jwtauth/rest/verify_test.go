@@ -0,0 +1,128 @@
+package rest
+
+import (
+	"net/http"
+	"regexp"
+	"sync"
+	"testing"
+
+	"github.com/iproduct/coursego/10-modules-rest-jwtauth/mail"
+	"github.com/iproduct/coursego/10-modules-rest-jwtauth/model"
+)
+
+var mailedToken = regexp.MustCompile(`(?i)token[=:] ?([\w.-]+)`)
+
+// lastToken returns token from the last mail sent to the address
+func lastToken(t *testing.T, a *App, to string) string {
+	t.Helper()
+	messages := a.Mailer.(*mail.MemoryMailer).Messages(to)
+	if len(messages) == 0 {
+		t.Fatalf("no mail sent to %s", to)
+	}
+	m := mailedToken.FindStringSubmatch(messages[len(messages)-1].Body)
+	if m == nil {
+		t.Fatalf("no token in mail %q", messages[len(messages)-1].Body)
+	}
+	return m[1]
+}
+
+func TestEmailVerification(t *testing.T) {
+	a := newTestApp(t)
+	credentials := model.UserLogin{Email: "new@mydomain.com", Password: "secret1"}
+	code, created := post(a, "/users", "", map[string]interface{}{
+		"name": "New User", "email": credentials.Email, "password": credentials.Password, "age": 30, "active": true,
+	})
+	if code != http.StatusCreated || created["active"] != false {
+		t.Fatalf("create user = %d %v, want inactive user", code, created)
+	}
+	if code, _ := post(a, "/login", "", credentials); code != http.StatusForbidden {
+		t.Errorf("login of inactive user = %d, want %d", code, http.StatusForbidden)
+	}
+
+	// resent link replaces the first one, both are valid
+	first := lastToken(t, a, credentials.Email)
+	if code, _ := post(a, "/verify-email/request", "", model.EmailRequest{Email: credentials.Email}); code != http.StatusAccepted {
+		t.Fatalf("verification request = %d, want %d", code, http.StatusAccepted)
+	}
+	token := lastToken(t, a, credentials.Email)
+	if code := send(a, http.MethodGet, "/auth/users/3", token); code != http.StatusUnauthorized {
+		t.Errorf("verification token used as access token = %d, want %d", code, http.StatusUnauthorized)
+	}
+	if code := send(a, http.MethodGet, "/verify-email/confirm?token="+token, ""); code != http.StatusOK {
+		t.Fatalf("verification = %d, want %d", code, http.StatusOK)
+	}
+	if code := send(a, http.MethodGet, "/verify-email/confirm?token="+token, ""); code != http.StatusBadRequest {
+		t.Errorf("reused verification = %d, want %d", code, http.StatusBadRequest)
+	}
+	if code, _ := post(a, "/verify-email/confirm", "", model.ActionRequest{Token: first}); code != http.StatusOK {
+		t.Errorf("verification with first token = %d, want %d", code, http.StatusOK)
+	}
+	login(t, a, credentials.Email, credentials.Password)
+}
+
+func TestPasswordReset(t *testing.T) {
+	a := newTestApp(t)
+	_, session := post(a, "/login", "", model.UserLogin{Email: "user1@mydomain.com", Password: "user1"})
+	refreshToken := session["refresh_token"].(string)
+	if code, _ := post(a, "/password-reset/request", "", model.EmailRequest{Email: "unknown@mydomain.com"}); code != http.StatusAccepted {
+		t.Errorf("reset request of unknown user = %d, want %d", code, http.StatusAccepted)
+	}
+	if code, _ := post(a, "/password-reset/request", "", model.EmailRequest{Email: "user1@mydomain.com"}); code != http.StatusAccepted {
+		t.Fatalf("reset request = %d, want %d", code, http.StatusAccepted)
+	}
+	token := lastToken(t, a, "user1@mydomain.com")
+
+	if code, _ := post(a, "/verify-email/confirm", "", model.ActionRequest{Token: token}); code != http.StatusBadRequest {
+		t.Errorf("reset token used for verification = %d, want %d", code, http.StatusBadRequest)
+	}
+	if code, _ := post(a, "/password-reset/confirm", "", model.ActionRequest{Token: token, Password: "123"}); code != http.StatusUnprocessableEntity {
+		t.Errorf("reset to short password = %d, want %d", code, http.StatusUnprocessableEntity)
+	}
+	if code, _ := post(a, "/password-reset/confirm", "", model.ActionRequest{Token: token, Password: "new-password"}); code != http.StatusOK {
+		t.Fatalf("reset = %d, want %d", code, http.StatusOK)
+	}
+	if code, _ := post(a, "/password-reset/confirm", "", model.ActionRequest{Token: token, Password: "other-password"}); code != http.StatusBadRequest {
+		t.Errorf("reused reset = %d, want %d", code, http.StatusBadRequest)
+	}
+	if code, _ := post(a, "/refresh", "", model.TokenRequest{RefreshToken: refreshToken}); code != http.StatusUnauthorized {
+		t.Errorf("refresh with token issued before reset = %d, want %d", code, http.StatusUnauthorized)
+	}
+	if code, _ := post(a, "/login", "", model.UserLogin{Email: "user1@mydomain.com", Password: "user1"}); code != http.StatusUnauthorized {
+		t.Errorf("login with old password = %d, want %d", code, http.StatusUnauthorized)
+	}
+	a.Throttle.Unlock("user1@mydomain.com")
+	login(t, a, "user1@mydomain.com", "new-password")
+}
+
+// TestPasswordReset_Concurrent checks reset token is accepted only once by concurrent requests
+func TestPasswordReset_Concurrent(t *testing.T) {
+	a := newTestApp(t)
+	if code, _ := post(a, "/password-reset/request", "", model.EmailRequest{Email: "user1@mydomain.com"}); code != http.StatusAccepted {
+		t.Fatalf("reset request = %d, want %d", code, http.StatusAccepted)
+	}
+	token := lastToken(t, a, "user1@mydomain.com")
+	a.Users = slowUserRepo{a.Users}
+
+	const requests = 10
+	codes := make(chan int, requests)
+	var wg sync.WaitGroup
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			code, _ := post(a, "/password-reset/confirm", "", model.ActionRequest{Token: token, Password: "new-password"})
+			codes <- code
+		}()
+	}
+	wg.Wait()
+	close(codes)
+	accepted := 0
+	for code := range codes {
+		if code == http.StatusOK {
+			accepted++
+		}
+	}
+	if accepted != 1 {
+		t.Errorf("%d concurrent resets accepted, want 1", accepted)
+	}
+}
@@ -11,26 +11,44 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"reflect"
+	"regexp"
 	"strconv"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
 )
 
 var a rest.App
+var nextLink = regexp.MustCompile(`<([^>]*)>; rel="next"`)
 var db *sql.DB
 
-func init() {
-	connectionString := fmt.Sprintf("%s:%s@/%s", "root", "root", "go_rest_api_test")
-	var err error
-	db, err = sql.Open("mysql", connectionString)
-	if err != nil {
-		log.Fatal(err)
-	}
+// cfg selects test database by TEST_DB_TYPE environment variable: memory (default), sqlite or mysql
+var cfg = rest.Config{
+	DBType:     os.Getenv("TEST_DB_TYPE"),
+	DBUser:     "root",
+	DBPassword: "root",
+	DBName:     "go_rest_api_test",
+	SQLitePath: ":memory:",
 }
 
 func TestMain(m *testing.M) {
+	if cfg.DBType == "" {
+		cfg.DBType = rest.Memory
+	}
+	if cfg.DBType == rest.MySQL {
+		connectionString := fmt.Sprintf("%s:%s@/%s", cfg.DBUser, cfg.DBPassword, cfg.DBName)
+		var err error
+		db, err = sql.Open("mysql", connectionString)
+		if err != nil {
+			log.Fatal(err)
+		}
+		ensureTableExists()
+	}
 	a = rest.App{}
-	a.Init("root", "root", "go_rest_api_test")
-	ensureTableExists()
+	a.Init(cfg)
 	code := m.Run()
 	clearTable()
 	os.Exit(code)
@@ -40,7 +58,7 @@ func TestMain(m *testing.M) {
 //Tests
 func TestEmptyTable(t *testing.T) {
 	clearTable()
-	req, _ := http.NewRequest("GET", "/users", nil)
+	req, _ := http.NewRequest("GET", "/auth/users", nil)
 	resp := executeRequest(req)
 	assertResponseCode(t, http.StatusOK, resp.Code)
 	if body := resp.Body.String(); body != "[]" {
@@ -48,24 +66,69 @@ func TestEmptyTable(t *testing.T) {
 	}
 }
 
+func TestListUsersPagination(t *testing.T) {
+	clearTable()
+	addUsers(5)
+
+	// users sorted by age descending, 2 per page, following next page links
+	path := "/auth/users?sort=-age&count=2&min_age=20"
+	ids := []int{}
+	for page := 0; path != ""; page++ {
+		if page > 3 {
+			t.Fatal("Too many pages")
+		}
+		response := executeRequest(httptest.NewRequest("GET", path, nil))
+		assertResponseCode(t, http.StatusOK, response.Code)
+		if total := response.Header().Get("X-Total-Count"); total != "5" {
+			t.Errorf("Expected X-Total-Count 5. Got %q", total)
+		}
+		var users []model.User
+		json.Unmarshal(response.Body.Bytes(), &users)
+		for _, user := range users {
+			ids = append(ids, user.ID)
+		}
+		path = ""
+		if m := nextLink.FindStringSubmatch(response.Header().Get("Link")); m != nil {
+			path = strings.TrimPrefix(m[1], a.BaseURL)
+		}
+	}
+	assertEqual(t, []int{5, 4, 3, 2, 1}, ids)
+}
+
+func TestListUsersFilter(t *testing.T) {
+	clearTable()
+	addUsers(3)
+
+	response := executeRequest(httptest.NewRequest("GET", "/auth/users?name=USER%202&active=true", nil))
+	assertResponseCode(t, http.StatusOK, response.Code)
+	var users []model.User
+	json.Unmarshal(response.Body.Bytes(), &users)
+	if len(users) != 1 || users[0].ID != 2 {
+		t.Errorf("Expected user 2. Got %v", users)
+	}
+
+	response = executeRequest(httptest.NewRequest("GET", "/auth/users?sort=password", nil))
+	assertResponseCode(t, http.StatusBadRequest, response.Code)
+}
+
 func TestGetNonExistentUser(t *testing.T) {
 	clearTable()
-	req, _ := http.NewRequest("GET", "/users/45", nil)
+	req, _ := http.NewRequest("GET", "/auth/users/45", nil)
 	response := executeRequest(req)
 	assertResponseCode(t, http.StatusNotFound, response.Code)
-	var m map[string]string
+	var m map[string]interface{}
 	json.Unmarshal(response.Body.Bytes(), &m)
-	if m["error"] != "User not found" {
-		t.Errorf("Expected the 'error' key of the response to be set to 'User not found'. Got '%s'", m["error"])
+	if m["detail"] != "User not found" {
+		t.Errorf("Expected the 'detail' key of the response to be set to 'User not found'. Got '%s'", m["detail"])
 	}
 }
 
 func TestGetUserById(t *testing.T) {
 	clearTable()
-	testUser := model.User{1, "User 1", "user1@mydomain.com", "user1", 20, true}
+	testUser := model.User{ID: 1, Name: "User 1", Email: "user1@mydomain.com", Password: "user1", Age: 20, Active: true, Roles: []string{model.RoleUser}}
 	addUser(&testUser)
 
-	req, _ := http.NewRequest("GET", "/users/1", nil)
+	req, _ := http.NewRequest("GET", "/auth/users/1", nil)
 	response := executeRequest(req)
 	log.Println("Response:", string(response.Body.Bytes()))
 
@@ -108,12 +171,47 @@ func TestCreateUser(t *testing.T) {
 	}
 }
 
+func TestCreateUserDuplicateEmail(t *testing.T) {
+	clearTable()
+	addUsers(1)
+
+	payload := []byte(`{"name":"test user","email":"USER1@mydomain.com","password":"test123","age":30}`)
+	req, _ := http.NewRequest("POST", "/users", bytes.NewBuffer(payload))
+	response := executeRequest(req)
+
+	assertResponseCode(t, http.StatusConflict, response.Code)
+}
+
+func TestCreateUserValidation(t *testing.T) {
+	clearTable()
+
+	payload := []byte(`{"name":"test user","email":"not-an-email","password":"test123","age":30}`)
+	req, _ := http.NewRequest("POST", "/users", bytes.NewBuffer(payload))
+	response := executeRequest(req)
+
+	assertResponseCode(t, http.StatusUnprocessableEntity, response.Code)
+	if ct := response.Header().Get("Content-Type"); ct != "application/problem+json" {
+		t.Errorf("Expected problem details content type. Got %q", ct)
+	}
+	var p struct {
+		Status        int    `json:"status"`
+		TraceID       string `json:"traceId"`
+		InvalidParams []struct {
+			Name string `json:"name"`
+		} `json:"invalid-params"`
+	}
+	json.Unmarshal(response.Body.Bytes(), &p)
+	if p.Status != http.StatusUnprocessableEntity || p.TraceID == "" || len(p.InvalidParams) != 1 || p.InvalidParams[0].Name != "email" {
+		t.Errorf("Expected validation problem of email field. Got %s", response.Body)
+	}
+}
+
 func TestUpdateUser(t *testing.T) {
 	clearTable()
-	testUser := model.User{1, "User 1", "user1@mydomain.com", "user1", 20, true}
+	testUser := model.User{ID: 1, Name: "User 1", Email: "user1@mydomain.com", Password: "user1", Age: 20, Active: true, Roles: []string{model.RoleUser}}
 	addUser(&testUser)
 
-	req, _ := http.NewRequest("GET", "/users/1", nil)
+	req, _ := http.NewRequest("GET", "/auth/users/1", nil)
 	response := executeRequest(req)
 	var originalUser model.User
 	json.Unmarshal(response.Body.Bytes(), &originalUser)
@@ -128,7 +226,7 @@ func TestUpdateUser(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	req, _ = http.NewRequest("PUT", "/users/1", bytes.NewBuffer(payload))
+	req, _ = http.NewRequest("PUT", "/auth/users/1", bytes.NewBuffer(payload))
 	response = executeRequest(req)
 	log.Println("Response:", string(response.Body.Bytes()))
 
@@ -158,20 +256,45 @@ func TestDeleteUser(t *testing.T) {
 	clearTable()
 	addUsers(1)
 
-	req, _ := http.NewRequest("GET", "/users/1", nil)
+	req, _ := http.NewRequest("GET", "/auth/users/1", nil)
 	response := executeRequest(req)
 	assertResponseCode(t, http.StatusOK, response.Code)
 
-	req, _ = http.NewRequest("DELETE", "/users/1", nil)
+	req, _ = http.NewRequest("DELETE", "/auth/users/1", nil)
 	response = executeRequest(req)
 
 	assertResponseCode(t, http.StatusOK, response.Code)
 
-	req, _ = http.NewRequest("GET", "/users/1", nil)
+	req, _ = http.NewRequest("GET", "/auth/users/1", nil)
 	response = executeRequest(req)
 	assertResponseCode(t, http.StatusNotFound, response.Code)
 }
 
+func TestAnonymousAccess(t *testing.T) {
+	clearTable()
+	addUsers(1)
+
+	for _, method := range []string{"GET", "PUT", "DELETE"} {
+		req, _ := http.NewRequest(method, "/auth/users/1", bytes.NewBufferString(`{"name":"Anonymous","active":false}`))
+		response := executeAnonymous(req)
+		assertResponseCode(t, http.StatusUnauthorized, response.Code)
+		// users are not served without authentication
+		req, _ = http.NewRequest(method, "/users/1", bytes.NewBufferString(`{"name":"Anonymous","active":false}`))
+		response = executeAnonymous(req)
+		assertResponseCode(t, http.StatusNotFound, response.Code)
+	}
+	req, _ := http.NewRequest("GET", "/users", nil)
+	assertResponseCode(t, http.StatusMethodNotAllowed, executeAnonymous(req).Code)
+
+	req, _ = http.NewRequest("GET", "/auth/users/1", nil)
+	response := executeRequest(req)
+	var user model.User
+	json.Unmarshal(response.Body.Bytes(), &user)
+	if user.Name != "User 1" || !user.Active {
+		t.Errorf("Expected user 1 unchanged. Got %v", user)
+	}
+}
+
 //Utility funcs
 func assertResponseCode(t *testing.T, expected int, actual int) {
 	if expected != actual {
@@ -180,40 +303,53 @@ func assertResponseCode(t *testing.T, expected int, actual int) {
 }
 
 func assertEqual(t *testing.T, expected interface{}, actual interface{}) {
-	if expected != actual {
+	if !reflect.DeepEqual(expected, actual) {
 		t.Errorf("Expected %[1]T: %[1]v. Got: %[2]v\n", expected, actual)
 	}
 }
 
+// executeRequest serves the request of an admin
 func executeRequest(req *http.Request) *httptest.ResponseRecorder {
+	req.Header.Set("Authorization", "Bearer "+adminToken())
+	return executeAnonymous(req)
+}
+
+func executeAnonymous(req *http.Request) *httptest.ResponseRecorder {
 	rr := httptest.NewRecorder()
 	a.Router.ServeHTTP(rr, req)
 	return rr
 }
 
+// adminToken returns access token of an admin, who is not one of the test users
+func adminToken() string {
+	token, err := a.Keys.Sign(&model.UserToken{
+		UserID: 1000,
+		Name:   "Admin",
+		Email:  "admin@mydomain.com",
+		Roles:  []string{model.RoleAdmin},
+		StandardClaims: jwt.StandardClaims{
+			Id:        "test-admin",
+			ExpiresAt: time.Now().Add(time.Minute).Unix(),
+		},
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	return token
+}
+
 func addUsers(count int) {
 	if count < 1 {
 		count = 1
 	}
 	for i := 0; i < count; i++ {
 		n := strconv.Itoa(i + 1)
-		addUser(&model.User{i, "User " + n, "user" + n + "@mydomain.com", "user" + n, (i + 2) * 10, true})
+		addUser(&model.User{ID: i, Name: "User " + n, Email: "user" + n + "@mydomain.com", Password: "user" + n, Age: (i + 2) * 10, Active: true, Roles: []string{model.RoleUser}})
 	}
 }
 
 func addUser(user *model.User) (*model.User, error) {
-	statement := "INSERT INTO users(name, email, password, age, active) VALUES(?, ?, ?, ?, ?)"
-	result, err := db.Exec(statement, user.Name, user.Email, user.Password, user.Age, user.Active)
-	if err != nil {
-		return nil, err
-	}
-	id, err := result.LastInsertId()
-	user.ID = int(id)
-	//err = r.db.QueryRow("SELECT LAST_INSERT_ID()").Scan(&user.ID)
-	if err != nil {
-		return nil, err
-	}
-	return user, nil
+	return a.Users.Create(user)
 }
 
 func ensureTableExists() {
@@ -234,7 +370,13 @@ func ensureTableExists() {
 	}
 }
 
+// clearTable removes all users, so IDs start from 1 again
 func clearTable() {
+	if cfg.DBType != rest.MySQL {
+		// in-memory databases are simply created again
+		a.Init(cfg)
+		return
+	}
 	db.Exec("DELETE FROM users")
 	db.Exec("ALTER TABLE users AUTO_INCREMENT = 1")
 }
@@ -249,7 +391,8 @@ CREATE TABLE IF NOT EXISTS users (
     email VARCHAR(50) NOT NULL,
     password VARCHAR(100) NOT NULL,
     age INT NOT NULL,
-    active BOOLEAN                           
+    active BOOLEAN,
+    roles VARCHAR(100) NOT NULL DEFAULT 'user'
 )`
 
 const emailIndexDropQuery = `DROP INDEX uidx_email ON users `
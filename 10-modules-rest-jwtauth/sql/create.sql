@@ -7,6 +7,61 @@ CREATE TABLE users (
     email VARCHAR(50) NOT NULL,
     password VARCHAR(120) NOT NULL,
     age INT NOT NULL,
-    active BOOL DEFAULT TRUE
+    active BOOL DEFAULT TRUE,
+    roles VARCHAR(100) NOT NULL DEFAULT 'user'
 );
-CREATE UNIQUE INDEX uidx_email ON users (email);
\ No newline at end of file
+CREATE UNIQUE INDEX uidx_email ON users (email);
+CREATE TABLE refresh_tokens (
+    token_hash CHAR(64) PRIMARY KEY,
+    family VARCHAR(32) NOT NULL,
+    user_id INT NOT NULL,
+    expires_at DATETIME NOT NULL,
+    replaced_by CHAR(64) NULL,
+    revoked BOOL NOT NULL DEFAULT FALSE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+CREATE INDEX idx_refresh_family ON refresh_tokens (family);
+CREATE TABLE revoked_tokens (
+    jti VARCHAR(32) PRIMARY KEY,
+    expires_at DATETIME NOT NULL
+);
+CREATE TABLE login_audit (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    time DATETIME(3) NOT NULL,
+    event VARCHAR(20) NOT NULL,
+    email VARCHAR(50) NOT NULL,
+    user_id INT NULL,
+    ip VARCHAR(45) NOT NULL,
+    reason VARCHAR(100) NOT NULL DEFAULT ''
+);
+CREATE INDEX idx_login_audit_email ON login_audit (email);
+CREATE TABLE audit_log (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    time DATETIME(3) NOT NULL,
+    actor_id INT NOT NULL,
+    action VARCHAR(20) NOT NULL,
+    target_id INT NOT NULL,
+    diff TEXT NOT NULL
+);
+CREATE INDEX idx_audit_log_actor ON audit_log (actor_id);
+CREATE INDEX idx_audit_log_target ON audit_log (target_id);
+CREATE TABLE user_identities (
+    issuer VARCHAR(255) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    user_id INT NOT NULL,
+    PRIMARY KEY (issuer, subject),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+CREATE TABLE api_keys (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    name VARCHAR(50) NOT NULL,
+    prefix CHAR(8) NOT NULL,
+    key_hash CHAR(64) NOT NULL,
+    scopes VARCHAR(100) NOT NULL,
+    created_at DATETIME(3) NOT NULL,
+    last_used_at DATETIME(3) NULL,
+    revoked BOOL NOT NULL DEFAULT FALSE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+CREATE UNIQUE INDEX uidx_api_keys_prefix ON api_keys (prefix);
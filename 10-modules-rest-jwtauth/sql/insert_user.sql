@@ -1,3 +1,3 @@
-INSERT INTO `go_rest_api`.`users` (name, email, password, age, active) VALUES ('admin','admin@abv.bg', '$2a$10$1D5JS7IDVHeiX8xYZrg4fuGr46QiEZZm5KTtGOcVDt0Hbmc0EcoR6', 36, TRUE);
+INSERT INTO `go_rest_api`.`users` (name, email, password, age, active, roles) VALUES ('admin','admin@abv.bg', '$2a$10$1D5JS7IDVHeiX8xYZrg4fuGr46QiEZZm5KTtGOcVDt0Hbmc0EcoR6', 36, TRUE, 'admin,user');
 SELECT * FROM `go_rest_api`.`users` LIMIT 50
 
@@ -11,3 +11,7 @@ require (
 	github.com/gorilla/mux v1.7.3
 	golang.org/x/crypto v0.0.0-20200208060501-ecb85df21340
 )
+
+require github.com/iproduct/coursego/problem v0.0.0
+
+replace github.com/iproduct/coursego/problem => ../problem
@@ -11,6 +11,7 @@ import (
 	en_translations "github.com/go-playground/validator/v10/translations/en"
 	"github.com/iproduct/coursego/modules/dao"
 	"github.com/iproduct/coursego/modules/model"
+	"github.com/iproduct/coursego/problem"
 	"golang.org/x/crypto/bcrypt"
 	"time"
 
@@ -53,6 +54,8 @@ func (a *App) Init(user, password, dbname string) {
 	if err := en_translations.RegisterDefaultTranslations(a.Validator, a.Translator); err != nil {
 		log.Fatal(err)
 	}
+	// Report invalid fields by their JSON names
+	a.Validator.RegisterTagNameFunc(problem.JSONFieldName)
 
 	// Create and initialize gorilla/mux router
 	a.Router = mux.NewRouter()
@@ -67,6 +70,10 @@ func (a *App) Run(addr string) {
 func (a *App) initializeRoutes() {
 	a.Router.StrictSlash(true)
 	//a.Router.Use(CommonMiddleware)
+	// Errors are problem details with ID of the request
+	a.Router.Use(problem.RequestID)
+	a.Router.NotFoundHandler = problem.RequestID(problem.NotFoundHandler)
+	a.Router.MethodNotAllowedHandler = problem.RequestID(problem.MethodNotAllowedHandler)
 	a.Router.HandleFunc("/users", a.getUsers).Methods("GET")
 	a.Router.HandleFunc("/users", a.createUser).Methods("POST")
 	a.Router.HandleFunc("/users/{id:[0-9]+}", a.getUserByID).Methods("GET")
@@ -86,28 +93,27 @@ func (a *App) login(w http.ResponseWriter, r *http.Request) {
 	user := &model.User{}
 	err := json.NewDecoder(r.Body).Decode(user)
 	if err != nil {
-		var resp = map[string]interface{}{"status": false, "message": "Invalid request"}
-		json.NewEncoder(w).Encode(resp)
+		respondWithError(w, r, http.StatusBadRequest, "Invalid request payload")
 		return
 	}
-	resp, err := a.checkEmailPassword(w, user.Email, user.Password)
+	resp, err := a.checkEmailPassword(w, r, user.Email, user.Password)
 	if err == nil {
-		json.NewEncoder(w).Encode(resp)
+		respondWithJSON(w, http.StatusOK, resp)
 	}
 }
 
-func (a *App) checkEmailPassword(w http.ResponseWriter, email, password string) (map[string]interface{}, error)  {
+func (a *App) checkEmailPassword(w http.ResponseWriter, r *http.Request, email, password string) (map[string]interface{}, error)  {
 
 	user, err := a.Users.FindByEmail(email)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Email address not found")
+		respondWithError(w, r, http.StatusUnauthorized, "Email address not found")
 		return nil, err
 	}
 	expiresAt := time.Now().Add(time.Minute * 100000).Unix()
 
 	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password))
 	if err != nil && err == bcrypt.ErrMismatchedHashAndPassword { //Password does not match!
-		respondWithError(w, http.StatusUnauthorized, "Invalid login credentials. Please try again")
+		respondWithError(w, r, http.StatusUnauthorized, "Invalid login credentials. Please try again")
 		return nil, err
 	}
 
@@ -128,9 +134,8 @@ func (a *App) checkEmailPassword(w http.ResponseWriter, email, password string)
 		fmt.Println(error)
 	}
 
-	var resp = map[string]interface{}{"status": false, "message": "logged in"}
+	var resp = map[string]interface{}{"message": "logged in"}
 	resp["token"] = tokenString //Store the token in the response
-	resp["user"] = user
 	return resp, nil
 }
 
@@ -148,7 +153,7 @@ func (a *App) getUsers(w http.ResponseWriter, r *http.Request) {
 
 	users, err := a.Users.Find(start, count)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, err.Error())
+		respondWithError(w, r, http.StatusInternalServerError, err.Error())
 		return
 	}
 
@@ -161,7 +166,7 @@ func (a *App) createUser(w http.ResponseWriter, r *http.Request) {
 	decoder := json.NewDecoder(r.Body)
 	var err error
 	if err = decoder.Decode(user); err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		respondWithError(w, r, http.StatusBadRequest, "Invalid request payload")
 		return
 	}
 	defer r.Body.Close()
@@ -171,7 +176,7 @@ func (a *App) createUser(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		// translate all error at once
 		errs := err.(validator.ValidationErrors)
-		respondWithValidationError(errs.Translate(a.Translator), w)
+		respondWithValidationError(w, r, errs.Translate(a.Translator))
 		return
 	}
 
@@ -179,13 +184,13 @@ func (a *App) createUser(w http.ResponseWriter, r *http.Request) {
 	pass, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
 	if err != nil {
 		fmt.Println(err)
-		respondWithError(w, http.StatusInternalServerError, "Password Encryption  failed")
+		respondWithError(w, r, http.StatusInternalServerError, "Password Encryption  failed")
 		return
 	}
 	user.Password = string(pass)
 
 	if user, err = a.Users.Create(user); err != nil {
-		respondWithError(w, http.StatusInternalServerError, err.Error())
+		respondWithError(w, r, http.StatusInternalServerError, err.Error())
 		return
 	}
 
@@ -196,7 +201,7 @@ func (a *App) getUserByID(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, err := strconv.Atoi(vars["id"])
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		respondWithError(w, r, http.StatusBadRequest, "Invalid user ID")
 		return
 	}
 
@@ -204,9 +209,9 @@ func (a *App) getUserByID(w http.ResponseWriter, r *http.Request) {
 	if user, err = a.Users.FindByID(id); err != nil {
 		switch err {
 		case sql.ErrNoRows:
-			respondWithError(w, http.StatusNotFound, "User not found")
+			respondWithError(w, r, http.StatusNotFound, "User not found")
 		default:
-			respondWithError(w, http.StatusInternalServerError, err.Error())
+			respondWithError(w, r, http.StatusInternalServerError, err.Error())
 		}
 		return
 	}
@@ -218,21 +223,21 @@ func (a *App) updateUser(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, err := strconv.Atoi(vars["id"])
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		respondWithError(w, r, http.StatusBadRequest, "Invalid user ID")
 		return
 	}
 
 	user := &model.User{}
 	decoder := json.NewDecoder(r.Body)
 	if err := decoder.Decode(user); err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid resquest payload")
+		respondWithError(w, r, http.StatusBadRequest, "Invalid resquest payload")
 		return
 	}
 	defer r.Body.Close()
 	user.ID = id
 
 	if user, err = a.Users.Update(user); err != nil {
-		respondWithError(w, http.StatusInternalServerError, err.Error())
+		respondWithError(w, r, http.StatusInternalServerError, err.Error())
 		return
 	}
 
@@ -243,13 +248,13 @@ func (a *App) deleteUser(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, err := strconv.Atoi(vars["id"])
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid User ID")
+		respondWithError(w, r, http.StatusBadRequest, "Invalid User ID")
 		return
 	}
 
 	user, err := a.Users.DeleteByID(id)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, err.Error())
+		respondWithError(w, r, http.StatusInternalServerError, err.Error())
 		return
 	}
 
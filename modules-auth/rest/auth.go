@@ -16,7 +16,7 @@ func JwtVerify(next http.Handler) http.Handler {
 
 		var token string
 		if header == "" || len(header) <= len(BEARER_SCHEMA) {
-			respondWithError(w, http.StatusForbidden, "Missing auth token")
+			respondWithError(w, r, http.StatusForbidden, "Missing auth token")
 			return
 		}
 		token = header[len(BEARER_SCHEMA):]
@@ -24,7 +24,7 @@ func JwtVerify(next http.Handler) http.Handler {
 
 		if token == "" {
 			//Token is missing, returns with error code 403 Unauthorized
-			respondWithError(w, http.StatusForbidden, "Missing auth token")
+			respondWithError(w, r, http.StatusForbidden, "Missing auth token")
 			return
 		}
 		claims := &model.UserToken{}
@@ -34,7 +34,7 @@ func JwtVerify(next http.Handler) http.Handler {
 		})
 
 		if err != nil {
-			respondWithError(w, http.StatusForbidden, err.Error())
+			respondWithError(w, r, http.StatusForbidden, err.Error())
 			return
 		}
 
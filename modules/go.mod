@@ -13,3 +13,7 @@ require (
 	golang.org/x/crypto v0.0.0-20200208060501-ecb85df21340 // indirect
 	gopkg.in/go-playground/validator.v9 v9.31.0 // indirect
 )
+
+require github.com/iproduct/coursego/problem v0.0.0
+
+replace github.com/iproduct/coursego/problem => ../problem
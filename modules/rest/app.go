@@ -9,6 +9,7 @@ import (
 	en_translations "github.com/go-playground/validator/v10/translations/en"
 	"github.com/iproduct/coursego/modules/dao"
 	"github.com/iproduct/coursego/modules/model"
+	"github.com/iproduct/coursego/problem"
 	"log"
 	"net/http"
 	"strconv"
@@ -45,6 +46,8 @@ func (a *App) Init(user, password, dbname string) {
 	if err := en_translations.RegisterDefaultTranslations(a.Validator, a.Translator); err != nil {
 		log.Fatal(err)
 	}
+	// Report invalid fields by their JSON names
+	a.Validator.RegisterTagNameFunc(problem.JSONFieldName)
 
 	// Create and initialize gorilla/mux router
 	a.Router = mux.NewRouter()
@@ -57,6 +60,10 @@ func (a *App) Run(addr string) {
 }
 
 func (a *App) initializeRoutes() {
+	// Errors are problem details with ID of the request
+	a.Router.Use(problem.RequestID)
+	a.Router.NotFoundHandler = problem.RequestID(problem.NotFoundHandler)
+	a.Router.MethodNotAllowedHandler = problem.RequestID(problem.MethodNotAllowedHandler)
 	a.Router.HandleFunc("/users", a.getUsers).Methods("GET")
 	a.Router.HandleFunc("/users", a.createUser).Methods("POST")
 	a.Router.HandleFunc("/users/{id:[0-9]+}", a.getUser).Methods("GET")
@@ -77,7 +84,7 @@ func (a *App) getUsers(w http.ResponseWriter, r *http.Request) {
 
 	users, err := a.Users.Find(start, count)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, err.Error())
+		respondWithError(w, r, http.StatusInternalServerError, err.Error())
 		return
 	}
 
@@ -90,7 +97,7 @@ func (a *App) createUser(w http.ResponseWriter, r *http.Request) {
 	decoder := json.NewDecoder(r.Body)
 	var err error
 	if err = decoder.Decode(u); err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		respondWithError(w, r, http.StatusBadRequest, "Invalid request payload")
 		return
 	}
 	defer r.Body.Close()
@@ -100,12 +107,12 @@ func (a *App) createUser(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		// translate all error at once
 		errs := err.(validator.ValidationErrors)
-		respondWithValidationError(errs.Translate(a.Translator), w)
+		respondWithValidationError(w, r, errs.Translate(a.Translator))
 		return
 	}
 
 	if u, err = a.Users.Create(u); err != nil {
-		respondWithError(w, http.StatusInternalServerError, err.Error())
+		respondWithError(w, r, http.StatusInternalServerError, err.Error())
 		return
 	}
 
@@ -116,7 +123,7 @@ func (a *App) getUser(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, err := strconv.Atoi(vars["id"])
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		respondWithError(w, r, http.StatusBadRequest, "Invalid user ID")
 		return
 	}
 
@@ -124,9 +131,9 @@ func (a *App) getUser(w http.ResponseWriter, r *http.Request) {
 	if user, err = a.Users.FindByID(id); err != nil {
 		switch err {
 		case sql.ErrNoRows:
-			respondWithError(w, http.StatusNotFound, "User not found")
+			respondWithError(w, r, http.StatusNotFound, "User not found")
 		default:
-			respondWithError(w, http.StatusInternalServerError, err.Error())
+			respondWithError(w, r, http.StatusInternalServerError, err.Error())
 		}
 		return
 	}
@@ -138,21 +145,21 @@ func (a *App) updateUser(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, err := strconv.Atoi(vars["id"])
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		respondWithError(w, r, http.StatusBadRequest, "Invalid user ID")
 		return
 	}
 
 	user := &model.User{}
 	decoder := json.NewDecoder(r.Body)
 	if err := decoder.Decode(user); err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid resquest payload")
+		respondWithError(w, r, http.StatusBadRequest, "Invalid resquest payload")
 		return
 	}
 	defer r.Body.Close()
 	user.ID = id
 
 	if user, err = a.Users.Update(user); err != nil {
-		respondWithError(w, http.StatusInternalServerError, err.Error())
+		respondWithError(w, r, http.StatusInternalServerError, err.Error())
 		return
 	}
 
@@ -163,30 +170,27 @@ func (a *App) deleteUser(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, err := strconv.Atoi(vars["id"])
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid User ID")
+		respondWithError(w, r, http.StatusBadRequest, "Invalid User ID")
 		return
 	}
 
 	user, err := a.Users.DeleteByID(id)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, err.Error())
+		respondWithError(w, r, http.StatusInternalServerError, err.Error())
 		return
 	}
 
 	respondWithJSON(w, http.StatusOK, user)
 }
 
-func respondWithError(w http.ResponseWriter, code int, message string) {
-	respondWithJSON(w, code, map[string]string{"error": message})
+// respondWithError responds with application/problem+json problem details
+func respondWithError(w http.ResponseWriter, r *http.Request, code int, message string) {
+	problem.Error(w, r, code, message)
 }
 
-func respondWithValidationError(fields  validator.ValidationErrorsTranslations, w http.ResponseWriter) {
-	//Create a new map and fill it
-	response := make(map[string]interface{})
-	response["status"] = "error"
-	response["message"] = "validation error"
-	response["errors"] = fields
-	respondWithJSON(w, http.StatusUnprocessableEntity, response)
+// respondWithValidationError responds with problem details listing invalid fields
+func respondWithValidationError(w http.ResponseWriter, r *http.Request, fields validator.ValidationErrorsTranslations) {
+	problem.ValidationError(w, r, fields)
 }
 
 func respondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
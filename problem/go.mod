@@ -0,0 +1,3 @@
+module github.com/iproduct/coursego/problem
+
+go 1.13
@@ -0,0 +1,120 @@
+// Package problem writes HTTP error responses as RFC 7807 problem details (application/problem+json),
+// including validation errors of request fields and the request ID for tracing.
+package problem
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+const (
+	// ContentType is media type of problem details
+	ContentType = "application/problem+json"
+	// TypeValidation is problem type of requests with invalid fields
+	TypeValidation = "/problems/validation-error"
+)
+
+// InvalidParam is validation error of single request field
+type InvalidParam struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// Details is RFC 7807 problem details object with trace ID and invalid params extension members
+type Details struct {
+	Type          string         `json:"type"`
+	Title         string         `json:"title"`
+	Status        int            `json:"status"`
+	Detail        string         `json:"detail,omitempty"`
+	Instance      string         `json:"instance,omitempty"`
+	TraceID       string         `json:"traceId,omitempty"`
+	InvalidParams []InvalidParam `json:"invalid-params,omitempty"`
+}
+
+// New returns problem of "about:blank" type, titled by the status text
+func New(status int, detail string) *Details {
+	return &Details{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+	}
+}
+
+// Validation returns problem of invalid request fields. Fields map field namespaces (e.g. "User.email"),
+// as returned by translated go-playground validator errors, to error messages.
+func Validation(fields map[string]string) *Details {
+	p := &Details{
+		Type:   TypeValidation,
+		Title:  "Validation failed",
+		Status: http.StatusUnprocessableEntity,
+		Detail: "Request has invalid fields",
+	}
+	for namespace, reason := range fields {
+		p.InvalidParams = append(p.InvalidParams, InvalidParam{Name: fieldName(namespace), Reason: reason})
+	}
+	sort.Slice(p.InvalidParams, func(i, j int) bool { return p.InvalidParams[i].Name < p.InvalidParams[j].Name })
+	return p
+}
+
+// Write writes the problem response. Instance defaults to the request path and TraceID to the request ID.
+func Write(w http.ResponseWriter, r *http.Request, p *Details) {
+	if p.Instance == "" {
+		p.Instance = r.URL.Path
+	}
+	if p.TraceID == "" {
+		p.TraceID = ensureRequestID(w, r)
+	}
+	body, err := json.Marshal(p)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", ContentType)
+	w.WriteHeader(p.Status)
+	w.Write(body)
+}
+
+// Error writes problem response of the status with the detail message
+func Error(w http.ResponseWriter, r *http.Request, status int, detail string) {
+	Write(w, r, New(status, detail))
+}
+
+// ValidationError writes problem response of invalid request fields
+func ValidationError(w http.ResponseWriter, r *http.Request, fields map[string]string) {
+	Write(w, r, Validation(fields))
+}
+
+// NotFoundHandler responds with not found problem, e.g. for routers' unmatched routes
+var NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	Error(w, r, http.StatusNotFound, "Resource not found")
+})
+
+// MethodNotAllowedHandler responds with method not allowed problem
+var MethodNotAllowedHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	Error(w, r, http.StatusMethodNotAllowed, "Method "+r.Method+" is not allowed")
+})
+
+// JSONFieldName returns name of the struct field in JSON, to be registered as validator tag name function,
+// so that invalid params are reported by their JSON names
+func JSONFieldName(field reflect.StructField) string {
+	name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+	if name == "-" {
+		return ""
+	}
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
+
+// fieldName returns field path without top level struct name
+func fieldName(namespace string) string {
+	if i := strings.Index(namespace, "."); i >= 0 {
+		return namespace[i+1:]
+	}
+	return namespace
+}
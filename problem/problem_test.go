@@ -0,0 +1,73 @@
+package problem
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestError(t *testing.T) {
+	handler := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Error(w, r, http.StatusNotFound, "User not found")
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/users/42", nil)
+	req.Header.Set(RequestIDHeader, "req-1")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if ct := rr.Header().Get("Content-Type"); ct != ContentType {
+		t.Errorf("Content-Type = %q, want %q", ct, ContentType)
+	}
+	var p Details
+	if err := json.Unmarshal(rr.Body.Bytes(), &p); err != nil {
+		t.Fatal(err)
+	}
+	want := Details{Type: "about:blank", Title: "Not Found", Status: http.StatusNotFound, Detail: "User not found",
+		Instance: "/users/42", TraceID: "req-1"}
+	if rr.Code != http.StatusNotFound || !reflect.DeepEqual(p, want) {
+		t.Errorf("response = %d %+v, want %+v", rr.Code, p, want)
+	}
+	if id := rr.Header().Get(RequestIDHeader); id != "req-1" {
+		t.Errorf("%s = %q, want %q", RequestIDHeader, id, "req-1")
+	}
+}
+
+func TestValidationError(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/users", nil)
+	// invalid request ID of the client is replaced
+	req.Header.Set(RequestIDHeader, "bad id\n")
+	rr := httptest.NewRecorder()
+	ValidationError(rr, req, map[string]string{
+		"User.name":  "name is a required field",
+		"User.email": "email must be a valid email address",
+	})
+
+	var p Details
+	json.Unmarshal(rr.Body.Bytes(), &p)
+	wantParams := []InvalidParam{
+		{Name: "email", Reason: "email must be a valid email address"},
+		{Name: "name", Reason: "name is a required field"},
+	}
+	if rr.Code != http.StatusUnprocessableEntity || p.Type != TypeValidation || !reflect.DeepEqual(p.InvalidParams, wantParams) {
+		t.Errorf("response = %d %+v, want validation problem with %v", rr.Code, p, wantParams)
+	}
+	if id := rr.Header().Get(RequestIDHeader); p.TraceID == "" || p.TraceID != id || id == "bad id\n" {
+		t.Errorf("traceId = %q, %s = %q, want new request ID", p.TraceID, RequestIDHeader, id)
+	}
+}
+
+func TestJSONFieldName(t *testing.T) {
+	type user struct {
+		Name     string `json:"name,omitempty"`
+		Age      int
+		Password string `json:"-"`
+	}
+	typ := reflect.TypeOf(user{})
+	for i, want := range []string{"name", "Age", ""} {
+		if got := JSONFieldName(typ.Field(i)); got != want {
+			t.Errorf("JSONFieldName(%s) = %q, want %q", typ.Field(i).Name, got, want)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package problem
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"regexp"
+)
+
+// RequestIDHeader is request and response header with the request ID
+const RequestIDHeader = "X-Request-ID"
+
+type requestIDKey struct{}
+
+// validRequestID limits request IDs accepted from clients, so they can be logged safely
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// RequestID is middleware assigning ID to each request. Valid X-Request-ID header of the request,
+// e.g. set by a proxy, is kept, otherwise new ID is generated. The ID is returned in X-Request-ID
+// response header and is available to handlers by RequestIDFrom.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID.MatchString(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
+
+// RequestIDFrom returns request ID assigned by RequestID middleware, or empty string
+func RequestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// ensureRequestID returns ID of the request, assigning new one to requests not passed through RequestID
+func ensureRequestID(w http.ResponseWriter, r *http.Request) string {
+	if id := RequestIDFrom(r.Context()); id != "" {
+		return id
+	}
+	id := w.Header().Get(RequestIDHeader)
+	if id == "" {
+		id = newRequestID()
+		w.Header().Set(RequestIDHeader, id)
+	}
+	return id
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}